@@ -8,6 +8,8 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+	
+	"github.com/TakahashiShuuhei/edito/internal/buildstamp"
 )
 
 const Version = "0.2.3"
@@ -96,9 +98,15 @@ var ConfigInit = func() {
 	
 	// Check if the output file was actually created
 	if _, err := os.Stat(outputFile); err != nil {
-		fmt.Printf("Warning: Output file %s was not created: %v\n", outputFile, err)
-	} else {
-		fmt.Printf("Output file %s created successfully\n", outputFile)
+		fmt.Printf("Error: Output file %s was not created: %v\n", outputFile, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Output file %s created successfully\n", outputFile)
+	
+	// Record the Go and dependency versions so that edito can tell
+	// whether it can load the config
+	if err := buildstamp.Write(outputFile); err != nil {
+		fmt.Printf("Warning: %v\n", err)
 	}
 	
 	fmt.Printf("Configuration compiled to: %s\n", outputFile)
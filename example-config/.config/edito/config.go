@@ -8,9 +8,8 @@ import (
 func init() {
 	// 基本設定
 	edito.SetOption("tab-width", 4)
-	edito.SetOption("show-line-numbers", true)
-	edito.SetOption("auto-save", true)
-	edito.SetOption("theme", "dark")
+	edito.SetOption("history-length", 200)
+	edito.SetOption("idle-delay", 3)
 	
 	// キーバインド設定
 	edito.BindKey("C-x C-s", "save-buffer")
@@ -40,13 +39,13 @@ func init() {
 			if strings.HasSuffix(filename, ".go") {
 				edito.ShowMessage("Go file opened: " + filename)
 				// Go特有の設定を適用
-				edito.SetOption("tab-width", 4)
-				edito.SetOption("use-tabs", true)
+				edito.SetLocalOption("tab-width", 4)
+				edito.SetLocalOption("indent-tabs-mode", true)
 			} else if strings.HasSuffix(filename, ".py") {
 				edito.ShowMessage("Python file opened: " + filename)
 				// Python特有の設定を適用
-				edito.SetOption("tab-width", 4)
-				edito.SetOption("use-tabs", false)
+				edito.SetLocalOption("tab-width", 4)
+				edito.SetLocalOption("indent-tabs-mode", false)
 			}
 		}
 	})
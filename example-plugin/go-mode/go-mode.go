@@ -2,14 +2,14 @@ package main
 
 import (
 	"fmt"
-	"os/exec"
+	"path/filepath"
 	"strings"
 	
-	"github.com/TakahashiShuuhei/edito/internal/api"
+	"github.com/TakahashiShuuhei/edito/pkg/edito"
 )
 
 type GoModePlugin struct {
-	api *api.EditorAPI
+	api *edito.API
 }
 
 func (p *GoModePlugin) Name() string {
@@ -20,7 +20,11 @@ func (p *GoModePlugin) Version() string {
 	return "1.0.0"
 }
 
-func (p *GoModePlugin) Init(editorAPI *api.EditorAPI) error {
+func (p *GoModePlugin) APIVersion() int {
+	return edito.APIVersion
+}
+
+func (p *GoModePlugin) Init(editorAPI *edito.API) error {
 	p.api = editorAPI
 	
 	// Go固有のコマンドを登録
@@ -34,8 +38,24 @@ func (p *GoModePlugin) Cleanup() error {
 }
 
 func (p *GoModePlugin) registerCommands() {
-	// Go固有のコマンドをエディタに登録する処理
-	// 実際の実装では editorAPI を通じてコマンドを登録
+	p.api.RegisterCommand("go-format", "Format the buffer with gofmt", func(args []string) error {
+		return p.formatBuffer()
+	})
+	p.api.RegisterCommand("go-test", "Run go test", func(args []string) error {
+		return p.runGoTest()
+	})
+	p.api.RegisterCommand("go-add-import", "Add an import to the buffer", func(args []string) error {
+		if len(args) > 0 {
+			return p.addImport(args[0])
+		}
+		p.api.Prompt("Import: ", func(input string) {
+			p.addImport(strings.TrimSpace(input))
+		})
+		return nil
+	})
+	
+	p.api.BindKey("C-c C-f", "go-format")
+	p.api.BindKey("C-c C-t", "go-test")
 }
 
 func (p *GoModePlugin) formatBuffer() error {
@@ -48,17 +68,15 @@ func (p *GoModePlugin) formatBuffer() error {
 	lines := buf.GetLines()
 	code := strings.Join(lines, "\n")
 	
-	cmd := exec.Command("gofmt")
-	cmd.Stdin = strings.NewReader(code)
-	
-	output, err := cmd.Output()
+	// マニフェストで宣言した exec:gofmt の権限で実行される
+	output, err := p.api.Exec("gofmt", nil, edito.ExecOptions{Input: code})
 	if err != nil {
 		p.api.ShowMessage("gofmt failed: " + err.Error())
 		return err
 	}
 	
 	// フォーマット済みコードをバッファに設定
-	formattedLines := strings.Split(string(output), "\n")
+	formattedLines := strings.Split(output, "\n")
 	buf.SetLines(formattedLines)
 	
 	p.api.ShowMessage("Buffer formatted with gofmt")
@@ -78,11 +96,10 @@ func (p *GoModePlugin) runGoTest() error {
 	}
 	
 	// go testを実行
-	cmd := exec.Command("go", "test", "-v")
-	output, err := cmd.CombinedOutput()
+	_, err := p.api.Exec("go", []string{"test", "-v"}, edito.ExecOptions{Dir: filepath.Dir(filename)})
 	
 	if err != nil {
-		p.api.ShowMessage("Tests failed: " + string(output))
+		p.api.ShowMessage("Tests failed: " + err.Error())
 	} else {
 		p.api.ShowMessage("Tests passed!")
 	}
@@ -128,4 +145,13 @@ func (p *GoModePlugin) addImport(packageName string) error {
 }
 
 // プラグインのエクスポート - これが重要！
-var Plugin GoModePlugin
\ No newline at end of file
+var Plugin GoModePlugin
+
+// マニフェスト: gofmt と go の実行権限を要求する
+var Manifest = edito.Manifest{
+	Name:         "go-mode",
+	Version:      "1.0.0",
+	APIVersion:   edito.APIVersion,
+	Commands:     []string{"go-format", "go-test", "go-add-import"},
+	Capabilities: []string{"exec:gofmt", "exec:go"},
+}
\ No newline at end of file
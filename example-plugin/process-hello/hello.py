@@ -0,0 +1,64 @@
+#!/usr/bin/env python3
+"""edito process plugin example.
+
+edito talks to this program with JSON-RPC 2.0 over stdin/stdout, one
+message per line. Anything written to stderr goes to the plugin log.
+"""
+import json
+import sys
+
+next_id = 0
+
+
+def send(message):
+    message["jsonrpc"] = "2.0"
+    sys.stdout.write(json.dumps(message) + "\n")
+    sys.stdout.flush()
+
+
+def call(method, params=None):
+    """Send a request to edito and wait for its response.
+
+    edito may send its own requests before answering; they are handled
+    in between.
+    """
+    global next_id
+    next_id += 1
+    my_id = next_id
+    send({"id": my_id, "method": method, "params": params or {}})
+    while True:
+        message = json.loads(sys.stdin.readline())
+        if "method" in message:
+            handle(message)
+        elif message.get("id") == my_id:
+            if "error" in message:
+                raise RuntimeError(message["error"]["message"])
+            return message.get("result")
+
+
+def handle(message):
+    method = message["method"]
+    params = message.get("params") or {}
+    result = None
+
+    if method == "initialize":
+        call("editor/registerCommand", {"name": "hello-process", "description": "Insert a greeting"})
+        call("editor/bindKey", {"key": "C-c h", "command": "hello-process"})
+        call("editor/addHook", {"event": "after-save"})
+    elif method == "command/execute" and params["name"] == "hello-process":
+        call("buffer/insertText", {"text": "Hello from a process plugin!\n"})
+    elif method == "hook/run" and params["event"] == "after-save":
+        call("editor/showMessage", {"message": "Saved " + params["buffer"]["name"]})
+
+    if "id" in message:
+        send({"id": message["id"], "result": result})
+
+
+def main():
+    for line in sys.stdin:
+        if line.strip():
+            handle(json.loads(line))
+
+
+if __name__ == "__main__":
+    main()
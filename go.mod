@@ -4,4 +4,6 @@ go 1.22.2
 
 require github.com/nsf/termbox-go v1.1.1
 
-require github.com/mattn/go-runewidth v0.0.9 // indirect
+require github.com/mattn/go-runewidth v0.0.9
+
+require github.com/tetratelabs/wazero v1.9.0
@@ -2,30 +2,70 @@
 package api
 
 import (
+	"errors"
+	"time"
+
 	"github.com/nsf/termbox-go"
 )
 
+// APIVersion is the version of the plugin contract defined in this package.
+// It is increased whenever Plugin or EditorAPI change incompatibly.
+const APIVersion = 1
+
 // Editor represents the main editor instance
 var Editor *EditorAPI
 
 // EditorAPI provides the public API for plugins and configuration
 type EditorAPI struct {
-	bindKey       func(key, command string)
-	loadPlugin    func(name string)
-	setOption     func(key string, value any)
-	registerHook  func(event string, handler func())
-	getCurrentBuffer func() Buffer
-	showMessage   func(message string)
-	executeCommand func(command string, args []string) error
-	installPlugin func(name, repository, version string)
+	backend Backend
+}
+
+// Backend holds the editor functions behind an EditorAPI. The editor fills
+// it in; plugins and configuration only see the EditorAPI methods.
+type Backend struct {
+	BindKey            func(key, command string)
+	BindKeyFunc        func(key string, handler func())
+	LoadPlugin         func(name string)
+	SetOption          func(key string, value any)
+	DefineOption       func(option Option) error
+	GetOption          func(name string) any
+	SetLocalOption     func(name string, value any) error
+	OnOptionChange     func(name string, fn func(change OptionChange))
+	RegisterHook       func(event string, handler func())
+	AddHook            func(event string, handler func(ctx *HookContext))
+	RegisterCommand    func(name, description string, handler func(args []string) error)
+	ExecuteCommand     func(command string, args []string) error
+	GetCurrentBuffer   func() Buffer
+	ListBuffers        func() []Buffer
+	FindFile           func(filename string) (Buffer, error)
+	ShowMessage        func(message string)
+	Prompt             func(prompt string, callback func(input string))
+	AddModeLineSegment func(name string, render func() string)
+	InstallPlugin      func(name, repository, version string)
+	AddRegistry        func(location string, priority int)
+	ReadFile           func(path string) ([]byte, error)
+	WriteFile          func(path string, data []byte) error
+	Exec               func(name string, args []string, options ExecOptions) (string, error)
+	HTTPRequest        func(method, url string, body []byte) ([]byte, error)
+	RunAfter           func(delay time.Duration, fn func()) (cancel func())
+	RunEvery           func(interval time.Duration, fn func()) (cancel func())
+	RunWhenIdle        func(delay time.Duration, fn func()) (cancel func())
+	Post               func(fn func())
+}
+
+// New creates an EditorAPI backed by the given editor functions
+func New(backend Backend) *EditorAPI {
+	return &EditorAPI{backend: backend}
 }
 
 // Buffer represents a text buffer
 type Buffer interface {
+	GetName() string
 	GetLines() []string
 	SetLines(lines []string)
 	GetCursorPosition() (x, y int)
 	SetCursorPosition(x, y int)
+	InsertText(text string)
 	GetFilename() string
 	IsModified() bool
 	Save() error
@@ -38,62 +78,299 @@ func Initialize(api *EditorAPI) {
 
 // BindKey binds a key combination to a command
 func (e *EditorAPI) BindKey(key, command string) {
-	if e.bindKey != nil {
-		e.bindKey(key, command)
+	if e.backend.BindKey != nil {
+		e.backend.BindKey(key, command)
+	}
+}
+
+// BindKeyFunc binds a key combination to a function
+func (e *EditorAPI) BindKeyFunc(key string, handler func()) {
+	if e.backend.BindKeyFunc != nil {
+		e.backend.BindKeyFunc(key, handler)
 	}
 }
 
 // LoadPlugin loads a plugin by name
 func (e *EditorAPI) LoadPlugin(name string) {
-	if e.loadPlugin != nil {
-		e.loadPlugin(name)
+	if e.backend.LoadPlugin != nil {
+		e.backend.LoadPlugin(name)
 	}
 }
 
 // SetOption sets an editor option
 func (e *EditorAPI) SetOption(key string, value any) {
-	if e.setOption != nil {
-		e.setOption(key, value)
+	if e.backend.SetOption != nil {
+		e.backend.SetOption(key, value)
+	}
+}
+
+// DefineOption declares an option of the plugin, so that SetOption and
+// set-variable accept it and describe-variable documents it
+func (e *EditorAPI) DefineOption(option Option) error {
+	if e.backend.DefineOption != nil {
+		return e.backend.DefineOption(option)
+	}
+	return nil
+}
+
+// GetOption returns the value of an option in the current buffer: its
+// buffer-local value if it has one, otherwise the global value
+func (e *EditorAPI) GetOption(name string) any {
+	if e.backend.GetOption != nil {
+		return e.backend.GetOption(name)
+	}
+	return nil
+}
+
+// SetLocalOption sets a buffer-local option for the current buffer only
+func (e *EditorAPI) SetLocalOption(name string, value any) error {
+	if e.backend.SetLocalOption != nil {
+		return e.backend.SetLocalOption(name, value)
+	}
+	return nil
+}
+
+// OnOptionChange calls fn whenever the option changes, globally or in a
+// buffer
+func (e *EditorAPI) OnOptionChange(name string, fn func(change OptionChange)) {
+	if e.backend.OnOptionChange != nil {
+		e.backend.OnOptionChange(name, fn)
 	}
 }
 
 // RegisterHook registers an event hook
 func (e *EditorAPI) RegisterHook(event string, handler func()) {
-	if e.registerHook != nil {
-		e.registerHook(event, handler)
+	if e.backend.RegisterHook != nil {
+		e.backend.RegisterHook(event, handler)
+	}
+}
+
+// AddHook registers a handler that receives the event context. Handlers
+// of before-* events may cancel the operation with ctx.Cancel.
+func (e *EditorAPI) AddHook(event string, handler func(ctx *HookContext)) {
+	if e.backend.AddHook != nil {
+		e.backend.AddHook(event, handler)
 	}
 }
 
+// RegisterCommand adds a command that can be run with M-x or bound to a key
+func (e *EditorAPI) RegisterCommand(name, description string, handler func(args []string) error) {
+	if e.backend.RegisterCommand != nil {
+		e.backend.RegisterCommand(name, description, handler)
+	}
+}
+
+// ExecuteCommand executes an editor command
+func (e *EditorAPI) ExecuteCommand(command string, args []string) error {
+	if e.backend.ExecuteCommand != nil {
+		return e.backend.ExecuteCommand(command, args)
+	}
+	return nil
+}
+
 // GetCurrentBuffer returns the current active buffer
 func (e *EditorAPI) GetCurrentBuffer() Buffer {
-	if e.getCurrentBuffer != nil {
-		return e.getCurrentBuffer()
+	if e.backend.GetCurrentBuffer != nil {
+		return e.backend.GetCurrentBuffer()
+	}
+	return nil
+}
+
+// ListBuffers returns all open buffers
+func (e *EditorAPI) ListBuffers() []Buffer {
+	if e.backend.ListBuffers != nil {
+		return e.backend.ListBuffers()
 	}
 	return nil
 }
 
+// FindFile opens a file in a new buffer and makes it current
+func (e *EditorAPI) FindFile(filename string) (Buffer, error) {
+	if e.backend.FindFile != nil {
+		return e.backend.FindFile(filename)
+	}
+	return nil, nil
+}
+
 // ShowMessage displays a message to the user
 func (e *EditorAPI) ShowMessage(message string) {
-	if e.showMessage != nil {
-		e.showMessage(message)
+	if e.backend.ShowMessage != nil {
+		e.backend.ShowMessage(message)
 	}
 }
 
-// ExecuteCommand executes an editor command
-func (e *EditorAPI) ExecuteCommand(command string, args []string) error {
-	if e.executeCommand != nil {
-		return e.executeCommand(command, args)
+// Prompt reads a line of input in the minibuffer and passes it to callback
+func (e *EditorAPI) Prompt(prompt string, callback func(input string)) {
+	if e.backend.Prompt != nil {
+		e.backend.Prompt(prompt, callback)
+	}
+}
+
+// AddModeLineSegment adds a named segment to the mode line
+func (e *EditorAPI) AddModeLineSegment(name string, render func() string) {
+	if e.backend.AddModeLineSegment != nil {
+		e.backend.AddModeLineSegment(name, render)
 	}
-	return nil
 }
 
 // InstallPlugin installs a plugin from a git repository
 func (e *EditorAPI) InstallPlugin(name, repository, version string) {
-	if e.installPlugin != nil {
-		e.installPlugin(name, repository, version)
+	if e.backend.InstallPlugin != nil {
+		e.backend.InstallPlugin(name, repository, version)
+	}
+}
+
+// AddRegistry adds a package registry: an http(s) URL, a file:// URL or
+// a directory holding packages.json. Registries with a higher priority
+// win when several list the same package.
+func (e *EditorAPI) AddRegistry(location string, priority int) {
+	if e.backend.AddRegistry != nil {
+		e.backend.AddRegistry(location, priority)
 	}
 }
 
+// ExecOptions configures a program run with Exec.
+type ExecOptions struct {
+	// Dir is the working directory. Empty means the editor's.
+	Dir string
+	// Input is written to the program's standard input.
+	Input string
+}
+
+// errUnavailable is returned by privileged operations the editor does not
+// provide.
+var errUnavailable = errors.New("not available")
+
+// ReadFile reads a file. Plugins need the fs-read capability for it.
+func (e *EditorAPI) ReadFile(path string) ([]byte, error) {
+	if e.backend.ReadFile != nil {
+		return e.backend.ReadFile(path)
+	}
+	return nil, errUnavailable
+}
+
+// WriteFile writes a file. Plugins need the fs-write capability for it.
+func (e *EditorAPI) WriteFile(path string, data []byte) error {
+	if e.backend.WriteFile != nil {
+		return e.backend.WriteFile(path, data)
+	}
+	return errUnavailable
+}
+
+// Exec runs a program and returns its standard output. Plugins need the
+// exec capability for it.
+func (e *EditorAPI) Exec(name string, args []string, options ExecOptions) (string, error) {
+	if e.backend.Exec != nil {
+		return e.backend.Exec(name, args, options)
+	}
+	return "", errUnavailable
+}
+
+// HTTPRequest sends an HTTP request and returns the response body.
+// Plugins need the network capability for it.
+func (e *EditorAPI) HTTPRequest(method, url string, body []byte) ([]byte, error) {
+	if e.backend.HTTPRequest != nil {
+		return e.backend.HTTPRequest(method, url, body)
+	}
+	return nil, errUnavailable
+}
+
+// RunAfter calls fn on the editor goroutine once, after delay. The
+// returned function cancels the call.
+func (e *EditorAPI) RunAfter(delay time.Duration, fn func()) (cancel func()) {
+	if e.backend.RunAfter != nil {
+		return e.backend.RunAfter(delay, fn)
+	}
+	return func() {}
+}
+
+// RunEvery calls fn on the editor goroutine every interval until the
+// returned function is called.
+func (e *EditorAPI) RunEvery(interval time.Duration, fn func()) (cancel func()) {
+	if e.backend.RunEvery != nil {
+		return e.backend.RunEvery(interval, fn)
+	}
+	return func() {}
+}
+
+// RunWhenIdle calls fn on the editor goroutine each time there has been no
+// input for delay, once per idle period, until the returned function is
+// called.
+func (e *EditorAPI) RunWhenIdle(delay time.Duration, fn func()) (cancel func()) {
+	if e.backend.RunWhenIdle != nil {
+		return e.backend.RunWhenIdle(delay, fn)
+	}
+	return func() {}
+}
+
+// Post calls fn on the editor goroutine as soon as possible. It is the
+// only API method that is safe to call from other goroutines; use it to
+// hand the results of background work back to the editor.
+func (e *EditorAPI) Post(fn func()) {
+	if e.backend.Post != nil {
+		e.backend.Post(fn)
+	}
+}
+
+// OptionType is the type of an option's value.
+type OptionType string
+
+// Option types. Numbers may be given as ints or floats; whole floats are
+// accepted for int options.
+const (
+	OptionBool   OptionType = "bool"
+	OptionInt    OptionType = "int"
+	OptionFloat  OptionType = "float"
+	OptionString OptionType = "string"
+)
+
+// Option declares an option with DefineOption.
+type Option struct {
+	Name    string
+	Type    OptionType
+	Default any
+	Doc     string
+	// BufferLocal options may also be set for a single buffer.
+	BufferLocal bool
+	// Validate, if set, rejects values of the right type that are
+	// out of range.
+	Validate func(value any) error
+}
+
+// OptionChange is passed to OnOptionChange functions. Buffer is the name
+// of the buffer whose local value changed, or "" for the global value.
+type OptionChange struct {
+	Name   string
+	Old    any
+	New    any
+	Buffer string
+}
+
+// HookContext describes the event a hook handler is called for. Fields
+// that do not apply to the event are left empty.
+type HookContext struct {
+	Event   string
+	Buffer  Buffer
+	Command string
+	Args    []string
+	Mode    string
+
+	cancelled bool
+	reason    string
+}
+
+// Cancel stops a before-* event: the remaining handlers are skipped and
+// the operation (saving, running the command) does not happen.
+func (c *HookContext) Cancel(reason string) {
+	c.cancelled = true
+	c.reason = reason
+}
+
+// Cancelled reports whether a handler called Cancel, and why.
+func (c *HookContext) Cancelled() (bool, string) {
+	return c.cancelled, c.reason
+}
+
 // KeyBinding represents a key binding
 type KeyBinding struct {
 	Key     termbox.Key
@@ -101,10 +378,52 @@ type KeyBinding struct {
 	Command string
 }
 
+// ErrPluginStopped is wrapped by the errors of a plugin that can no longer
+// run, such as a WebAssembly module stopped at its CPU time limit. The
+// editor unloads such a plugin. Callbacks that cannot return an error
+// panic with it.
+var ErrPluginStopped = errors.New("plugin stopped")
+
 // Plugin interface that all plugins must implement
 type Plugin interface {
 	Name() string
 	Version() string
 	Init(api *EditorAPI) error
 	Cleanup() error
-}
\ No newline at end of file
+}
+
+// Versioned may be implemented by a plugin to declare the APIVersion it
+// was built against. Plugins that do not implement it are treated as
+// version 1 plugins.
+type Versioned interface {
+	APIVersion() int
+}
+
+// Manifest describes a plugin before it is loaded. Process and
+// WebAssembly plugins read it from JSON; .so plugins may export it as a
+// variable named Manifest or ship it as name.json next to name.so.
+type Manifest struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	// APIVersion is the plugin API version the plugin needs. Zero means 1.
+	APIVersion int `json:"apiVersion,omitempty"`
+	// Dependencies are the names of plugins that must be loaded first.
+	Dependencies []string `json:"dependencies,omitempty"`
+	// Commands lists the commands the plugin provides.
+	Commands []string `json:"commands,omitempty"`
+	// Capabilities lists what the plugin asks to be allowed to do.
+	Capabilities []string `json:"capabilities,omitempty"`
+}
+
+// RequiredAPIVersion returns APIVersion, treating zero as version 1.
+func (m Manifest) RequiredAPIVersion() int {
+	if m.APIVersion == 0 {
+		return 1
+	}
+	return m.APIVersion
+}
+
+// Described is implemented by plugins that carry a Manifest.
+type Described interface {
+	Manifest() Manifest
+}
@@ -1,23 +1,37 @@
 package buffer
 
 import (
-	"bufio"
+	"bytes"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	EOLUnix = "LF"
+	EOLDOS  = "CRLF"
 )
 
 type Buffer struct {
-	ID        string
-	Name      string
-	Filename  string
-	Lines     []string
-	CursorX   int
-	CursorY   int
-	OffsetX   int
-	OffsetY   int
-	Modified  bool
-	ReadOnly  bool
+	ID         string
+	Name       string
+	Filename   string
+	Lines      []string
+	CursorX    int
+	CursorY    int
+	OffsetX    int
+	OffsetY    int
+	Modified   bool
+	ReadOnly   bool
+	MajorMode  string
+	MinorModes []string
+	Encoding   string
+	EOL        string
+	// Options holds the buffer-local option values, set with
+	// SetLocalOption. It is nil until one is set.
+	Options    map[string]any
 }
 
 type Manager struct {
@@ -38,10 +52,13 @@ func (m *Manager) NewBuffer(filename string) (*Buffer, error) {
 	m.nextID++
 	
 	buffer := &Buffer{
-		ID:       id,
-		Name:     filepath.Base(filename),
-		Filename: filename,
-		Lines:    []string{""},
+		ID:        id,
+		Name:      filepath.Base(filename),
+		Filename:  filename,
+		Lines:     []string{""},
+		MajorMode: DetectMajorMode(filename),
+		Encoding:  "utf-8",
+		EOL:       EOLUnix,
 	}
 	
 	if filename != "" {
@@ -58,6 +75,40 @@ func (m *Manager) NewBuffer(filename string) (*Buffer, error) {
 	return buffer, nil
 }
 
+// NewSpecialBuffer shows lines in a read-only buffer that has no file,
+// such as *Help*. An existing buffer with the same name is reused.
+func (m *Manager) NewSpecialBuffer(name string, lines []string) *Buffer {
+	if len(lines) == 0 {
+		lines = []string{""}
+	}
+	for _, buffer := range m.buffers {
+		if buffer.Filename == "" && buffer.Name == name && buffer.ReadOnly {
+			buffer.Lines = lines
+			buffer.CursorX, buffer.CursorY = 0, 0
+			buffer.OffsetX, buffer.OffsetY = 0, 0
+			m.currentBuffer = buffer.ID
+			return buffer
+		}
+	}
+	
+	id := fmt.Sprintf("buffer-%d", m.nextID)
+	m.nextID++
+	
+	buffer := &Buffer{
+		ID:        id,
+		Name:      name,
+		Lines:     lines,
+		ReadOnly:  true,
+		MajorMode: DefaultMajorMode,
+		Encoding:  "utf-8",
+		EOL:       EOLUnix,
+	}
+	m.buffers[id] = buffer
+	m.currentBuffer = id
+	
+	return buffer
+}
+
 func (m *Manager) GetBuffer(id string) *Buffer {
 	return m.buffers[id]
 }
@@ -104,28 +155,34 @@ func (m *Manager) CloseBuffer(id string) bool {
 }
 
 func (b *Buffer) LoadFile(filename string) error {
-	file, err := os.Open(filename)
+	data, err := os.ReadFile(filename)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
 	
-	b.Lines = make([]string, 0)
-	scanner := bufio.NewScanner(file)
-	
-	for scanner.Scan() {
-		b.Lines = append(b.Lines, scanner.Text())
+	b.Encoding = "utf-8"
+	if bytes.HasPrefix(data, []byte("\xef\xbb\xbf")) {
+		b.Encoding = "utf-8-bom"
+		data = data[3:]
+	} else if !utf8.Valid(data) {
+		b.Encoding = "binary"
 	}
 	
-	if len(b.Lines) == 0 {
-		b.Lines = []string{""}
+	b.EOL = EOLUnix
+	if bytes.Contains(data, []byte("\r\n")) {
+		b.EOL = EOLDOS
 	}
 	
+	content := strings.ReplaceAll(string(data), "\r\n", "\n")
+	content = strings.TrimSuffix(content, "\n")
+	b.Lines = strings.Split(content, "\n")
+	
 	b.Filename = filename
 	b.Name = filepath.Base(filename)
+	b.MajorMode = DetectMajorMode(filename)
 	b.Modified = false
 	
-	return scanner.Err()
+	return nil
 }
 
 func (b *Buffer) SaveFile() error {
@@ -139,9 +196,17 @@ func (b *Buffer) SaveFile() error {
 	}
 	defer file.Close()
 	
+	eol := "\n"
+	if b.EOL == EOLDOS {
+		eol = "\r\n"
+	}
+	if b.Encoding == "utf-8-bom" {
+		file.WriteString("\xef\xbb\xbf")
+	}
+	
 	for i, line := range b.Lines {
 		if i > 0 {
-			file.WriteString("\n")
+			file.WriteString(eol)
 		}
 		file.WriteString(line)
 	}
@@ -0,0 +1,36 @@
+package buffer
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// DefaultMajorMode is used for files whose extension is not recognised.
+const DefaultMajorMode = "Fundamental"
+
+var majorModesByExt = map[string]string{
+	".go":   "Go",
+	".py":   "Python",
+	".js":   "JavaScript",
+	".ts":   "TypeScript",
+	".rs":   "Rust",
+	".c":    "C",
+	".h":    "C",
+	".md":   "Markdown",
+	".json": "JSON",
+	".yaml": "YAML",
+	".yml":  "YAML",
+	".sh":   "Shell",
+	".txt":  "Text",
+}
+
+// DetectMajorMode returns the major mode name for filename based on its extension.
+func DetectMajorMode(filename string) string {
+	if filepath.Base(filename) == "Makefile" {
+		return "Makefile"
+	}
+	if mode, ok := majorModesByExt[strings.ToLower(filepath.Ext(filename))]; ok {
+		return mode
+	}
+	return DefaultMajorMode
+}
@@ -0,0 +1,217 @@
+// Package buildstamp records what a Go plugin or config.so was built with
+// and checks it against the running edito before the file is opened.
+//
+// The Go runtime refuses to open a plugin built with another Go version or
+// with other versions of packages the binary also contains, but it only
+// says "plugin was built with a different version of package". A stamp
+// lets edito name the difference, and rebuild or report the plugin,
+// without calling plugin.Open.
+package buildstamp
+
+import (
+	"debug/buildinfo"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+)
+
+// EditoModule is the module path of edito.
+const EditoModule = "github.com/TakahashiShuuhei/edito"
+
+// Module is the version of a dependency and its go.sum hash.
+type Module struct {
+	Version string `json:"version"`
+	Sum     string `json:"sum,omitempty"`
+}
+
+// Stamp describes the toolchain and dependencies of a build.
+type Stamp struct {
+	GoVersion    string            `json:"go_version"`
+	EditoVersion string            `json:"edito_version,omitempty"`
+	Deps         map[string]Module `json:"deps,omitempty"`
+}
+
+// MismatchError reports a difference between a stamp and the running
+// edito. What is "Go", "edito" or the path of a module.
+type MismatchError struct {
+	Artifact string
+	What     string
+	Built    string
+	Running  string
+}
+
+func (e *MismatchError) Error() string {
+	return fmt.Sprintf("%s was built with %s %s but edito runs %s", filepath.Base(e.Artifact), e.What, e.Built, e.Running)
+}
+
+// FromBuildInfo returns the stamp of a build.
+func FromBuildInfo(bi *debug.BuildInfo) Stamp {
+	s := Stamp{GoVersion: bi.GoVersion, Deps: make(map[string]Module)}
+	if bi.Main.Path == EditoModule {
+		s.EditoVersion = bi.Main.Version
+	}
+	for _, dep := range bi.Deps {
+		// A replaced module keeps its path but takes the version of
+		// its replacement, which is "(devel)" for a directory.
+		path := dep.Path
+		if dep.Replace != nil {
+			dep = dep.Replace
+		}
+		if path == EditoModule {
+			s.EditoVersion = dep.Version
+			continue
+		}
+		s.Deps[path] = Module{Version: dep.Version, Sum: dep.Sum}
+	}
+	return s
+}
+
+// Running returns the stamp of the running binary. It reports false when
+// the binary carries no build information.
+func Running() (Stamp, bool) {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return Stamp{}, false
+	}
+	return FromBuildInfo(bi), true
+}
+
+// File returns the stamp file of artifact.
+func File(artifact string) string {
+	return artifact + ".stamp"
+}
+
+// Read returns the stamp of artifact: its stamp file, unless the artifact
+// was replaced after the stamp was written, otherwise the build
+// information in the artifact itself.
+func Read(artifact string) (Stamp, error) {
+	if s, err := readFile(artifact); err == nil {
+		return s, nil
+	}
+	bi, err := buildinfo.ReadFile(artifact)
+	if err != nil {
+		return Stamp{}, fmt.Errorf("failed to read build information of %s: %v", artifact, err)
+	}
+	return FromBuildInfo(bi), nil
+}
+
+func readFile(artifact string) (Stamp, error) {
+	var s Stamp
+	info, err := os.Stat(artifact)
+	if err != nil {
+		return s, err
+	}
+	stampInfo, err := os.Stat(File(artifact))
+	if err != nil {
+		return s, err
+	}
+	if info.ModTime().After(stampInfo.ModTime()) {
+		return s, fmt.Errorf("stamp of %s is stale", artifact)
+	}
+	data, err := os.ReadFile(File(artifact))
+	if err != nil {
+		return s, err
+	}
+	return s, json.Unmarshal(data, &s)
+}
+
+// Write stamps a freshly built artifact with its build information.
+func Write(artifact string) error {
+	bi, err := buildinfo.ReadFile(artifact)
+	if err != nil {
+		return fmt.Errorf("failed to read build information of %s: %v", artifact, err)
+	}
+	data, err := json.MarshalIndent(FromBuildInfo(bi), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(File(artifact), append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write build stamp: %v", err)
+	}
+	return nil
+}
+
+// Remove removes the stamp of artifact, if any.
+func Remove(artifact string) {
+	os.Remove(File(artifact))
+}
+
+// Check compares s with running. Modules only one of them uses do not
+// matter; a module both use must be at the same version.
+func (s Stamp) Check(artifact string, running Stamp) error {
+	if s.GoVersion != running.GoVersion {
+		return &MismatchError{Artifact: artifact, What: "Go", Built: s.GoVersion, Running: running.GoVersion}
+	}
+	if Released(s.EditoVersion) && Released(running.EditoVersion) && s.EditoVersion != running.EditoVersion {
+		return &MismatchError{Artifact: artifact, What: "edito", Built: s.EditoVersion, Running: running.EditoVersion}
+	}
+
+	paths := make([]string, 0, len(s.Deps))
+	for path := range s.Deps {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		built := s.Deps[path]
+		want, ok := running.Deps[path]
+		if !ok {
+			continue
+		}
+		if built.Version != want.Version || (built.Sum != "" && want.Sum != "" && built.Sum != want.Sum) {
+			return &MismatchError{Artifact: artifact, What: path, Built: built.Version, Running: want.Version}
+		}
+	}
+	return nil
+}
+
+// Released reports whether version names a release; builds from a
+// working tree are "(devel)" and cannot be told apart.
+func Released(version string) bool {
+	return version != "" && version != "(devel)"
+}
+
+// Check reports whether artifact can be opened by the running edito. It
+// returns nil when either build cannot be told, leaving the decision to
+// plugin.Open.
+func Check(artifact string) error {
+	running, ok := Running()
+	if !ok {
+		return nil
+	}
+	s, err := Read(artifact)
+	if err != nil {
+		return nil
+	}
+	return s.Check(artifact, running)
+}
+
+// Requirements returns the module@version arguments for go get that make
+// a build use the edito and dependency versions of s.
+func (s Stamp) Requirements() []string {
+	var reqs []string
+	if Released(s.EditoVersion) {
+		reqs = append(reqs, EditoModule+"@"+s.EditoVersion)
+	}
+	for path, m := range s.Deps {
+		if Released(m.Version) {
+			reqs = append(reqs, path+"@"+m.Version)
+		}
+	}
+	sort.Strings(reqs)
+	return reqs
+}
+
+// BuildEnv returns the environment the go command needs to build with the
+// Go version of the running edito, downloading that toolchain if needed.
+func BuildEnv() []string {
+	env := []string{"CGO_ENABLED=1"}
+	if v := runtime.Version(); strings.HasPrefix(v, "go1.") && !strings.ContainsAny(v, " +") {
+		env = append(env, "GOTOOLCHAIN="+v)
+	}
+	return env
+}
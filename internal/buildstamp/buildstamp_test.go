@@ -0,0 +1,88 @@
+package buildstamp
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime/debug"
+	"testing"
+	"time"
+)
+
+func TestCheck(t *testing.T) {
+	running := FromBuildInfo(&debug.BuildInfo{
+		GoVersion: "go1.22.2",
+		Main:      debug.Module{Path: EditoModule, Version: "v0.3.0"},
+		Deps: []*debug.Module{
+			{Path: "github.com/nsf/termbox-go", Version: "v1.1.1", Sum: "h1:a"},
+		},
+	})
+	plugin := func(goVersion, edito, termbox string) Stamp {
+		return FromBuildInfo(&debug.BuildInfo{
+			GoVersion: goVersion,
+			Main:      debug.Module{Path: "temp-plugin-build", Version: "(devel)"},
+			Deps: []*debug.Module{
+				{Path: EditoModule, Version: edito},
+				{Path: "github.com/nsf/termbox-go", Version: termbox},
+				{Path: "example.com/tree", Version: "v1.0.0"},
+			},
+		})
+	}
+
+	tests := []struct {
+		stamp Stamp
+		what  string
+	}{
+		{plugin("go1.22.2", "v0.3.0", "v1.1.1"), ""},
+		{plugin("go1.21.0", "v0.3.0", "v1.1.1"), "Go"},
+		{plugin("go1.22.2", "v0.2.3", "v1.1.1"), "edito"},
+		{plugin("go1.22.2", "(devel)", "v1.1.1"), ""},
+		{plugin("go1.22.2", "v0.3.0", "v1.1.0"), "github.com/nsf/termbox-go"},
+	}
+	for _, test := range tests {
+		err := test.stamp.Check("tree.so", running)
+		var mismatch *MismatchError
+		switch {
+		case test.what == "" && err != nil:
+			t.Errorf("Check(%+v) = %v, want nil", test.stamp, err)
+		case test.what != "" && (!errors.As(err, &mismatch) || mismatch.What != test.what):
+			t.Errorf("Check(%+v) = %v, want a %s mismatch", test.stamp, err, test.what)
+		}
+	}
+
+	want := []string{EditoModule + "@v0.3.0", "github.com/nsf/termbox-go@v1.1.1"}
+	if reqs := running.Requirements(); !reflect.DeepEqual(reqs, want) {
+		t.Errorf("Requirements = %v, want %v", reqs, want)
+	}
+}
+
+func TestReadPrefersFreshStampFile(t *testing.T) {
+	artifact := filepath.Join(t.TempDir(), "tree.so")
+	os.WriteFile(artifact, []byte("not a Go binary"), 0644)
+	if _, err := Read(artifact); err == nil {
+		t.Error("Read of an unstamped non-Go file succeeded")
+	}
+	if err := Check(artifact); err != nil {
+		t.Errorf("Check of an unreadable build = %v, want nil", err)
+	}
+
+	stamp := Stamp{GoVersion: "go1.1"}
+	data, _ := json.Marshal(stamp)
+	os.WriteFile(File(artifact), data, 0644)
+	if got, err := Read(artifact); err != nil || got.GoVersion != "go1.1" {
+		t.Errorf("Read = %+v, %v, want the stamp file", got, err)
+	}
+	var mismatch *MismatchError
+	if err := Check(artifact); !errors.As(err, &mismatch) || mismatch.What != "Go" {
+		t.Errorf("Check = %v, want a Go mismatch", err)
+	}
+
+	// An artifact replaced after it was stamped is read again.
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(artifact, later, later)
+	if _, err := Read(artifact); err == nil {
+		t.Error("Read used a stale stamp file")
+	}
+}
@@ -0,0 +1,160 @@
+// Package capability describes the privileged operations a plugin may
+// ask for in its manifest, such as reading files or running programs.
+//
+// A capability is written as kind:scope, for example
+//
+//	fs-read:~/notes      read files under ~/notes
+//	fs-write:/tmp        write files under /tmp
+//	exec:gofmt           run gofmt
+//	network:example.com  make HTTP requests to example.com
+//
+// A scope of "*" allows everything of that kind. Network scopes may start
+// with "*." to match subdomains.
+package capability
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Kinds of privileged operations.
+const (
+	FSRead  = "fs-read"
+	FSWrite = "fs-write"
+	Exec    = "exec"
+	Network = "network"
+)
+
+// Capability allows one kind of operation within a scope.
+type Capability struct {
+	Kind  string
+	Scope string
+}
+
+func (c Capability) String() string {
+	return c.Kind + ":" + c.Scope
+}
+
+// Parse reads a capability. ok is false for strings that name no
+// privileged operation, such as the WebAssembly sandbox capabilities,
+// which are not handled here.
+func Parse(s string) (c Capability, ok bool) {
+	kind, scope, found := strings.Cut(s, ":")
+	switch kind {
+	case FSRead, FSWrite, Exec, Network:
+	default:
+		return Capability{}, false
+	}
+	if !found || scope == "" {
+		scope = "*"
+	}
+	return Capability{Kind: kind, Scope: scope}, true
+}
+
+// ParseAll returns the privileged capabilities in list.
+func ParseAll(list []string) []Capability {
+	var caps []Capability
+	for _, s := range list {
+		if c, ok := Parse(s); ok {
+			caps = append(caps, c)
+		}
+	}
+	return caps
+}
+
+// Allows reports whether c permits an operation of kind on target: a
+// file path, a program name or a URL.
+func (c Capability) Allows(kind, target string) bool {
+	if c.Kind != kind {
+		return false
+	}
+	if c.Scope == "*" {
+		return true
+	}
+
+	switch kind {
+	case FSRead, FSWrite:
+		scope, err := absPath(c.Scope)
+		if err != nil {
+			return false
+		}
+		path, err := absPath(target)
+		if err != nil {
+			return false
+		}
+		rel, err := filepath.Rel(scope, path)
+		return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+	case Exec:
+		// Programs are compared by the file they run, so that a grant for
+		// a program on PATH does not cover another file of the same name.
+		scope, err := programPath(c.Scope)
+		if err != nil {
+			return false
+		}
+		program, err := programPath(target)
+		return err == nil && program == scope
+	case Network:
+		u, err := url.Parse(target)
+		if err != nil {
+			return false
+		}
+		host := u.Hostname()
+		if strings.HasPrefix(c.Scope, "*.") {
+			return strings.HasSuffix(host, c.Scope[1:])
+		}
+		return host == c.Scope
+	}
+	return false
+}
+
+// Check returns an error unless one of caps permits the operation.
+func Check(caps []Capability, kind, target string) error {
+	for _, c := range caps {
+		if c.Allows(kind, target) {
+			return nil
+		}
+	}
+	return fmt.Errorf("permission denied: %s %s is not granted", kind, target)
+}
+
+// programPath returns the absolute path of the file that running name
+// executes. Bare names are looked up on PATH.
+func programPath(name string) (string, error) {
+	if !strings.ContainsRune(name, filepath.Separator) {
+		found, err := exec.LookPath(name)
+		if err != nil {
+			return "", err
+		}
+		name = found
+	}
+	return absPath(name)
+}
+
+func absPath(path string) (string, error) {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		path = filepath.Join(home, path[1:])
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	// Resolve symbolic links so that a link inside the scope cannot point
+	// outside it. A file that does not exist yet is resolved through its
+	// directory.
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved, nil
+	}
+	if dir, err := filepath.EvalSymlinks(filepath.Dir(path)); err == nil {
+		return filepath.Join(dir, filepath.Base(path)), nil
+	}
+	return path, nil
+}
@@ -0,0 +1,67 @@
+package capability
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	if c, ok := Parse("exec:gofmt"); !ok || c.Kind != Exec || c.Scope != "gofmt" {
+		t.Errorf("Parse(exec:gofmt) = %+v, %v", c, ok)
+	}
+	if c, ok := Parse("network"); !ok || c.Scope != "*" {
+		t.Errorf("Parse(network) = %+v, %v; want scope *", c, ok)
+	}
+	if _, ok := Parse("buffer-read"); ok {
+		t.Error("buffer-read parsed as a privileged capability")
+	}
+}
+
+func TestAllows(t *testing.T) {
+	dir := t.TempDir()
+	notes := filepath.Join(dir, "notes")
+	os.Mkdir(notes, 0755)
+	os.Symlink(dir, filepath.Join(notes, "escape"))
+
+	// tool is on PATH; a file of the same name elsewhere is another
+	// program.
+	bin := filepath.Join(dir, "bin")
+	other := filepath.Join(dir, "other")
+	for _, d := range []string{bin, other} {
+		os.Mkdir(d, 0755)
+		os.WriteFile(filepath.Join(d, "tool"), []byte("#!/bin/sh\n"), 0755)
+	}
+	t.Setenv("PATH", bin)
+
+	tests := []struct {
+		capability string
+		kind       string
+		target     string
+		want       bool
+	}{
+		{"fs-read:" + notes, FSRead, filepath.Join(notes, "todo.txt"), true},
+		{"fs-read:" + notes, FSRead, notes, true},
+		{"fs-read:" + notes, FSRead, filepath.Join(notes, "..", "secret"), false},
+		{"fs-read:" + notes, FSRead, notes + "-other/file", false},
+		{"fs-read:" + notes, FSRead, filepath.Join(notes, "escape", "secret"), false},
+		{"fs-read:" + notes, FSWrite, filepath.Join(notes, "todo.txt"), false},
+		{"fs-write:*", FSWrite, "/etc/passwd", true},
+		{"exec:tool", Exec, "tool", true},
+		{"exec:tool", Exec, filepath.Join(bin, "tool"), true},
+		{"exec:tool", Exec, filepath.Join(other, "tool"), false},
+		{"exec:tool", Exec, "missing", false},
+		{"exec:" + filepath.Join(other, "tool"), Exec, filepath.Join(other, "tool"), true},
+		{"exec:" + filepath.Join(other, "tool"), Exec, "tool", false},
+		{"network:example.com", Network, "https://example.com/api", true},
+		{"network:example.com", Network, "https://evil.com/?example.com", false},
+		{"network:*.example.com", Network, "https://api.example.com/", true},
+		{"network:*.example.com", Network, "https://example.com.evil.net/", false},
+	}
+	for _, tt := range tests {
+		c, _ := Parse(tt.capability)
+		if got := c.Allows(tt.kind, tt.target); got != tt.want {
+			t.Errorf("%s allows %s %s = %v, want %v", tt.capability, tt.kind, tt.target, got, tt.want)
+		}
+	}
+}
@@ -15,6 +15,8 @@ type Command struct {
 	Handler     Handler
 	Interactive InteractiveHandler
 	NeedsArgs   bool
+	// Owner is the plugin that registered the command, or "" for the core.
+	Owner string
 }
 
 type Registry struct {
@@ -35,6 +37,26 @@ func (r *Registry) Register(name, description string, handler Handler) {
 	}
 }
 
+// RegisterOwned registers a command on behalf of a plugin so that it can
+// be listed by origin and removed when the plugin is unloaded.
+func (r *Registry) RegisterOwned(owner, name, description string, handler Handler) {
+	r.commands[name] = &Command{
+		Name:        name,
+		Description: description,
+		Handler:     handler,
+		Owner:       owner,
+	}
+}
+
+// RemoveOwner deletes every command registered by owner.
+func (r *Registry) RemoveOwner(owner string) {
+	for name, cmd := range r.commands {
+		if cmd.Owner == owner {
+			delete(r.commands, name)
+		}
+	}
+}
+
 func (r *Registry) RegisterInteractive(name, description string, interactive InteractiveHandler) {
 	r.commands[name] = &Command{
 		Name:        name,
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"os"
 	"plugin"
+	
+	"github.com/TakahashiShuuhei/edito/internal/buildstamp"
 )
 
 // LoadCompiledConfig loads a compiled configuration file (.so)
@@ -14,6 +16,11 @@ func LoadCompiledConfig(filepath string) error {
 		return nil
 	}
 	
+	// A config.so built for another Go or edito version cannot be opened
+	if err := buildstamp.Check(filepath); err != nil {
+		return fmt.Errorf("compiled config is out of date: %w; rebuild it with edito-config", err)
+	}
+	
 	// Load the plugin
 	p, err := plugin.Open(filepath)
 	if err != nil {
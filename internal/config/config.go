@@ -14,15 +14,15 @@ type Config struct {
 
 func New() (*Config, error) {
 	cfg := &Config{}
-	
+
 	if err := cfg.initXDGDirs(); err != nil {
 		return nil, err
 	}
-	
+
 	if err := cfg.ensureDirs(); err != nil {
 		return nil, err
 	}
-	
+
 	return cfg, nil
 }
 
@@ -31,37 +31,37 @@ func (c *Config) initXDGDirs() error {
 	if err != nil {
 		return fmt.Errorf("failed to get home directory: %v", err)
 	}
-	
+
 	c.ConfigDir = os.Getenv("XDG_CONFIG_HOME")
 	if c.ConfigDir == "" {
 		c.ConfigDir = filepath.Join(homeDir, ".config")
 	}
 	c.ConfigDir = filepath.Join(c.ConfigDir, "edito")
-	
+
 	c.DataDir = os.Getenv("XDG_DATA_HOME")
 	if c.DataDir == "" {
 		c.DataDir = filepath.Join(homeDir, ".local", "share")
 	}
 	c.DataDir = filepath.Join(c.DataDir, "edito")
-	
+
 	c.CacheDir = os.Getenv("XDG_CACHE_HOME")
 	if c.CacheDir == "" {
 		c.CacheDir = filepath.Join(homeDir, ".cache")
 	}
 	c.CacheDir = filepath.Join(c.CacheDir, "edito")
-	
+
 	return nil
 }
 
 func (c *Config) ensureDirs() error {
 	dirs := []string{c.ConfigDir, c.DataDir, c.CacheDir}
-	
+
 	for _, dir := range dirs {
 		if err := os.MkdirAll(dir, 0755); err != nil {
 			return fmt.Errorf("failed to create directory %s: %v", dir, err)
 		}
 	}
-	
+
 	return nil
 }
 
@@ -77,6 +77,39 @@ func (c *Config) PluginDir() string {
 	return filepath.Join(c.DataDir, "plugins")
 }
 
+func (c *Config) HistoryFile() string {
+	return filepath.Join(c.DataDir, "history.json")
+}
+
 func (c *Config) CacheFile(name string) string {
 	return filepath.Join(c.CacheDir, name)
-}
\ No newline at end of file
+}
+
+func (c *Config) PluginStateFile() string {
+	return filepath.Join(c.DataDir, "plugin-state.json")
+}
+
+func (c *Config) PluginGrantsFile() string {
+	return filepath.Join(c.DataDir, "plugin-grants.json")
+}
+
+// TrustedKeysFile lists the public keys allowed to sign packages.
+func (c *Config) TrustedKeysFile() string {
+	return filepath.Join(c.ConfigDir, "trusted-keys")
+}
+
+// InstalledFile records the version and source of each installed plugin.
+func (c *Config) InstalledFile() string {
+	return filepath.Join(c.DataDir, "installed.json")
+}
+
+// LockFile pins plugin versions next to config.go, so that it can be
+// shared along with the configuration.
+func (c *Config) LockFile() string {
+	return filepath.Join(c.ConfigDir, "plugins.lock")
+}
+
+// RegistryCacheDir holds copies of the package registry indexes.
+func (c *Config) RegistryCacheDir() string {
+	return filepath.Join(c.CacheDir, "registries")
+}
@@ -6,254 +6,165 @@ import (
 	"go/parser"
 	"go/token"
 	"os"
-	"reflect"
+	"path/filepath"
 	"strconv"
-	"strings"
+
+	"github.com/TakahashiShuuhei/edito/internal/api"
 )
 
-type GoConfig struct {
-	editor EditorAPI
+// UnsupportedError reports a part of config.go the interpreter cannot
+// run. Such a config.go can still be compiled into config.so.
+type UnsupportedError struct {
+	Pos  token.Position
+	What string
 }
 
-type EditorAPI struct {
-	BindKey       func(key, command string)
-	LoadPlugin    func(name string)
-	SetOption     func(key string, value any)
-	RegisterHook  func(event string, handler func())
-	InstallPlugin func(name, repository, version string)
+func (e *UnsupportedError) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s cannot be interpreted", filepath.Base(e.Pos.Filename), e.Pos.Line, e.Pos.Column, e.What)
 }
 
-func LoadGoConfig(filepath string, api EditorAPI) error {
-	goConfig := &GoConfig{editor: api}
-	
-	src, err := os.ReadFile(filepath)
+// LoadGoConfig runs config.go without compiling it. Its package-level
+// variables and functions are set up in order and its init functions run
+// against editor; the closures it hands to the editor, such as hooks, are
+// interpreted whenever they are called.
+func LoadGoConfig(filename string, editor *api.EditorAPI) error {
+	src, err := os.ReadFile(filename)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil
 		}
 		return err
 	}
-	
+
 	fset := token.NewFileSet()
-	f, err := parser.ParseFile(fset, filepath, src, parser.ParseComments)
+	f, err := parser.ParseFile(fset, filename, src, 0)
 	if err != nil {
 		return fmt.Errorf("failed to parse Go config: %v", err)
 	}
-	
-	return goConfig.executeAST(f)
-}
-
-func (gc *GoConfig) executeAST(f *ast.File) error {
-	for _, decl := range f.Decls {
-		if fn, ok := decl.(*ast.FuncDecl); ok {
-			if fn.Name.Name == "init" {
-				if err := gc.executeBlock(fn.Body); err != nil {
-					return err
-				}
-			}
-		}
-	}
-	return nil
-}
-
-func (gc *GoConfig) executeBlock(block *ast.BlockStmt) error {
-	for _, stmt := range block.List {
-		if err := gc.executeStmt(stmt); err != nil {
-			return err
-		}
+	if err := check(fset, f); err != nil {
+		return err
 	}
-	return nil
-}
 
-func (gc *GoConfig) executeStmt(stmt ast.Stmt) error {
-	switch s := stmt.(type) {
-	case *ast.ExprStmt:
-		return gc.executeExpr(s.X)
-	case *ast.IfStmt:
-		return gc.executeIfStmt(s)
-	case *ast.ForStmt:
-		return gc.executeForStmt(s)
-	case *ast.AssignStmt:
-		return gc.executeAssignStmt(s)
+	in := &interpreter{
+		fset:    fset,
+		globals: newScope(nil),
+		imports: make(map[string]map[string]any),
+		report: func(err error) {
+			editor.ShowMessage(err.Error())
+		},
 	}
-	return nil
-}
-
-func (gc *GoConfig) executeExpr(expr ast.Expr) error {
-	switch e := expr.(type) {
-	case *ast.CallExpr:
-		return gc.executeCallExpr(e)
-	}
-	return nil
-}
-
-func (gc *GoConfig) executeCallExpr(call *ast.CallExpr) error {
-	switch fun := call.Fun.(type) {
-	case *ast.SelectorExpr:
-		if ident, ok := fun.X.(*ast.Ident); ok && ident.Name == "editor" {
-			return gc.executeEditorCall(fun.Sel.Name, call.Args)
+	for _, spec := range f.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		members := stdlib[path]
+		if path == EditoPackage {
+			members = editoPackage(editor)
 		}
-	case *ast.Ident:
-		switch fun.Name {
-		case "BindKey":
-			return gc.executeBindKey(call.Args)
-		case "LoadPlugin":
-			return gc.executeLoadPlugin(call.Args)
-		case "SetOption":
-			return gc.executeSetOption(call.Args)
-		case "InstallPlugin":
-			return gc.executeInstallPlugin(call.Args)
+		name := filepath.Base(path)
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		switch name {
+		case "_":
+		case ".":
+			for member, value := range members {
+				in.globals.define(member, &variable{value: value, constant: true})
+			}
+		default:
+			in.imports[name] = members
 		}
 	}
-	return nil
-}
-
-func (gc *GoConfig) executeEditorCall(method string, args []ast.Expr) error {
-	switch method {
-	case "BindKey":
-		return gc.executeBindKey(args)
-	case "LoadPlugin":
-		return gc.executeLoadPlugin(args)
-	case "SetOption":
-		return gc.executeSetOption(args)
-	case "RegisterHook":
-		return gc.executeRegisterHook(args)
-	case "InstallPlugin":
-		return gc.executeInstallPlugin(args)
-	}
-	return nil
-}
-
-func (gc *GoConfig) executeBindKey(args []ast.Expr) error {
-	if len(args) < 2 {
-		return fmt.Errorf("BindKey requires 2 arguments")
-	}
-	
-	key, err := gc.evalStringLiteral(args[0])
-	if err != nil {
-		return err
-	}
-	
-	command, err := gc.evalStringLiteral(args[1])
-	if err != nil {
-		return err
-	}
-	
-	gc.editor.BindKey(key, command)
-	return nil
-}
-
-func (gc *GoConfig) executeLoadPlugin(args []ast.Expr) error {
-	if len(args) < 1 {
-		return fmt.Errorf("LoadPlugin requires 1 argument")
-	}
-	
-	name, err := gc.evalStringLiteral(args[0])
-	if err != nil {
-		return err
-	}
-	
-	gc.editor.LoadPlugin(name)
-	return nil
-}
-
-func (gc *GoConfig) executeSetOption(args []ast.Expr) error {
-	if len(args) < 2 {
-		return fmt.Errorf("SetOption requires 2 arguments")
-	}
-	
-	key, err := gc.evalStringLiteral(args[0])
-	if err != nil {
-		return err
-	}
-	
-	value, err := gc.evalExpression(args[1])
-	if err != nil {
-		return err
-	}
-	
-	gc.editor.SetOption(key, value)
-	return nil
-}
 
-func (gc *GoConfig) executeRegisterHook(args []ast.Expr) error {
-	if len(args) < 2 {
-		return fmt.Errorf("RegisterHook requires 2 arguments")
-	}
-	
-	event, err := gc.evalStringLiteral(args[0])
-	if err != nil {
-		return err
-	}
-	
-	gc.editor.RegisterHook(event, func() {
+	_, err = in.run(func() (any, error) {
+		return nil, in.runFile(f)
 	})
-	return nil
+	return err
 }
 
-func (gc *GoConfig) executeInstallPlugin(args []ast.Expr) error {
-	if len(args) < 3 {
-		return fmt.Errorf("InstallPlugin requires 3 arguments")
-	}
-	
-	name, err := gc.evalStringLiteral(args[0])
-	if err != nil {
-		return err
-	}
-	
-	repository, err := gc.evalStringLiteral(args[1])
-	if err != nil {
-		return err
+// runFile declares the functions and variables of f and runs its init
+// functions. Variables are initialized in the order they are written.
+func (in *interpreter) runFile(f *ast.File) error {
+	var inits []*ast.FuncDecl
+	for _, decl := range f.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok {
+			if fn.Name.Name == "init" {
+				inits = append(inits, fn)
+				continue
+			}
+			in.globals.define(fn.Name.Name, &variable{value: &closure{name: fn.Name.Name, typ: fn.Type, body: fn.Body, env: in.globals}})
+		}
 	}
-	
-	version, err := gc.evalStringLiteral(args[2])
-	if err != nil {
-		return err
+	for _, decl := range f.Decls {
+		if gen, ok := decl.(*ast.GenDecl); ok && (gen.Tok == token.VAR || gen.Tok == token.CONST) {
+			if err := in.declare(in.globals, gen); err != nil {
+				return err
+			}
+		}
 	}
-	
-	if gc.editor.InstallPlugin != nil {
-		gc.editor.InstallPlugin(name, repository, version)
+	for _, fn := range inits {
+		if _, err := in.callClosure(&closure{name: "init", typ: fn.Type, body: fn.Body, env: in.globals}, nil, false); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
-func (gc *GoConfig) executeIfStmt(stmt *ast.IfStmt) error {
-	return nil
-}
-
-func (gc *GoConfig) executeForStmt(stmt *ast.ForStmt) error {
-	return nil
-}
-
-func (gc *GoConfig) executeAssignStmt(stmt *ast.AssignStmt) error {
-	return nil
-}
-
-func (gc *GoConfig) evalStringLiteral(expr ast.Expr) (string, error) {
-	if lit, ok := expr.(*ast.BasicLit); ok && lit.Kind == token.STRING {
-		return strings.Trim(lit.Value, "\""), nil
-	}
-	return "", fmt.Errorf("expected string literal")
-}
-
-func (gc *GoConfig) evalExpression(expr ast.Expr) (any, error) {
-	switch e := expr.(type) {
-	case *ast.BasicLit:
-		switch e.Kind {
-		case token.STRING:
-			return strings.Trim(e.Value, "\""), nil
-		case token.INT:
-			return strconv.Atoi(e.Value)
-		case token.FLOAT:
-			return strconv.ParseFloat(e.Value, 64)
-		}
-	case *ast.Ident:
-		switch e.Name {
-		case "true":
-			return true, nil
-		case "false":
-			return false, nil
+// check reports the first construct of f the interpreter does not
+// support, before any of it runs.
+func check(fset *token.FileSet, f *ast.File) error {
+	var err error
+	unsupported := func(node ast.Node, what string) {
+		if err == nil {
+			err = &UnsupportedError{Pos: fset.Position(node.Pos()), What: what}
 		}
 	}
-	return nil, fmt.Errorf("unsupported expression type: %s", reflect.TypeOf(expr))
-}
\ No newline at end of file
+	ast.Inspect(f, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.ImportSpec:
+			path, _ := strconv.Unquote(n.Path.Value)
+			if _, ok := stdlib[path]; !ok && path != EditoPackage {
+				unsupported(n, fmt.Sprintf("import %q", path))
+			}
+		case *ast.FuncDecl:
+			if n.Recv != nil {
+				unsupported(n, "a method")
+			}
+			if n.Body == nil {
+				unsupported(n, "a function without body")
+			}
+		case *ast.FuncType:
+			if n.TypeParams != nil {
+				unsupported(n, "a generic function")
+			}
+		case *ast.TypeSpec:
+			unsupported(n, "a type declaration")
+		case *ast.StructType:
+			unsupported(n, "a struct type")
+		case *ast.InterfaceType:
+			if n.Methods != nil && len(n.Methods.List) > 0 {
+				unsupported(n, "an interface type with methods")
+			}
+		case *ast.IndexListExpr:
+			unsupported(n, "a generic instantiation")
+		case *ast.ChanType, *ast.SendStmt, *ast.SelectStmt:
+			unsupported(n, "a channel")
+		case *ast.UnaryExpr:
+			if n.Op == token.ARROW {
+				unsupported(n, "a channel")
+			}
+		case *ast.GoStmt:
+			unsupported(n, "a go statement")
+		case *ast.DeferStmt:
+			unsupported(n, "a defer statement")
+		case *ast.BranchStmt:
+			if n.Tok == token.GOTO {
+				unsupported(n, "goto")
+			}
+		case *ast.BasicLit:
+			if n.Kind == token.IMAG {
+				unsupported(n, "a complex number")
+			}
+		}
+		return err == nil
+	})
+	return err
+}
@@ -0,0 +1,259 @@
+package config
+
+import (
+	"errors"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TakahashiShuuhei/edito/internal/api"
+)
+
+// recorder is an editor that records what config.go does.
+type recorder struct {
+	keys     map[string]string
+	options  map[string]any
+	hooks    map[string][]func()
+	commands map[string]func(args []string) error
+	messages []string
+	plugins  []string
+	timers   []time.Duration
+}
+
+func newRecorder() (*recorder, *api.EditorAPI) {
+	r := &recorder{
+		keys:     make(map[string]string),
+		options:  make(map[string]any),
+		hooks:    make(map[string][]func()),
+		commands: make(map[string]func(args []string) error),
+	}
+	return r, api.New(api.Backend{
+		BindKey:     func(key, command string) { r.keys[key] = command },
+		SetOption:   func(key string, value any) { r.options[key] = value },
+		ShowMessage: func(message string) { r.messages = append(r.messages, message) },
+		RegisterHook: func(event string, handler func()) {
+			r.hooks[event] = append(r.hooks[event], handler)
+		},
+		RegisterCommand: func(name, description string, handler func(args []string) error) {
+			r.commands[name] = handler
+		},
+		InstallPlugin: func(name, repository, version string) {
+			r.plugins = append(r.plugins, name+" "+repository+" "+version)
+		},
+		GetCurrentBuffer: func() api.Buffer { return testBuffer("main.go") },
+		RunAfter: func(delay time.Duration, fn func()) func() {
+			r.timers = append(r.timers, delay)
+			return func() {}
+		},
+	})
+}
+
+type testBuffer string
+
+func (b testBuffer) GetName() string               { return string(b) }
+func (b testBuffer) GetLines() []string            { return nil }
+func (b testBuffer) SetLines(lines []string)       {}
+func (b testBuffer) GetCursorPosition() (x, y int) { return 0, 0 }
+func (b testBuffer) SetCursorPosition(x, y int)    {}
+func (b testBuffer) InsertText(text string)        {}
+func (b testBuffer) GetFilename() string           { return "/src/" + string(b) }
+func (b testBuffer) IsModified() bool              { return false }
+func (b testBuffer) Save() error                   { return nil }
+
+func loadConfig(t *testing.T, src string) (*recorder, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.go")
+	if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r, editor := newRecorder()
+	return r, LoadGoConfig(path, editor)
+}
+
+func TestLoadGoConfigRunsGo(t *testing.T) {
+	t.Setenv("EDITO_TEST_THEME", "dark")
+	r, err := loadConfig(t, `package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/TakahashiShuuhei/edito/pkg/edito"
+)
+
+const (
+	small = iota + 2
+	large
+)
+
+var languages = map[string]int{"go": 8, "python": 4}
+
+func width(lang string) (int, bool) {
+	w, ok := languages[lang]
+	return w, ok
+}
+
+func counter() func() int {
+	n := 0
+	return func() int {
+		n++
+		return n
+	}
+}
+
+func init() {
+	edito.SetOption("theme", os.Getenv("EDITO_TEST_THEME"))
+	if w, ok := width("go"); ok && w > large {
+		edito.SetOption("tab-width", w)
+	} else {
+		edito.SetOption("tab-width", small)
+	}
+
+	keys := []string{"a", "b", "c"}
+	for i, k := range keys {
+		edito.BindKey("C-c "+k, fmt.Sprintf("command-%d", i))
+	}
+	total := 0
+	for i := 0; i < 10; i++ {
+		if i%2 == 0 {
+			continue
+		}
+		total += i
+	}
+	edito.SetOption("total", total)
+
+	next := counter()
+	next()
+	edito.SetOption("count", next())
+
+	var funcs []func() string
+	for _, name := range []string{"x", "y"} {
+		funcs = append(funcs, func() string { return name })
+	}
+	edito.SetOption("captured", funcs[0]()+funcs[1]())
+
+	switch ext := filepath.Ext("/src/main.go"); ext {
+	case ".py":
+		edito.SetOption("lang", "python")
+	case ".go", ".mod":
+		edito.SetOption("lang", "go")
+	default:
+		edito.SetOption("lang", "other")
+	}
+
+	edito.RunAfter(2*time.Second, func() {})
+	edito.InstallPlugin("tree", filepath.Join("~", "src", "tree"), "develop")
+
+	edito.RegisterHook("file-opened", func() {
+		buf := edito.GetCurrentBuffer()
+		if buf != nil && strings.HasSuffix(buf.GetFilename(), ".go") {
+			edito.ShowMessage("Go file opened: " + buf.GetName())
+		}
+	})
+	edito.RegisterCommand("fail", "", func(args []string) error {
+		if len(args) == 0 {
+			return fmt.Errorf("no arguments")
+		}
+		var missing map[string]int
+		missing[args[0]] = 1
+		return nil
+	})
+}
+`)
+	if err != nil {
+		t.Fatalf("LoadGoConfig failed: %v", err)
+	}
+
+	want := map[string]any{"theme": "dark", "tab-width": 8, "total": 25, "count": 2, "captured": "xy", "lang": "go"}
+	if !reflect.DeepEqual(r.options, want) {
+		t.Errorf("options = %v, want %v", r.options, want)
+	}
+	if r.keys["C-c c"] != "command-2" || len(r.keys) != 3 {
+		t.Errorf("keys = %v", r.keys)
+	}
+	if !slices.Equal(r.timers, []time.Duration{2 * time.Second}) {
+		t.Errorf("timers = %v", r.timers)
+	}
+	if !slices.Equal(r.plugins, []string{"tree ~/src/tree develop"}) {
+		t.Errorf("plugins = %v", r.plugins)
+	}
+
+	if len(r.hooks["file-opened"]) != 1 {
+		t.Fatalf("hooks = %v", r.hooks)
+	}
+	r.hooks["file-opened"][0]()
+	if !slices.Equal(r.messages, []string{"Go file opened: main.go"}) {
+		t.Errorf("messages = %v, want the hook to run", r.messages)
+	}
+
+	if err := r.commands["fail"](nil); err == nil || err.Error() != "no arguments" {
+		t.Errorf("fail() = %v, want the error the command returned", err)
+	}
+	err = r.commands["fail"]([]string{"x"})
+	if err == nil || !strings.Contains(err.Error(), "config.go:") || !strings.Contains(err.Error(), "nil map") {
+		t.Errorf("fail(x) = %v, want a runtime error with its position", err)
+	}
+}
+
+func TestLoadGoConfigErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		unsupported bool
+		want        string
+	}{
+		{"undefined", `edito.SetOption("x", y)`, false, "config.go:11:23: undefined: y"},
+		{"not allowed", `edito.SetOption("x", os.Args)`, false, "os.Args is not available"},
+		{"type", `var n int = "four"; _ = n`, false, "cannot use"},
+		{"endless", `for {}`, false, "endless loop"},
+		{"goroutine", `go edito.ShowMessage("x")`, true, "go statement"},
+		{"recursion", `var f func(); f = func() { f() }; f()`, false, "endless recursion"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := loadConfig(t, "package config\n\nimport (\n\t\"os\"\n\t\"github.com/TakahashiShuuhei/edito/pkg/edito\"\n)\n\nvar _ = os.Getenv\n\nfunc init() {\n\t"+test.body+"\n}\n")
+			var unsupported *UnsupportedError
+			if errors.As(err, &unsupported) != test.unsupported {
+				t.Errorf("err = %#v, unsupported = %v", err, test.unsupported)
+			}
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("err = %v, want %q", err, test.want)
+			}
+		})
+	}
+
+	_, err := loadConfig(t, "package config\n\nimport \"net/http\"\n\nvar _ = http.Get\n")
+	var unsupported *UnsupportedError
+	if !errors.As(err, &unsupported) || !strings.Contains(err.Error(), `import "net/http"`) {
+		t.Errorf("err = %v, want the import reported as unsupported", err)
+	}
+}
+
+// TestEditoFuncsMatchPackage keeps the functions config.go can call in
+// step with those pkg/edito offers to compiled configs.
+func TestEditoFuncsMatchPackage(t *testing.T) {
+	f, err := parser.ParseFile(token.NewFileSet(), "../../pkg/edito/edito.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var funcs []string
+	for _, decl := range f.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Name.IsExported() {
+			funcs = append(funcs, fn.Name.Name)
+		}
+	}
+	slices.Sort(funcs)
+	if !slices.Equal(funcs, editoFuncs) {
+		t.Errorf("pkg/edito has %v, the interpreter %v", funcs, editoFuncs)
+	}
+}
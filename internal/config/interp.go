@@ -0,0 +1,2234 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+// maxSteps bounds the statements one call into config.go may run, so
+// that an endless loop is reported instead of hanging the editor.
+const maxSteps = 10_000_000
+
+// maxDepth bounds the nesting of calls to functions of config.go.
+const maxDepth = 1000
+
+// Error is a failure while running config.go.
+type Error struct {
+	Pos token.Position
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s", filepath.Base(e.Pos.Filename), e.Pos.Line, e.Pos.Column, e.Msg)
+}
+
+// interpreter runs the functions of config.go. Values are plain Go
+// values, so they can be passed to the allow-listed packages and the
+// editor API as they are; functions of config.go are closures, turned
+// into Go functions when they are passed out.
+type interpreter struct {
+	fset    *token.FileSet
+	globals *scope
+	// imports maps the package names of the file to their members.
+	imports map[string]map[string]any
+	// report receives errors of callbacks that cannot return them.
+	report func(error)
+
+	steps   int
+	depth   int
+	entered int
+	pos     token.Pos
+}
+
+type variable struct {
+	value any
+	// typ is the static type of the variable, nil for functions of
+	// config.go.
+	typ      reflect.Type
+	constant bool
+}
+
+type scope struct {
+	vars   map[string]*variable
+	parent *scope
+}
+
+func newScope(parent *scope) *scope {
+	return &scope{vars: make(map[string]*variable), parent: parent}
+}
+
+func (s *scope) lookup(name string) *variable {
+	for ; s != nil; s = s.parent {
+		if v, ok := s.vars[name]; ok {
+			return v
+		}
+	}
+	return nil
+}
+
+func (s *scope) define(name string, v *variable) {
+	if name != "_" {
+		s.vars[name] = v
+	}
+}
+
+// closure is a function declared in config.go.
+type closure struct {
+	name string
+	typ  *ast.FuncType
+	body *ast.BlockStmt
+	env  *scope
+}
+
+// tuple holds the results of a call returning several values.
+type tuple []any
+
+// typeRef is a type used as a value, as in a conversion.
+type typeRef struct{ t reflect.Type }
+
+// builtin is a predeclared function such as len or append.
+type builtin string
+
+type flowKind int
+
+const (
+	flowNext flowKind = iota
+	flowBreak
+	flowContinue
+	flowReturn
+	flowFallthrough
+)
+
+// flow tells the enclosing statements how a statement ended.
+type flow struct {
+	kind  flowKind
+	label string
+}
+
+// frame holds the results of a running function.
+type frame struct {
+	results []any
+	named   []*variable
+}
+
+var (
+	anyType   = reflect.TypeOf((*any)(nil)).Elem()
+	errorType = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+var universeTypes = map[string]reflect.Type{
+	"bool":    reflect.TypeOf(false),
+	"string":  reflect.TypeOf(""),
+	"int":     reflect.TypeOf(0),
+	"int8":    reflect.TypeOf(int8(0)),
+	"int16":   reflect.TypeOf(int16(0)),
+	"int32":   reflect.TypeOf(int32(0)),
+	"int64":   reflect.TypeOf(int64(0)),
+	"uint":    reflect.TypeOf(uint(0)),
+	"uint8":   reflect.TypeOf(uint8(0)),
+	"uint16":  reflect.TypeOf(uint16(0)),
+	"uint32":  reflect.TypeOf(uint32(0)),
+	"uint64":  reflect.TypeOf(uint64(0)),
+	"float32": reflect.TypeOf(float32(0)),
+	"float64": reflect.TypeOf(float64(0)),
+	"byte":    reflect.TypeOf(byte(0)),
+	"rune":    reflect.TypeOf(rune(0)),
+	"any":     anyType,
+	"error":   errorType,
+}
+
+var builtins = map[string]builtin{
+	"len": "len", "cap": "cap", "append": "append", "make": "make", "new": "new",
+	"delete": "delete", "copy": "copy", "panic": "panic", "min": "min", "max": "max",
+}
+
+// errorf returns an error at the position of node.
+func (in *interpreter) errorf(node ast.Node, format string, args ...any) error {
+	return &Error{Pos: in.fset.Position(node.Pos()), Msg: fmt.Sprintf(format, args...)}
+}
+
+// at gives err the position of node unless it has one.
+func (in *interpreter) at(node ast.Node, err error) error {
+	var e *Error
+	if err == nil || errors.As(err, &e) {
+		return err
+	}
+	return &Error{Pos: in.fset.Position(node.Pos()), Msg: err.Error()}
+}
+
+// run runs fn as one entry into config.go, from LoadGoConfig or from a
+// callback the editor calls, turning panics into errors.
+func (in *interpreter) run(fn func() (any, error)) (result any, err error) {
+	if in.entered == 0 {
+		in.steps = 0
+	}
+	in.entered++
+	defer func() {
+		in.entered--
+		if r := recover(); r != nil {
+			err = &Error{Pos: in.fset.Position(in.pos), Msg: fmt.Sprintf("panic: %v", r)}
+		}
+	}()
+	return fn()
+}
+
+func (in *interpreter) step(node ast.Node) error {
+	in.pos = node.Pos()
+	in.steps++
+	if in.steps > maxSteps {
+		return in.errorf(node, "still running after %d steps; is there an endless loop?", maxSteps)
+	}
+	return nil
+}
+
+// Statements
+
+func (in *interpreter) execBlock(f *frame, sc *scope, list []ast.Stmt) (flow, error) {
+	for _, stmt := range list {
+		fl, err := in.exec(f, sc, stmt, "")
+		if err != nil || fl.kind != flowNext {
+			return fl, err
+		}
+	}
+	return flow{}, nil
+}
+
+func (in *interpreter) exec(f *frame, sc *scope, stmt ast.Stmt, label string) (flow, error) {
+	if err := in.step(stmt); err != nil {
+		return flow{}, err
+	}
+	fl, err := in.execStmt(f, sc, stmt, label)
+	return fl, in.at(stmt, err)
+}
+
+func (in *interpreter) execStmt(f *frame, sc *scope, stmt ast.Stmt, label string) (flow, error) {
+	switch s := stmt.(type) {
+	case *ast.EmptyStmt:
+		return flow{}, nil
+	case *ast.ExprStmt:
+		_, err := in.evalExpr(sc, s.X)
+		return flow{}, err
+	case *ast.AssignStmt:
+		return flow{}, in.execAssign(sc, s)
+	case *ast.IncDecStmt:
+		op := token.ADD
+		if s.Tok == token.DEC {
+			op = token.SUB
+		}
+		cur, err := in.eval(sc, s.X)
+		if err != nil {
+			return flow{}, err
+		}
+		value, err := binaryOp(op, cur, 1)
+		if err != nil {
+			return flow{}, err
+		}
+		return flow{}, in.assign(sc, s.X, value)
+	case *ast.DeclStmt:
+		return flow{}, in.declare(sc, s.Decl.(*ast.GenDecl))
+	case *ast.BlockStmt:
+		return in.execBlock(f, newScope(sc), s.List)
+	case *ast.LabeledStmt:
+		return in.exec(f, sc, s.Stmt, s.Label.Name)
+	case *ast.IfStmt:
+		return in.execIf(f, sc, s)
+	case *ast.ForStmt:
+		return in.execFor(f, sc, s, label)
+	case *ast.RangeStmt:
+		return in.execRange(f, sc, s, label)
+	case *ast.SwitchStmt:
+		return in.execSwitch(f, sc, s, label)
+	case *ast.TypeSwitchStmt:
+		return in.execTypeSwitch(f, sc, s, label)
+	case *ast.ReturnStmt:
+		return in.execReturn(f, sc, s)
+	case *ast.BranchStmt:
+		name := ""
+		if s.Label != nil {
+			name = s.Label.Name
+		}
+		switch s.Tok {
+		case token.BREAK:
+			return flow{kind: flowBreak, label: name}, nil
+		case token.CONTINUE:
+			return flow{kind: flowContinue, label: name}, nil
+		case token.FALLTHROUGH:
+			return flow{kind: flowFallthrough}, nil
+		}
+	}
+	return flow{}, in.errorf(stmt, "unsupported statement %T", stmt)
+}
+
+func (in *interpreter) execAssign(sc *scope, s *ast.AssignStmt) error {
+	if s.Tok != token.ASSIGN && s.Tok != token.DEFINE {
+		// x op= y
+		cur, err := in.eval(sc, s.Lhs[0])
+		if err != nil {
+			return err
+		}
+		rhs, err := in.eval(sc, s.Rhs[0])
+		if err != nil {
+			return err
+		}
+		value, err := binaryOp(assignOps[s.Tok], cur, rhs)
+		if err != nil {
+			return err
+		}
+		return in.assign(sc, s.Lhs[0], value)
+	}
+
+	values, err := in.evalValues(sc, s.Rhs, len(s.Lhs))
+	if err != nil {
+		return err
+	}
+	if s.Tok == token.ASSIGN {
+		for i, lhs := range s.Lhs {
+			if err := in.assign(sc, lhs, values[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for i, lhs := range s.Lhs {
+		name := lhs.(*ast.Ident).Name
+		if v, ok := sc.vars[name]; ok {
+			if err := in.store(v, values[i]); err != nil {
+				return in.at(lhs, err)
+			}
+			continue
+		}
+		sc.define(name, newVariable(values[i]))
+	}
+	return nil
+}
+
+var assignOps = map[token.Token]token.Token{
+	token.ADD_ASSIGN: token.ADD, token.SUB_ASSIGN: token.SUB, token.MUL_ASSIGN: token.MUL,
+	token.QUO_ASSIGN: token.QUO, token.REM_ASSIGN: token.REM, token.AND_ASSIGN: token.AND,
+	token.OR_ASSIGN: token.OR, token.XOR_ASSIGN: token.XOR, token.SHL_ASSIGN: token.SHL,
+	token.SHR_ASSIGN: token.SHR, token.AND_NOT_ASSIGN: token.AND_NOT,
+}
+
+// newVariable returns a variable declared with :=, typed after value. A
+// nil value, as returned by GetOption for an unknown option, makes a
+// variable of type any.
+func newVariable(value any) *variable {
+	switch value.(type) {
+	case nil:
+		return &variable{typ: anyType}
+	case *closure:
+		return &variable{value: value}
+	}
+	return &variable{value: value, typ: reflect.TypeOf(value)}
+}
+
+// store assigns value to v, converted to the type of v.
+func (in *interpreter) store(v *variable, value any) error {
+	if v.constant {
+		return fmt.Errorf("cannot assign to a constant")
+	}
+	// Functions of config.go stay closures while they are held in
+	// variables, so that their errors reach the caller.
+	if _, ok := value.(*closure); ok && (v.typ == nil || v.typ.Kind() == reflect.Func) {
+		v.value = value
+		return nil
+	}
+	if v.typ == nil {
+		if value != nil {
+			return fmt.Errorf("cannot assign %s to a function variable", describe(value))
+		}
+		v.value = value
+		return nil
+	}
+	rv, err := in.convert(value, v.typ)
+	if err != nil {
+		return err
+	}
+	v.value = rv.Interface()
+	return nil
+}
+
+// assign stores value in the variable, element or field lhs denotes.
+func (in *interpreter) assign(sc *scope, lhs ast.Expr, value any) error {
+	switch l := lhs.(type) {
+	case *ast.Ident:
+		if l.Name == "_" {
+			return nil
+		}
+		v := sc.lookup(l.Name)
+		if v == nil {
+			return in.errorf(l, "undefined: %s", l.Name)
+		}
+		return in.at(l, in.store(v, value))
+	case *ast.ParenExpr:
+		return in.assign(sc, l.X, value)
+	case *ast.IndexExpr:
+		container, err := in.eval(sc, l.X)
+		if err != nil {
+			return err
+		}
+		index, err := in.eval(sc, l.Index)
+		if err != nil {
+			return err
+		}
+		// Arrays are values: the element is set on a copy, which is
+		// assigned back to what l.X denotes.
+		if rv := reflect.ValueOf(container); rv.Kind() == reflect.Array {
+			copied := reflect.New(rv.Type()).Elem()
+			copied.Set(rv)
+			if err := in.setIndex(copied, index, value); err != nil {
+				return in.at(l, err)
+			}
+			return in.assign(sc, l.X, copied.Interface())
+		}
+		return in.at(l, in.setIndex(reflect.ValueOf(container), index, value))
+	case *ast.SelectorExpr:
+		target, err := in.eval(sc, l.X)
+		if err != nil {
+			return err
+		}
+		rv := reflect.ValueOf(target)
+		// Likewise a field of a struct value is set on a copy.
+		if rv.Kind() == reflect.Struct {
+			copied := reflect.New(rv.Type()).Elem()
+			copied.Set(rv)
+			if err := in.setField(copied, l.Sel.Name, value); err != nil {
+				return in.at(l, err)
+			}
+			return in.assign(sc, l.X, copied.Interface())
+		}
+		if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+			return in.errorf(l, "cannot assign to %s", l.Sel.Name)
+		}
+		return in.at(l, in.setField(rv.Elem(), l.Sel.Name, value))
+	case *ast.StarExpr:
+		target, err := in.eval(sc, l.X)
+		if err != nil {
+			return err
+		}
+		rv := reflect.ValueOf(target)
+		if rv.Kind() != reflect.Pointer || rv.IsNil() {
+			return in.errorf(l, "cannot assign through %s", describe(target))
+		}
+		converted, err := in.convert(value, rv.Type().Elem())
+		if err != nil {
+			return in.at(l, err)
+		}
+		rv.Elem().Set(converted)
+		return nil
+	}
+	return in.errorf(lhs, "cannot assign to %T", lhs)
+}
+
+func (in *interpreter) setIndex(rv reflect.Value, index, value any) error {
+	switch rv.Kind() {
+	case reflect.Map:
+		if rv.IsNil() {
+			return fmt.Errorf("assignment to entry in nil map")
+		}
+		key, err := in.convert(index, rv.Type().Key())
+		if err != nil {
+			return err
+		}
+		elem, err := in.convert(value, rv.Type().Elem())
+		if err != nil {
+			return err
+		}
+		rv.SetMapIndex(key, elem)
+		return nil
+	case reflect.Slice, reflect.Array:
+		i, err := toIndex(index, rv.Len())
+		if err != nil {
+			return err
+		}
+		elem, err := in.convert(value, rv.Type().Elem())
+		if err != nil {
+			return err
+		}
+		rv.Index(i).Set(elem)
+		return nil
+	}
+	return fmt.Errorf("cannot index %s", describe(rv.Interface()))
+}
+
+func (in *interpreter) setField(rv reflect.Value, name string, value any) error {
+	field, ok := rv.Type().FieldByName(name)
+	if !ok || !field.IsExported() {
+		return fmt.Errorf("%s has no field %s", rv.Type(), name)
+	}
+	converted, err := in.convert(value, field.Type)
+	if err != nil {
+		return err
+	}
+	rv.FieldByIndex(field.Index).Set(converted)
+	return nil
+}
+
+// declare runs a var or const declaration in sc.
+func (in *interpreter) declare(sc *scope, decl *ast.GenDecl) error {
+	var last *ast.ValueSpec
+	for i, spec := range decl.Specs {
+		vs, ok := spec.(*ast.ValueSpec)
+		if !ok {
+			continue
+		}
+		if decl.Tok == token.CONST {
+			// A constant without values repeats the previous ones with
+			// the next iota.
+			if len(vs.Values) == 0 && last != nil {
+				vs = &ast.ValueSpec{Names: vs.Names, Type: last.Type, Values: last.Values}
+			}
+			last = vs
+			consts := newScope(sc)
+			consts.define("iota", &variable{value: i, typ: universeTypes["int"], constant: true})
+			if err := in.declareSpec(sc, consts, vs, true); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := in.declareSpec(sc, sc, vs, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (in *interpreter) declareSpec(sc, evalScope *scope, vs *ast.ValueSpec, constant bool) error {
+	var typ reflect.Type
+	if vs.Type != nil {
+		t, err := in.typeOf(sc, vs.Type)
+		if err != nil {
+			return err
+		}
+		typ = t
+	}
+	var values []any
+	if len(vs.Values) > 0 {
+		var err error
+		if values, err = in.evalValues(evalScope, vs.Values, len(vs.Names)); err != nil {
+			return err
+		}
+	}
+	for i, name := range vs.Names {
+		var v *variable
+		switch {
+		case typ != nil:
+			v = &variable{value: reflect.Zero(typ).Interface(), typ: typ}
+			if values != nil {
+				if err := in.store(v, values[i]); err != nil {
+					return in.at(name, err)
+				}
+			}
+		case values != nil:
+			v = newVariable(values[i])
+		default:
+			return in.errorf(name, "missing type or value for %s", name.Name)
+		}
+		v.constant = constant
+		sc.define(name.Name, v)
+	}
+	return nil
+}
+
+func (in *interpreter) execIf(f *frame, sc *scope, s *ast.IfStmt) (flow, error) {
+	sc = newScope(sc)
+	if s.Init != nil {
+		if _, err := in.exec(f, sc, s.Init, ""); err != nil {
+			return flow{}, err
+		}
+	}
+	cond, err := in.evalBool(sc, s.Cond)
+	if err != nil {
+		return flow{}, err
+	}
+	if cond {
+		return in.execBlock(f, newScope(sc), s.Body.List)
+	}
+	if s.Else != nil {
+		return in.exec(f, sc, s.Else, "")
+	}
+	return flow{}, nil
+}
+
+// loopControl reports whether fl ends the loop labeled label, and
+// whether it must be passed on to the enclosing statements.
+func loopControl(fl flow, label string) (stop, propagate bool) {
+	switch fl.kind {
+	case flowBreak:
+		if fl.label == "" || fl.label == label {
+			return true, false
+		}
+		return true, true
+	case flowContinue:
+		if fl.label == "" || fl.label == label {
+			return false, false
+		}
+		return true, true
+	case flowReturn:
+		return true, true
+	}
+	return false, false
+}
+
+func (in *interpreter) execFor(f *frame, sc *scope, s *ast.ForStmt, label string) (flow, error) {
+	sc = newScope(sc)
+	if s.Init != nil {
+		if _, err := in.exec(f, sc, s.Init, ""); err != nil {
+			return flow{}, err
+		}
+	}
+	for {
+		if err := in.step(s); err != nil {
+			return flow{}, err
+		}
+		if s.Cond != nil {
+			cond, err := in.evalBool(sc, s.Cond)
+			if err != nil {
+				return flow{}, err
+			}
+			if !cond {
+				return flow{}, nil
+			}
+		}
+		// Each iteration has its own copy of the loop variables, so
+		// closures made in the body keep the values of their iteration.
+		iter := newScope(sc.parent)
+		for name, v := range sc.vars {
+			copied := *v
+			iter.vars[name] = &copied
+		}
+		fl, err := in.execBlock(f, newScope(iter), s.Body.List)
+		if err != nil {
+			return flow{}, err
+		}
+		for name, v := range iter.vars {
+			*sc.vars[name] = *v
+		}
+		if stop, propagate := loopControl(fl, label); stop {
+			if propagate {
+				return fl, nil
+			}
+			return flow{}, nil
+		}
+		if s.Post != nil {
+			if _, err := in.exec(f, sc, s.Post, ""); err != nil {
+				return flow{}, err
+			}
+		}
+	}
+}
+
+func (in *interpreter) execRange(f *frame, sc *scope, s *ast.RangeStmt, label string) (flow, error) {
+	x, err := in.eval(sc, s.X)
+	if err != nil {
+		return flow{}, err
+	}
+
+	var keys, values []any
+	rv := reflect.ValueOf(x)
+	switch rv.Kind() {
+	case reflect.Invalid:
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		for i := int64(0); i < rv.Int(); i++ {
+			keys = append(keys, reflect.ValueOf(i).Convert(rv.Type()).Interface())
+		}
+	case reflect.String:
+		for i, r := range rv.String() {
+			keys = append(keys, i)
+			values = append(values, r)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			keys = append(keys, i)
+			values = append(values, rv.Index(i).Interface())
+		}
+	case reflect.Map:
+		mapKeys := rv.MapKeys()
+		sortValues(mapKeys)
+		for _, k := range mapKeys {
+			keys = append(keys, k.Interface())
+			values = append(values, rv.MapIndex(k).Interface())
+		}
+	default:
+		return flow{}, in.errorf(s.X, "cannot range over %s", describe(x))
+	}
+
+	for i, key := range keys {
+		if err := in.step(s); err != nil {
+			return flow{}, err
+		}
+		iter := newScope(sc)
+		bind := func(expr ast.Expr, value any) error {
+			if expr == nil {
+				return nil
+			}
+			if s.Tok == token.DEFINE {
+				iter.define(expr.(*ast.Ident).Name, newVariable(value))
+				return nil
+			}
+			return in.assign(sc, expr, value)
+		}
+		if err := bind(s.Key, key); err != nil {
+			return flow{}, err
+		}
+		if s.Value != nil {
+			if err := bind(s.Value, values[i]); err != nil {
+				return flow{}, err
+			}
+		}
+		fl, err := in.execBlock(f, newScope(iter), s.Body.List)
+		if err != nil {
+			return flow{}, err
+		}
+		if stop, propagate := loopControl(fl, label); stop {
+			if propagate {
+				return fl, nil
+			}
+			return flow{}, nil
+		}
+	}
+	return flow{}, nil
+}
+
+// sortValues sorts map keys of ordered types, so that ranging over a map
+// in config.go gives the same result every time.
+func sortValues(values []reflect.Value) {
+	sort.Slice(values, func(i, j int) bool {
+		a, b := values[i], values[j]
+		switch a.Kind() {
+		case reflect.String:
+			return a.String() < b.String()
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return a.Int() < b.Int()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return a.Uint() < b.Uint()
+		case reflect.Float32, reflect.Float64:
+			return a.Float() < b.Float()
+		}
+		return false
+	})
+}
+
+// execClauses runs the body of clause matched and those it falls
+// through to.
+func (in *interpreter) execClauses(f *frame, sc *scope, clauses []ast.Stmt, matched int, label string, bind func(*scope, *ast.CaseClause)) (flow, error) {
+	for i := matched; i < len(clauses); i++ {
+		clause := clauses[i].(*ast.CaseClause)
+		body := newScope(sc)
+		if bind != nil {
+			bind(body, clause)
+		}
+		fl, err := in.execBlock(f, body, clause.Body)
+		if err != nil {
+			return flow{}, err
+		}
+		switch {
+		case fl.kind == flowFallthrough:
+			continue
+		case fl.kind == flowBreak && (fl.label == "" || fl.label == label):
+			return flow{}, nil
+		}
+		return fl, nil
+	}
+	return flow{}, nil
+}
+
+func (in *interpreter) execSwitch(f *frame, sc *scope, s *ast.SwitchStmt, label string) (flow, error) {
+	sc = newScope(sc)
+	if s.Init != nil {
+		if _, err := in.exec(f, sc, s.Init, ""); err != nil {
+			return flow{}, err
+		}
+	}
+	var tag any = true
+	if s.Tag != nil {
+		var err error
+		if tag, err = in.eval(sc, s.Tag); err != nil {
+			return flow{}, err
+		}
+	}
+
+	matched := -1
+	for i, stmt := range s.Body.List {
+		clause := stmt.(*ast.CaseClause)
+		if clause.List == nil {
+			if matched < 0 {
+				matched = i
+			}
+			continue
+		}
+		for _, expr := range clause.List {
+			value, err := in.eval(sc, expr)
+			if err != nil {
+				return flow{}, err
+			}
+			eq, err := binaryOp(token.EQL, tag, value)
+			if err != nil {
+				return flow{}, in.at(expr, err)
+			}
+			if eq == true {
+				return in.execClauses(f, sc, s.Body.List, i, label, nil)
+			}
+		}
+	}
+	if matched < 0 {
+		return flow{}, nil
+	}
+	return in.execClauses(f, sc, s.Body.List, matched, label, nil)
+}
+
+func (in *interpreter) execTypeSwitch(f *frame, sc *scope, s *ast.TypeSwitchStmt, label string) (flow, error) {
+	sc = newScope(sc)
+	if s.Init != nil {
+		if _, err := in.exec(f, sc, s.Init, ""); err != nil {
+			return flow{}, err
+		}
+	}
+	var name string
+	var assert *ast.TypeAssertExpr
+	switch a := s.Assign.(type) {
+	case *ast.AssignStmt:
+		name = a.Lhs[0].(*ast.Ident).Name
+		assert = a.Rhs[0].(*ast.TypeAssertExpr)
+	case *ast.ExprStmt:
+		assert = a.X.(*ast.TypeAssertExpr)
+	}
+	x, err := in.eval(sc, assert.X)
+	if err != nil {
+		return flow{}, err
+	}
+
+	bind := func(body *scope, clause *ast.CaseClause) {
+		if name == "" {
+			return
+		}
+		v := &variable{value: x, typ: anyType}
+		if len(clause.List) == 1 {
+			if t, err := in.typeOf(sc, clause.List[0]); err == nil {
+				v.typ = t
+			}
+		}
+		body.define(name, v)
+	}
+	matched := -1
+	for i, stmt := range s.Body.List {
+		clause := stmt.(*ast.CaseClause)
+		if clause.List == nil {
+			matched = i
+			continue
+		}
+		for _, expr := range clause.List {
+			if id, ok := expr.(*ast.Ident); ok && id.Name == "nil" {
+				if x == nil {
+					return in.execClauses(f, sc, s.Body.List[:i+1], i, label, bind)
+				}
+				continue
+			}
+			t, err := in.typeOf(sc, expr)
+			if err != nil {
+				return flow{}, err
+			}
+			if hasType(x, t) {
+				return in.execClauses(f, sc, s.Body.List[:i+1], i, label, bind)
+			}
+		}
+	}
+	if matched < 0 {
+		return flow{}, nil
+	}
+	return in.execClauses(f, sc, s.Body.List[:matched+1], matched, label, bind)
+}
+
+func (in *interpreter) execReturn(f *frame, sc *scope, s *ast.ReturnStmt) (flow, error) {
+	if len(s.Results) == 0 {
+		f.results = nil
+		for _, v := range f.named {
+			f.results = append(f.results, v.value)
+		}
+		return flow{kind: flowReturn}, nil
+	}
+	n := len(s.Results)
+	if n == 1 && len(f.named) > 1 {
+		n = len(f.named)
+	}
+	values, err := in.evalValues(sc, s.Results, n)
+	if err != nil {
+		return flow{}, err
+	}
+	f.results = values
+	return flow{kind: flowReturn}, nil
+}
+
+// Expressions
+
+// eval evaluates expr to a single value.
+func (in *interpreter) eval(sc *scope, expr ast.Expr) (any, error) {
+	v, err := in.evalExpr(sc, expr)
+	if err != nil {
+		return nil, err
+	}
+	if t, ok := v.(tuple); ok {
+		return nil, in.errorf(expr, "multiple-value (%d values) in single-value context", len(t))
+	}
+	return v, nil
+}
+
+func (in *interpreter) evalBool(sc *scope, expr ast.Expr) (bool, error) {
+	v, err := in.eval(sc, expr)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, in.errorf(expr, "non-boolean condition %s", describe(v))
+	}
+	return b, nil
+}
+
+// evalValues evaluates the right-hand side of an assignment to n values:
+// one per expression, or n from a single call, map index or type
+// assertion.
+func (in *interpreter) evalValues(sc *scope, exprs []ast.Expr, n int) ([]any, error) {
+	if len(exprs) == 1 && n == 2 {
+		switch e := ast.Unparen(exprs[0]).(type) {
+		case *ast.IndexExpr:
+			container, err := in.eval(sc, e.X)
+			if err != nil {
+				return nil, err
+			}
+			if rv := reflect.ValueOf(container); rv.Kind() == reflect.Map {
+				key, err := in.eval(sc, e.Index)
+				if err != nil {
+					return nil, err
+				}
+				value, ok, err := in.mapIndex(rv, key)
+				return []any{value, ok}, in.at(e, err)
+			}
+		case *ast.TypeAssertExpr:
+			x, err := in.eval(sc, e.X)
+			if err != nil {
+				return nil, err
+			}
+			t, err := in.typeOf(sc, e.Type)
+			if err != nil {
+				return nil, err
+			}
+			if hasType(x, t) {
+				return []any{x, true}, nil
+			}
+			return []any{reflect.Zero(t).Interface(), false}, nil
+		}
+	}
+	if len(exprs) == 1 && n > 1 {
+		v, err := in.evalExpr(sc, exprs[0])
+		if err != nil {
+			return nil, err
+		}
+		t, ok := v.(tuple)
+		if !ok || len(t) != n {
+			return nil, in.errorf(exprs[0], "assignment mismatch: %d variables but 1 value", n)
+		}
+		return t, nil
+	}
+	if len(exprs) != n {
+		return nil, in.errorf(exprs[0], "assignment mismatch: %d variables but %d values", n, len(exprs))
+	}
+	values := make([]any, n)
+	for i, expr := range exprs {
+		v, err := in.eval(sc, expr)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+func (in *interpreter) evalExpr(sc *scope, expr ast.Expr) (any, error) {
+	v, err := in.evalExpr1(sc, expr)
+	return v, in.at(expr, err)
+}
+
+func (in *interpreter) evalExpr1(sc *scope, expr ast.Expr) (any, error) {
+	switch e := expr.(type) {
+	case *ast.BasicLit:
+		return evalLiteral(e)
+	case *ast.Ident:
+		return in.evalIdent(sc, e)
+	case *ast.ParenExpr:
+		return in.evalExpr(sc, e.X)
+	case *ast.FuncLit:
+		return &closure{name: "func literal", typ: e.Type, body: e.Body, env: sc}, nil
+	case *ast.SelectorExpr:
+		return in.evalSelector(sc, e)
+	case *ast.CallExpr:
+		return in.evalCall(sc, e)
+	case *ast.IndexExpr:
+		return in.evalIndex(sc, e)
+	case *ast.SliceExpr:
+		return in.evalSlice(sc, e)
+	case *ast.CompositeLit:
+		t, err := in.literalType(sc, e)
+		if err != nil {
+			return nil, err
+		}
+		rv, err := in.composite(sc, e, t)
+		if err != nil {
+			return nil, err
+		}
+		return rv.Interface(), nil
+	case *ast.UnaryExpr:
+		return in.evalUnary(sc, e)
+	case *ast.BinaryExpr:
+		return in.evalBinary(sc, e)
+	case *ast.StarExpr:
+		x, err := in.eval(sc, e.X)
+		if err != nil {
+			return nil, err
+		}
+		rv := reflect.ValueOf(x)
+		if rv.Kind() != reflect.Pointer || rv.IsNil() {
+			return nil, fmt.Errorf("invalid indirect of %s", describe(x))
+		}
+		return rv.Elem().Interface(), nil
+	case *ast.TypeAssertExpr:
+		x, err := in.eval(sc, e.X)
+		if err != nil {
+			return nil, err
+		}
+		t, err := in.typeOf(sc, e.Type)
+		if err != nil {
+			return nil, err
+		}
+		if !hasType(x, t) {
+			return nil, fmt.Errorf("interface conversion: %s is not %s", describe(x), t)
+		}
+		return x, nil
+	case *ast.ArrayType, *ast.MapType, *ast.FuncType, *ast.InterfaceType:
+		t, err := in.typeOf(sc, e)
+		if err != nil {
+			return nil, err
+		}
+		return typeRef{t}, nil
+	}
+	return nil, fmt.Errorf("unsupported expression %T", expr)
+}
+
+func evalLiteral(lit *ast.BasicLit) (any, error) {
+	switch lit.Kind {
+	case token.INT:
+		n, err := strconv.ParseInt(lit.Value, 0, 64)
+		if err != nil {
+			return nil, err
+		}
+		return int(n), nil
+	case token.FLOAT:
+		return strconv.ParseFloat(lit.Value, 64)
+	case token.CHAR:
+		r, _, _, err := strconv.UnquoteChar(lit.Value[1:len(lit.Value)-1], '\'')
+		if err != nil {
+			return nil, err
+		}
+		return r, nil
+	case token.STRING:
+		return strconv.Unquote(lit.Value)
+	}
+	return nil, fmt.Errorf("unsupported literal %s", lit.Value)
+}
+
+func (in *interpreter) evalIdent(sc *scope, id *ast.Ident) (any, error) {
+	if v := sc.lookup(id.Name); v != nil {
+		return v.value, nil
+	}
+	if _, ok := in.imports[id.Name]; ok {
+		return nil, fmt.Errorf("use of package %s without selector", id.Name)
+	}
+	switch id.Name {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "nil":
+		return nil, nil
+	}
+	if t, ok := universeTypes[id.Name]; ok {
+		return typeRef{t}, nil
+	}
+	if b, ok := builtins[id.Name]; ok {
+		return b, nil
+	}
+	return nil, fmt.Errorf("undefined: %s", id.Name)
+}
+
+// packageMember returns pkg.name if x names an imported package.
+func (in *interpreter) packageMember(sc *scope, x ast.Expr, name string) (any, bool, error) {
+	id, ok := x.(*ast.Ident)
+	if !ok || sc.lookup(id.Name) != nil {
+		return nil, false, nil
+	}
+	members, ok := in.imports[id.Name]
+	if !ok {
+		return nil, false, nil
+	}
+	member, ok := members[name]
+	if !ok {
+		return nil, true, fmt.Errorf("%s.%s is not available in config.go", id.Name, name)
+	}
+	return member, true, nil
+}
+
+func (in *interpreter) evalSelector(sc *scope, e *ast.SelectorExpr) (any, error) {
+	if member, ok, err := in.packageMember(sc, e.X, e.Sel.Name); ok || err != nil {
+		return member, err
+	}
+	x, err := in.eval(sc, e.X)
+	if err != nil {
+		return nil, err
+	}
+	rv := reflect.ValueOf(x)
+	if !rv.IsValid() {
+		return nil, fmt.Errorf("%s of nil", e.Sel.Name)
+	}
+	if m := rv.MethodByName(e.Sel.Name); m.IsValid() {
+		return m.Interface(), nil
+	}
+	if rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil, fmt.Errorf("%s of nil pointer", e.Sel.Name)
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() == reflect.Struct {
+		if field, ok := rv.Type().FieldByName(e.Sel.Name); ok && field.IsExported() {
+			return rv.FieldByIndex(field.Index).Interface(), nil
+		}
+	}
+	return nil, fmt.Errorf("%s has no field or method %s", describe(x), e.Sel.Name)
+}
+
+func (in *interpreter) evalIndex(sc *scope, e *ast.IndexExpr) (any, error) {
+	x, err := in.eval(sc, e.X)
+	if err != nil {
+		return nil, err
+	}
+	index, err := in.eval(sc, e.Index)
+	if err != nil {
+		return nil, err
+	}
+	rv := reflect.ValueOf(x)
+	switch rv.Kind() {
+	case reflect.Map:
+		value, _, err := in.mapIndex(rv, index)
+		return value, err
+	case reflect.Slice, reflect.Array, reflect.String:
+		i, err := toIndex(index, rv.Len())
+		if err != nil {
+			return nil, err
+		}
+		return rv.Index(i).Interface(), nil
+	}
+	return nil, fmt.Errorf("cannot index %s", describe(x))
+}
+
+func (in *interpreter) mapIndex(rv reflect.Value, index any) (any, bool, error) {
+	key, err := in.convert(index, rv.Type().Key())
+	if err != nil {
+		return nil, false, err
+	}
+	value := rv.MapIndex(key)
+	if !value.IsValid() {
+		return reflect.Zero(rv.Type().Elem()).Interface(), false, nil
+	}
+	return value.Interface(), true, nil
+}
+
+func toIndex(index any, length int) (int, error) {
+	rv := reflect.ValueOf(index)
+	if !isInt(rv.Kind()) {
+		return 0, fmt.Errorf("invalid index %s", describe(index))
+	}
+	i := int(rv.Int())
+	if i < 0 || i >= length {
+		return 0, fmt.Errorf("index out of range [%d] with length %d", i, length)
+	}
+	return i, nil
+}
+
+func (in *interpreter) evalSlice(sc *scope, e *ast.SliceExpr) (any, error) {
+	x, err := in.eval(sc, e.X)
+	if err != nil {
+		return nil, err
+	}
+	rv := reflect.ValueOf(x)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.String:
+	case reflect.Array:
+		// A slice of an array shares its storage, which the values the
+		// interpreter keeps arrays in do not allow.
+		return nil, fmt.Errorf("cannot slice %s: config.go can only slice slices and strings", describe(x))
+	default:
+		return nil, fmt.Errorf("cannot slice %s", describe(x))
+	}
+	bound := func(expr ast.Expr, def int) (int, error) {
+		if expr == nil {
+			return def, nil
+		}
+		v, err := in.eval(sc, expr)
+		if err != nil {
+			return 0, err
+		}
+		b := reflect.ValueOf(v)
+		if !isInt(b.Kind()) {
+			return 0, fmt.Errorf("invalid slice index %s", describe(v))
+		}
+		return int(b.Int()), nil
+	}
+	capacity := rv.Len()
+	if rv.Kind() == reflect.Slice {
+		capacity = rv.Cap()
+	}
+	low, err := bound(e.Low, 0)
+	if err != nil {
+		return nil, err
+	}
+	high, err := bound(e.High, rv.Len())
+	if err != nil {
+		return nil, err
+	}
+	if e.Slice3 {
+		max, err := bound(e.Max, capacity)
+		if err != nil {
+			return nil, err
+		}
+		if low < 0 || low > high || high > max || max > capacity {
+			return nil, fmt.Errorf("slice bounds out of range [%d:%d:%d]", low, high, max)
+		}
+		return rv.Slice3(low, high, max).Interface(), nil
+	}
+	if low < 0 || low > high || high > capacity {
+		return nil, fmt.Errorf("slice bounds out of range [%d:%d]", low, high)
+	}
+	return rv.Slice(low, high).Interface(), nil
+}
+
+// literalType returns the type of lit, counting the elements of an array
+// literal of the form [...]T{...}.
+func (in *interpreter) literalType(sc *scope, lit *ast.CompositeLit) (reflect.Type, error) {
+	at, ok := lit.Type.(*ast.ArrayType)
+	if !ok {
+		return in.typeOf(sc, lit.Type)
+	}
+	if _, ok := at.Len.(*ast.Ellipsis); !ok {
+		return in.typeOf(sc, lit.Type)
+	}
+	elem, err := in.typeOf(sc, at.Elt)
+	if err != nil {
+		return nil, err
+	}
+	_, length, err := in.elementIndices(sc, lit)
+	if err != nil {
+		return nil, err
+	}
+	return reflect.ArrayOf(length, elem), nil
+}
+
+// elementIndices returns the index of each element of a slice or array
+// literal, which may give some of them as index: value, and the length
+// they make up.
+func (in *interpreter) elementIndices(sc *scope, lit *ast.CompositeLit) ([]int, int, error) {
+	indices := make([]int, len(lit.Elts))
+	seen := make(map[int]bool)
+	next, length := 0, 0
+	for i, elt := range lit.Elts {
+		if kv, ok := elt.(*ast.KeyValueExpr); ok {
+			key, err := in.eval(sc, kv.Key)
+			if err != nil {
+				return nil, 0, err
+			}
+			index, ok := key.(int)
+			if !ok || index < 0 {
+				return nil, 0, in.errorf(kv.Key, "invalid index %s in literal", describe(key))
+			}
+			next = index
+		}
+		if seen[next] {
+			return nil, 0, in.errorf(elt, "duplicate index %d in literal", next)
+		}
+		seen[next] = true
+		indices[i] = next
+		next++
+		length = max(length, next)
+	}
+	return indices, length, nil
+}
+
+// composite builds a composite literal of type t. Elements may leave out
+// their type, as in []edito.Option{{Name: "x"}}.
+func (in *interpreter) composite(sc *scope, lit *ast.CompositeLit, t reflect.Type) (reflect.Value, error) {
+	element := func(expr ast.Expr, t reflect.Type) (reflect.Value, error) {
+		if inner, ok := expr.(*ast.CompositeLit); ok && inner.Type == nil {
+			if t.Kind() == reflect.Pointer {
+				rv, err := in.composite(sc, inner, t.Elem())
+				if err != nil {
+					return reflect.Value{}, err
+				}
+				ptr := reflect.New(t.Elem())
+				ptr.Elem().Set(rv)
+				return ptr, nil
+			}
+			return in.composite(sc, inner, t)
+		}
+		v, err := in.eval(sc, expr)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		rv, err := in.convert(v, t)
+		return rv, in.at(expr, err)
+	}
+
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array:
+		indices, length, err := in.elementIndices(sc, lit)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		rv := reflect.New(t).Elem()
+		if t.Kind() == reflect.Slice {
+			rv = reflect.MakeSlice(t, length, length)
+		} else if length > t.Len() {
+			return reflect.Value{}, in.errorf(lit, "too many elements for %s", t)
+		}
+		for i, elt := range lit.Elts {
+			if kv, ok := elt.(*ast.KeyValueExpr); ok {
+				elt = kv.Value
+			}
+			ev, err := element(elt, t.Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			rv.Index(indices[i]).Set(ev)
+		}
+		return rv, nil
+	case reflect.Map:
+		rv := reflect.MakeMapWithSize(t, len(lit.Elts))
+		for _, elt := range lit.Elts {
+			kv, ok := elt.(*ast.KeyValueExpr)
+			if !ok {
+				return reflect.Value{}, in.errorf(elt, "missing key in map literal")
+			}
+			key, err := element(kv.Key, t.Key())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			value, err := element(kv.Value, t.Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			rv.SetMapIndex(key, value)
+		}
+		return rv, nil
+	case reflect.Struct:
+		rv := reflect.New(t).Elem()
+		for i, elt := range lit.Elts {
+			kv, ok := elt.(*ast.KeyValueExpr)
+			var field reflect.StructField
+			var value ast.Expr
+			if ok {
+				name := kv.Key.(*ast.Ident).Name
+				if field, ok = t.FieldByName(name); !ok || !field.IsExported() {
+					return reflect.Value{}, in.errorf(kv.Key, "unknown field %s in %s", name, t)
+				}
+				value = kv.Value
+			} else {
+				if i >= t.NumField() || !t.Field(i).IsExported() {
+					return reflect.Value{}, in.errorf(elt, "too many values in %s", t)
+				}
+				field, value = t.Field(i), elt
+			}
+			fv, err := element(value, field.Type)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			rv.FieldByIndex(field.Index).Set(fv)
+		}
+		return rv, nil
+	}
+	return reflect.Value{}, in.errorf(lit, "invalid composite literal type %s", t)
+}
+
+func (in *interpreter) evalUnary(sc *scope, e *ast.UnaryExpr) (any, error) {
+	if e.Op == token.AND {
+		lit, ok := ast.Unparen(e.X).(*ast.CompositeLit)
+		if !ok {
+			return nil, fmt.Errorf("cannot take the address of %T", e.X)
+		}
+		t, err := in.literalType(sc, lit)
+		if err != nil {
+			return nil, err
+		}
+		rv, err := in.composite(sc, lit, t)
+		if err != nil {
+			return nil, err
+		}
+		ptr := reflect.New(t)
+		ptr.Elem().Set(rv)
+		return ptr.Interface(), nil
+	}
+	x, err := in.eval(sc, e.X)
+	if err != nil {
+		return nil, err
+	}
+	rv := reflect.ValueOf(x)
+	switch {
+	case e.Op == token.NOT && rv.Kind() == reflect.Bool:
+		return !rv.Bool(), nil
+	case e.Op == token.ADD && isNumber(rv.Kind()):
+		return x, nil
+	case e.Op == token.SUB && isNumber(rv.Kind()):
+		return binaryOp(token.SUB, reflect.Zero(rv.Type()).Interface(), x)
+	case e.Op == token.XOR && isInt(rv.Kind()):
+		return reflect.ValueOf(^rv.Int()).Convert(rv.Type()).Interface(), nil
+	}
+	return nil, fmt.Errorf("invalid operation: %s%s", e.Op, describe(x))
+}
+
+func (in *interpreter) evalBinary(sc *scope, e *ast.BinaryExpr) (any, error) {
+	if e.Op == token.LAND || e.Op == token.LOR {
+		x, err := in.evalBool(sc, e.X)
+		if err != nil {
+			return nil, err
+		}
+		if x == (e.Op == token.LOR) {
+			return x, nil
+		}
+		return in.evalBool(sc, e.Y)
+	}
+	x, err := in.eval(sc, e.X)
+	if err != nil {
+		return nil, err
+	}
+	y, err := in.eval(sc, e.Y)
+	if err != nil {
+		return nil, err
+	}
+	return binaryOp(e.Op, x, y)
+}
+
+// Calls
+
+func (in *interpreter) evalCall(sc *scope, call *ast.CallExpr) (any, error) {
+	fn, err := in.eval(sc, call.Fun)
+	if err != nil {
+		return nil, err
+	}
+	switch f := fn.(type) {
+	case builtin:
+		return in.callBuiltin(sc, f, call)
+	case typeRef:
+		if len(call.Args) != 1 {
+			return nil, fmt.Errorf("conversion to %s needs 1 argument", f.t)
+		}
+		v, err := in.eval(sc, call.Args[0])
+		if err != nil {
+			return nil, err
+		}
+		rv, err := in.conversion(v, f.t)
+		if err != nil {
+			return nil, err
+		}
+		return rv.Interface(), nil
+	}
+
+	var args []any
+	if len(call.Args) == 1 {
+		v, err := in.evalExpr(sc, call.Args[0])
+		if err != nil {
+			return nil, err
+		}
+		if t, ok := v.(tuple); ok {
+			args = t
+		} else {
+			args = []any{v}
+		}
+	} else {
+		for _, arg := range call.Args {
+			v, err := in.eval(sc, arg)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, v)
+		}
+	}
+	return in.apply(fn, args, call.Ellipsis.IsValid())
+}
+
+// apply calls fn, a closure or a Go function, with args. With spread the
+// last argument is the slice of variadic arguments.
+func (in *interpreter) apply(fn any, args []any, spread bool) (any, error) {
+	if c, ok := fn.(*closure); ok {
+		return in.callClosure(c, args, spread)
+	}
+	rv := reflect.ValueOf(fn)
+	if rv.Kind() != reflect.Func {
+		return nil, fmt.Errorf("cannot call non-function %s", describe(fn))
+	}
+	if rv.IsNil() {
+		return nil, fmt.Errorf("call of nil function")
+	}
+	ft := rv.Type()
+	fixed := ft.NumIn()
+	if ft.IsVariadic() {
+		fixed--
+	}
+	if len(args) < fixed || (!ft.IsVariadic() && len(args) > fixed) || (spread && len(args) != ft.NumIn()) {
+		return nil, fmt.Errorf("wrong number of arguments: have %d, want %d", len(args), ft.NumIn())
+	}
+	values := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		t := ft.In(min(i, ft.NumIn()-1))
+		if ft.IsVariadic() && i >= fixed && !spread {
+			t = t.Elem()
+		}
+		v, err := in.convert(arg, t)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d: %v", i+1, err)
+		}
+		values[i] = v
+	}
+	var out []reflect.Value
+	if spread {
+		out = rv.CallSlice(values)
+	} else {
+		out = rv.Call(values)
+	}
+	return results(out), nil
+}
+
+func results(out []reflect.Value) any {
+	switch len(out) {
+	case 0:
+		return nil
+	case 1:
+		return out[0].Interface()
+	}
+	t := make(tuple, len(out))
+	for i, v := range out {
+		t[i] = v.Interface()
+	}
+	return t
+}
+
+// signature returns the parameter and result types of a function type
+// of config.go.
+func (in *interpreter) signature(sc *scope, ft *ast.FuncType) (params, res []reflect.Type, variadic bool, err error) {
+	fields := func(list *ast.FieldList) ([]reflect.Type, error) {
+		var types []reflect.Type
+		if list == nil {
+			return nil, nil
+		}
+		for _, field := range list.List {
+			expr := field.Type
+			if ell, ok := expr.(*ast.Ellipsis); ok {
+				variadic = true
+				expr = &ast.ArrayType{Elt: ell.Elt}
+			}
+			t, err := in.typeOf(sc, expr)
+			if err != nil {
+				return nil, err
+			}
+			for n := max(len(field.Names), 1); n > 0; n-- {
+				types = append(types, t)
+			}
+		}
+		return types, nil
+	}
+	if params, err = fields(ft.Params); err != nil {
+		return
+	}
+	res, err = fields(ft.Results)
+	return
+}
+
+func fieldNames(list *ast.FieldList) []string {
+	var names []string
+	if list == nil {
+		return nil
+	}
+	for _, field := range list.List {
+		if len(field.Names) == 0 {
+			names = append(names, "_")
+		}
+		for _, name := range field.Names {
+			names = append(names, name.Name)
+		}
+	}
+	return names
+}
+
+func (in *interpreter) callClosure(c *closure, args []any, spread bool) (any, error) {
+	in.depth++
+	defer func() { in.depth-- }()
+	if in.depth > maxDepth {
+		return nil, fmt.Errorf("calls nested deeper than %d; is there endless recursion?", maxDepth)
+	}
+
+	params, res, variadic, err := in.signature(c.env, c.typ)
+	if err != nil {
+		return nil, err
+	}
+	if variadic && !spread {
+		fixed := len(params) - 1
+		if len(args) < fixed {
+			return nil, fmt.Errorf("not enough arguments in call to %s", c.name)
+		}
+		rest := reflect.MakeSlice(params[fixed], 0, len(args)-fixed)
+		for _, arg := range args[fixed:] {
+			v, err := in.convert(arg, params[fixed].Elem())
+			if err != nil {
+				return nil, fmt.Errorf("argument to %s: %v", c.name, err)
+			}
+			rest = reflect.Append(rest, v)
+		}
+		args = append(args[:fixed:fixed], rest.Interface())
+	}
+	if len(args) != len(params) {
+		return nil, fmt.Errorf("wrong number of arguments in call to %s: have %d, want %d", c.name, len(args), len(params))
+	}
+
+	sc := newScope(c.env)
+	for i, name := range fieldNames(c.typ.Params) {
+		v := &variable{value: reflect.Zero(params[i]).Interface(), typ: params[i]}
+		if err := in.store(v, args[i]); err != nil {
+			return nil, fmt.Errorf("argument to %s: %v", c.name, err)
+		}
+		sc.define(name, v)
+	}
+	f := &frame{}
+	if names := fieldNames(c.typ.Results); len(names) > 0 && c.typ.Results.List[0].Names != nil {
+		for i, name := range names {
+			v := &variable{value: reflect.Zero(res[i]).Interface(), typ: res[i]}
+			f.named = append(f.named, v)
+			sc.define(name, v)
+		}
+	}
+
+	fl, err := in.execBlock(f, sc, c.body.List)
+	if err != nil {
+		return nil, err
+	}
+	if fl.kind != flowReturn {
+		if len(res) > 0 && f.named == nil {
+			return nil, &Error{Pos: in.fset.Position(c.body.Rbrace), Msg: "missing return in " + c.name}
+		}
+		for _, v := range f.named {
+			f.results = append(f.results, v.value)
+		}
+	}
+	if len(f.results) != len(res) {
+		return nil, fmt.Errorf("%s returns %d values, not %d", c.name, len(res), len(f.results))
+	}
+	out := make([]reflect.Value, len(res))
+	for i, t := range res {
+		v, err := in.convert(f.results[i], t)
+		if err != nil {
+			return nil, fmt.Errorf("result of %s: %v", c.name, err)
+		}
+		out[i] = v
+	}
+	return results(out), nil
+}
+
+// goFunc turns a closure into a Go function of type t for the editor to
+// call. An error in the closure is returned if t returns an error, and
+// reported otherwise.
+func (in *interpreter) goFunc(c *closure, t reflect.Type) reflect.Value {
+	return reflect.MakeFunc(t, func(args []reflect.Value) []reflect.Value {
+		values := make([]any, len(args))
+		for i, arg := range args {
+			values[i] = arg.Interface()
+		}
+		out := make([]reflect.Value, t.NumOut())
+		for i := range out {
+			out[i] = reflect.Zero(t.Out(i))
+		}
+		_, err := in.run(func() (any, error) {
+			result, err := in.callClosure(c, values, t.IsVariadic())
+			if err != nil || len(out) == 0 {
+				return nil, err
+			}
+			list, ok := result.(tuple)
+			if !ok {
+				list = tuple{result}
+			}
+			for i := range out {
+				v, err := in.convert(list[i], t.Out(i))
+				if err != nil {
+					return nil, fmt.Errorf("result of %s: %v", c.name, err)
+				}
+				out[i] = v
+			}
+			return nil, nil
+		})
+		if err != nil {
+			if n := len(out); n > 0 && t.Out(n-1) == errorType {
+				out[n-1] = reflect.ValueOf(&err).Elem()
+			} else if in.report != nil {
+				in.report(err)
+			}
+		}
+		return out
+	})
+}
+
+func (in *interpreter) callBuiltin(sc *scope, b builtin, call *ast.CallExpr) (any, error) {
+	switch b {
+	case "make", "new":
+		if len(call.Args) == 0 {
+			return nil, fmt.Errorf("missing argument to %s", b)
+		}
+		t, err := in.typeOf(sc, call.Args[0])
+		if err != nil {
+			return nil, err
+		}
+		if b == "new" {
+			return reflect.New(t).Interface(), nil
+		}
+		var sizes []int
+		for _, arg := range call.Args[1:] {
+			v, err := in.eval(sc, arg)
+			if err != nil {
+				return nil, err
+			}
+			rv := reflect.ValueOf(v)
+			if !isInt(rv.Kind()) || rv.Int() < 0 {
+				return nil, fmt.Errorf("invalid size %s in make", describe(v))
+			}
+			sizes = append(sizes, int(rv.Int()))
+		}
+		switch t.Kind() {
+		case reflect.Slice:
+			if len(sizes) == 0 {
+				return nil, fmt.Errorf("make(%s) needs a length", t)
+			}
+			capacity := sizes[0]
+			if len(sizes) > 1 {
+				capacity = sizes[1]
+			}
+			if capacity < sizes[0] {
+				return nil, fmt.Errorf("len larger than cap in make(%s)", t)
+			}
+			return reflect.MakeSlice(t, sizes[0], capacity).Interface(), nil
+		case reflect.Map:
+			return reflect.MakeMap(t).Interface(), nil
+		}
+		return nil, fmt.Errorf("cannot make %s", t)
+	}
+
+	var args []any
+	for _, arg := range call.Args {
+		v, err := in.eval(sc, arg)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, v)
+	}
+	need := func(n int) error {
+		if len(args) < n {
+			return fmt.Errorf("not enough arguments for %s", b)
+		}
+		return nil
+	}
+	switch b {
+	case "len", "cap":
+		if err := need(1); err != nil {
+			return nil, err
+		}
+		rv := reflect.ValueOf(args[0])
+		switch rv.Kind() {
+		case reflect.Invalid:
+			return 0, nil
+		case reflect.String, reflect.Map:
+			if b == "len" {
+				return rv.Len(), nil
+			}
+		case reflect.Slice, reflect.Array:
+			if b == "len" {
+				return rv.Len(), nil
+			}
+			return rv.Cap(), nil
+		}
+		return nil, fmt.Errorf("invalid argument %s for %s", describe(args[0]), b)
+	case "append":
+		if err := need(1); err != nil {
+			return nil, err
+		}
+		rv := reflect.ValueOf(args[0])
+		if rv.Kind() != reflect.Slice {
+			return nil, fmt.Errorf("first argument to append must be a slice, not %s", describe(args[0]))
+		}
+		if call.Ellipsis.IsValid() {
+			if len(args) != 2 {
+				return nil, fmt.Errorf("can only use ... with final argument")
+			}
+			more, err := in.convert(args[1], rv.Type())
+			if err != nil {
+				return nil, err
+			}
+			return reflect.AppendSlice(rv, more).Interface(), nil
+		}
+		for _, arg := range args[1:] {
+			v, err := in.convert(arg, rv.Type().Elem())
+			if err != nil {
+				return nil, err
+			}
+			rv = reflect.Append(rv, v)
+		}
+		return rv.Interface(), nil
+	case "delete":
+		if err := need(2); err != nil {
+			return nil, err
+		}
+		rv := reflect.ValueOf(args[0])
+		if rv.Kind() != reflect.Map {
+			return nil, fmt.Errorf("first argument to delete must be a map")
+		}
+		key, err := in.convert(args[1], rv.Type().Key())
+		if err != nil {
+			return nil, err
+		}
+		rv.SetMapIndex(key, reflect.Value{})
+		return nil, nil
+	case "copy":
+		if err := need(2); err != nil {
+			return nil, err
+		}
+		dst, src := reflect.ValueOf(args[0]), reflect.ValueOf(args[1])
+		if dst.Kind() != reflect.Slice || (src.Kind() != reflect.Slice && src.Kind() != reflect.String) {
+			return nil, fmt.Errorf("arguments to copy must be slices")
+		}
+		return reflect.Copy(dst, src), nil
+	case "panic":
+		if err := need(1); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("panic: %v", args[0])
+	case "min", "max":
+		if err := need(1); err != nil {
+			return nil, err
+		}
+		op := token.LSS
+		if b == "max" {
+			op = token.GTR
+		}
+		best := args[0]
+		for _, arg := range args[1:] {
+			better, err := binaryOp(op, arg, best)
+			if err != nil {
+				return nil, err
+			}
+			if better == true {
+				best = arg
+			}
+		}
+		return best, nil
+	}
+	return nil, fmt.Errorf("unsupported builtin %s", b)
+}
+
+// Types and values
+
+// typeOf resolves a type expression.
+func (in *interpreter) typeOf(sc *scope, expr ast.Expr) (reflect.Type, error) {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		if v := sc.lookup(e.Name); v != nil {
+			// A type of a dot import
+			if t, ok := v.value.(typeRef); ok {
+				return t.t, nil
+			}
+		} else if t, ok := universeTypes[e.Name]; ok {
+			return t, nil
+		}
+	case *ast.ParenExpr:
+		return in.typeOf(sc, e.X)
+	case *ast.SelectorExpr:
+		member, ok, err := in.packageMember(sc, e.X, e.Sel.Name)
+		if err != nil {
+			return nil, in.at(e, err)
+		}
+		if t, isType := member.(typeRef); ok && isType {
+			return t.t, nil
+		}
+	case *ast.StarExpr:
+		t, err := in.typeOf(sc, e.X)
+		if err != nil {
+			return nil, err
+		}
+		return reflect.PointerTo(t), nil
+	case *ast.ArrayType:
+		elem, err := in.typeOf(sc, e.Elt)
+		if err != nil {
+			return nil, err
+		}
+		if e.Len == nil {
+			return reflect.SliceOf(elem), nil
+		}
+		n, err := in.eval(sc, e.Len)
+		if err != nil {
+			return nil, err
+		}
+		length, ok := n.(int)
+		if !ok || length < 0 {
+			return nil, in.errorf(e.Len, "invalid array length %s", describe(n))
+		}
+		return reflect.ArrayOf(length, elem), nil
+	case *ast.MapType:
+		key, err := in.typeOf(sc, e.Key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := in.typeOf(sc, e.Value)
+		if err != nil {
+			return nil, err
+		}
+		return reflect.MapOf(key, value), nil
+	case *ast.InterfaceType:
+		if e.Methods == nil || len(e.Methods.List) == 0 {
+			return anyType, nil
+		}
+	case *ast.FuncType:
+		params, res, variadic, err := in.signature(sc, e)
+		if err != nil {
+			return nil, err
+		}
+		return reflect.FuncOf(params, res, variadic), nil
+	}
+	return nil, in.errorf(expr, "%s is not a type config.go can use", exprString(expr))
+}
+
+func exprString(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		return e.Name
+	case *ast.SelectorExpr:
+		return exprString(e.X) + "." + e.Sel.Name
+	}
+	return fmt.Sprintf("%T", expr)
+}
+
+// convert returns v as a value of type t, the way Go assigns it: untyped
+// constants of config.go, which are ints, float64s and strings here,
+// become any numeric or string type they fit, and closures become Go
+// functions.
+func (in *interpreter) convert(v any, t reflect.Type) (reflect.Value, error) {
+	switch x := v.(type) {
+	case nil:
+		switch t.Kind() {
+		case reflect.Interface, reflect.Pointer, reflect.Slice, reflect.Map, reflect.Func:
+			return reflect.Zero(t), nil
+		}
+		return reflect.Value{}, fmt.Errorf("cannot use nil as %s", t)
+	case *closure:
+		if t.Kind() == reflect.Func {
+			return in.goFunc(x, t), nil
+		}
+		return reflect.Value{}, fmt.Errorf("cannot use function %s as %s", x.name, t)
+	case typeRef, builtin, tuple:
+		return reflect.Value{}, fmt.Errorf("cannot use %s as a value", describe(v))
+	}
+
+	rv := reflect.ValueOf(v)
+	from := rv.Type()
+	switch {
+	case from == t:
+		return rv, nil
+	case from.AssignableTo(t):
+		return rv.Convert(t), nil
+	case from.PkgPath() == "" && isNumber(from.Kind()) && isNumber(t.Kind()):
+		if isFloat(from.Kind()) && !isFloat(t.Kind()) && rv.Float() != float64(int64(rv.Float())) {
+			return reflect.Value{}, fmt.Errorf("%v truncated to %s", v, t)
+		}
+		return rv.Convert(t), nil
+	case from.PkgPath() == "" && from.Kind() == reflect.String && t.Kind() == reflect.String:
+		return rv.Convert(t), nil
+	}
+	return reflect.Value{}, fmt.Errorf("cannot use %s as %s", describe(v), t)
+}
+
+// conversion converts v to t explicitly, as in T(v).
+func (in *interpreter) conversion(v any, t reflect.Type) (reflect.Value, error) {
+	if rv := reflect.ValueOf(v); rv.IsValid() && t.Kind() == reflect.String && isInt(rv.Kind()) {
+		return reflect.ValueOf(string(rune(rv.Int()))).Convert(t), nil
+	}
+	if rv := reflect.ValueOf(v); rv.IsValid() && rv.Type().ConvertibleTo(t) {
+		return rv.Convert(t), nil
+	}
+	return in.convert(v, t)
+}
+
+// hasType reports whether x, as an interface value, holds a t.
+func hasType(x any, t reflect.Type) bool {
+	if x == nil {
+		return false
+	}
+	if t.Kind() == reflect.Interface {
+		return reflect.TypeOf(x).Implements(t)
+	}
+	return reflect.TypeOf(x) == t
+}
+
+func describe(v any) string {
+	switch x := v.(type) {
+	case nil:
+		return "nil"
+	case *closure:
+		return "function " + x.name
+	case typeRef:
+		return "type " + x.t.String()
+	case builtin:
+		return "builtin " + string(x)
+	case tuple:
+		return fmt.Sprintf("%d values", len(x))
+	case string:
+		return strconv.Quote(x) + " (string)"
+	}
+	return fmt.Sprintf("%v (%T)", v, v)
+}
+
+func isInt(k reflect.Kind) bool {
+	return k >= reflect.Int && k <= reflect.Int64
+}
+
+func isUint(k reflect.Kind) bool {
+	return k >= reflect.Uint && k <= reflect.Uintptr
+}
+
+func isFloat(k reflect.Kind) bool {
+	return k == reflect.Float32 || k == reflect.Float64
+}
+
+func isNumber(k reflect.Kind) bool {
+	return isInt(k) || isUint(k) || isFloat(k)
+}
+
+// binaryOp applies op to x and y. Operands of different types are
+// matched the way untyped constants are: a plain int or float64 takes the
+// type of the other operand, such as time.Duration.
+func binaryOp(op token.Token, x, y any) (any, error) {
+	if op == token.EQL || op == token.NEQ {
+		if x == nil || y == nil {
+			eq := isNil(x) && isNil(y)
+			return eq == (op == token.EQL), nil
+		}
+	}
+	xv, yv := reflect.ValueOf(x), reflect.ValueOf(y)
+	if !xv.IsValid() || !yv.IsValid() {
+		return nil, fmt.Errorf("invalid operation: %s %s %s", describe(x), op, describe(y))
+	}
+
+	if op == token.SHL || op == token.SHR {
+		if !isInt(xv.Kind()) && !isUint(xv.Kind()) || !isInt(yv.Kind()) && !isUint(yv.Kind()) {
+			return nil, fmt.Errorf("invalid shift %s %s %s", describe(x), op, describe(y))
+		}
+		n := toUint(yv)
+		r := reflect.New(xv.Type()).Elem()
+		if isInt(xv.Kind()) {
+			if op == token.SHL {
+				r.SetInt(xv.Int() << n)
+			} else {
+				r.SetInt(xv.Int() >> n)
+			}
+		} else if op == token.SHL {
+			r.SetUint(xv.Uint() << n)
+		} else {
+			r.SetUint(xv.Uint() >> n)
+		}
+		return r.Interface(), nil
+	}
+
+	if xv.Type() != yv.Type() {
+		var err error
+		if xv, yv, err = unify(xv, yv); err != nil {
+			return nil, fmt.Errorf("invalid operation: %s %s %s (%v)", describe(x), op, describe(y), err)
+		}
+	}
+	t := xv.Type()
+	r := reflect.New(t).Elem()
+	invalid := fmt.Errorf("invalid operation: operator %s not defined on %s", op, describe(x))
+
+	switch k := t.Kind(); {
+	case isInt(k):
+		a, b := xv.Int(), yv.Int()
+		if cmp, ok := compare(op, a, b); ok {
+			return cmp, nil
+		}
+		if (op == token.QUO || op == token.REM) && b == 0 {
+			return nil, fmt.Errorf("integer divide by zero")
+		}
+		switch op {
+		case token.ADD:
+			r.SetInt(a + b)
+		case token.SUB:
+			r.SetInt(a - b)
+		case token.MUL:
+			r.SetInt(a * b)
+		case token.QUO:
+			r.SetInt(a / b)
+		case token.REM:
+			r.SetInt(a % b)
+		case token.AND:
+			r.SetInt(a & b)
+		case token.OR:
+			r.SetInt(a | b)
+		case token.XOR:
+			r.SetInt(a ^ b)
+		case token.AND_NOT:
+			r.SetInt(a &^ b)
+		default:
+			return nil, invalid
+		}
+		return r.Interface(), nil
+	case isUint(k):
+		a, b := xv.Uint(), yv.Uint()
+		if cmp, ok := compare(op, a, b); ok {
+			return cmp, nil
+		}
+		if (op == token.QUO || op == token.REM) && b == 0 {
+			return nil, fmt.Errorf("integer divide by zero")
+		}
+		switch op {
+		case token.ADD:
+			r.SetUint(a + b)
+		case token.SUB:
+			r.SetUint(a - b)
+		case token.MUL:
+			r.SetUint(a * b)
+		case token.QUO:
+			r.SetUint(a / b)
+		case token.REM:
+			r.SetUint(a % b)
+		case token.AND:
+			r.SetUint(a & b)
+		case token.OR:
+			r.SetUint(a | b)
+		case token.XOR:
+			r.SetUint(a ^ b)
+		case token.AND_NOT:
+			r.SetUint(a &^ b)
+		default:
+			return nil, invalid
+		}
+		return r.Interface(), nil
+	case isFloat(k):
+		a, b := xv.Float(), yv.Float()
+		if cmp, ok := compare(op, a, b); ok {
+			return cmp, nil
+		}
+		switch op {
+		case token.ADD:
+			r.SetFloat(a + b)
+		case token.SUB:
+			r.SetFloat(a - b)
+		case token.MUL:
+			r.SetFloat(a * b)
+		case token.QUO:
+			r.SetFloat(a / b)
+		default:
+			return nil, invalid
+		}
+		return r.Interface(), nil
+	case k == reflect.String:
+		a, b := xv.String(), yv.String()
+		if cmp, ok := compare(op, a, b); ok {
+			return cmp, nil
+		}
+		if op != token.ADD {
+			return nil, invalid
+		}
+		r.SetString(a + b)
+		return r.Interface(), nil
+	}
+
+	if op != token.EQL && op != token.NEQ {
+		return nil, invalid
+	}
+	if !t.Comparable() {
+		return nil, fmt.Errorf("invalid operation: %s cannot be compared", t)
+	}
+	return (xv.Interface() == yv.Interface()) == (op == token.EQL), nil
+}
+
+type ordered interface {
+	~int64 | ~uint64 | ~float64 | ~string
+}
+
+func compare[T ordered](op token.Token, a, b T) (bool, bool) {
+	switch op {
+	case token.EQL:
+		return a == b, true
+	case token.NEQ:
+		return a != b, true
+	case token.LSS:
+		return a < b, true
+	case token.LEQ:
+		return a <= b, true
+	case token.GTR:
+		return a > b, true
+	case token.GEQ:
+		return a >= b, true
+	}
+	return false, false
+}
+
+// unify converts the operand of a predeclared type to the type of the
+// other one.
+func unify(x, y reflect.Value) (reflect.Value, reflect.Value, error) {
+	fits := func(v reflect.Value, t reflect.Type) bool {
+		if v.Type().PkgPath() != "" {
+			return false
+		}
+		switch {
+		case isNumber(v.Kind()) && isNumber(t.Kind()):
+			return !isFloat(v.Kind()) || isFloat(t.Kind()) || v.Float() == float64(int64(v.Float()))
+		case v.Kind() == reflect.String && t.Kind() == reflect.String:
+			return true
+		}
+		return false
+	}
+	switch {
+	case isInt(x.Kind()) && isFloat(y.Kind()) && x.Type().PkgPath() == "" && y.Type().PkgPath() == "":
+		return x.Convert(y.Type()), y, nil
+	case isFloat(x.Kind()) && isInt(y.Kind()) && x.Type().PkgPath() == "" && y.Type().PkgPath() == "":
+		return x, y.Convert(x.Type()), nil
+	case fits(x, y.Type()):
+		return x.Convert(y.Type()), y, nil
+	case fits(y, x.Type()):
+		return x, y.Convert(x.Type()), nil
+	}
+	return x, y, fmt.Errorf("mismatched types %s and %s", x.Type(), y.Type())
+}
+
+func toUint(v reflect.Value) uint64 {
+	if isInt(v.Kind()) {
+		return uint64(v.Int())
+	}
+	return v.Uint()
+}
+
+func isNil(v any) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Map, reflect.Func, reflect.Interface, reflect.Chan:
+		return rv.IsNil()
+	}
+	return false
+}
@@ -0,0 +1,514 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/TakahashiShuuhei/edito/internal/api"
+)
+
+// interpCase is the body of a function returning a string, and what that
+// function returns when compiled by Go. TestInterpCasesMatchGo checks the
+// expectations against the Go toolchain.
+type interpCase struct {
+	name string
+	body string
+	want string
+}
+
+// interpImports are available to every case.
+var interpImports = []string{"errors", "fmt", "sort", "strconv", "strings", "time"}
+
+var interpCases = []interpCase{
+	// Declarations and assignments
+	{"iota", `
+		const (
+			a = iota * 10
+			b
+			_
+			d
+		)
+		const big = 1 << 40
+		return fmt.Sprint(a, b, d, big>>38)`, "0 10 30 4"},
+	{"untyped constants", `
+		const ratio = 3 / 2.0
+		x := 7
+		f := 1.5
+		return fmt.Sprint(ratio, x/2, x%3, -x/2, -x%3, f*2, 'a'+1, string(rune('a'+1)))`, "1.5 3 1 -3 -1 3 98b"},
+	{"swap and op assign", `
+		a, b := 1, 2
+		a, b = b, a
+		s := "x"
+		s += "y"
+		n := 10
+		n -= 3
+		n *= 2
+		n <<= 1
+		n |= 1
+		n &^= 8
+		return fmt.Sprint(a, b, s, n)`, "2 1xy21"},
+	{"conversions", `
+		n := 200
+		f := 2.9
+		return fmt.Sprint(int8(n), uint8(n+100), int(f), int(-f), float64(n)/3 > 66, string([]byte{104, 105}), []byte("ab"), []rune("日本"))`,
+		"-56 44 2 -2 truehi[97 98] [26085 26412]"},
+	{"shadowing", `
+		x := 1
+		if x := 2; x > 1 {
+			x++
+			_ = x
+		}
+		{
+			x := "inner"
+			_ = x
+		}
+		return fmt.Sprint(x)`, "1"},
+
+	// Control flow
+	{"switch", `
+		var out []string
+		for i := range 6 {
+			switch {
+			case i == 0:
+				out = append(out, "zero")
+			case i%2 == 0:
+				out = append(out, "even")
+			default:
+				out = append(out, "odd")
+			}
+			switch j := i * 2; j {
+			case 2, 4:
+				out = append(out, "small")
+			}
+		}
+		return strings.Join(out, ",")`, "zero,odd,small,even,small,odd,even,odd"},
+	{"fallthrough", `
+		var out []string
+		for _, n := range []int{1, 2, 3} {
+			switch n {
+			case 1:
+				out = append(out, "one")
+				fallthrough
+			case 2:
+				out = append(out, "two")
+				fallthrough
+			default:
+				out = append(out, "any")
+			case 4:
+				out = append(out, "four")
+			}
+		}
+		return strings.Join(out, ",")`, "one,two,any,two,any,any"},
+	{"type switch", `
+		var out []string
+		for _, x := range []any{1, "a", 2.5, nil, []int{1, 2}, errors.New("e"), int64(3)} {
+			switch v := x.(type) {
+			case nil:
+				out = append(out, "nil")
+			case int, int64:
+				out = append(out, fmt.Sprintf("integer %v", v))
+			case string:
+				out = append(out, "string "+v)
+			case []int:
+				out = append(out, fmt.Sprint("slice ", len(v)))
+			case error:
+				out = append(out, "error "+v.Error())
+			default:
+				out = append(out, fmt.Sprintf("other %T", v))
+			}
+		}
+		return strings.Join(out, ",")`, "integer 1,string a,other float64,nil,slice 2,error e,integer 3"},
+	{"labeled break and continue", `
+		var out []string
+	outer:
+		for i := 0; i < 4; i++ {
+			for j := 0; j < 4; j++ {
+				if j == 2 {
+					continue outer
+				}
+				if i == 3 {
+					break outer
+				}
+				out = append(out, fmt.Sprint(i, j))
+			}
+		}
+		n := 0
+	loop:
+		for {
+			switch {
+			case n > 3:
+				break loop
+			}
+			n++
+		}
+		return strings.Join(out, ",") + fmt.Sprint(" ", n)`, "0 0,0 1,1 0,1 1,2 0,2 1 4"},
+	{"range", `
+		total := 0
+		for i, v := range []int{5, 6, 7} {
+			total += i * v
+		}
+		var runes []string
+		for i, r := range "aé日" {
+			runes = append(runes, fmt.Sprint(i, string(r)))
+		}
+		m := map[string]int{"b": 2, "a": 1, "c": 3}
+		var keys []string
+		sum := 0
+		for k, v := range m {
+			keys = append(keys, k)
+			sum += v
+		}
+		sort.Strings(keys)
+		count := 0
+		for range 3 {
+			count++
+		}
+		return fmt.Sprint(total, runes, keys, sum, count)`, "20 [0a 1é 3日] [a b c] 6 3"},
+	{"loop variables per iteration", `
+		var fs []func() int
+		for i := 0; i < 3; i++ {
+			fs = append(fs, func() int { return i * i })
+		}
+		s := ""
+		for _, f := range fs {
+			s += strconv.Itoa(f())
+		}
+		return s`, "014"},
+
+	// Functions
+	{"named results", `
+		split := func(n int) (q, r int) {
+			q = n / 3
+			r = n % 3
+			return
+		}
+		var parse func(s string) (n int, err error)
+		parse = func(s string) (n int, err error) {
+			n, err = strconv.Atoi(s)
+			if err != nil {
+				return 0, fmt.Errorf("parse %q: %w", s, err)
+			}
+			return n * 2, nil
+		}
+		q, r := split(11)
+		n, err := parse("21")
+		_, bad := parse("x")
+		return fmt.Sprint(q, r, n, err, errors.Is(bad, strconv.ErrSyntax))`, "3 2 42 <nil> true"},
+	{"variadic", `
+		sum := func(prefix string, ns ...int) string {
+			total := 0
+			for _, n := range ns {
+				total += n
+			}
+			return fmt.Sprint(prefix, len(ns), total)
+		}
+		ns := []int{1, 2, 3}
+		parts := []any{"a", 1, true}
+		more := append([]int{0}, ns...)
+		return strings.Join([]string{sum("x"), sum("y", 4, 5), sum("z", ns...), fmt.Sprint(parts...), fmt.Sprint(more), strings.Join(append([]string{}, "p", "q"), "")}, " ")`,
+		"x0 0 y2 9 z3 6 a1 true [0 1 2 3] pq"},
+	{"closures and recursion", `
+		counter := func() func() int {
+			n := 0
+			return func() int {
+				n++
+				return n
+			}
+		}
+		next := counter()
+		next()
+		next()
+		var fib func(int) int
+		fib = func(n int) int {
+			if n < 2 {
+				return n
+			}
+			return fib(n-1) + fib(n-2)
+		}
+		return fmt.Sprint(next(), fib(15))`, "3 610"},
+	{"go callbacks", `
+		words := strings.FieldsFunc("a,b;;c", func(r rune) bool { return r == ',' || r == ';' })
+		upper := strings.Map(func(r rune) rune {
+			if r == 'b' {
+				return -1
+			}
+			return r - 32
+		}, "abc")
+		return fmt.Sprint(words, upper)`, "[a b c]AC"},
+
+	// Slices, arrays and maps
+	{"slice expressions", `
+		s := []int{0, 1, 2, 3, 4, 5}
+		a := s[1:3]
+		b := s[:2]
+		c := s[4:]
+		d := s[1:2:3]
+		d = append(d, 9)
+		e := append(d, 10)
+		e[0] = 7
+		str := "hello"
+		return fmt.Sprint(a, b, c, len(d), cap(d), s, e, str[1:3], str[3:])`,
+		"[1 9] [0 1] [4 5] 2 2 [0 1 9 3 4 5] [7 9 10]ello"},
+	{"index assignment", `
+		m := map[string]int{}
+		m["a"] = 1
+		m["a"] += 2
+		m["b"]++
+		s := make([]int, 3)
+		s[1] = 5
+		s[2] -= 1
+		s[0]++
+		grid := [][]string{{"a", "b"}, {"c"}}
+		grid[1][0] = "C"
+		nested := map[string][]int{}
+		nested["x"] = append(nested["x"], 1, 2)
+		nested["x"][0] = 9
+		counts := map[string]map[string]int{"outer": {}}
+		counts["outer"]["inner"] += 4
+		arr := [3]int{}
+		arr[2] = 1
+		v, ok := m["missing"]
+		delete(m, "b")
+		return fmt.Sprint(m, s, grid, nested, counts, arr, v, ok, len(m))`,
+		"map[a:3] [1 5 -1] [[a b] [C]] map[x:[9 2]] map[outer:map[inner:4]] [0 0 1] 0 false 1"},
+	{"composite literals", `
+		type_ := map[string][]string{"go": {"gofmt", "vet"}, "py": nil}
+		pts := [][2]int{{1, 2}, {3, 4}}
+		arr := [...]string{2: "c", 0: "a"}
+		ptr := &[]int{1, 2}
+		(*ptr)[0] = 5
+		return fmt.Sprint(len(type_["go"]), type_["py"] == nil, pts[1][0], len(arr), arr[2], *ptr)`, "2 true 3 3c[5 2]"},
+	{"builtins", `
+		s := make([]int, 2, 10)
+		dst := make([]int, 3)
+		n := copy(dst, []int{7, 8, 9, 10})
+		p := new(int)
+		*p = 4
+		*p += 1
+		var nilSlice []int
+		return fmt.Sprint(len(s), cap(s), n, dst, *p, min(3, 1, 2), max(2.5, 1), min("b", "a"), nilSlice == nil, len(nilSlice))`,
+		"2 10 3 [7 8 9] 5 1 2.5atrue 0"},
+
+	// Type assertions and interfaces
+	{"type assertions", `
+		var x any = "text"
+		s, ok := x.(string)
+		_, isInt := x.(int)
+		var err error = fmt.Errorf("wrapped: %w", errors.New("base"))
+		var stringer fmt.Stringer = time.Second
+		return fmt.Sprint(s, ok, isInt, errors.Unwrap(err), stringer.String())`, "texttrue false base1s"},
+
+	// Standard library values
+	{"time.Duration arithmetic", `
+		d := 2*time.Second + 500*time.Millisecond
+		n := 3
+		scaled := time.Duration(n) * time.Minute
+		half := d / 2
+		parsed, _ := time.ParseDuration("1h30m")
+		return fmt.Sprint(d, scaled, half, d/time.Millisecond, d.Seconds(), parsed.Minutes(), d > time.Second, scaled.String(), -d)`,
+		"2.5s 3m0s 1.25s 2.5µs 2.5 90 true3m0s-2.5s"},
+	{"strings and strconv", `
+		before, after, found := strings.Cut("key=value", "=")
+		f, _ := strconv.ParseFloat("2.50", 64)
+		q := strconv.Quote("a\"b")
+		return fmt.Sprint(before, after, found, strings.Repeat("ab", 2), f, q, strings.Fields(" x  y "), strings.TrimSuffix("main.go", ".go"))`,
+		`keyvaluetrueabab2.5"a\"b"[x y]main`},
+}
+
+// interpConfig wraps a case into a config.go that shows its result.
+func interpConfig(c interpCase) string {
+	var b strings.Builder
+	b.WriteString("package config\n\nimport (\n")
+	for _, path := range interpImports {
+		fmt.Fprintf(&b, "\t%q\n", path)
+	}
+	fmt.Fprintf(&b, "\n\t%q\n)\n\n", EditoPackage)
+	for _, path := range interpImports {
+		fmt.Fprintf(&b, "var _ = %s.%s\n", path, interpUse[path])
+	}
+	fmt.Fprintf(&b, "\nfunc result() string {%s\n}\n\nfunc init() {\n\tedito.ShowMessage(result())\n}\n", c.body)
+	return b.String()
+}
+
+// interpUse names a member of each of interpImports, so that the cases
+// need not use them all.
+var interpUse = map[string]string{
+	"errors":  "New",
+	"fmt":     "Sprint",
+	"sort":    "Ints",
+	"strconv": "Itoa",
+	"strings": "Join",
+	"time":    "Second",
+}
+
+func TestInterpCases(t *testing.T) {
+	for _, c := range interpCases {
+		t.Run(c.name, func(t *testing.T) {
+			r, err := loadConfig(t, interpConfig(c))
+			if err != nil {
+				t.Fatalf("LoadGoConfig failed: %v", err)
+			}
+			if len(r.messages) != 1 || r.messages[0] != c.want {
+				t.Errorf("got %q, want %q", r.messages, c.want)
+			}
+		})
+	}
+}
+
+// TestInterpCasesMatchGo compiles the cases with the Go toolchain, so
+// that the expectations of TestInterpCases are what Go itself produces.
+func TestInterpCasesMatchGo(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds a program with the go tool")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go tool not found")
+	}
+
+	var b strings.Builder
+	b.WriteString("package main\n\nimport (\n\t\"encoding/json\"\n\t\"os\"\n")
+	for _, path := range interpImports {
+		fmt.Fprintf(&b, "\t%q\n", path)
+	}
+	b.WriteString(")\n\n")
+	for _, path := range interpImports {
+		fmt.Fprintf(&b, "var _ = %s.%s\n", path, interpUse[path])
+	}
+	for i, c := range interpCases {
+		fmt.Fprintf(&b, "\nfunc case%d() string {%s\n}\n", i, c.body)
+	}
+	b.WriteString("\nfunc main() {\n\tjson.NewEncoder(os.Stdout).Encode([]string{\n")
+	for i := range interpCases {
+		fmt.Fprintf(&b, "\t\tcase%d(),\n", i)
+	}
+	b.WriteString("\t})\n}\n")
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module interpcases\n\ngo 1.22\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "main.go"), []byte(b.String()), 0644)
+	cmd := exec.Command(goTool, "run", ".")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOTOOLCHAIN=local", "GOFLAGS=")
+	out, err := cmd.Output()
+	if err != nil {
+		var stderr []byte
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			stderr = exitErr.Stderr
+		}
+		t.Fatalf("go run failed: %v\n%s", err, stderr)
+	}
+
+	var got []string
+	if err := json.Unmarshal(out, &got); err != nil {
+		t.Fatalf("decoding %s: %v", out, err)
+	}
+	for i, c := range interpCases {
+		if got[i] != c.want {
+			t.Errorf("%s: Go returns %q, the case expects %q", c.name, got[i], c.want)
+		}
+	}
+}
+
+// TestInterpRuntimeErrors checks that failures Go reports at run time
+// stop config.go with the position of the failing expression.
+func TestInterpRuntimeErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"index out of range", `s := []int{1}; _ = s[3]`, "config.go:12:21: index out of range"},
+		{"slice bounds", `s := "ab"; _ = s[1:5]`, "config.go:12:17: slice bounds out of range"},
+		{"nil map", `var m map[string]int; m["a"] = 1`, "config.go:12:24: assignment to entry in nil map"},
+		{"division by zero", `n := 0; _ = 1 / n`, "config.go:12:14: integer divide by zero"},
+		{"type assertion", `var x any = 1; _ = x.(string)`, "config.go:12:21: interface conversion"},
+		{"slicing an array", `a := [2]int{}; _ = a[:1]`, "config.go:12:21: cannot slice [0 0] ([2]int)"},
+		{"nil func", `var f func(); f()`, "config.go:12:16: call of nil function"},
+		{"panic", `panic("stop")`, "config.go:12:2: panic: stop"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := loadConfig(t, "package config\n\nimport (\n\t\"os\"\n\t\"github.com/TakahashiShuuhei/edito/pkg/edito\"\n)\n\nvar _ = os.Getenv\nvar _ = edito.APIVersion\n\nfunc init() {\n\t"+test.body+"\n}\n")
+			if err == nil || !strings.HasPrefix(err.Error(), test.want) {
+				t.Errorf("err = %v, want %q", err, test.want)
+			}
+		})
+	}
+}
+
+// TestInterpHooksAndCommands runs the closures config.go hands to the
+// editor after loading, as the editor does.
+func TestInterpHooksAndCommands(t *testing.T) {
+	var handlers []func(*api.HookContext)
+	var messages []string
+	commands := make(map[string]func([]string) error)
+	editor := api.New(api.Backend{
+		AddHook:     func(event string, handler func(ctx *api.HookContext)) { handlers = append(handlers, handler) },
+		ShowMessage: func(message string) { messages = append(messages, message) },
+		RegisterCommand: func(name, description string, handler func(args []string) error) {
+			commands[name] = handler
+		},
+	})
+	path := filepath.Join(t.TempDir(), "config.go")
+	os.WriteFile(path, []byte(`package config
+
+import (
+	"strings"
+
+	"github.com/TakahashiShuuhei/edito/pkg/edito"
+)
+
+var saves = map[string]int{}
+
+func init() {
+	edito.AddHook("before-save", func(ctx *edito.HookContext) {
+		name := ctx.Buffer.GetName()
+		saves[name]++
+		if strings.HasSuffix(name, ".lock") {
+			ctx.Cancel("locked: " + name)
+			return
+		}
+		if ctx.Command != "" {
+			edito.ShowMessage(ctx.Event + " by " + ctx.Command)
+		}
+	})
+	edito.RegisterCommand("saves", "", func(args []string) error {
+		for _, name := range args {
+			edito.ShowMessage(strings.Repeat("*", saves[name]))
+		}
+		return nil
+	})
+}
+`), 0644)
+	if err := LoadGoConfig(path, editor); err != nil {
+		t.Fatalf("LoadGoConfig failed: %v", err)
+	}
+	if len(handlers) != 1 {
+		t.Fatalf("%d hooks added, want 1", len(handlers))
+	}
+
+	locked := &api.HookContext{Event: "before-save", Buffer: testBuffer("a.lock")}
+	handlers[0](locked)
+	if cancelled, reason := locked.Cancelled(); !cancelled || reason != "locked: a.lock" {
+		t.Errorf("Cancelled = %v, %q, want the hook to cancel", cancelled, reason)
+	}
+	ctx := &api.HookContext{Event: "before-save", Buffer: testBuffer("main.go"), Command: "save-buffer"}
+	handlers[0](ctx)
+	handlers[0](ctx)
+	if cancelled, _ := ctx.Cancelled(); cancelled {
+		t.Error("main.go save was cancelled")
+	}
+	if err := commands["saves"]([]string{"main.go", "a.lock"}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"before-save by save-buffer", "before-save by save-buffer", "**", "*"}
+	if strings.Join(messages, "|") != strings.Join(want, "|") {
+		t.Errorf("messages = %q, want %q", messages, want)
+	}
+}
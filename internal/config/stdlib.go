@@ -0,0 +1,189 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TakahashiShuuhei/edito/internal/api"
+	"github.com/TakahashiShuuhei/edito/internal/buildstamp"
+)
+
+// EditoPackage is the import path of the API config.go is written
+// against.
+const EditoPackage = buildstamp.EditoModule + "/pkg/edito"
+
+// stdlib is the part of the standard library config.go may use. Only
+// functions without side effects on the system are listed, apart from
+// reading the environment.
+var stdlib = map[string]map[string]any{
+	"strings": {
+		"Compare":      strings.Compare,
+		"Contains":     strings.Contains,
+		"ContainsAny":  strings.ContainsAny,
+		"ContainsRune": strings.ContainsRune,
+		"Count":        strings.Count,
+		"Cut":          strings.Cut,
+		"CutPrefix":    strings.CutPrefix,
+		"CutSuffix":    strings.CutSuffix,
+		"EqualFold":    strings.EqualFold,
+		"Fields":       strings.Fields,
+		"FieldsFunc":   strings.FieldsFunc,
+		"HasPrefix":    strings.HasPrefix,
+		"HasSuffix":    strings.HasSuffix,
+		"Index":        strings.Index,
+		"IndexAny":     strings.IndexAny,
+		"IndexRune":    strings.IndexRune,
+		"Join":         strings.Join,
+		"LastIndex":    strings.LastIndex,
+		"Map":          strings.Map,
+		"Repeat":       strings.Repeat,
+		"Replace":      strings.Replace,
+		"ReplaceAll":   strings.ReplaceAll,
+		"Split":        strings.Split,
+		"SplitAfter":   strings.SplitAfter,
+		"SplitN":       strings.SplitN,
+		"ToLower":      strings.ToLower,
+		"ToTitle":      strings.ToTitle,
+		"ToUpper":      strings.ToUpper,
+		"Trim":         strings.Trim,
+		"TrimFunc":     strings.TrimFunc,
+		"TrimLeft":     strings.TrimLeft,
+		"TrimPrefix":   strings.TrimPrefix,
+		"TrimRight":    strings.TrimRight,
+		"TrimSpace":    strings.TrimSpace,
+		"TrimSuffix":   strings.TrimSuffix,
+	},
+	"strconv": {
+		"Atoi":        strconv.Atoi,
+		"FormatBool":  strconv.FormatBool,
+		"FormatFloat": strconv.FormatFloat,
+		"FormatInt":   strconv.FormatInt,
+		"Itoa":        strconv.Itoa,
+		"ParseBool":   strconv.ParseBool,
+		"ParseFloat":  strconv.ParseFloat,
+		"ParseInt":    strconv.ParseInt,
+		"ErrRange":    strconv.ErrRange,
+		"ErrSyntax":   strconv.ErrSyntax,
+		"Quote":       strconv.Quote,
+		"Unquote":     strconv.Unquote,
+	},
+	"path/filepath": {
+		"Abs":           filepath.Abs,
+		"Base":          filepath.Base,
+		"Clean":         filepath.Clean,
+		"Dir":           filepath.Dir,
+		"Ext":           filepath.Ext,
+		"FromSlash":     filepath.FromSlash,
+		"IsAbs":         filepath.IsAbs,
+		"Join":          filepath.Join,
+		"Match":         filepath.Match,
+		"Rel":           filepath.Rel,
+		"Separator":     filepath.Separator,
+		"Split":         filepath.Split,
+		"SplitList":     filepath.SplitList,
+		"ToSlash":       filepath.ToSlash,
+		"VolumeName":    filepath.VolumeName,
+		"ListSeparator": filepath.ListSeparator,
+	},
+	"path": {
+		"Base":  path.Base,
+		"Clean": path.Clean,
+		"Dir":   path.Dir,
+		"Ext":   path.Ext,
+		"IsAbs": path.IsAbs,
+		"Join":  path.Join,
+		"Match": path.Match,
+		"Split": path.Split,
+	},
+	"os": {
+		"ExpandEnv":   os.ExpandEnv,
+		"Getenv":      os.Getenv,
+		"Hostname":    os.Hostname,
+		"LookupEnv":   os.LookupEnv,
+		"UserHomeDir": os.UserHomeDir,
+	},
+	"fmt": {
+		"Errorf":   fmt.Errorf,
+		"Sprint":   fmt.Sprint,
+		"Sprintf":  fmt.Sprintf,
+		"Sprintln": fmt.Sprintln,
+		"Stringer": typeRef{reflect.TypeOf((*fmt.Stringer)(nil)).Elem()},
+	},
+	"errors": {
+		"Is":     errors.Is,
+		"New":    errors.New,
+		"Unwrap": errors.Unwrap,
+	},
+	"sort": {
+		"Ints":    sort.Ints,
+		"Strings": sort.Strings,
+	},
+	"runtime": {
+		"GOARCH": runtime.GOARCH,
+		"GOOS":   runtime.GOOS,
+	},
+	"time": {
+		"Duration":      typeRef{reflect.TypeOf(time.Duration(0))},
+		"Hour":          time.Hour,
+		"Microsecond":   time.Microsecond,
+		"Millisecond":   time.Millisecond,
+		"Minute":        time.Minute,
+		"Nanosecond":    time.Nanosecond,
+		"Now":           time.Now,
+		"ParseDuration": time.ParseDuration,
+		"Second":        time.Second,
+	},
+}
+
+// editoFuncs are the functions of pkg/edito, which config.go calls on the
+// editor it is loaded into.
+var editoFuncs = []string{
+	"AddHook",
+	"AddRegistry",
+	"BindKey",
+	"ExecuteCommand",
+	"GetCurrentBuffer",
+	"GetOption",
+	"InstallPlugin",
+	"LoadPlugin",
+	"OnOptionChange",
+	"Post",
+	"RegisterCommand",
+	"RegisterHook",
+	"RunAfter",
+	"RunEvery",
+	"RunWhenIdle",
+	"SetLocalOption",
+	"SetOption",
+	"ShowMessage",
+}
+
+// editoPackage returns the members of pkg/edito bound to editor.
+func editoPackage(editor *api.EditorAPI) map[string]any {
+	members := map[string]any{
+		"APIVersion":   api.APIVersion,
+		"Buffer":       typeRef{reflect.TypeOf((*api.Buffer)(nil)).Elem()},
+		"HookContext":  typeRef{reflect.TypeOf(api.HookContext{})},
+		"Option":       typeRef{reflect.TypeOf(api.Option{})},
+		"OptionBool":   api.OptionBool,
+		"OptionChange": typeRef{reflect.TypeOf(api.OptionChange{})},
+		"OptionFloat":  api.OptionFloat,
+		"OptionInt":    api.OptionInt,
+		"OptionString": api.OptionString,
+		"OptionType":   typeRef{reflect.TypeOf(api.OptionType(""))},
+	}
+	rv := reflect.ValueOf(editor)
+	for _, name := range editoFuncs {
+		members[name] = rv.MethodByName(name).Interface()
+	}
+	return members
+}
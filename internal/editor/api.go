@@ -0,0 +1,274 @@
+package editor
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/TakahashiShuuhei/edito/internal/api"
+	"github.com/TakahashiShuuhei/edito/internal/buffer"
+)
+
+// ownerConfig tags commands and key bindings made by the user's config.go.
+// Plugins use their own name; the core uses "".
+const ownerConfig = "config"
+
+// setupAPI publishes the editor to plugins and configuration through
+// the global api.Editor instance.
+func (e *Editor) setupAPI() {
+	api.Initialize(e.newAPI(ownerConfig))
+}
+
+// newAPI returns an EditorAPI whose registrations are tagged with owner,
+// so that they can be listed by origin and removed together.
+func (e *Editor) newAPI(owner string) *api.EditorAPI {
+	return api.New(api.Backend{
+		BindKey: func(key, command string) {
+			e.bindKeyToCommand(owner, key, command)
+		},
+		BindKeyFunc: func(key string, handler func()) {
+			e.registerKeyBinding(owner, key, func() {
+				e.callPlugin(owner, "key "+key, func() error {
+					handler()
+					return nil
+				})
+			})
+		},
+		LoadPlugin: e.loadPluginFromConfig,
+		SetOption: func(key string, value any) {
+			e.setOption(owner, key, value)
+		},
+		DefineOption: func(opt api.Option) error {
+			return e.defineOption(owner, opt)
+		},
+		GetOption:      e.optionValue,
+		SetLocalOption: e.setLocalOption,
+		OnOptionChange: func(name string, fn func(change api.OptionChange)) {
+			e.watchOption(owner, name, fn)
+		},
+		RegisterHook: func(event string, handler func()) {
+			e.addHook(owner, event, func(ctx *api.HookContext) {
+				e.callPlugin(owner, event+" hook", func() error {
+					handler()
+					return nil
+				})
+			})
+		},
+		AddHook: func(event string, handler func(ctx *api.HookContext)) {
+			e.addHook(owner, event, func(ctx *api.HookContext) {
+				e.callPlugin(owner, event+" hook", func() error {
+					handler(ctx)
+					return nil
+				})
+			})
+		},
+		RegisterCommand: func(name, description string, handler func(args []string) error) {
+			e.registerCommand(owner, name, description, func(args []string) error {
+				return e.callPlugin(owner, "command "+name, func() error {
+					return handler(args)
+				})
+			})
+		},
+		ExecuteCommand:   e.runCommand,
+		GetCurrentBuffer: e.currentBufferHandle,
+		ListBuffers:      e.bufferHandles,
+		FindFile:         e.findFileHandle,
+		ShowMessage:      e.showMessage,
+		Prompt: func(prompt string, callback func(input string)) {
+			e.prompt(prompt, func(input string) {
+				e.callPlugin(owner, "prompt callback", func() error {
+					callback(input)
+					return nil
+				})
+			})
+		},
+		AddModeLineSegment: func(name string, render func() string) {
+			e.addModeLineSegment(owner, name, render)
+		},
+		InstallPlugin: e.installPluginFromConfig,
+		AddRegistry:   e.addRegistryFromConfig,
+		ReadFile: func(path string) ([]byte, error) {
+			return e.pluginReadFile(owner, path)
+		},
+		WriteFile: func(path string, data []byte) error {
+			return e.pluginWriteFile(owner, path, data)
+		},
+		Exec: func(name string, args []string, options api.ExecOptions) (string, error) {
+			return e.pluginExec(owner, name, args, options)
+		},
+		HTTPRequest: func(method, url string, body []byte) ([]byte, error) {
+			return e.pluginHTTPRequest(owner, method, url, body)
+		},
+		RunAfter: func(delay time.Duration, fn func()) func() {
+			return e.loop.RunAfter(owner, delay, e.pluginTimerFunc(owner, "timer", fn)).Stop
+		},
+		RunEvery: func(interval time.Duration, fn func()) func() {
+			return e.loop.RunEvery(owner, interval, e.pluginTimerFunc(owner, "timer", fn)).Stop
+		},
+		RunWhenIdle: func(delay time.Duration, fn func()) func() {
+			return e.loop.RunWhenIdle(owner, delay, e.pluginTimerFunc(owner, "idle timer", fn)).Stop
+		},
+		Post: func(fn func()) {
+			e.loop.Post(e.pluginTimerFunc(owner, "posted function", fn))
+		},
+	})
+}
+
+// pluginTimerFunc wraps fn, registered by owner, for the event loop. It
+// is dropped if owner is unloaded before it runs.
+func (e *Editor) pluginTimerFunc(owner, operation string, fn func()) func() {
+	return func() {
+		if owner != ownerConfig && e.pluginManager != nil && !e.pluginManager.IsLoaded(owner) {
+			return
+		}
+		e.callPlugin(owner, operation, func() error {
+			fn()
+			return nil
+		})
+	}
+}
+
+// callPlugin runs code registered by owner. Plugin code runs under the
+// plugin manager's panic recovery and time limit; config.go code runs as
+// is.
+func (e *Editor) callPlugin(owner, operation string, fn func() error) error {
+	if owner == ownerConfig || e.pluginManager == nil {
+		return fn()
+	}
+	return e.pluginManager.Call(owner, operation, fn)
+}
+
+func (e *Editor) registerCommand(owner, name, description string, handler func(args []string) error) {
+	e.commandRegistry.RegisterOwned(owner, name, description, handler)
+}
+
+// registerKeyBinding binds key for owner. Bindings made before the key map
+// exists, i.e. while config.go is loading, are applied by setupKeyBindings.
+func (e *Editor) registerKeyBinding(owner, key string, handler func()) {
+	if e.keyMap == nil {
+		e.pendingKeyBindings = append(e.pendingKeyBindings, pendingKeyBinding{owner, key, handler})
+		return
+	}
+	if err := e.keyMap.BindString(key, owner, handler); err != nil {
+		e.showMessage(fmt.Sprintf("Cannot bind %q: %v", key, err))
+	}
+}
+
+func (e *Editor) bindKeyToCommand(owner, key, command string) {
+	e.registerKeyBinding(owner, key, func() {
+		if err := e.runCommand(command, []string{}); err != nil {
+			e.showMessage(fmt.Sprintf("Command failed: %v", err))
+		}
+	})
+}
+
+// removeOwned drops every command, key binding, hook and timer registered
+// by owner.
+func (e *Editor) removeOwned(owner string) {
+	e.loop.RemoveOwner(owner)
+	e.commandRegistry.RemoveOwner(owner)
+	e.hooks.RemoveOwner(owner)
+	e.keyMap.RemoveOwner(owner)
+	e.options.RemoveOwner(owner)
+	for _, name := range e.ownedSegments[owner] {
+		e.modeLine.Unregister(name)
+	}
+	delete(e.ownedSegments, owner)
+}
+
+func (e *Editor) prompt(prompt string, callback func(input string)) {
+	e.readMinibuffer(prompt, "", func(input string) error {
+		callback(input)
+		return nil
+	})
+}
+
+func (e *Editor) currentBufferHandle() api.Buffer {
+	buf := e.bufferManager.GetCurrentBuffer()
+	if buf == nil {
+		return nil
+	}
+	return &bufferHandle{editor: e, buf: buf}
+}
+
+func (e *Editor) bufferHandles() []api.Buffer {
+	buffers := e.bufferManager.ListBuffers()
+	handles := make([]api.Buffer, len(buffers))
+	for i, buf := range buffers {
+		handles[i] = &bufferHandle{editor: e, buf: buf}
+	}
+	return handles
+}
+
+func (e *Editor) findFileHandle(filename string) (api.Buffer, error) {
+	if err := e.findFile(filename); err != nil {
+		return nil, err
+	}
+	return e.currentBufferHandle(), nil
+}
+
+// bufferHandle implements api.Buffer on top of a buffer.Buffer.
+type bufferHandle struct {
+	editor *Editor
+	buf    *buffer.Buffer
+}
+
+func (h *bufferHandle) GetName() string {
+	return h.buf.Name
+}
+
+func (h *bufferHandle) GetLines() []string {
+	return append([]string(nil), h.buf.Lines...)
+}
+
+func (h *bufferHandle) SetLines(lines []string) {
+	if h.buf.ReadOnly {
+		return
+	}
+	if len(lines) == 0 {
+		lines = []string{""}
+	}
+	h.buf.Lines = append([]string(nil), lines...)
+	h.buf.Modified = true
+	h.buf.MoveCursor(0, 0)
+	h.adjustOffset()
+}
+
+func (h *bufferHandle) GetCursorPosition() (int, int) {
+	return h.buf.CursorX, h.buf.CursorY
+}
+
+func (h *bufferHandle) SetCursorPosition(x, y int) {
+	h.buf.CursorX = x
+	h.buf.CursorY = y
+	h.buf.MoveCursor(0, 0)
+	h.adjustOffset()
+}
+
+func (h *bufferHandle) InsertText(text string) {
+	for _, ch := range text {
+		if ch == '\n' {
+			h.buf.InsertNewline()
+		} else {
+			h.buf.InsertChar(ch)
+		}
+	}
+	h.adjustOffset()
+}
+
+func (h *bufferHandle) GetFilename() string {
+	return h.buf.Filename
+}
+
+func (h *bufferHandle) IsModified() bool {
+	return h.buf.Modified
+}
+
+func (h *bufferHandle) Save() error {
+	return h.editor.saveBuffer(h.buf)
+}
+
+func (h *bufferHandle) adjustOffset() {
+	if h.editor.bufferManager.GetCurrentBuffer() == h.buf {
+		h.editor.adjustOffset()
+	}
+}
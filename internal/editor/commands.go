@@ -2,10 +2,12 @@ package editor
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
-	
-	"github.com/nsf/termbox-go"
+
+	"github.com/TakahashiShuuhei/edito/internal/hook"
 	"github.com/TakahashiShuuhei/edito/internal/minibuffer"
 )
 
@@ -31,26 +33,22 @@ func (e *Editor) setupCommands() {
 	
 	e.commandRegistry.Register("find-file", "Open a file", func(args []string) error {
 		if len(args) == 0 {
-			return fmt.Errorf("filename required")
+			e.promptFindFile()
+			return nil
 		}
-		_, err := e.bufferManager.NewBuffer(args[0])
-		return err
+		return e.findFile(args[0])
 	})
 	
 	e.commandRegistry.Register("list-buffers", "List all open buffers", func(args []string) error {
 		return e.showBufferList()
 	})
 	
-	e.commandRegistry.RegisterInteractive("goto-line", "Go to line number", func(promptFunc func(prompt string) (string, error)) error {
-		input, err := promptFunc("Go to line: ")
-		if err != nil {
-			return err
-		}
-		lineNum, err := strconv.Atoi(strings.TrimSpace(input))
-		if err != nil {
-			return fmt.Errorf("invalid line number: %s", input)
+	e.commandRegistry.Register("goto-line", "Go to line number", func(args []string) error {
+		if len(args) == 0 {
+			e.readMinibuffer("Go to line: ", minibuffer.HistoryGotoLine, e.gotoLineInput)
+			return nil
 		}
-		return e.gotoLine(lineNum)
+		return e.gotoLineInput(args[0])
 	})
 	
 	e.commandRegistry.Register("quit", "Quit editor", func(args []string) error {
@@ -65,20 +63,41 @@ func (e *Editor) setupCommands() {
 	e.commandRegistry.Register("list-commands", "List all available commands", func(args []string) error {
 		return e.showCommandList()
 	})
+	
+	e.setupPluginCommands()
+	e.setupOptionCommands()
 }
 
 func (e *Editor) activateCommandMode() {
 	commands := e.commandRegistry.ListCommands()
-	completions := make([]minibuffer.Completion, len(commands))
+	completions := make([]minibuffer.Completion, 0, len(commands))
+	
+	// Recently used commands come first, most recent at the top.
+	seen := make(map[string]bool)
+	for _, entry := range e.history.Entries(minibuffer.HistoryCommand) {
+		fields := strings.Fields(entry)
+		if len(fields) == 0 || seen[fields[0]] {
+			continue
+		}
+		if cmd := e.commandRegistry.GetCommand(fields[0]); cmd != nil {
+			seen[cmd.Name] = true
+			completions = append(completions, minibuffer.Completion{
+				Text:        cmd.Name,
+				Description: cmd.Description,
+			})
+		}
+	}
 	
-	for i, cmd := range commands {
-		completions[i] = minibuffer.Completion{
+	for _, cmd := range commands {
+		if seen[cmd.Name] {
+			continue
+		}
+		completions = append(completions, minibuffer.Completion{
 			Text:        cmd.Name,
 			Description: cmd.Description,
-		}
+		})
 	}
 	
-	e.minibuffer.SetCompletions(completions)
 	e.minibuffer.Activate(minibuffer.ModeCommand, "M-x (or F1/C-Space) ", func(input string) error {
 		parts := strings.Fields(input)
 		if len(parts) == 0 {
@@ -95,22 +114,27 @@ func (e *Editor) activateCommandMode() {
 			return nil
 		}
 		
-		// Execute interactive command
-		if cmd.Interactive != nil {
-			err := e.commandRegistry.ExecuteInteractive(commandName, e.promptUser)
-			if err != nil {
-				e.showMessage(fmt.Sprintf("Command failed: %v", err))
-			}
-			return nil
-		}
-		
-		// Execute regular command
-		err := e.commandRegistry.Execute(commandName, args)
+		err := e.runCommand(commandName, args)
 		if err != nil {
 			e.showMessage(fmt.Sprintf("Command failed: %v", err))
 		}
 		return nil
 	})
+	e.minibuffer.UseHistory(minibuffer.HistoryCommand)
+	e.minibuffer.RequireMatch()
+	e.minibuffer.SetCompletions(completions)
+}
+
+// readMinibuffer prompts for a line of input recorded in the given history
+// category and passes it to handler. Errors are shown in the echo area.
+func (e *Editor) readMinibuffer(prompt, history string, handler func(input string) error) {
+	e.minibuffer.Activate(minibuffer.ModeInput, prompt, func(input string) error {
+		if err := handler(input); err != nil {
+			e.showMessage(fmt.Sprintf("Command failed: %v", err))
+		}
+		return nil
+	})
+	e.minibuffer.UseHistory(history)
 }
 
 func (e *Editor) promptUser(prompt string) (string, error) {
@@ -122,24 +146,6 @@ func (e *Editor) promptUser(prompt string) (string, error) {
 	return "", fmt.Errorf("interactive input not yet fully implemented")
 }
 
-func (e *Editor) handleCtrlX() {
-}
-
-func (e *Editor) bindConfigKey(key, cmd string) {
-	// Convert config key notation to termbox events
-	// For now, we'll support basic bindings
-	switch key {
-	case "C-x C-s":
-		e.keyMap.BindKey(termbox.KeyCtrlS, func() {
-			e.commandRegistry.Execute(cmd, []string{})
-		})
-	case "C-x C-c":
-		e.keyMap.BindKey(termbox.KeyCtrlQ, func() {
-			e.commandRegistry.Execute(cmd, []string{})
-		})
-	}
-}
-
 func (e *Editor) moveToLineBeginning() {
 	buf := e.bufferManager.GetCurrentBuffer()
 	if buf != nil {
@@ -155,9 +161,12 @@ func (e *Editor) moveToLineEnd() {
 }
 
 func (e *Editor) closeBuffer(id string) error {
+	buf := e.bufferManager.GetBuffer(id)
 	if !e.bufferManager.CloseBuffer(id) {
 		return fmt.Errorf("buffer not found: %s", id)
 	}
+	e.runHook(e.hookContext(hook.BufferKilled, buf))
+	e.bufferChanged(buf)
 	return nil
 }
 
@@ -165,7 +174,9 @@ func (e *Editor) switchToBufferByName(name string) error {
 	buffers := e.bufferManager.ListBuffers()
 	for _, buf := range buffers {
 		if buf.Name == name {
+			prev := e.bufferManager.GetCurrentBuffer()
 			e.bufferManager.SetCurrentBuffer(buf.ID)
+			e.bufferChanged(prev)
 			return nil
 		}
 	}
@@ -176,6 +187,70 @@ func (e *Editor) showBufferList() error {
 	return nil
 }
 
+// promptFindFile reads a path starting in the current buffer's directory,
+// completing directory entries as the user types.
+func (e *Editor) promptFindFile() {
+	source := minibuffer.NewFileSource()
+	
+	dir, err := os.Getwd()
+	if buf := e.bufferManager.GetCurrentBuffer(); buf != nil && buf.Filename != "" {
+		if abs, absErr := filepath.Abs(buf.Filename); absErr == nil {
+			dir, err = filepath.Dir(abs), nil
+		}
+	}
+	initial := ""
+	if err == nil {
+		initial = source.Abbreviate(dir)
+		if !strings.HasSuffix(initial, "/") {
+			initial += "/"
+		}
+	}
+	
+	e.readMinibuffer("Find file: ", minibuffer.HistoryFile, func(input string) error {
+		path := source.Expand(minibuffer.ResolveFileInput(input))
+		if path == "" {
+			return fmt.Errorf("filename required")
+		}
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			e.confirm(fmt.Sprintf("File %s does not exist, create it? (y or n) ", path), func() {
+				if err := e.findFile(path); err != nil {
+					e.showMessage(fmt.Sprintf("Command failed: %v", err))
+				}
+			})
+			return nil
+		}
+		return e.findFile(path)
+	})
+	e.minibuffer.SetInput(initial)
+	e.minibuffer.SetSource(source)
+}
+
+// confirm asks a yes-or-no question and calls onYes if the answer is yes.
+func (e *Editor) confirm(prompt string, onYes func()) {
+	e.minibuffer.Activate(minibuffer.ModeInput, prompt, func(input string) error {
+		switch strings.ToLower(strings.TrimSpace(input)) {
+		case "y", "yes":
+			onYes()
+		}
+		return nil
+	})
+}
+
+func (e *Editor) findFile(filename string) error {
+	if stat, err := os.Stat(filename); err == nil && stat.IsDir() {
+		return fmt.Errorf("%s is a directory", filename)
+	}
+	return e.openFile(filename)
+}
+
+func (e *Editor) gotoLineInput(input string) error {
+	lineNum, err := strconv.Atoi(strings.TrimSpace(input))
+	if err != nil {
+		return fmt.Errorf("invalid line number: %s", input)
+	}
+	return e.gotoLine(lineNum)
+}
+
 func (e *Editor) gotoLine(lineNum int) error {
 	buf := e.bufferManager.GetCurrentBuffer()
 	if buf == nil {
@@ -202,8 +277,8 @@ func (e *Editor) showHelp() error {
 		"Edito - Emacs-like CLI Editor",
 		"",
 		"Key Bindings:",
-		"  Ctrl+Q     - Quit editor",
-		"  Ctrl+S     - Save current buffer", 
+		"  Ctrl+Q     - Quit editor (or C-x C-c)",
+		"  Ctrl+S     - Save current buffer (or C-x C-s)", 
 		"  Ctrl+A     - Move to line beginning",
 		"  Ctrl+E     - Move to line end",
 		"  Ctrl+P     - Previous line (or Up arrow)",
@@ -223,7 +298,6 @@ func (e *Editor) showHelp() error {
 		"  quit           - Quit editor",
 		"",
 		"Type any command name in M-x to execute it.",
-		"Press any key to close this help.",
 	}
 	
 	return e.showHelpBuffer("*Help*", helpContent)
@@ -236,21 +310,23 @@ func (e *Editor) showCommandList() error {
 	helpContent = append(helpContent, "Available Commands:")
 	helpContent = append(helpContent, "")
 	for _, cmd := range commands {
-		helpContent = append(helpContent, fmt.Sprintf("  %-15s - %s", cmd.Name, cmd.Description))
+		helpContent = append(helpContent, fmt.Sprintf("  %-20s %-12s %s", cmd.Name, commandOrigin(cmd.Owner), cmd.Description))
 	}
-	helpContent = append(helpContent, "")
-	helpContent = append(helpContent, "Press any key to close this list.")
 	
 	return e.showHelpBuffer("*Commands*", helpContent)
 }
 
-func (e *Editor) showHelpBuffer(name string, content []string) error {
-	// For now, show as a simple message
-	// In future, this could create a temporary read-only buffer
-	message := strings.Join(content, " | ")
-	if len(message) > 100 {
-		message = message[:100] + "... (Type 'help' or 'list-commands' for full info)"
+// commandOrigin describes who registered a command or key binding.
+func commandOrigin(owner string) string {
+	if owner == "" {
+		return "built-in"
 	}
-	e.showMessage(message)
+	return owner
+}
+
+func (e *Editor) showHelpBuffer(name string, content []string) error {
+	prev := e.bufferManager.GetCurrentBuffer()
+	e.bufferManager.NewSpecialBuffer(name, content)
+	e.bufferChanged(prev)
 	return nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,111 @@
+package editor
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/TakahashiShuuhei/edito/internal/eventloop"
+	"github.com/TakahashiShuuhei/edito/internal/plugin"
+)
+
+// developInterval is how often the source of a plugin being developed is
+// checked for changes.
+const developInterval = time.Second
+
+// developedPlugin is a plugin built from its source directory and rebuilt
+// whenever the source changes.
+type developedPlugin struct {
+	dir      string
+	digest   string
+	building bool
+	watch    *eventloop.Timer
+}
+
+func (e *Editor) setupDevelopCommands() {
+	e.commandRegistry.Register("develop-plugin", "Build a plugin from its source directory and rebuild it whenever the source changes", func(args []string) error {
+		if len(args) >= 2 {
+			return e.developPlugin(args[0], args[1])
+		}
+		return e.withPluginName(args, "Develop plugin: ", e.pluginManager.ListPlugins(), func(name string) error {
+			if dir, ok := e.pluginSources[name]; ok {
+				return e.developPlugin(name, dir)
+			}
+			e.promptPluginSource(name, func(dir string) error {
+				return e.developPlugin(name, dir)
+			})
+			return nil
+		})
+	})
+
+	e.commandRegistry.Register("stop-developing-plugin", "Stop rebuilding a plugin when its source changes", func(args []string) error {
+		return e.withPluginName(args, "Stop developing plugin: ", e.developedPlugins(), e.stopDeveloping)
+	})
+}
+
+// developPlugin builds the plugin in dir in the background, loads it in
+// place of the running copy, and does so again whenever the source in
+// dir changes.
+func (e *Editor) developPlugin(name, dir string) error {
+	if d, ok := e.developing[name]; ok {
+		d.watch.Stop()
+	}
+	d := &developedPlugin{dir: dir}
+	d.watch = e.loop.RunEvery("", developInterval, func() {
+		if d.building {
+			return
+		}
+		if digest, err := plugin.SourceDigest(d.dir); err == nil && digest != d.digest {
+			e.rebuildDeveloped(name, d)
+		}
+	})
+	e.developing[name] = d
+	e.rebuildDeveloped(name, d)
+	return nil
+}
+
+// rebuildDeveloped runs the go tool on another goroutine and loads the
+// result on the editor goroutine.
+func (e *Editor) rebuildDeveloped(name string, d *developedPlugin) {
+	// Changes made during the build are picked up by the next check.
+	d.digest, _ = plugin.SourceDigest(d.dir)
+	d.building = true
+	e.showMessage(fmt.Sprintf("Building plugin %s from %s...", name, d.dir))
+	outDir := e.config.CacheFile("dev-plugins")
+	go func() {
+		path, err := plugin.BuildDev(d.dir, outDir, name)
+		e.post(func() {
+			d.building = false
+			if e.developing[name] != d {
+				return
+			}
+			if err == nil {
+				err = e.loadDevBuild(name, d.dir, path)
+			}
+			if err != nil {
+				e.recordPluginError(fmt.Errorf("plugin %s: %v", name, err))
+				e.showMessage(fmt.Sprintf("Failed to build plugin %s; see M-x plugin-errors", name))
+			}
+		})
+	}()
+}
+
+func (e *Editor) stopDeveloping(name string) error {
+	d, ok := e.developing[name]
+	if !ok {
+		return fmt.Errorf("plugin %s is not being developed", name)
+	}
+	d.watch.Stop()
+	delete(e.developing, name)
+	e.showMessage(fmt.Sprintf("Stopped watching the source of %s", name))
+	return nil
+}
+
+func (e *Editor) developedPlugins() []string {
+	names := make([]string, 0, len(e.developing))
+	for name := range e.developing {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -1,20 +1,31 @@
 package editor
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/nsf/termbox-go"
-	"github.com/TakahashiShuuhei/edito/internal/api"
 	"github.com/TakahashiShuuhei/edito/internal/buffer"
+	"github.com/TakahashiShuuhei/edito/internal/buildstamp"
 	"github.com/TakahashiShuuhei/edito/internal/command"
 	"github.com/TakahashiShuuhei/edito/internal/config"
+	"github.com/TakahashiShuuhei/edito/internal/eventloop"
+	"github.com/TakahashiShuuhei/edito/internal/hook"
 	"github.com/TakahashiShuuhei/edito/internal/keybinding"
+	"github.com/TakahashiShuuhei/edito/internal/killring"
 	"github.com/TakahashiShuuhei/edito/internal/minibuffer"
+	"github.com/TakahashiShuuhei/edito/internal/modeline"
+	"github.com/TakahashiShuuhei/edito/internal/option"
 	"github.com/TakahashiShuuhei/edito/internal/package_manager"
+	"github.com/TakahashiShuuhei/edito/internal/pkgstate"
 	"github.com/TakahashiShuuhei/edito/internal/plugin"
 )
 
@@ -24,26 +35,65 @@ type Editor struct {
 	quit           bool
 	keyMap         *keybinding.KeyMap
 	pluginManager  *plugin.Manager
+	pluginState    *plugin.State
+	pluginSources  map[string]string
+	pluginErrors   []string
+	grants         *plugin.Grants
+	grantQueue     []string
+	grantWaiting   bool
 	packageManager *package_manager.Manager
 	bufferManager  *buffer.Manager
 	commandRegistry *command.Registry
+	hooks          *hook.Bus
 	minibuffer     *minibuffer.Minibuffer
+	history        *minibuffer.History
+	killRing       *killring.KillRing
+	modeLine       *modeline.ModeLine
+	ownedSegments  map[string][]string
 	config         *config.Config
-	configSettings map[string]any
+	options        *option.Registry
+	configErrors   []string
+	loading        bool
 	configPlugins  []string
-	configKeyBindings map[string]string
+	pendingKeyBindings []pendingKeyBinding
 	autoInstaller  *plugin.AutoInstaller
 	configPluginSpecs []plugin.PluginSpec
+	configRegistries []configRegistry
+	installedDB    *pkgstate.DB
+	packageRows    []packageRow
+	modeKeyMaps    map[string]*keybinding.KeyMap
+	upgrading      bool
+	developing     map[string]*developedPlugin
+	installCancel  context.CancelFunc
 	statusMessage  string
-	messageTimeout int
+	messageTimer   *eventloop.Timer
+	idleTimer      *eventloop.Timer
+	loop           *eventloop.Loop
+}
+
+// configRegistry is a package registry added by config.go.
+type configRegistry struct {
+	location string
+	priority int
+}
+
+// pendingKeyBinding is a key binding requested before the key map exists.
+type pendingKeyBinding struct {
+	owner   string
+	key     string
+	handler func()
 }
 
 func New() *Editor {
 	e := &Editor{
-		configSettings: make(map[string]any),
+		options: option.New(),
+		loading: true,
 		configPlugins: make([]string, 0),
-		configKeyBindings: make(map[string]string),
 		configPluginSpecs: make([]plugin.PluginSpec, 0),
+		pluginSources: make(map[string]string),
+		ownedSegments: make(map[string][]string),
+		modeKeyMaps: make(map[string]*keybinding.KeyMap),
+		developing: make(map[string]*developedPlugin),
 	}
 	
 	var err error
@@ -53,23 +103,33 @@ func New() *Editor {
 		os.Exit(1)
 	}
 	
-	err = e.loadGoConfig()
-	if err != nil {
-		fmt.Printf("Failed to load Go config file: %v\n", err)
-		os.Exit(1)
-	}
-	
 	e.bufferManager = buffer.NewManager()
 	e.commandRegistry = command.NewRegistry()
+	e.hooks = hook.New()
+	e.loop = eventloop.New()
 	e.minibuffer = minibuffer.New()
+	e.setupAPI()
+	e.setupOptions()
+	
+	if err := e.loadGoConfig(); err != nil {
+		e.configErrors = append(e.configErrors, err.Error())
+	}
+	
+	e.killRing = killring.New(killring.DefaultSize)
+	e.minibuffer.SetKillRing(e.killRing)
+	e.setupHistory()
+	e.setupModeLine()
+	
+	e.setupIdleHook()
 	
 	e.setupCommands()
 	e.setupKeyBindings()
 	e.setupPluginSystem()
 	e.setupAutoInstaller()
-	e.setupAPI()
 	e.checkAndInstallPlugins()
 	
+	e.loading = false
+	e.reportConfigErrors()
 	return e
 }
 
@@ -77,105 +137,107 @@ func (e *Editor) setupPluginSystem() {
 	pluginDir := e.config.PluginDir()
 	
 	e.pluginManager = plugin.NewManager()
-	e.packageManager = package_manager.NewManager(
-		"https://packages.edito.dev",
-		pluginDir,
-	)
-	
-	api := &plugin.API{
-		RegisterCommand:   e.registerCommand,
-		RegisterKeyBinding: e.registerKeyBinding,
-		GetCurrentLine:    e.getCurrentLine,
-		SetCurrentLine:    e.setCurrentLine,
-		GetCursorPosition: e.getCursorPosition,
-		SetCursorPosition: e.setCursorPosition,
-		InsertText:        e.insertText,
-		DeleteText:        e.deleteText,
-		ShowMessage:       e.showMessage,
-	}
-	
-	e.pluginManager.SetAPI(api)
+	e.packageManager = package_manager.NewManager(pluginDir)
+	e.packageManager.SetCacheDir(e.config.RegistryCacheDir())
+	if len(e.configRegistries) == 0 {
+		e.packageManager.AddRegistry(package_manager.DefaultRegistry, 0)
+	}
+	for _, r := range e.configRegistries {
+		e.packageManager.AddRegistry(r.location, r.priority)
+	}
+	installed, err := pkgstate.Open(e.config.InstalledFile())
+	if err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+	e.installedDB = installed
+	e.packageManager.SetInstalled(installed)
+	if keys, err := package_manager.LoadTrustedKeys(e.config.TrustedKeysFile()); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	} else {
+		e.packageManager.SetTrustedKeys(keys)
+	}
+	
+	e.pluginManager.SetAPIFactory(e.newAPI)
+	e.pluginManager.SetUnloadHook(e.removeOwned)
+	e.pluginManager.SetFailureHandler(e.pluginFailed)
+	
+	e.pluginState = plugin.NewState(e.config.PluginStateFile())
+	if err := e.pluginState.Load(); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+	e.grants = plugin.NewGrants(e.config.PluginGrantsFile())
+	if err := e.grants.Load(); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
 	e.loadInstalledPlugins()
+	e.requestGrants()
 }
 
-func (e *Editor) registerCommand(name string, handler func(args []string) error) {
-}
-
-func (e *Editor) registerKeyBinding(key string, handler func()) {
-}
+// messageDuration is how long a message stays in the echo area.
+const messageDuration = 5 * time.Second
 
-func (e *Editor) getCurrentLine() string {
-	buf := e.bufferManager.GetCurrentBuffer()
-	if buf != nil && buf.CursorY < len(buf.Lines) {
-		return buf.Lines[buf.CursorY]
+func (e *Editor) showMessage(message string) {
+	e.statusMessage = message
+	if e.messageTimer != nil {
+		e.messageTimer.Stop()
 	}
-	return ""
+	e.messageTimer = e.loop.RunAfter("", messageDuration, func() {
+		e.statusMessage = ""
+	})
 }
 
-func (e *Editor) setCurrentLine(line string) {
-	buf := e.bufferManager.GetCurrentBuffer()
-	if buf != nil && buf.CursorY < len(buf.Lines) {
-		buf.Lines[buf.CursorY] = line
+func (e *Editor) setupHistory() {
+	size, _ := e.options.Get("history-length").(int)
+	e.history = minibuffer.NewHistory(e.config.HistoryFile(), size)
+	e.options.Watch("", "history-length", func(c option.Change) {
+		e.history.SetMaxSize(c.New.(int))
+	})
+	if err := e.history.Load(); err != nil {
+		fmt.Printf("Warning: %v\n", err)
 	}
+	e.minibuffer.SetHistory(e.history)
 }
 
-func (e *Editor) getCursorPosition() (int, int) {
-	buf := e.bufferManager.GetCurrentBuffer()
-	if buf != nil {
-		return buf.CursorX, buf.CursorY
+func (e *Editor) setupModeLine() {
+	e.modeLine = modeline.New()
+	if e.options.IsSet("mode-line-format") {
+		e.modeLine.SetFormat(modeline.ParseFormat(e.options.Get("mode-line-format").(string)))
 	}
-	return 0, 0
+	e.options.Watch("", "mode-line-format", func(c option.Change) {
+		e.modeLine.SetFormat(modeline.ParseFormat(c.New.(string)))
+	})
 }
 
-func (e *Editor) setCursorPosition(x, y int) {
-	buf := e.bufferManager.GetCurrentBuffer()
-	if buf != nil {
-		buf.CursorX = x
-		buf.CursorY = y
-		e.adjustOffset()
-	}
+func (e *Editor) addModeLineSegment(owner, name string, render func() string) {
+	e.modeLine.Register(name, func(ctx modeline.Context) string {
+		var text string
+		e.callPlugin(owner, "mode line segment "+name, func() error {
+			text = render()
+			return nil
+		})
+		return text
+	})
+	e.ownedSegments[owner] = append(e.ownedSegments[owner], name)
 }
 
-func (e *Editor) insertText(text string) {
-	for _, ch := range text {
-		e.insertChar(ch)
+// loadGoConfig interprets config.go, so that starting edito needs no Go
+// toolchain. Only a config.go using Go the interpreter does not support
+// is compiled into config.so and loaded as a plugin.
+func (e *Editor) loadGoConfig() error {
+	err := config.LoadGoConfig(e.config.GoConfigFile(), e.newAPI(ownerConfig))
+	var unsupported *config.UnsupportedError
+	if !errors.As(err, &unsupported) {
+		return err
 	}
-}
-
-func (e *Editor) deleteText(start, end int) {
-}
-
-func (e *Editor) showMessage(message string) {
-	e.statusMessage = message
-	e.messageTimeout = 100 // Show message for ~5 seconds (assuming 20fps)
-}
 
-func (e *Editor) loadGoConfig() error {
-	// Check if config needs to be rebuilt
 	if e.shouldRebuildConfig() {
 		if err := e.rebuildConfig(); err != nil {
-			fmt.Printf("Warning: failed to rebuild config: %v\n", err)
+			return fmt.Errorf("%v, and compiling it failed: %v", unsupported, err)
 		}
 	}
-	
-	// Try to load and parse Go source first
-	api := config.EditorAPI{
-		BindKey: e.bindKeyFromConfig,
-		LoadPlugin: e.loadPluginFromConfig,
-		SetOption: e.setOptionFromConfig,
-		RegisterHook: e.registerHookFromConfig,
-		InstallPlugin: e.installPluginFromConfig,
-	}
-	
-	err := config.LoadGoConfig(e.config.GoConfigFile(), api)
-	if err != nil {
-		// If Go config fails, try compiled config as fallback
-		compiledErr := config.LoadCompiledConfig(e.config.CompiledConfigFile())
-		if compiledErr != nil {
-			return fmt.Errorf("failed to load Go config: %v, and compiled config: %v", err, compiledErr)
-		}
+	if err := config.LoadCompiledConfig(e.config.CompiledConfigFile()); err != nil {
+		return fmt.Errorf("%v, and compiled config: %v", unsupported, err)
 	}
-	
 	return nil
 }
 
@@ -195,6 +257,12 @@ func (e *Editor) shouldRebuildConfig() bool {
 		return true // config.so doesn't exist, need to build
 	}
 	
+	// Rebuild a config.so built for another Go or edito version
+	if err := buildstamp.Check(compiledFile); err != nil {
+		fmt.Printf("%v\n", err)
+		return true
+	}
+	
 	// Check if config.go is newer than config.so
 	return configStat.ModTime().After(compiledStat.ModTime())
 }
@@ -248,9 +316,22 @@ var ConfigInit = func() {
 		return fmt.Errorf("failed to write main.go: %v", err)
 	}
 	
+	// Use the Go version and the dependency versions of this edito, so
+	// that config.so can be loaded
+	env := append(os.Environ(), buildstamp.BuildEnv()...)
+	if running, ok := buildstamp.Running(); ok && len(running.Requirements()) > 0 {
+		cmd = exec.Command("go", append([]string{"get"}, running.Requirements()...)...)
+		cmd.Dir = tempDir
+		cmd.Env = env
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to pin dependencies: %v\nOutput: %s", err, string(output))
+		}
+	}
+	
 	// Run go mod tidy to resolve dependencies
 	cmd = exec.Command("go", "mod", "tidy")
 	cmd.Dir = tempDir
+	cmd.Env = env
 	if err := cmd.Run(); err != nil {
 		return fmt.Errorf("failed to run go mod tidy: %v", err)
 	}
@@ -258,14 +339,14 @@ var ConfigInit = func() {
 	// Build as plugin
 	cmd = exec.Command("go", "build", "-buildmode=plugin", "-o", outputFile, ".")
 	cmd.Dir = tempDir
-	cmd.Env = append(os.Environ(), "CGO_ENABLED=1")
+	cmd.Env = env
 	
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("build failed: %v\nOutput: %s", err, string(output))
 	}
 	
-	return nil
+	return buildstamp.Write(outputFile)
 }
 
 func (e *Editor) processConfigContent(content string) string {
@@ -284,26 +365,26 @@ func (e *Editor) processConfigContent(content string) string {
 	return strings.Join(result, "\n")
 }
 
-func (e *Editor) bindKeyFromConfig(key, command string) {
-	e.configKeyBindings[key] = command
-	e.bindConfigKey(key, command)
-}
-
 func (e *Editor) loadPluginFromConfig(name string) {
 	e.configPlugins = append(e.configPlugins, name)
 }
 
 func (e *Editor) setOptionFromConfig(key string, value any) {
-	e.configSettings[key] = value
-}
-
-func (e *Editor) registerHookFromConfig(event string, handler func()) {
+	e.setOption(ownerConfig, key, value)
 }
 
 func (e *Editor) setupAutoInstaller() {
 	pluginDir := e.config.PluginDir()
 	cacheDir := e.config.CacheDir
 	e.autoInstaller = plugin.NewAutoInstaller(pluginDir, cacheDir)
+	
+	lock, err := pkgstate.Open(e.config.LockFile())
+	if err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+	e.autoInstaller.SetState(e.installedDB, lock)
+	// Installs run in the background and report in the echo area.
+	e.autoInstaller.SetOutput(io.Discard)
 }
 
 func (e *Editor) installPluginFromConfig(name, repository, version string) {
@@ -312,26 +393,12 @@ func (e *Editor) installPluginFromConfig(name, repository, version string) {
 		Repository: repository,
 		Version:    version,
 	}
-	e.configPluginSpecs = append(e.configPluginSpecs, spec)
-}
-
-func (e *Editor) checkAndInstallPlugins() {
-	if e.autoInstaller == nil || len(e.configPluginSpecs) == 0 {
-		return
-	}
-	
-	if err := e.autoInstaller.CheckAndInstallPlugins(e.configPluginSpecs); err != nil {
-		fmt.Printf("Warning: error during plugin installation: %v\n", err)
-	}
+	// Local directories are relative to config.go
+	e.configPluginSpecs = append(e.configPluginSpecs, spec.WithBaseDir(e.config.ConfigDir))
 }
 
-func (e *Editor) setupAPI() {
-	apiInstance := &api.EditorAPI{}
-	
-	// Set up the API functions
-	// This allows plugins and config to call back into the editor
-	
-	api.Initialize(apiInstance)
+func (e *Editor) addRegistryFromConfig(location string, priority int) {
+	e.configRegistries = append(e.configRegistries, configRegistry{location, priority})
 }
 
 func (e *Editor) loadInstalledPlugins() {
@@ -340,17 +407,49 @@ func (e *Editor) loadInstalledPlugins() {
 		return
 	}
 	
-	pluginDir := e.config.PluginDir()
-	
-	for _, name := range installed {
-		pluginPath := filepath.Join(pluginDir, name+".so")
-		e.pluginManager.LoadPlugin(pluginPath)
+	var candidates []plugin.Candidate
+	seen := make(map[string]bool)
+	for _, name := range append(installed, e.configPlugins...) {
+		if seen[name] || e.pluginState.IsDisabled(name) || e.pluginManager.IsLoaded(name) {
+			continue
+		}
+		seen[name] = true
+		
+		c, err := e.openPlugin(name)
+		if err != nil {
+			switch {
+			case !os.IsNotExist(err):
+				e.recordPluginError(e.explainLoadError(name, err))
+			case slices.Contains(e.configPlugins, name) && !e.isConfigSpec(name):
+				e.recordPluginError(fmt.Errorf("plugin %s is loaded by config.go but not installed; install it with M-x list-packages or edito pkg install %s", name, name))
+			}
+			continue
+		}
+		candidates = append(candidates, c)
 	}
 	
-	for _, pluginName := range e.configPlugins {
-		pluginPath := filepath.Join(pluginDir, pluginName+".so")
-		e.pluginManager.LoadPlugin(pluginPath)
+	for _, err := range e.pluginManager.LoadAll(candidates) {
+		e.recordPluginError(err)
+	}
+}
+
+// explainLoadError adds what to do about a plugin built for another Go or
+// edito version to err.
+func (e *Editor) explainLoadError(name string, err error) error {
+	var mismatch *buildstamp.MismatchError
+	if !errors.As(err, &mismatch) {
+		return err
+	}
+	if e.isConfigSpec(name) {
+		return fmt.Errorf("%v; rebuilding it in the background", err)
 	}
+	return fmt.Errorf("%v; install a build for this edito, or remove it with edito pkg uninstall %s", err, name)
+}
+
+// isConfigSpec reports whether config.go installs name from source.
+func (e *Editor) isConfigSpec(name string) bool {
+	_, ok := e.specFor(name)
+	return ok
 }
 
 func (e *Editor) setupKeyBindings() {
@@ -369,9 +468,11 @@ func (e *Editor) setupKeyBindings() {
 	e.keyMap.BindKey(termbox.KeyCtrlF, func() { e.moveCursor(1, 0) })
 	e.keyMap.BindKey(termbox.KeyCtrlB, func() { e.moveCursor(-1, 0) })
 	e.keyMap.BindKey(termbox.KeyEnter, func() { e.insertNewline() })
+	e.keyMap.BindKey(termbox.KeyTab, func() { e.insertTab() })
 	e.keyMap.BindKey(termbox.KeyBackspace, func() { e.deleteChar() })
 	e.keyMap.BindKey(termbox.KeyBackspace2, func() { e.deleteChar() })
-	e.keyMap.BindKey(termbox.KeyCtrlX, func() { e.handleCtrlX() })
+	e.keyMap.BindString("C-x C-s", "", func() { e.saveCurrentBuffer() })
+	e.keyMap.BindString("C-x C-c", "", func() { e.quit = true })
 	
 	// M-x (Alt+x) for command mode
 	e.keyMap.Bind(0, 'x', termbox.ModAlt, func() { e.activateCommandMode() })
@@ -382,14 +483,33 @@ func (e *Editor) setupKeyBindings() {
 	// Ctrl+Space as alternative to M-x
 	e.keyMap.BindKey(termbox.KeyCtrlSpace, func() { e.activateCommandMode() })
 	
-	for key, cmd := range e.configKeyBindings {
-		e.bindConfigKey(key, cmd)
+	for _, b := range e.pendingKeyBindings {
+		e.registerKeyBinding(b.owner, b.key, b.handler)
 	}
+	e.pendingKeyBindings = nil
 }
 
 func (e *Editor) LoadFile(filename string) error {
-	_, err := e.bufferManager.NewBuffer(filename)
-	return err
+	return e.openFile(filename)
+}
+
+// openFile visits filename in a new buffer and runs the mode-enabled,
+// file-opened and buffer-switched hooks.
+func (e *Editor) openFile(filename string) error {
+	prev := e.bufferManager.GetCurrentBuffer()
+	buf, err := e.bufferManager.NewBuffer(filename)
+	if err != nil {
+		return err
+	}
+	
+	ctx := e.hookContext(hook.ModeEnabled, buf)
+	ctx.Mode = buf.MajorMode
+	e.runHook(ctx)
+	if filename != "" {
+		e.runHook(e.hookContext(hook.FileOpened, buf))
+	}
+	e.bufferChanged(prev)
+	return nil
 }
 
 func (e *Editor) Run() error {
@@ -398,21 +518,56 @@ func (e *Editor) Run() error {
 		return err
 	}
 	defer termbox.Close()
+	// termbox reports Esc followed by a key as that key with ModAlt only
+	// in InputAlt mode; otherwise M- bindings arrive as Esc and a letter.
+	termbox.SetInputMode(termbox.InputEsc | termbox.InputAlt)
 
 	e.width, e.height = termbox.Size()
 	
+	// PollEvent blocks, so terminal events are read on their own
+	// goroutine and merged with timers and posted functions here.
+	events := make(chan termbox.Event)
+	go func() {
+		for {
+			events <- termbox.PollEvent()
+		}
+	}()
+	
+	e.runPosted()
 	e.draw()
 	
 	for !e.quit {
-		ev := termbox.PollEvent()
-		if ev.Type == termbox.EventKey {
-			e.handleKey(ev)
-		} else if ev.Type == termbox.EventResize {
-			e.width, e.height = termbox.Size()
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if wait, ok := e.loop.Next(time.Now()); ok {
+			timer = time.NewTimer(wait)
+			timeout = timer.C
+		}
+		
+		select {
+		case ev := <-events:
+			switch ev.Type {
+			case termbox.EventKey:
+				e.loop.Input(time.Now())
+				e.handleKey(ev)
+			case termbox.EventResize:
+				e.width, e.height = termbox.Size()
+			}
+		case <-e.loop.Wake():
+		case <-timeout:
+		}
+		if timer != nil {
+			timer.Stop()
 		}
+		e.runPosted()
+		e.resumeGrant()
 		e.draw()
 	}
 	
+	e.runHook(e.hookContext(hook.EditorExit, e.bufferManager.GetCurrentBuffer()))
+	if e.installCancel != nil {
+		e.installCancel()
+	}
 	return nil
 }
 
@@ -423,6 +578,10 @@ func (e *Editor) handleKey(ev termbox.Event) {
 		}
 	}
 	
+	if e.handleModeKey(ev) {
+		return
+	}
+	
 	if !e.keyMap.Handle(ev) {
 		if ev.Ch != 0 {
 			e.insertChar(ev.Ch)
@@ -491,7 +650,18 @@ func (e *Editor) saveCurrentBuffer() error {
 	if buf == nil {
 		return fmt.Errorf("no current buffer")
 	}
-	return buf.SaveFile()
+	return e.saveBuffer(buf)
+}
+
+func (e *Editor) saveBuffer(buf *buffer.Buffer) error {
+	if err := e.runHook(e.hookContext(hook.BeforeSave, buf)); err != nil {
+		return fmt.Errorf("save cancelled: %v", err)
+	}
+	if err := buf.SaveFile(); err != nil {
+		return err
+	}
+	e.runHook(e.hookContext(hook.AfterSave, buf))
+	return nil
 }
 
 func (e *Editor) draw() {
@@ -502,15 +672,11 @@ func (e *Editor) draw() {
 		e.drawBuffer(buf)
 	}
 	
-	e.drawStatusLine()
-	e.minibuffer.Draw(e.width, e.height-1)
-	
-	// Handle message timeout
-	if e.messageTimeout > 0 {
-		e.messageTimeout--
-	}
-	if e.messageTimeout <= 0 {
-		e.statusMessage = ""
+	e.drawModeLine()
+	if e.minibuffer.IsActive() {
+		e.minibuffer.Draw(e.width, e.height-1)
+	} else {
+		e.drawEchoArea()
 	}
 	
 	termbox.Flush()
@@ -539,33 +705,40 @@ func (e *Editor) drawBuffer(buf *buffer.Buffer) {
 	}
 }
 
-func (e *Editor) drawStatusLine() {
-	var statusLine string
+func (e *Editor) drawModeLine() {
+	statusLine := e.modeLine.Render(modeline.Context{
+		Buffer: e.bufferManager.GetCurrentBuffer(),
+		Height: e.height - 2,
+	})
 	
-	// Show message if available, otherwise show buffer info
-	if e.statusMessage != "" {
-		statusLine = e.statusMessage
-	} else {
-		buf := e.bufferManager.GetCurrentBuffer()
-		if buf != nil {
-			modified := ""
-			if buf.Modified {
-				modified = "*"
-			}
-			statusLine = fmt.Sprintf("%s%s - Line %d, Col %d", buf.Name, modified, buf.CursorY+1, buf.CursorX+1)
-		} else {
-			statusLine = "No buffer"
+	x := 0
+	for _, ch := range statusLine {
+		if x >= e.width {
+			break
 		}
+		termbox.SetCell(x, e.height-2, ch, termbox.ColorBlack, termbox.ColorWhite)
+		x++
 	}
 	
-	for i, ch := range statusLine {
-		if i >= e.width {
-			break
-		}
-		termbox.SetCell(i, e.height-2, ch, termbox.ColorBlack, termbox.ColorWhite)
+	for ; x < e.width; x++ {
+		termbox.SetCell(x, e.height-2, ' ', termbox.ColorBlack, termbox.ColorWhite)
+	}
+}
+
+// drawEchoArea shows the current message on the last line while the
+// minibuffer is not in use.
+func (e *Editor) drawEchoArea() {
+	message := e.statusMessage
+	if pending := e.keyMap.Pending(); pending != "" {
+		message = pending + "-"
 	}
 	
-	for i := len(statusLine); i < e.width; i++ {
-		termbox.SetCell(i, e.height-2, ' ', termbox.ColorBlack, termbox.ColorWhite)
+	x := 0
+	for _, ch := range message {
+		if x >= e.width {
+			break
+		}
+		termbox.SetCell(x, e.height-1, ch, termbox.ColorDefault, termbox.ColorDefault)
+		x++
 	}
-}
\ No newline at end of file
+}
@@ -1,19 +1,41 @@
 package editor
 
 import (
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
 	"path/filepath"
+	"strings"
+	"time"
+	
+	"github.com/nsf/termbox-go"
+	"github.com/TakahashiShuuhei/edito/internal/api"
+	"github.com/TakahashiShuuhei/edito/internal/capability"
+	"github.com/TakahashiShuuhei/edito/internal/minibuffer"
+	"github.com/TakahashiShuuhei/edito/internal/package_manager"
+	"github.com/TakahashiShuuhei/edito/internal/plugin"
 )
 
+// newTestEditor creates an editor whose XDG directories are temporary, so
+// that tests neither read the user's config.go nor write to their data.
+func newTestEditor(t *testing.T) *Editor {
+	t.Helper()
+	for _, v := range []string{"XDG_CONFIG_HOME", "XDG_DATA_HOME", "XDG_CACHE_HOME"} {
+		t.Setenv(v, t.TempDir())
+	}
+	return New()
+}
+
 func TestNew(t *testing.T) {
-	e := New()
+	e := newTestEditor(t)
 	if e == nil {
 		t.Fatal("New() returned nil")
 	}
 	
-	if e.lines == nil {
-		t.Error("lines slice not initialized")
+	if e.bufferManager == nil {
+		t.Error("bufferManager not initialized")
 	}
 	
 	if e.keyMap == nil {
@@ -30,47 +52,50 @@ func TestNew(t *testing.T) {
 }
 
 func TestLoadFile(t *testing.T) {
-	tmpFile := filepath.Join(os.TempDir(), "test_edito.txt")
+	tmpFile := filepath.Join(t.TempDir(), "test_edito.txt")
 	content := "line1\nline2\nline3"
 	
 	if err := os.WriteFile(tmpFile, []byte(content), 0644); err != nil {
 		t.Fatalf("Failed to create test file: %v", err)
 	}
-	defer os.Remove(tmpFile)
 	
-	e := New()
+	e := newTestEditor(t)
 	if err := e.LoadFile(tmpFile); err != nil {
 		t.Fatalf("LoadFile failed: %v", err)
 	}
 	
+	lines := e.bufferManager.GetCurrentBuffer().Lines
 	expectedLines := []string{"line1", "line2", "line3"}
-	if len(e.lines) != len(expectedLines) {
-		t.Errorf("Expected %d lines, got %d", len(expectedLines), len(e.lines))
+	if len(lines) != len(expectedLines) {
+		t.Errorf("Expected %d lines, got %d", len(expectedLines), len(lines))
 	}
 	
 	for i, expected := range expectedLines {
-		if i >= len(e.lines) || e.lines[i] != expected {
-			t.Errorf("Line %d: expected %q, got %q", i, expected, e.lines[i])
+		if i >= len(lines) || lines[i] != expected {
+			t.Errorf("Line %d: expected %q, got %q", i, expected, lines[i])
 		}
 	}
 }
 
 func TestLoadNonExistentFile(t *testing.T) {
-	e := New()
-	if err := e.LoadFile("nonexistent.txt"); err != nil {
+	e := newTestEditor(t)
+	if err := e.LoadFile(filepath.Join(t.TempDir(), "nonexistent.txt")); err != nil {
 		t.Errorf("LoadFile should create empty file for non-existent file, got error: %v", err)
 	}
 	
-	if len(e.lines) != 1 || e.lines[0] != "" {
+	lines := e.bufferManager.GetCurrentBuffer().Lines
+	if len(lines) != 1 || lines[0] != "" {
 		t.Error("LoadFile should create one empty line for non-existent file")
 	}
 }
 
 func TestInsertChar(t *testing.T) {
-	e := New()
-	e.lines = []string{"hello"}
-	e.cursorX = 5
-	e.cursorY = 0
+	e := newTestEditor(t)
+	e.LoadFile("")
+	buf := e.bufferManager.GetCurrentBuffer()
+	buf.Lines = []string{"hello"}
+	buf.CursorX = 5
+	buf.CursorY = 0
 	
 	e.insertChar(' ')
 	e.insertChar('w')
@@ -80,33 +105,515 @@ func TestInsertChar(t *testing.T) {
 	e.insertChar('d')
 	
 	expected := "hello world"
-	if e.lines[0] != expected {
-		t.Errorf("Expected %q, got %q", expected, e.lines[0])
+	if buf.Lines[0] != expected {
+		t.Errorf("Expected %q, got %q", expected, buf.Lines[0])
 	}
 	
-	if e.cursorX != 11 {
-		t.Errorf("Expected cursor at position 11, got %d", e.cursorX)
+	if buf.CursorX != 11 {
+		t.Errorf("Expected cursor at position 11, got %d", buf.CursorX)
 	}
 }
 
 func TestMoveCursor(t *testing.T) {
-	e := New()
-	e.lines = []string{"hello", "world"}
-	e.cursorX = 0
-	e.cursorY = 0
+	e := newTestEditor(t)
+	e.LoadFile("")
+	buf := e.bufferManager.GetCurrentBuffer()
+	buf.Lines = []string{"hello", "world"}
+	buf.CursorX = 0
+	buf.CursorY = 0
 	
 	e.moveCursor(2, 0)
-	if e.cursorX != 2 || e.cursorY != 0 {
-		t.Errorf("Expected cursor at (2,0), got (%d,%d)", e.cursorX, e.cursorY)
+	if buf.CursorX != 2 || buf.CursorY != 0 {
+		t.Errorf("Expected cursor at (2,0), got (%d,%d)", buf.CursorX, buf.CursorY)
 	}
 	
 	e.moveCursor(0, 1)
-	if e.cursorX != 2 || e.cursorY != 1 {
-		t.Errorf("Expected cursor at (2,1), got (%d,%d)", e.cursorX, e.cursorY)
+	if buf.CursorX != 2 || buf.CursorY != 1 {
+		t.Errorf("Expected cursor at (2,1), got (%d,%d)", buf.CursorX, buf.CursorY)
 	}
 	
 	e.moveCursor(-10, -10)
-	if e.cursorX != 0 || e.cursorY != 0 {
-		t.Errorf("Cursor should be bounded at (0,0), got (%d,%d)", e.cursorX, e.cursorY)
+	if buf.CursorX != 0 || buf.CursorY != 0 {
+		t.Errorf("Cursor should be bounded at (0,0), got (%d,%d)", buf.CursorX, buf.CursorY)
+	}
+}
+
+func TestPluginRegistrationsAreOwned(t *testing.T) {
+	e := newTestEditor(t)
+	pluginAPI := e.newAPI("go-mode")
+	
+	pluginAPI.RegisterCommand("go-format", "Format Go code", func(args []string) error {
+		return nil
+	})
+	pluginAPI.BindKey("C-c C-f", "go-format")
+	
+	cmd := e.commandRegistry.GetCommand("go-format")
+	if cmd == nil || cmd.Owner != "go-mode" {
+		t.Fatalf("go-format = %+v, want command owned by go-mode", cmd)
+	}
+	
+	bound := false
+	for _, b := range e.keyMap.Bindings() {
+		if b.Owner == "go-mode" {
+			bound = true
+		}
+	}
+	if !bound {
+		t.Error("key binding was not tagged with go-mode")
+	}
+	
+	e.removeOwned("go-mode")
+	if e.commandRegistry.GetCommand("go-format") != nil {
+		t.Error("go-format still registered after unload")
+	}
+	for _, b := range e.keyMap.Bindings() {
+		if b.Owner == "go-mode" {
+			t.Error("go-mode key binding still present after unload")
+		}
+	}
+}
+
+type tickerPlugin struct {
+	api *api.EditorAPI
+}
+
+func (p *tickerPlugin) Name() string                     { return "ticker" }
+func (p *tickerPlugin) Version() string                  { return "1.0.0" }
+func (p *tickerPlugin) Cleanup() error                   { return nil }
+func (p *tickerPlugin) Init(editor *api.EditorAPI) error { p.api = editor; return nil }
+
+func TestTimersRunOnTheEventLoop(t *testing.T) {
+	e := newTestEditor(t)
+	e.showMessage("hello")
+	
+	p := &tickerPlugin{}
+	if err := e.pluginManager.Add(p, "test"); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	ran := 0
+	p.api.RunEvery(time.Millisecond, func() { ran++ })
+	done := make(chan struct{})
+	go p.api.Post(func() { close(done) })
+	
+	deadline := time.Now().Add(time.Second)
+	for posted := false; !posted || ran == 0; {
+		if time.Now().After(deadline) {
+			t.Fatalf("posted = %v, timer ran %d times", posted, ran)
+		}
+		time.Sleep(time.Millisecond)
+		e.runPosted()
+		select {
+		case <-done:
+			posted = true
+		default:
+		}
+	}
+	
+	if err := e.pluginManager.UnloadPlugin("ticker"); err != nil {
+		t.Fatalf("UnloadPlugin failed: %v", err)
+	}
+	before := ran
+	time.Sleep(2 * time.Millisecond)
+	e.runPosted()
+	if ran != before {
+		t.Error("timer kept running after its plugin was unloaded")
+	}
+	
+	if e.statusMessage != "hello" {
+		t.Fatalf("statusMessage = %q before it expired", e.statusMessage)
+	}
+	e.loop.RunDue(time.Now().Add(messageDuration))
+	if e.statusMessage != "" {
+		t.Errorf("statusMessage = %q, want it cleared after %v", e.statusMessage, messageDuration)
+	}
+}
+
+func TestBeforeSaveHookCancelsSave(t *testing.T) {
+	tmpFile := filepath.Join(t.TempDir(), "hooked.txt")
+	
+	e := newTestEditor(t)
+	if err := e.LoadFile(tmpFile); err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	
+	saved := false
+	e.newAPI("guard").AddHook("before-save", func(ctx *api.HookContext) {
+		ctx.Cancel("not today")
+	})
+	e.newAPI("watcher").RegisterHook("after-save", func() { saved = true })
+	
+	if err := e.saveCurrentBuffer(); err == nil {
+		t.Fatal("save succeeded despite cancelled before-save hook")
+	}
+	if _, err := os.Stat(tmpFile); !os.IsNotExist(err) {
+		t.Error("file was written despite cancelled save")
+	}
+	if saved {
+		t.Error("after-save ran for a cancelled save")
+	}
+	
+	e.removeOwned("guard")
+	if err := e.saveCurrentBuffer(); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	if !saved {
+		t.Error("after-save hook did not run")
+	}
+}
+
+type panickyPlugin struct{}
+
+func (p *panickyPlugin) Name() string    { return "panicky" }
+func (p *panickyPlugin) Version() string { return "1.0.0" }
+func (p *panickyPlugin) Cleanup() error  { return nil }
+func (p *panickyPlugin) Init(editor *api.EditorAPI) error {
+	editor.RegisterCommand("explode", "Dereference nil", func(args []string) error {
+		var buf api.Buffer
+		buf.GetName()
+		return nil
+	})
+	return nil
+}
+
+func TestPanickingPluginIsDisabled(t *testing.T) {
+	e := newTestEditor(t)
+	if err := e.pluginManager.Add(&panickyPlugin{}, "test"); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	
+	for i := 0; i < 3; i++ {
+		if err := e.runCommand("explode", nil); err == nil {
+			t.Fatal("panicking command reported success")
+		}
+	}
+	e.runPosted()
+	
+	if e.pluginManager.IsLoaded("panicky") || !e.pluginState.IsDisabled("panicky") {
+		t.Error("plugin was not disabled after repeated panics")
+	}
+	if e.commandRegistry.GetCommand("explode") != nil {
+		t.Error("command of the disabled plugin is still registered")
+	}
+	
+	lines := e.pluginErrorLines()
+	if len(lines) < 2 || !strings.Contains(lines[0], "panicky failed in command explode") || !strings.HasPrefix(lines[1], "    ") {
+		t.Errorf("plugin errors = %q, want the failure with a stack trace", lines)
+	}
+}
+
+type slowPlugin struct{}
+
+func (p *slowPlugin) Name() string    { return "slow" }
+func (p *slowPlugin) Version() string { return "1.0.0" }
+func (p *slowPlugin) Cleanup() error  { return nil }
+func (p *slowPlugin) Init(editor *api.EditorAPI) error {
+	editor.RegisterCommand("crawl", "Take a while", func(args []string) error {
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	})
+	return nil
+}
+
+func TestSlowPluginIsNotDisabledForGood(t *testing.T) {
+	e := newTestEditor(t)
+	e.pluginManager.SetCallTimeout(10 * time.Millisecond)
+	if err := e.pluginManager.Add(&slowPlugin{}, "test"); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+
+	if err := e.runCommand("crawl", nil); err != nil {
+		t.Fatalf("slow command failed: %v", err)
+	}
+	e.runPosted()
+	if !e.pluginManager.IsLoaded("slow") {
+		t.Fatal("plugin was unloaded after one slow call")
+	}
+
+	for i := 1; i < 3; i++ {
+		e.runCommand("crawl", nil)
+	}
+	e.runPosted()
+	if e.pluginManager.IsLoaded("slow") {
+		t.Error("plugin was not unloaded after repeated slow calls")
+	}
+	if e.pluginState.IsDisabled("slow") {
+		t.Error("plugin was disabled for good for being slow")
+	}
+}
+
+type shellPlugin struct {
+	api *api.EditorAPI
+}
+
+func (p *shellPlugin) Name() string                     { return "shell" }
+func (p *shellPlugin) Version() string                  { return "1.0.0" }
+func (p *shellPlugin) Cleanup() error                   { return nil }
+func (p *shellPlugin) Init(editor *api.EditorAPI) error { p.api = editor; return nil }
+func (p *shellPlugin) Manifest() api.Manifest {
+	return api.Manifest{Name: "shell", Capabilities: []string{"exec:echo"}}
+}
+
+func TestPluginCapabilitiesAreEnforced(t *testing.T) {
+	e := newTestEditor(t)
+	p := &shellPlugin{}
+	if err := e.pluginManager.Add(p, "test"); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	
+	if _, err := p.api.Exec("echo", []string{"hi"}, api.ExecOptions{}); err == nil {
+		t.Error("exec succeeded before the user answered")
+	}
+	if !e.minibuffer.IsActive() {
+		t.Fatal("the user was not asked for permission")
+	}
+	e.minibuffer.SetInput("y")
+	e.minibuffer.HandleKey(termbox.Event{Type: termbox.EventKey, Key: termbox.KeyEnter})
+	
+	out, err := p.api.Exec("echo", []string{"hi"}, api.ExecOptions{})
+	if err != nil || out != "hi\n" {
+		t.Errorf("Exec(echo) = %q, %v after granting", out, err)
 	}
-}
\ No newline at end of file
+	if _, err := p.api.Exec("ls", nil, api.ExecOptions{}); err == nil {
+		t.Error("undeclared program was run")
+	}
+	if _, err := p.api.ReadFile("/etc/hostname"); err == nil {
+		t.Error("undeclared file read succeeded")
+	}
+	
+	grants := plugin.NewGrants(e.config.PluginGrantsFile())
+	grants.Load()
+	if !grants.Decided("shell", []capability.Capability{{Kind: capability.Exec, Scope: "echo"}}) {
+		t.Error("grant was not persisted")
+	}
+}
+
+func TestGrantPromptWaitsForTheMinibuffer(t *testing.T) {
+	e := newTestEditor(t)
+	e.minibuffer.Activate(minibuffer.ModeInput, "Find file: ", nil)
+	e.minibuffer.SetInput("notes.txt")
+
+	p := &shellPlugin{}
+	if err := e.pluginManager.Add(p, "test"); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	p.api.Exec("echo", nil, api.ExecOptions{})
+	if got := e.minibuffer.GetInput(); got != "notes.txt" {
+		t.Fatalf("input = %q, want the open prompt left alone", got)
+	}
+
+	e.minibuffer.Deactivate()
+	e.resumeGrant()
+	if !e.minibuffer.IsActive() {
+		t.Fatal("the grant question was not asked once the minibuffer was free")
+	}
+	e.minibuffer.SetInput("y")
+	e.minibuffer.HandleKey(termbox.Event{Type: termbox.EventKey, Key: termbox.KeyEnter})
+	if !e.grants.Decided("shell", []capability.Capability{{Kind: capability.Exec, Scope: "echo"}}) {
+		t.Error("the answer was not recorded for the plugin")
+	}
+}
+
+type fetchPlugin struct {
+	api  *api.EditorAPI
+	host string
+}
+
+func (p *fetchPlugin) Name() string                     { return "fetch" }
+func (p *fetchPlugin) Version() string                  { return "1.0.0" }
+func (p *fetchPlugin) Cleanup() error                   { return nil }
+func (p *fetchPlugin) Init(editor *api.EditorAPI) error { p.api = editor; return nil }
+func (p *fetchPlugin) Manifest() api.Manifest {
+	return api.Manifest{Name: "fetch", Capabilities: []string{"network:" + p.host}}
+}
+
+func TestHTTPRedirectsAreChecked(t *testing.T) {
+	e := newTestEditor(t)
+	reached := false
+	elsewhere := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	}))
+	defer elsewhere.Close()
+	// The servers are both on the loopback address, so the redirect
+	// names the other one by another host name.
+	_, port, _ := net.SplitHostPort(elsewhere.Listener.Addr().String())
+	allowed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://localhost:"+port+"/", http.StatusFound)
+	}))
+	defer allowed.Close()
+
+	p := &fetchPlugin{host: "127.0.0.1"}
+	if err := e.pluginManager.Add(p, "test"); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	p.api.HTTPRequest("GET", allowed.URL, nil)
+	e.minibuffer.SetInput("y")
+	e.minibuffer.HandleKey(termbox.Event{Type: termbox.EventKey, Key: termbox.KeyEnter})
+
+	if _, err := p.api.HTTPRequest("GET", allowed.URL, nil); err == nil || reached {
+		t.Errorf("HTTPRequest = %v, reached = %v; want the redirect to another host refused", err, reached)
+	}
+}
+
+func TestPackageListMarksAndExecutes(t *testing.T) {
+	e := newTestEditor(t)
+	
+	registry := t.TempDir()
+	os.WriteFile(filepath.Join(registry, "packages.json"), []byte(`[{"name": "tree", "version": "1.0.0", "description": "File tree", "author": "someone", "url": "tree.so"}]`), 0644)
+	e.packageManager = package_manager.NewManager(e.config.PluginDir())
+	e.packageManager.AddRegistry(registry, 0)
+	os.MkdirAll(e.config.PluginDir(), 0755)
+	os.WriteFile(filepath.Join(e.config.PluginDir(), "old.so"), nil, 0644)
+	
+	wait := func() {
+		deadline := time.Now().Add(5 * time.Second)
+		for e.upgrading {
+			if time.Now().After(deadline) {
+				t.Fatal("background package job did not finish")
+			}
+			time.Sleep(time.Millisecond)
+			e.runPosted()
+		}
+	}
+	
+	if err := e.runCommand("list-packages", nil); err != nil {
+		t.Fatalf("list-packages failed: %v", err)
+	}
+	wait()
+	buf := e.bufferManager.GetCurrentBuffer()
+	if buf.Name != packageListBuffer || len(buf.Lines) != 3 {
+		t.Fatalf("package list = %q", buf.Lines)
+	}
+	if !strings.Contains(buf.Lines[1], "old") || !strings.Contains(buf.Lines[1], "installed") ||
+		!strings.Contains(buf.Lines[2], "tree") || !strings.Contains(buf.Lines[2], "someone") || !strings.Contains(buf.Lines[2], "available") {
+		t.Errorf("package list = %q", buf.Lines)
+	}
+	
+	// i on an installed package is refused; d marks it and moves down.
+	e.handleKey(termbox.Event{Type: termbox.EventKey, Ch: 'i'})
+	e.handleKey(termbox.Event{Type: termbox.EventKey, Ch: 'd'})
+	if !strings.HasPrefix(buf.Lines[1], "D old") || buf.CursorY != 2 {
+		t.Errorf("after d: lines %q, cursor line %d", buf.Lines, buf.CursorY)
+	}
+	
+	e.handleKey(termbox.Event{Type: termbox.EventKey, Ch: 'x'})
+	wait()
+	if _, err := os.Stat(filepath.Join(e.config.PluginDir(), "old.so")); !os.IsNotExist(err) {
+		t.Error("old.so was not deleted")
+	}
+	if len(buf.Lines) != 2 || !strings.Contains(buf.Lines[1], "tree") {
+		t.Errorf("package list after x = %q", buf.Lines)
+	}
+}
+
+func TestDevelopPluginRebuildsOnChange(t *testing.T) {
+	e := newTestEditor(t)
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/broken\n\ngo 1.22\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "broken.go"), []byte("package main\n\nfunc broken() {\n"), 0644)
+	
+	wait := func() {
+		deadline := time.Now().Add(30 * time.Second)
+		for e.developing["broken"].building {
+			if time.Now().After(deadline) {
+				t.Fatal("plugin build did not finish")
+			}
+			time.Sleep(time.Millisecond)
+			e.runPosted()
+		}
+	}
+	
+	if err := e.runCommand("develop-plugin", []string{"broken", dir}); err != nil {
+		t.Fatalf("develop-plugin failed: %v", err)
+	}
+	wait()
+	if n := len(e.pluginErrorLines()); n == 0 || !strings.Contains(strings.Join(e.pluginErrorLines(), "\n"), "broken") {
+		t.Errorf("build failure not reported: %q", e.pluginErrorLines())
+	}
+	
+	// Unchanged source is not rebuilt; a change is.
+	e.loop.RunDue(time.Now().Add(developInterval))
+	if e.developing["broken"].building {
+		t.Error("unchanged source was rebuilt")
+	}
+	os.WriteFile(filepath.Join(dir, "broken.go"), []byte("package main\n\nfunc broken() {}\nfunc broken() {}\n"), 0644)
+	e.loop.RunDue(time.Now().Add(2 * developInterval))
+	if !e.developing["broken"].building {
+		t.Error("changed source was not rebuilt")
+	}
+	wait()
+	
+	if err := e.runCommand("stop-developing-plugin", []string{"broken"}); err != nil {
+		t.Errorf("stop-developing-plugin failed: %v", err)
+	}
+	if err := e.runCommand("stop-developing-plugin", []string{"broken"}); err == nil {
+		t.Error("stopping twice succeeded")
+	}
+}
+
+type optionPlugin struct {
+	api *api.EditorAPI
+}
+
+func (p *optionPlugin) Name() string                     { return "tree" }
+func (p *optionPlugin) Version() string                  { return "1.0.0" }
+func (p *optionPlugin) Cleanup() error                   { return nil }
+func (p *optionPlugin) Init(editor *api.EditorAPI) error {
+	p.api = editor
+	return editor.DefineOption(api.Option{Name: "tree-width", Type: api.OptionInt, Default: 20, Doc: "Width of the tree."})
+}
+
+func TestOptions(t *testing.T) {
+	e := newTestEditor(t)
+	
+	e.setOptionFromConfig("tab-widht", 2)
+	e.setOptionFromConfig("tree-width", 30)
+	e.reportConfigErrors()
+	if !strings.Contains(e.statusMessage, `"tab-widht" (did you mean "tab-width"?)`) {
+		t.Errorf("statusMessage = %q, want a suggestion for the typo", e.statusMessage)
+	}
+	
+	p := &optionPlugin{}
+	if err := e.pluginManager.Add(p, "test"); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if got := p.api.GetOption("tree-width"); got != 30 {
+		t.Errorf("tree-width = %v, want the value config.go set before the plugin loaded", got)
+	}
+	var changes []api.OptionChange
+	p.api.OnOptionChange("tab-width", func(c api.OptionChange) { changes = append(changes, c) })
+	
+	e.openFile("")
+	if err := e.runCommand("set-local-variable", []string{"tab-width", "8"}); err != nil {
+		t.Fatalf("set-local-variable failed: %v", err)
+	}
+	if err := e.runCommand("set-variable", []string{"indent-tabs-mode", "nil"}); err != nil {
+		t.Fatalf("set-variable failed: %v", err)
+	}
+	if err := e.runCommand("set-variable", []string{"tab-width", "-1"}); err == nil {
+		t.Error("set-variable accepted a negative tab-width")
+	}
+	e.insertChar('x')
+	e.insertTab()
+	buf := e.bufferManager.GetCurrentBuffer()
+	if buf.Lines[0] != "x       " {
+		t.Errorf("line = %q, want TAB to indent to column 8", buf.Lines[0])
+	}
+	if len(changes) != 1 || changes[0].New != 8 || changes[0].Buffer != buf.Name {
+		t.Errorf("changes = %+v, want the local change of tab-width", changes)
+	}
+	
+	if err := e.runCommand("describe-variable", []string{"tree-width"}); err != nil {
+		t.Fatalf("describe-variable failed: %v", err)
+	}
+	help := strings.Join(e.bufferManager.GetCurrentBuffer().Lines, "\n")
+	if !strings.Contains(help, "tree-width is 30") || !strings.Contains(help, "Defined by plugin: tree") {
+		t.Errorf("*Help* = %q", help)
+	}
+	
+	if err := e.pluginManager.UnloadPlugin("tree"); err != nil {
+		t.Fatalf("UnloadPlugin failed: %v", err)
+	}
+	if _, ok := e.options.Lookup("tree-width"); ok {
+		t.Error("tree-width still defined after its plugin was unloaded")
+	}
+}
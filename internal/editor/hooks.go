@@ -0,0 +1,93 @@
+package editor
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/TakahashiShuuhei/edito/internal/buffer"
+	"github.com/TakahashiShuuhei/edito/internal/hook"
+	"github.com/TakahashiShuuhei/edito/internal/option"
+)
+
+// defaultIdleDelay is how long the editor waits for input before running
+// the idle hooks. The "idle-delay" option overrides it in seconds.
+const defaultIdleDelay = 2 * time.Second
+
+func (e *Editor) addHook(owner, event string, handler func(ctx *hook.Context)) {
+	if err := e.hooks.Add(event, owner, handler); err != nil {
+		e.showMessage(err.Error())
+	}
+}
+
+func (e *Editor) hookContext(event string, buf *buffer.Buffer) *hook.Context {
+	ctx := &hook.Context{Event: event}
+	if buf != nil {
+		ctx.Buffer = &bufferHandle{editor: e, buf: buf}
+	}
+	return ctx
+}
+
+// runHook runs the handlers of ctx.Event. Handler failures are shown in
+// the echo area; the returned error is set only when a before-* event
+// was cancelled.
+func (e *Editor) runHook(ctx *hook.Context) error {
+	if errs := e.hooks.Run(ctx); len(errs) > 0 {
+		e.showMessage(errs[0].Error())
+	}
+	if cancelled, reason := ctx.Cancelled(); cancelled && hook.Cancellable(ctx.Event) {
+		if reason == "" {
+			reason = "cancelled by " + ctx.Event + " hook"
+		}
+		return fmt.Errorf("%s", reason)
+	}
+	return nil
+}
+
+// bufferChanged runs buffer-switched if the current buffer is no longer prev.
+func (e *Editor) bufferChanged(prev *buffer.Buffer) {
+	if buf := e.bufferManager.GetCurrentBuffer(); buf != nil && buf != prev {
+		e.runHook(e.hookContext(hook.BufferSwitched, buf))
+	}
+}
+
+// runCommand executes a command between the before-command and
+// after-command hooks.
+func (e *Editor) runCommand(name string, args []string) error {
+	ctx := e.hookContext(hook.BeforeCommand, e.bufferManager.GetCurrentBuffer())
+	ctx.Command = name
+	ctx.Args = args
+	if err := e.runHook(ctx); err != nil {
+		return err
+	}
+
+	var err error
+	if cmd := e.commandRegistry.GetCommand(name); cmd != nil && cmd.Interactive != nil {
+		err = e.commandRegistry.ExecuteInteractive(name, e.promptUser)
+	} else {
+		err = e.commandRegistry.Execute(name, args)
+	}
+
+	after := e.hookContext(hook.AfterCommand, e.bufferManager.GetCurrentBuffer())
+	after.Command = name
+	after.Args = args
+	e.runHook(after)
+	return err
+}
+
+func (e *Editor) idleDelay() time.Duration {
+	seconds, _ := e.options.Get("idle-delay").(int)
+	return time.Duration(seconds) * time.Second
+}
+
+// setupIdleHook runs the idle hooks once each time the editor has been
+// idle for idleDelay.
+func (e *Editor) setupIdleHook() {
+	run := func() {
+		e.runHook(e.hookContext(hook.Idle, e.bufferManager.GetCurrentBuffer()))
+	}
+	e.idleTimer = e.loop.RunWhenIdle("", e.idleDelay(), run)
+	e.options.Watch("", "idle-delay", func(option.Change) {
+		e.idleTimer.Stop()
+		e.idleTimer = e.loop.RunWhenIdle("", e.idleDelay(), run)
+	})
+}
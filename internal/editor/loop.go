@@ -0,0 +1,16 @@
+package editor
+
+import (
+	"time"
+)
+
+// post schedules fn to run on the editor goroutine and wakes the event
+// loop. It is safe to call from any goroutine.
+func (e *Editor) post(fn func()) {
+	e.loop.Post(fn)
+}
+
+// runPosted runs the posted functions and the timers that are due.
+func (e *Editor) runPosted() {
+	e.loop.RunDue(time.Now())
+}
@@ -0,0 +1,257 @@
+package editor
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/TakahashiShuuhei/edito/internal/api"
+	"github.com/TakahashiShuuhei/edito/internal/minibuffer"
+	"github.com/TakahashiShuuhei/edito/internal/modeline"
+	"github.com/TakahashiShuuhei/edito/internal/option"
+)
+
+// setupOptions declares the options of the core. It runs before config.go
+// so that SetOption there is checked against them.
+func (e *Editor) setupOptions() {
+	positive := func(value any) error {
+		if value.(int) <= 0 {
+			return fmt.Errorf("must be positive")
+		}
+		return nil
+	}
+	for _, opt := range []option.Option{
+		{
+			Name:     "history-length",
+			Type:     option.Int,
+			Default:  minibuffer.DefaultHistorySize,
+			Doc:      "Number of minibuffer inputs remembered per prompt.",
+			Validate: positive,
+		},
+		{
+			Name:    "mode-line-format",
+			Type:    option.String,
+			Default: strings.Join(modeline.DefaultFormat, " "),
+			Doc:     "Space-separated segments shown in the mode line, in order.",
+		},
+		{
+			Name:     "idle-delay",
+			Type:     option.Int,
+			Default:  int(defaultIdleDelay / time.Second),
+			Doc:      "Seconds without input before the idle hooks run.",
+			Validate: positive,
+		},
+		{
+			Name:        "tab-width",
+			Type:        option.Int,
+			Default:     4,
+			Doc:         "Columns between tab stops, used by TAB.",
+			BufferLocal: true,
+			Validate:    positive,
+		},
+		{
+			Name:        "indent-tabs-mode",
+			Type:        option.Bool,
+			Default:     false,
+			Doc:         "Whether TAB inserts a tab character instead of spaces.",
+			BufferLocal: true,
+		},
+	} {
+		if err := e.options.Define(opt); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func (e *Editor) setupOptionCommands() {
+	e.commandRegistry.Register("describe-variable", "Show the value and documentation of an option", func(args []string) error {
+		return e.withOptionName(args, "Describe variable: ", false, e.describeVariable)
+	})
+
+	e.commandRegistry.Register("set-variable", "Set an option", func(args []string) error {
+		return e.withOptionName(args, "Set variable: ", false, func(name string) error {
+			return e.withOptionValue(name, args, func(value any) error {
+				return e.options.Set(name, value)
+			})
+		})
+	})
+
+	e.commandRegistry.Register("set-local-variable", "Set an option for the current buffer only", func(args []string) error {
+		return e.withOptionName(args, "Set local variable: ", true, func(name string) error {
+			return e.withOptionValue(name, args, func(value any) error {
+				return e.setLocalOption(name, value)
+			})
+		})
+	})
+}
+
+// withOptionName calls fn with the option named in args or, without
+// arguments, read from the minibuffer with completion.
+func (e *Editor) withOptionName(args []string, prompt string, local bool, fn func(name string) error) error {
+	var names []string
+	for _, opt := range e.options.Options() {
+		if opt.BufferLocal || !local {
+			names = append(names, opt.Name)
+		}
+	}
+	return e.withPluginName(args, prompt, names, func(name string) error {
+		if _, ok := e.options.Lookup(name); !ok {
+			return &option.UnknownError{Name: name, Suggestion: e.options.Suggest(name)}
+		}
+		return fn(name)
+	})
+}
+
+// withOptionValue calls fn with the value in args[1] or read from the
+// minibuffer, parsed as the type of option name.
+func (e *Editor) withOptionValue(name string, args []string, fn func(value any) error) error {
+	opt, _ := e.options.Lookup(name)
+	set := func(input string) error {
+		value, err := option.Parse(opt.Type, input)
+		if err != nil {
+			return fmt.Errorf("invalid %s for %s: %v", opt.Type, name, err)
+		}
+		if err := fn(value); err != nil {
+			return err
+		}
+		e.showMessage(fmt.Sprintf("%s is now %s", name, option.Format(e.optionValue(name))))
+		return nil
+	}
+	if len(args) > 1 {
+		return set(args[1])
+	}
+	e.readMinibuffer(fmt.Sprintf("Set %s to (%s): ", name, opt.Type), "set-variable", set)
+	return nil
+}
+
+func (e *Editor) describeVariable(name string) error {
+	opt, _ := e.options.Lookup(name)
+	lines := []string{
+		fmt.Sprintf("%s is %s", name, option.Format(e.optionValue(name))),
+		"",
+		"Type: " + string(opt.Type),
+		"Default: " + option.Format(opt.Default),
+	}
+	if opt.BufferLocal {
+		lines = append(lines, fmt.Sprintf("Global value: %s", option.Format(e.options.Get(name))))
+		if buf := e.bufferManager.GetCurrentBuffer(); buf != nil {
+			if value, ok := buf.Options[name]; ok {
+				lines = append(lines, fmt.Sprintf("Local value in %s: %s", buf.Name, option.Format(value)))
+			}
+		}
+		lines = append(lines, "Can be set for a single buffer.")
+	}
+	if opt.Owner != "" {
+		lines = append(lines, "Defined by plugin: "+opt.Owner)
+	}
+	lines = append(lines, "", opt.Doc)
+	return e.showHelpBuffer("*Help*", lines)
+}
+
+// optionValue returns the value of name in the current buffer.
+func (e *Editor) optionValue(name string) any {
+	var locals map[string]any
+	if buf := e.bufferManager.GetCurrentBuffer(); buf != nil {
+		locals = buf.Options
+	}
+	return e.options.Local(name, locals)
+}
+
+// setLocalOption sets name for the current buffer.
+func (e *Editor) setLocalOption(name string, value any) error {
+	buf := e.bufferManager.GetCurrentBuffer()
+	if buf == nil {
+		return fmt.Errorf("no current buffer")
+	}
+	if buf.Options == nil {
+		buf.Options = make(map[string]any)
+	}
+	return e.options.SetLocal(buf.Name, buf.Options, name, value)
+}
+
+// setOption sets name on behalf of owner. Errors in config.go are
+// reported once startup is over, when the options of plugins are known;
+// errors of plugins go to the plugin error log.
+func (e *Editor) setOption(owner, name string, value any) {
+	err := e.options.Set(name, value)
+	var unknown *option.UnknownError
+	switch {
+	case err == nil:
+	case e.loading && errors.As(err, &unknown):
+		// A plugin loaded later may declare it.
+	case e.loading:
+		e.configErrors = append(e.configErrors, "config.go: "+err.Error())
+	case owner == ownerConfig:
+		e.showMessage(fmt.Sprintf("config.go: %v", err))
+	default:
+		e.recordPluginError(fmt.Errorf("plugin %s: %v", owner, err))
+	}
+}
+
+// reportConfigErrors shows the errors config.go caused during startup,
+// including the options it set that no plugin declared. While plugins are
+// still being installed, unknown options wait for them to load.
+func (e *Editor) reportConfigErrors() {
+	errs := e.configErrors
+	e.configErrors = nil
+	if e.installCancel == nil {
+		for _, name := range e.options.Pending() {
+			errs = append(errs, "config.go: "+(&option.UnknownError{Name: name, Suggestion: e.options.Suggest(name)}).Error())
+		}
+	}
+	if len(errs) > 0 {
+		e.showMessage(strings.Join(errs, "; "))
+	}
+}
+
+// defineOption declares an option of owner.
+func (e *Editor) defineOption(owner string, opt api.Option) error {
+	def := option.Option{
+		Name:        opt.Name,
+		Type:        option.Type(opt.Type),
+		Default:     opt.Default,
+		Doc:         opt.Doc,
+		BufferLocal: opt.BufferLocal,
+		Owner:       owner,
+	}
+	if opt.Validate != nil {
+		def.Validate = func(value any) error {
+			return e.callPlugin(owner, "option "+opt.Name+" validator", func() error {
+				return opt.Validate(value)
+			})
+		}
+	}
+	err := e.options.Define(def)
+	if err != nil && owner != ownerConfig {
+		e.recordPluginError(fmt.Errorf("plugin %s: %v", owner, err))
+	}
+	return err
+}
+
+func (e *Editor) watchOption(owner, name string, fn func(change api.OptionChange)) {
+	e.options.Watch(owner, name, func(c option.Change) {
+		e.callPlugin(owner, "option "+name+" watcher", func() error {
+			fn(api.OptionChange{Name: c.Name, Old: c.Old, New: c.New, Buffer: c.Buffer})
+			return nil
+		})
+	})
+}
+
+// insertTab indents to the next tab stop with a tab or spaces, as the
+// buffer's tab-width and indent-tabs-mode say.
+func (e *Editor) insertTab() {
+	buf := e.bufferManager.GetCurrentBuffer()
+	if buf == nil {
+		return
+	}
+	if useTabs, _ := e.optionValue("indent-tabs-mode").(bool); useTabs {
+		e.insertChar('\t')
+		return
+	}
+	width, _ := e.optionValue("tab-width").(int)
+	for n := width - buf.CursorX%width; n > 0; n-- {
+		buf.InsertChar(' ')
+	}
+	e.adjustOffset()
+}
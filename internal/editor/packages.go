@@ -0,0 +1,288 @@
+package editor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nsf/termbox-go"
+	"github.com/TakahashiShuuhei/edito/internal/keybinding"
+)
+
+// packageListBuffer shows the packages of the registries and the installed
+// plugins, and packageListMode is its major mode.
+const (
+	packageListBuffer = "*Packages*"
+	packageListMode   = "package-list"
+)
+
+// Marks set on package list entries with i, d and U.
+const (
+	markInstall = 'I'
+	markDelete  = 'D'
+	markUpgrade = 'U'
+)
+
+// packageRow is one line of the package list.
+type packageRow struct {
+	Name        string
+	Version     string // in the registry
+	Installed   string // recorded version, or "-" when installed without a record
+	Status      string // available, installed, outdated or disabled
+	Description string
+	Author      string
+	mark        rune
+}
+
+func (e *Editor) setupPackageListCommands() {
+	e.commandRegistry.Register("list-packages", "Browse, install, delete and upgrade packages", func(args []string) error {
+		return e.listPackages()
+	})
+
+	km := keybinding.NewKeyMap()
+	km.BindChar('i', func() { e.markPackage(markInstall) })
+	km.BindChar('d', func() { e.markPackage(markDelete) })
+	km.BindChar('U', func() { e.markPackage(markUpgrade) })
+	km.BindChar('u', func() { e.markPackage(0) })
+	km.BindChar('x', func() {
+		if err := e.executePackageMarks(); err != nil {
+			e.showMessage(err.Error())
+		}
+	})
+	km.BindChar('g', func() {
+		if err := e.listPackages(); err != nil {
+			e.showMessage(err.Error())
+		}
+	})
+	km.BindChar('n', func() { e.moveCursor(0, 1) })
+	km.BindChar('p', func() { e.moveCursor(0, -1) })
+	e.modeKeyMaps[packageListMode] = km
+}
+
+// listPackages opens the package list and fills it once the registries
+// have been read in the background.
+func (e *Editor) listPackages() error {
+	if e.upgrading {
+		return errUpgrading
+	}
+	e.showPackageList()
+	return e.inBackground("Reading package registries...", func() func() error {
+		err := e.packageManager.UpdateRegistry()
+		return func() error {
+			e.packageRows = e.collectPackageRows()
+			e.showPackageList()
+			if err != nil {
+				e.recordPluginError(fmt.Errorf("package registries: %v", err))
+			}
+			e.showMessage("i: install, d: delete, U: upgrade, u: unmark, x: execute, g: refresh")
+			return nil
+		}
+	})
+}
+
+// collectPackageRows merges the registry packages with the installed,
+// disabled and config.go plugins.
+func (e *Editor) collectPackageRows() []packageRow {
+	rows := make(map[string]*packageRow)
+	row := func(name string) *packageRow {
+		if r, ok := rows[name]; ok {
+			return r
+		}
+		rows[name] = &packageRow{Name: name, Status: "available"}
+		return rows[name]
+	}
+
+	for _, pkg := range e.packageManager.SearchPackage("") {
+		r := row(pkg.Name)
+		r.Version, r.Description, r.Author = pkg.Version, pkg.Description, pkg.Author
+	}
+	for _, spec := range e.configPluginSpecs {
+		r := row(spec.Name)
+		if r.Description == "" {
+			r.Description = spec.Repository
+		}
+		if r.Version == "" {
+			r.Version = spec.Version
+		}
+	}
+	installed, _ := e.packageManager.ListInstalled()
+	for _, name := range installed {
+		r := row(name)
+		r.Status = "installed"
+		r.Installed = "-"
+		if p, ok := e.installedDB.Get(name); ok {
+			r.Installed = p.Version
+		}
+	}
+	for name := range e.packageManager.Outdated() {
+		if r, ok := rows[name]; ok && r.Status == "installed" {
+			r.Status = "outdated"
+		}
+	}
+	for _, name := range e.pluginState.Disabled() {
+		row(name).Status = "disabled"
+	}
+
+	list := make([]packageRow, 0, len(rows))
+	for _, r := range rows {
+		list = append(list, *r)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+func (e *Editor) packageListLines() []string {
+	format := "%c %-20s %-10s %-10s %-10s %-16s %s"
+	lines := []string{strings.TrimRight(fmt.Sprintf(format, ' ', "Package", "Version", "Installed", "Status", "Author", "Description"), " ")}
+	if e.packageRows == nil {
+		return append(lines, "  Loading...")
+	}
+	for _, r := range e.packageRows {
+		mark := ' '
+		if r.mark != 0 {
+			mark = r.mark
+		}
+		lines = append(lines, strings.TrimRight(fmt.Sprintf(format, mark, r.Name, r.Version, r.Installed, r.Status, r.Author, r.Description), " "))
+	}
+	return lines
+}
+
+// showPackageList displays the package list, keeping the cursor line when
+// it is already displayed.
+func (e *Editor) showPackageList() {
+	prev := e.bufferManager.GetCurrentBuffer()
+	line := 1
+	if prev != nil && prev.MajorMode == packageListMode {
+		line = prev.CursorY
+	}
+
+	buf := e.bufferManager.NewSpecialBuffer(packageListBuffer, e.packageListLines())
+	buf.MajorMode = packageListMode
+	if line >= len(buf.Lines) {
+		line = len(buf.Lines) - 1
+	}
+	buf.CursorY = line
+	e.adjustOffset()
+	if prev != buf {
+		e.bufferChanged(prev)
+	}
+}
+
+// currentPackageRow returns the entry under the cursor.
+func (e *Editor) currentPackageRow() *packageRow {
+	buf := e.bufferManager.GetCurrentBuffer()
+	if buf == nil || buf.MajorMode != packageListMode {
+		return nil
+	}
+	i := buf.CursorY - 1
+	if i < 0 || i >= len(e.packageRows) {
+		return nil
+	}
+	return &e.packageRows[i]
+}
+
+// markPackage marks the entry under the cursor, or clears its mark when
+// mark is 0, and moves to the next entry.
+func (e *Editor) markPackage(mark rune) {
+	r := e.currentPackageRow()
+	if r == nil {
+		return
+	}
+	switch {
+	case mark == markInstall && r.Installed != "":
+		e.showMessage(fmt.Sprintf("%s is already installed", r.Name))
+		return
+	case (mark == markDelete || mark == markUpgrade) && r.Installed == "":
+		e.showMessage(fmt.Sprintf("%s is not installed", r.Name))
+		return
+	}
+	r.mark = mark
+	e.showPackageList()
+	e.moveCursor(0, 1)
+}
+
+// executePackageMarks runs the marked operations in the background,
+// reporting progress in the echo area, and refreshes the list at the end.
+func (e *Editor) executePackageMarks() error {
+	type job struct {
+		name string
+		mark rune
+	}
+	var jobs []job
+	for _, r := range e.packageRows {
+		if r.mark != 0 {
+			jobs = append(jobs, job{r.Name, r.mark})
+		}
+	}
+	if len(jobs) == 0 {
+		return fmt.Errorf("no packages are marked; use i, d or U")
+	}
+
+	// Plugins are unloaded on the editor goroutine before their files go.
+	for _, j := range jobs {
+		if j.mark == markDelete && e.pluginManager.IsLoaded(j.name) {
+			if err := e.pluginManager.UnloadPlugin(j.name); err != nil {
+				return err
+			}
+		}
+	}
+
+	return e.inBackground(fmt.Sprintf("Processing %d packages...", len(jobs)), func() func() error {
+		var failed, installed []string
+		for i, j := range jobs {
+			progress := fmt.Sprintf("(%d/%d)", i+1, len(jobs))
+			var err error
+			switch j.mark {
+			case markInstall:
+				e.post(func() { e.showMessage(fmt.Sprintf("Installing %s %s...", j.name, progress)) })
+				if spec, ok := e.specFor(j.name); ok {
+					err = e.autoInstaller.InstallPlugin(spec)
+				} else {
+					err = e.packageManager.InstallPackage(j.name)
+				}
+				if err == nil {
+					installed = append(installed, j.name)
+				}
+			case markDelete:
+				e.post(func() { e.showMessage(fmt.Sprintf("Deleting %s %s...", j.name, progress)) })
+				err = e.packageManager.UninstallPackage(j.name)
+			case markUpgrade:
+				e.post(func() { e.showMessage(fmt.Sprintf("Upgrading %s %s...", j.name, progress)) })
+				_, err = e.upgradePlugin(j.name)
+			}
+			if err != nil {
+				failed = append(failed, j.name)
+				e.post(func() { e.recordPluginError(fmt.Errorf("package %s: %v", j.name, err)) })
+			}
+		}
+
+		return func() error {
+			for _, name := range installed {
+				if e.pluginState.IsDisabled(name) || e.pluginManager.IsLoaded(name) {
+					continue
+				}
+				if err := e.loadPluginByName(name); err != nil {
+					e.recordPluginError(err)
+				}
+			}
+			e.packageRows = e.collectPackageRows()
+			e.showPackageList()
+			if len(failed) > 0 {
+				return fmt.Errorf("failed: %s; see M-x plugin-errors", strings.Join(failed, ", "))
+			}
+			e.showMessage(fmt.Sprintf("Done: %d packages; upgraded plugins are used after a restart", len(jobs)))
+			return nil
+		}
+	})
+}
+
+// handleModeKey gives the key map of the current buffer's major mode the
+// first look at ev.
+func (e *Editor) handleModeKey(ev termbox.Event) bool {
+	buf := e.bufferManager.GetCurrentBuffer()
+	if buf == nil || e.keyMap.Pending() != "" {
+		return false
+	}
+	km := e.modeKeyMaps[buf.MajorMode]
+	return km != nil && km.Handle(ev)
+}
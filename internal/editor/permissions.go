@@ -0,0 +1,211 @@
+package editor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/TakahashiShuuhei/edito/internal/api"
+	"github.com/TakahashiShuuhei/edito/internal/capability"
+	"github.com/TakahashiShuuhei/edito/internal/minibuffer"
+)
+
+// httpTimeout bounds HTTP requests made through the plugin API.
+const httpTimeout = 30 * time.Second
+
+// maxRedirects is how many redirects an HTTP request made through the
+// plugin API follows.
+const maxRedirects = 10
+
+// checkCapability returns an error unless owner may perform an operation
+// of kind on target. config.go is trusted. A plugin must have declared a
+// matching capability in its manifest, and the user must have allowed it.
+func (e *Editor) checkCapability(owner, kind, target string) error {
+	if owner == ownerConfig {
+		return nil
+	}
+
+	manifest, _ := e.pluginManager.Manifest(owner)
+	requested := capability.ParseAll(manifest.Capabilities)
+	if err := capability.Check(requested, kind, target); err != nil {
+		return fmt.Errorf("plugin %s did not declare the %s capability for %s", owner, kind, target)
+	}
+	if !e.grants.Decided(owner, requested) {
+		e.requestGrant(owner)
+		return fmt.Errorf("plugin %s is waiting for permission to use %s", owner, kind)
+	}
+	if err := capability.Check(e.grants.Granted(owner, requested), kind, target); err != nil {
+		return fmt.Errorf("plugin %s is not allowed to use %s; run reset-plugin-permissions to be asked again", owner, kind)
+	}
+	return nil
+}
+
+// requestGrant asks the user whether the plugin called name may use the
+// capabilities its manifest declares, unless the user already answered.
+// Requests from several plugins are asked one after another.
+func (e *Editor) requestGrant(name string) {
+	for _, queued := range e.grantQueue {
+		if queued == name {
+			// The prompt may have been dismissed with C-g.
+			if !e.minibuffer.IsActive() {
+				e.promptGrant()
+			}
+			return
+		}
+	}
+	e.grantQueue = append(e.grantQueue, name)
+	if len(e.grantQueue) == 1 {
+		e.promptGrant()
+	}
+}
+
+func (e *Editor) promptGrant() {
+	for len(e.grantQueue) > 0 {
+		name := e.grantQueue[0]
+		manifest, _ := e.pluginManager.Manifest(name)
+		requested := capability.ParseAll(manifest.Capabilities)
+		if len(requested) > 0 && !e.grants.Decided(name, requested) {
+			// Replacing another prompt would throw away what the user
+			// is typing, so the question waits until it is closed.
+			if e.minibuffer.IsActive() {
+				e.grantWaiting = true
+				return
+			}
+			e.askGrant(name, requested)
+			return
+		}
+		e.grantQueue = e.grantQueue[1:]
+	}
+}
+
+// resumeGrant asks a question that was waiting for the minibuffer, once
+// the minibuffer is free.
+func (e *Editor) resumeGrant() {
+	if e.grantWaiting && !e.minibuffer.IsActive() {
+		e.grantWaiting = false
+		e.promptGrant()
+	}
+}
+
+func (e *Editor) askGrant(name string, requested []capability.Capability) {
+	caps := make([]string, len(requested))
+	for i, c := range requested {
+		caps[i] = c.String()
+	}
+
+	prompt := fmt.Sprintf("Allow plugin %s to use %s? (y/n) ", name, strings.Join(caps, ", "))
+	e.minibuffer.Activate(minibuffer.ModeInput, prompt, func(input string) error {
+		answer := strings.ToLower(strings.TrimSpace(input))
+		allowed := answer == "y" || answer == "yes"
+		e.grants.Set(name, requested, allowed)
+		if err := e.grants.Save(); err != nil {
+			e.showMessage(err.Error())
+		} else if allowed {
+			e.showMessage(fmt.Sprintf("Plugin %s allowed to use %s", name, strings.Join(caps, ", ")))
+		} else {
+			e.showMessage(fmt.Sprintf("Plugin %s denied; run reset-plugin-permissions to be asked again", name))
+		}
+
+		e.grantQueue = e.grantQueue[1:]
+		e.promptGrant()
+		return nil
+	})
+}
+
+// requestGrants asks about every loaded plugin that declares capabilities
+// the user has not answered for yet.
+func (e *Editor) requestGrants() {
+	for _, name := range e.pluginManager.ListPlugins() {
+		manifest, _ := e.pluginManager.Manifest(name)
+		requested := capability.ParseAll(manifest.Capabilities)
+		if len(requested) > 0 && !e.grants.Decided(name, requested) {
+			e.requestGrant(name)
+		}
+	}
+}
+
+func (e *Editor) resetPluginPermissions(name string) error {
+	e.grants.Forget(name)
+	if err := e.grants.Save(); err != nil {
+		return err
+	}
+	if e.pluginManager.IsLoaded(name) {
+		e.requestGrant(name)
+	}
+	return nil
+}
+
+func (e *Editor) pluginReadFile(owner, path string) ([]byte, error) {
+	if err := e.checkCapability(owner, capability.FSRead, path); err != nil {
+		return nil, err
+	}
+	return os.ReadFile(path)
+}
+
+func (e *Editor) pluginWriteFile(owner, path string, data []byte) error {
+	if err := e.checkCapability(owner, capability.FSWrite, path); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func (e *Editor) pluginExec(owner, name string, args []string, options api.ExecOptions) (string, error) {
+	if err := e.checkCapability(owner, capability.Exec, name); err != nil {
+		return "", err
+	}
+
+	cmd := exec.Command(name, args...)
+	cmd.Dir = options.Dir
+	cmd.Stdin = strings.NewReader(options.Input)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return stdout.String(), fmt.Errorf("%s: %v: %s", name, err, msg)
+		}
+		return stdout.String(), fmt.Errorf("%s: %v", name, err)
+	}
+	return stdout.String(), nil
+}
+
+func (e *Editor) pluginHTTPRequest(owner, method, url string, body []byte) ([]byte, error) {
+	if err := e.checkCapability(owner, capability.Network, url); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{
+		Timeout: httpTimeout,
+		// Every hop must be to a host the plugin may reach.
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return errors.New("stopped after too many redirects")
+			}
+			return e.checkCapability(owner, capability.Network, req.URL.String())
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		return data, fmt.Errorf("%s %s: %s", method, url, resp.Status)
+	}
+	return data, nil
+}
@@ -0,0 +1,362 @@
+package editor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/TakahashiShuuhei/edito/internal/minibuffer"
+	"github.com/TakahashiShuuhei/edito/internal/plugin"
+	"github.com/TakahashiShuuhei/edito/internal/rpcplugin"
+	"github.com/TakahashiShuuhei/edito/internal/wasmplugin"
+)
+
+func (e *Editor) setupPluginCommands() {
+	e.commandRegistry.Register("list-plugins", "List loaded and disabled plugins", func(args []string) error {
+		return e.showPluginList()
+	})
+
+	e.commandRegistry.Register("unload-plugin", "Unload a plugin and remove its commands, keys and hooks", func(args []string) error {
+		return e.withPluginName(args, "Unload plugin: ", e.pluginManager.ListPlugins(), e.unloadPlugin)
+	})
+
+	e.commandRegistry.Register("disable-plugin", "Unload a plugin and keep it disabled across restarts", func(args []string) error {
+		return e.withPluginName(args, "Disable plugin: ", e.pluginManager.ListPlugins(), func(name string) error {
+			return e.setPluginDisabled(name, true)
+		})
+	})
+
+	e.commandRegistry.Register("enable-plugin", "Enable a disabled plugin and load it", func(args []string) error {
+		return e.withPluginName(args, "Enable plugin: ", e.pluginState.Disabled(), func(name string) error {
+			return e.setPluginDisabled(name, false)
+		})
+	})
+
+	e.commandRegistry.Register("reset-plugin-permissions", "Forget the capabilities granted to a plugin and ask again", func(args []string) error {
+		return e.withPluginName(args, "Reset permissions of plugin: ", e.pluginManager.ListPlugins(), e.resetPluginPermissions)
+	})
+
+	e.commandRegistry.Register("plugin-errors", "Show plugin load errors, panics and timeouts", func(args []string) error {
+		return e.showHelpBuffer(pluginErrorsBuffer, e.pluginErrorLines())
+	})
+
+	e.commandRegistry.Register("reload-plugin", "Rebuild a plugin from its source directory and load it again", func(args []string) error {
+		if len(args) >= 2 {
+			return e.reloadPlugin(args[0], args[1])
+		}
+		return e.withPluginName(args, "Reload plugin: ", e.pluginManager.ListPlugins(), func(name string) error {
+			if dir, ok := e.pluginSources[name]; ok {
+				return e.reloadPlugin(name, dir)
+			}
+			if dir := filepath.Join(e.config.PluginDir(), name); rpcplugin.IsPluginDir(dir) {
+				return e.reloadPlugin(name, dir)
+			}
+			if path := e.pluginManager.PluginPath(name); filepath.Ext(path) == ".wasm" {
+				return e.reloadPlugin(name, path)
+			}
+			e.promptPluginSource(name, func(dir string) error {
+				return e.reloadPlugin(name, dir)
+			})
+			return nil
+		})
+	})
+
+	e.setupDevelopCommands()
+	e.setupUpgradeCommands()
+	e.setupPackageListCommands()
+}
+
+// withPluginName calls fn with the first argument, or reads a plugin name
+// in the minibuffer, completing from candidates.
+func (e *Editor) withPluginName(args []string, prompt string, candidates []string, fn func(name string) error) error {
+	if len(args) > 0 {
+		return fn(args[0])
+	}
+
+	completions := make([]minibuffer.Completion, len(candidates))
+	for i, name := range candidates {
+		completions[i] = minibuffer.Completion{Text: name}
+	}
+	e.readMinibuffer(prompt, "", fn)
+	e.minibuffer.RequireMatch()
+	e.minibuffer.SetCompletions(completions)
+	return nil
+}
+
+func (e *Editor) unloadPlugin(name string) error {
+	if err := e.pluginManager.UnloadPlugin(name); err != nil {
+		return err
+	}
+	e.showMessage(fmt.Sprintf("Plugin %s unloaded", name))
+	return nil
+}
+
+// setPluginDisabled records the plugin's state and unloads or loads it
+// to match.
+func (e *Editor) setPluginDisabled(name string, disabled bool) error {
+	e.pluginState.SetDisabled(name, disabled)
+	if err := e.pluginState.Save(); err != nil {
+		return err
+	}
+
+	if disabled {
+		if e.pluginManager.IsLoaded(name) {
+			return e.unloadPlugin(name)
+		}
+		e.showMessage(fmt.Sprintf("Plugin %s disabled", name))
+		return nil
+	}
+
+	if !e.pluginManager.IsLoaded(name) {
+		if err := e.loadPluginByName(name); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	e.showMessage(fmt.Sprintf("Plugin %s enabled", name))
+	return nil
+}
+
+// promptPluginSource asks for the source directory of a plugin being
+// developed and calls fn with it.
+func (e *Editor) promptPluginSource(name string, fn func(dir string) error) {
+	source := minibuffer.NewFileSource()
+	initial := ""
+	if dir, err := os.Getwd(); err == nil {
+		initial = source.Abbreviate(dir) + "/"
+	}
+
+	e.readMinibuffer(fmt.Sprintf("Source directory of %s: ", name), minibuffer.HistoryFile, func(input string) error {
+		dir := source.Expand(minibuffer.ResolveFileInput(input))
+		if dir == "" {
+			return fmt.Errorf("directory required")
+		}
+		return fn(dir)
+	})
+	e.minibuffer.SetInput(initial)
+	e.minibuffer.SetSource(source)
+}
+
+// loadPluginByName loads an installed plugin. Its dependencies must
+// already be loaded.
+func (e *Editor) loadPluginByName(name string) error {
+	c, err := e.openPlugin(name)
+	if err != nil {
+		return err
+	}
+	if err := e.pluginManager.Add(c.Plugin, c.Path); err != nil {
+		return err
+	}
+	e.requestGrants()
+	return nil
+}
+
+// openPlugin finds an installed plugin without initializing it: a
+// directory with a plugin.json runs as a child process, name.wasm runs in
+// the WebAssembly runtime, otherwise name.so is opened.
+func (e *Editor) openPlugin(name string) (plugin.Candidate, error) {
+	if dir := filepath.Join(e.config.PluginDir(), name); rpcplugin.IsPluginDir(dir) {
+		p, err := e.newProcessPlugin(dir)
+		if err != nil {
+			return plugin.Candidate{}, err
+		}
+		return plugin.Candidate{Plugin: p, Path: dir}, nil
+	}
+
+	if path := filepath.Join(e.config.PluginDir(), name+".wasm"); isFile(path) {
+		p, err := wasmplugin.Load(path)
+		if err != nil {
+			return plugin.Candidate{}, fmt.Errorf("plugin %s: %v", name, err)
+		}
+		return plugin.Candidate{Plugin: p, Path: path}, nil
+	}
+
+	path := filepath.Join(e.config.PluginDir(), name+".so")
+	if _, err := os.Stat(path); err != nil {
+		return plugin.Candidate{}, err
+	}
+	return e.pluginManager.Open(path)
+}
+
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+// loadProcessPlugin starts the process plugin in dir under supervision.
+func (e *Editor) loadProcessPlugin(dir string) error {
+	p, err := e.newProcessPlugin(dir)
+	if err != nil {
+		return err
+	}
+	return e.pluginManager.Add(p, dir)
+}
+
+func (e *Editor) newProcessPlugin(dir string) (*rpcplugin.Plugin, error) {
+	manifest, err := rpcplugin.LoadManifest(dir)
+	if err != nil {
+		return nil, fmt.Errorf("plugin in %s: %v", dir, err)
+	}
+	p, err := rpcplugin.New(dir, rpcplugin.Options{
+		Post:    e.post,
+		Reset:   e.removeOwned,
+		LogFile: e.config.CacheFile(filepath.Join("plugin-logs", manifest.Name+".log")),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s: %v", manifest.Name, err)
+	}
+	return p, nil
+}
+
+// reloadPlugin rebuilds the plugin in dir and replaces the loaded copy.
+// A process plugin is simply restarted, and a .wasm module is read again.
+func (e *Editor) reloadPlugin(name, dir string) error {
+	if filepath.Ext(dir) == ".wasm" {
+		p, err := wasmplugin.Load(dir)
+		if err != nil {
+			return fmt.Errorf("plugin %s: %v", name, err)
+		}
+		if e.pluginManager.IsLoaded(name) {
+			if err := e.pluginManager.UnloadPlugin(name); err != nil {
+				return err
+			}
+		}
+		if err := e.pluginManager.Add(p, dir); err != nil {
+			return err
+		}
+		e.pluginSources[name] = dir
+		e.showMessage(fmt.Sprintf("Plugin %s reloaded from %s", name, dir))
+		return nil
+	}
+
+	if rpcplugin.IsPluginDir(dir) {
+		if e.pluginManager.IsLoaded(name) {
+			if err := e.pluginManager.UnloadPlugin(name); err != nil {
+				return err
+			}
+		}
+		if err := e.loadProcessPlugin(dir); err != nil {
+			return err
+		}
+		e.pluginSources[name] = dir
+		e.showMessage(fmt.Sprintf("Plugin %s restarted", name))
+		return nil
+	}
+
+	path, err := plugin.BuildDev(dir, e.config.CacheFile("dev-plugins"), name)
+	if err != nil {
+		return err
+	}
+	return e.loadDevBuild(name, dir, path)
+}
+
+// loadDevBuild replaces the loaded copy of a plugin with the build of its
+// source in dir at path.
+func (e *Editor) loadDevBuild(name, dir, path string) error {
+	if err := e.pluginManager.ReloadPlugin(name, path); err != nil {
+		return err
+	}
+	e.pluginSources[name] = dir
+	e.showMessage(fmt.Sprintf("Plugin %s reloaded from %s", name, dir))
+	return nil
+}
+
+func (e *Editor) showPluginList() error {
+	status := make(map[string]string)
+	for _, name := range e.pluginManager.ListPlugins() {
+		status[name] = "loaded"
+	}
+	for _, name := range e.pluginState.Disabled() {
+		status[name] = "disabled"
+	}
+
+	names := make([]string, 0, len(status))
+	for name := range status {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	content := []string{"Plugins:", ""}
+	for _, name := range names {
+		version := ""
+		var deps []string
+		if manifest, ok := e.pluginManager.Manifest(name); ok {
+			version, deps = manifest.Version, manifest.Dependencies
+		}
+		line := fmt.Sprintf("  %-20s %-10s %-10s", name, version, status[name])
+		if path := e.pluginManager.PluginPath(name); path != "" {
+			line += " " + path
+		}
+		if len(deps) > 0 {
+			line += " (requires " + strings.Join(deps, ", ") + ")"
+		}
+		content = append(content, line)
+	}
+	return e.showHelpBuffer("*Plugins*", content)
+}
+
+// pluginErrorsBuffer lists plugin failures, most recent last.
+const pluginErrorsBuffer = "*Plugin Errors*"
+
+// pluginFailed records a plugin panic, slow call or stop and disables
+// the plugin when the manager asks for it. A plugin that was only slow is
+// unloaded for this session but not disabled for good, since a long
+// command may simply have had a lot to do. The work is posted so that
+// the plugin is not unloaded in the middle of the call that failed.
+func (e *Editor) pluginFailed(f plugin.Failure) {
+	e.post(func() {
+		e.logPluginError(f.Time, f.Err, f.Stack)
+
+		switch {
+		case !f.Disable:
+			e.showMessage(fmt.Sprintf("Plugin %s failed in %s; see M-x plugin-errors", f.Plugin, f.Operation))
+		case f.Slow:
+			if !e.pluginManager.IsLoaded(f.Plugin) {
+				return
+			}
+			if err := e.unloadPlugin(f.Plugin); err != nil {
+				e.showMessage(fmt.Sprintf("Failed to unload plugin %s: %v", f.Plugin, err))
+				return
+			}
+			e.showMessage(fmt.Sprintf("Plugin %s unloaded until restart; see M-x plugin-errors", f.Plugin))
+		default:
+			if err := e.setPluginDisabled(f.Plugin, true); err != nil {
+				e.showMessage(fmt.Sprintf("Failed to disable plugin %s: %v", f.Plugin, err))
+				return
+			}
+			e.showMessage(fmt.Sprintf("Plugin %s disabled; see M-x plugin-errors", f.Plugin))
+		}
+	})
+}
+
+// recordPluginError logs a plugin that could not be loaded.
+func (e *Editor) recordPluginError(err error) {
+	e.logPluginError(time.Now(), err, "")
+	e.showMessage(fmt.Sprintf("%v; see M-x plugin-errors", err))
+}
+
+// logPluginError appends an entry to *Plugin Errors*.
+func (e *Editor) logPluginError(t time.Time, err error, stack string) {
+	e.pluginErrors = append(e.pluginErrors, fmt.Sprintf("%s %v", t.Format("2006-01-02 15:04:05"), err))
+	for _, line := range strings.Split(strings.TrimRight(stack, "\n"), "\n") {
+		if line != "" {
+			e.pluginErrors = append(e.pluginErrors, "    "+line)
+		}
+	}
+	e.pluginErrors = append(e.pluginErrors, "")
+
+	for _, buf := range e.bufferManager.ListBuffers() {
+		if buf.Name == pluginErrorsBuffer && buf.ReadOnly && buf.Filename == "" {
+			buf.Lines = e.pluginErrorLines()
+		}
+	}
+}
+
+func (e *Editor) pluginErrorLines() []string {
+	if len(e.pluginErrors) == 0 {
+		return []string{"No plugin errors."}
+	}
+	return append([]string(nil), e.pluginErrors...)
+}
@@ -0,0 +1,244 @@
+package editor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/TakahashiShuuhei/edito/internal/plugin"
+)
+
+// outdatedBuffer lists plugins with newer versions available.
+const outdatedBuffer = "*Outdated Plugins*"
+
+var errUpgrading = errors.New("a plugin update is already running")
+
+func (e *Editor) setupUpgradeCommands() {
+	e.commandRegistry.Register("cancel-plugin-installs", "Stop installing the plugins of config.go", func(args []string) error {
+		if e.installCancel == nil {
+			return fmt.Errorf("no plugins are being installed")
+		}
+		e.installCancel()
+		return nil
+	})
+
+	e.commandRegistry.Register("list-outdated", "List plugins with newer versions available", func(args []string) error {
+		return e.inBackground("Checking for plugin updates...", func() func() error {
+			lines, err := e.outdatedLines()
+			return func() error {
+				if err != nil {
+					return err
+				}
+				return e.showHelpBuffer(outdatedBuffer, lines)
+			}
+		})
+	})
+
+	e.commandRegistry.Register("upgrade-plugin", "Upgrade a plugin to the newest version its constraint allows", func(args []string) error {
+		if e.upgrading {
+			return errUpgrading
+		}
+		return e.withPluginName(args, "Upgrade plugin: ", e.upgradablePlugins(), func(name string) error {
+			return e.inBackground(fmt.Sprintf("Upgrading %s...", name), func() func() error {
+				version, err := e.upgradePlugin(name)
+				return func() error {
+					if err != nil {
+						return err
+					}
+					e.showMessage(fmt.Sprintf("Plugin %s is at %s; restart edito to use a new version", name, version))
+					return nil
+				}
+			})
+		})
+	})
+
+	e.commandRegistry.Register("upgrade-plugins", "Upgrade every plugin to the newest version its constraint allows", func(args []string) error {
+		return e.inBackground("Upgrading plugins...", func() func() error {
+			var failed []string
+			for _, name := range e.upgradablePlugins() {
+				if _, err := e.upgradePlugin(name); err != nil {
+					e.post(func() { e.recordPluginError(fmt.Errorf("failed to upgrade %s: %v", name, err)) })
+					failed = append(failed, name)
+				}
+			}
+			return func() error {
+				if len(failed) > 0 {
+					return fmt.Errorf("failed to upgrade %v; see M-x plugin-errors", failed)
+				}
+				e.showMessage("Plugins upgraded; restart edito to use the new versions")
+				return nil
+			}
+		})
+	})
+}
+
+// checkAndInstallPlugins installs the plugins of config.go that are
+// missing or at another version, building several at once in the
+// background. Each plugin is loaded as soon as it is installed. Like the
+// jobs of inBackground, it keeps other installs and upgrades from running
+// until it is done.
+func (e *Editor) checkAndInstallPlugins() {
+	if e.autoInstaller == nil || len(e.configPluginSpecs) == 0 {
+		return
+	}
+
+	// Plugins under development are built from their directories
+	// instead of being installed.
+	var specs []plugin.PluginSpec
+	for _, spec := range e.configPluginSpecs {
+		if spec.Develop() {
+			e.developPlugin(spec.Name, spec.Repository)
+		} else {
+			specs = append(specs, spec)
+		}
+	}
+	if len(specs) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	e.installCancel = cancel
+	e.upgrading = true
+	go func() {
+		defer cancel()
+		err := e.autoInstaller.InstallAll(ctx, specs, func(p plugin.Progress) {
+			e.post(func() { e.pluginInstalled(p) })
+		})
+		e.post(func() {
+			e.installCancel = nil
+			e.upgrading = false
+			switch {
+			case ctx.Err() != nil:
+				e.showMessage("Plugin installation cancelled")
+			case err != nil:
+				e.showMessage("Some plugins failed to install; see M-x plugin-errors")
+			default:
+				e.reportConfigErrors()
+			}
+		})
+	}()
+}
+
+// pluginInstalled reports the progress of checkAndInstallPlugins.
+func (e *Editor) pluginInstalled(p plugin.Progress) {
+	switch p.State {
+	case plugin.InstallBuilding:
+		e.showMessage(fmt.Sprintf("Building plugin %s... (M-x cancel-plugin-installs to stop)", p.Name))
+	case plugin.InstallInstalled:
+		e.showMessage(fmt.Sprintf("Installed plugin %s (%d/%d)", p.Name, p.Done, p.Total))
+		if e.pluginState.IsDisabled(p.Name) || e.pluginManager.IsLoaded(p.Name) {
+			return
+		}
+		if err := e.loadPluginByName(p.Name); err != nil {
+			e.recordPluginError(err)
+		}
+	case plugin.InstallFailed:
+		e.recordPluginError(fmt.Errorf("failed to install plugin %s: %v", p.Name, p.Err))
+	}
+}
+
+// inBackground runs work on another goroutine, since it talks to the go
+// tool and the network, and runs the function it returns on the editor
+// goroutine. Only one such job runs at a time.
+func (e *Editor) inBackground(message string, work func() func() error) error {
+	if e.upgrading {
+		return errUpgrading
+	}
+	e.upgrading = true
+	e.showMessage(message)
+	go func() {
+		done := work()
+		e.post(func() {
+			e.upgrading = false
+			if err := done(); err != nil {
+				e.showMessage(err.Error())
+			}
+		})
+	}()
+	return nil
+}
+
+// upgradablePlugins returns the plugins installed from config.go specs or
+// from a registry.
+func (e *Editor) upgradablePlugins() []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, spec := range e.configPluginSpecs {
+		seen[spec.Name] = true
+		if !spec.Develop() {
+			names = append(names, spec.Name)
+		}
+	}
+	for _, p := range e.installedDB.List() {
+		if !seen[p.Name] && e.packageManager.IsRegistry(p.Source) {
+			names = append(names, p.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (e *Editor) specFor(name string) (plugin.PluginSpec, bool) {
+	for _, spec := range e.configPluginSpecs {
+		if spec.Name == name {
+			return spec, true
+		}
+	}
+	return plugin.PluginSpec{}, false
+}
+
+// upgradePlugin runs off the editor goroutine.
+func (e *Editor) upgradePlugin(name string) (string, error) {
+	if spec, ok := e.specFor(name); ok {
+		return e.autoInstaller.Upgrade(spec)
+	}
+	if err := e.packageManager.UpdateRegistry(); err != nil {
+		return "", err
+	}
+	if err := e.packageManager.InstallPackage(name); err != nil {
+		return "", err
+	}
+	p, _ := e.installedDB.Get(name)
+	return p.Version, nil
+}
+
+// outdatedLines runs off the editor goroutine.
+func (e *Editor) outdatedLines() ([]string, error) {
+	updates, err := e.autoInstaller.Outdated(e.configPluginSpecs)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := []string{fmt.Sprintf("%-24s %-12s %-12s %s", "Plugin", "Installed", "Wanted", "Latest")}
+	for _, u := range updates {
+		lines = append(lines, fmt.Sprintf("%-24s %-12s %-12s %s", u.Name, u.Installed, u.Wanted, u.Latest))
+	}
+
+	registry := false
+	for _, name := range e.upgradablePlugins() {
+		if _, ok := e.specFor(name); !ok {
+			registry = true
+		}
+	}
+	if registry {
+		if err := e.packageManager.UpdateRegistry(); err != nil {
+			return nil, err
+		}
+		outdated := e.packageManager.Outdated()
+		names := make([]string, 0, len(outdated))
+		for name := range outdated {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			p, _ := e.installedDB.Get(name)
+			lines = append(lines, fmt.Sprintf("%-24s %-12s %-12s %s", name, p.Version, outdated[name], outdated[name]))
+		}
+	}
+
+	if len(lines) == 1 {
+		return []string{"All plugins are up to date."}, nil
+	}
+	return append(lines, "", "Run M-x upgrade-plugin or M-x upgrade-plugins to upgrade."), nil
+}
@@ -0,0 +1,199 @@
+// Package eventloop schedules work on the editor goroutine: functions
+// posted from other goroutines, timers and idle callbacks. The editor
+// waits on Wake and the Next timer alongside terminal events, and calls
+// RunDue after each of them.
+package eventloop
+
+import (
+	"sync"
+	"time"
+)
+
+// Timer is a scheduled callback. Every timer has an owner, "" for the
+// core, so that a plugin's timers can be removed when it is unloaded.
+type Timer struct {
+	loop     *Loop
+	owner    string
+	fn       func()
+	due      time.Time // zero while an idle timer waits for input
+	interval time.Duration
+	idle     time.Duration
+	stopped  bool
+}
+
+// Stop cancels the timer. It is safe to call more than once and from any
+// goroutine.
+func (t *Timer) Stop() {
+	t.loop.mutex.Lock()
+	defer t.loop.mutex.Unlock()
+
+	t.loop.remove(t)
+}
+
+type Loop struct {
+	mutex     sync.Mutex
+	posted    []func()
+	timers    []*Timer
+	lastInput time.Time
+	wake      chan struct{}
+}
+
+func New() *Loop {
+	return &Loop{
+		lastInput: time.Now(),
+		wake:      make(chan struct{}, 1),
+	}
+}
+
+// Wake receives a value whenever there is new work: a posted function or
+// a timer that may be due earlier than the editor expected.
+func (l *Loop) Wake() <-chan struct{} {
+	return l.wake
+}
+
+func (l *Loop) notify() {
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Post schedules fn to run on the editor goroutine. It is safe to call
+// from any goroutine.
+func (l *Loop) Post(fn func()) {
+	l.mutex.Lock()
+	l.posted = append(l.posted, fn)
+	l.mutex.Unlock()
+	l.notify()
+}
+
+// RunAfter runs fn once, after delay.
+func (l *Loop) RunAfter(owner string, delay time.Duration, fn func()) *Timer {
+	return l.add(&Timer{owner: owner, fn: fn, due: time.Now().Add(delay)})
+}
+
+// RunEvery runs fn every interval until the timer is stopped.
+func (l *Loop) RunEvery(owner string, interval time.Duration, fn func()) *Timer {
+	if interval <= 0 {
+		interval = time.Millisecond
+	}
+	return l.add(&Timer{owner: owner, fn: fn, due: time.Now().Add(interval), interval: interval})
+}
+
+// RunWhenIdle runs fn each time there has been no input for delay. It
+// runs once per idle period and again only after the next input.
+func (l *Loop) RunWhenIdle(owner string, delay time.Duration, fn func()) *Timer {
+	l.mutex.Lock()
+	due := l.lastInput.Add(delay)
+	l.mutex.Unlock()
+	return l.add(&Timer{owner: owner, fn: fn, due: due, idle: delay})
+}
+
+func (l *Loop) add(t *Timer) *Timer {
+	t.loop = l
+	l.mutex.Lock()
+	l.timers = append(l.timers, t)
+	l.mutex.Unlock()
+	l.notify()
+	return t
+}
+
+// remove must be called with the mutex held.
+func (l *Loop) remove(t *Timer) {
+	t.stopped = true
+	for i, timer := range l.timers {
+		if timer == t {
+			l.timers = append(l.timers[:i], l.timers[i+1:]...)
+			return
+		}
+	}
+}
+
+// RemoveOwner stops every timer of owner.
+func (l *Loop) RemoveOwner(owner string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	timers := l.timers[:0]
+	for _, t := range l.timers {
+		if t.owner == owner {
+			t.stopped = true
+			continue
+		}
+		timers = append(timers, t)
+	}
+	l.timers = timers
+}
+
+// Input records user activity at now, which restarts the idle timers.
+func (l *Loop) Input(now time.Time) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.lastInput = now
+	for _, t := range l.timers {
+		if t.idle > 0 {
+			t.due = now.Add(t.idle)
+		}
+	}
+}
+
+// Next returns how long after now the next timer is due. ok is false when
+// no timer is pending.
+func (l *Loop) Next(now time.Time) (wait time.Duration, ok bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	var next time.Time
+	for _, t := range l.timers {
+		if !t.due.IsZero() && (next.IsZero() || t.due.Before(next)) {
+			next = t.due
+		}
+	}
+	if next.IsZero() {
+		return 0, false
+	}
+	if wait = next.Sub(now); wait < 0 {
+		wait = 0
+	}
+	return wait, true
+}
+
+// RunDue runs the posted functions and then the timers that are due at
+// now. It must be called on the editor goroutine.
+func (l *Loop) RunDue(now time.Time) {
+	l.mutex.Lock()
+	posted := l.posted
+	l.posted = nil
+
+	var due []*Timer
+	for _, t := range append([]*Timer(nil), l.timers...) {
+		if t.due.IsZero() || t.due.After(now) {
+			continue
+		}
+		due = append(due, t)
+		switch {
+		case t.interval > 0:
+			t.due = now.Add(t.interval)
+		case t.idle > 0:
+			t.due = time.Time{}
+		default:
+			l.remove(t)
+			// remove marks it stopped; it still runs this once.
+			t.stopped = false
+		}
+	}
+	l.mutex.Unlock()
+
+	for _, fn := range posted {
+		fn()
+	}
+	for _, t := range due {
+		l.mutex.Lock()
+		stopped := t.stopped
+		l.mutex.Unlock()
+		if !stopped {
+			t.fn()
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package eventloop
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTimers(t *testing.T) {
+	l := New()
+	start := time.Now()
+	var ran []string
+
+	l.RunAfter("", 10*time.Millisecond, func() { ran = append(ran, "after") })
+	every := l.RunEvery("", 5*time.Millisecond, func() { ran = append(ran, "every") })
+	stopped := l.RunAfter("", time.Millisecond, func() { ran = append(ran, "stopped") })
+	stopped.Stop()
+
+	if wait, ok := l.Next(time.Now()); !ok || wait > 5*time.Millisecond {
+		t.Errorf("Next() = %v, %v; want at most 5ms", wait, ok)
+	}
+
+	l.RunDue(start.Add(6 * time.Millisecond))
+	l.RunDue(start.Add(20 * time.Millisecond))
+	l.RunDue(start.Add(40 * time.Millisecond))
+	every.Stop()
+	l.RunDue(start.Add(time.Second))
+
+	want := []string{"every", "after", "every", "every"}
+	if !reflect.DeepEqual(ran, want) {
+		t.Errorf("ran %v, want %v", ran, want)
+	}
+	if _, ok := l.Next(start); ok {
+		t.Error("timers still pending after all were stopped or ran")
+	}
+}
+
+func TestIdleTimersRunOncePerIdlePeriod(t *testing.T) {
+	l := New()
+	now := time.Now()
+	l.Input(now)
+	count := 0
+	l.RunWhenIdle("", time.Second, func() { count++ })
+
+	l.RunDue(now.Add(500 * time.Millisecond))
+	l.RunDue(now.Add(2 * time.Second))
+	l.RunDue(now.Add(5 * time.Second))
+	if count != 1 {
+		t.Fatalf("idle timer ran %d times in one idle period, want 1", count)
+	}
+
+	l.Input(now.Add(6 * time.Second))
+	l.RunDue(now.Add(7 * time.Second))
+	if count != 2 {
+		t.Errorf("idle timer ran %d times after new input, want 2", count)
+	}
+}
+
+func TestPostAndRemoveOwner(t *testing.T) {
+	l := New()
+	var ran []string
+	l.RunAfter("plugin", 0, func() { ran = append(ran, "plugin") })
+	l.RunAfter("", 0, func() { ran = append(ran, "core") })
+	l.RemoveOwner("plugin")
+
+	done := make(chan struct{})
+	go func() {
+		l.Post(func() { ran = append(ran, "posted") })
+		close(done)
+	}()
+	<-done
+
+	select {
+	case <-l.Wake():
+	default:
+		t.Fatal("Post did not wake the loop")
+	}
+	l.RunDue(time.Now().Add(time.Millisecond))
+	if want := []string{"posted", "core"}; !reflect.DeepEqual(ran, want) {
+		t.Errorf("ran %v, want %v", ran, want)
+	}
+}
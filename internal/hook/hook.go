@@ -0,0 +1,122 @@
+// Package hook runs handlers registered for editor events
+package hook
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/TakahashiShuuhei/edito/internal/api"
+)
+
+// Events that the editor emits.
+const (
+	FileOpened     = "file-opened"
+	BeforeSave     = "before-save"
+	AfterSave      = "after-save"
+	BufferSwitched = "buffer-switched"
+	BufferKilled   = "buffer-killed"
+	BeforeCommand  = "before-command"
+	AfterCommand   = "after-command"
+	ModeEnabled    = "mode-enabled"
+	Idle           = "idle"
+	EditorExit     = "editor-exit"
+)
+
+var events = []string{
+	FileOpened, BeforeSave, AfterSave, BufferSwitched, BufferKilled,
+	BeforeCommand, AfterCommand, ModeEnabled, Idle, EditorExit,
+}
+
+// Context is passed to every handler of an event.
+type Context = api.HookContext
+
+type Handler func(ctx *Context)
+
+type entry struct {
+	owner   string
+	handler Handler
+}
+
+// Bus keeps the handlers of each event in registration order.
+type Bus struct {
+	handlers map[string][]entry
+}
+
+func New() *Bus {
+	return &Bus{
+		handlers: make(map[string][]entry),
+	}
+}
+
+// Events returns the names of all events.
+func Events() []string {
+	return append([]string(nil), events...)
+}
+
+// Cancellable reports whether handlers of event may cancel it.
+func Cancellable(event string) bool {
+	return strings.HasPrefix(event, "before-")
+}
+
+// Add registers handler for event on behalf of owner.
+func (b *Bus) Add(event, owner string, handler Handler) error {
+	if !known(event) {
+		return fmt.Errorf("unknown hook event: %s", event)
+	}
+	b.handlers[event] = append(b.handlers[event], entry{owner: owner, handler: handler})
+	return nil
+}
+
+// RemoveOwner deletes every handler registered by owner.
+func (b *Bus) RemoveOwner(owner string) {
+	for event, entries := range b.handlers {
+		kept := entries[:0]
+		for _, e := range entries {
+			if e.owner != owner {
+				kept = append(kept, e)
+			}
+		}
+		b.handlers[event] = kept
+	}
+}
+
+// Run calls the handlers of ctx.Event in order. A panicking handler is
+// reported as an error and does not stop the others. For cancellable
+// events Run stops at the first handler that cancels.
+func (b *Bus) Run(ctx *Context) []error {
+	var errs []error
+	// Copy so that handlers may register or remove hooks while running.
+	entries := append([]entry(nil), b.handlers[ctx.Event]...)
+	for _, e := range entries {
+		if err := call(e, ctx); err != nil {
+			errs = append(errs, err)
+		}
+		if cancelled, _ := ctx.Cancelled(); cancelled && Cancellable(ctx.Event) {
+			break
+		}
+	}
+	return errs
+}
+
+func call(e entry, ctx *Context) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			owner := e.owner
+			if owner == "" {
+				owner = "built-in"
+			}
+			err = fmt.Errorf("%s hook from %s panicked: %v", ctx.Event, owner, r)
+		}
+	}()
+	e.handler(ctx)
+	return nil
+}
+
+func known(event string) bool {
+	for _, name := range events {
+		if name == event {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package hook
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRunInOrderAndRecover(t *testing.T) {
+	b := New()
+	var calls []string
+	b.Add(AfterSave, "a", func(ctx *Context) { calls = append(calls, "a") })
+	b.Add(AfterSave, "bad", func(ctx *Context) { panic("boom") })
+	b.Add(AfterSave, "c", func(ctx *Context) { calls = append(calls, "c") })
+
+	errs := b.Run(&Context{Event: AfterSave})
+	if len(errs) != 1 {
+		t.Fatalf("Run returned %d errors, want 1", len(errs))
+	}
+	if want := []string{"a", "c"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+}
+
+func TestCancelStopsBeforeEvent(t *testing.T) {
+	b := New()
+	ran := false
+	b.Add(BeforeSave, "guard", func(ctx *Context) { ctx.Cancel("read only") })
+	b.Add(BeforeSave, "later", func(ctx *Context) { ran = true })
+
+	ctx := &Context{Event: BeforeSave}
+	b.Run(ctx)
+	if cancelled, reason := ctx.Cancelled(); !cancelled || reason != "read only" {
+		t.Errorf("Cancelled() = %v, %q", cancelled, reason)
+	}
+	if ran {
+		t.Error("handler after Cancel was run")
+	}
+}
+
+func TestRemoveOwnerAndUnknownEvent(t *testing.T) {
+	b := New()
+	ran := false
+	b.Add(Idle, "plugin", func(ctx *Context) { ran = true })
+	b.RemoveOwner("plugin")
+	b.Run(&Context{Event: Idle})
+	if ran {
+		t.Error("removed handler was run")
+	}
+
+	if err := b.Add("no-such-event", "", func(ctx *Context) {}); err == nil {
+		t.Error("Add accepted an unknown event")
+	}
+}
@@ -1,20 +1,30 @@
 package keybinding
 
 import (
+	"strings"
+
 	"github.com/nsf/termbox-go"
 )
 
 type KeyHandler func()
 
-type KeyBinding struct {
+// KeyPress is a single key of a key sequence. Either Key or Ch is set.
+type KeyPress struct {
 	Key      termbox.Key
 	Ch       rune
 	Modifier termbox.Modifier
+}
+
+type KeyBinding struct {
+	Sequence []KeyPress
 	Handler  KeyHandler
+	// Owner is the plugin that created the binding, or "" for the core.
+	Owner string
 }
 
 type KeyMap struct {
 	bindings []KeyBinding
+	pending  []KeyPress
 }
 
 func NewKeyMap() *KeyMap {
@@ -24,13 +34,7 @@ func NewKeyMap() *KeyMap {
 }
 
 func (km *KeyMap) Bind(key termbox.Key, ch rune, modifier termbox.Modifier, handler KeyHandler) {
-	binding := KeyBinding{
-		Key:      key,
-		Ch:       ch,
-		Modifier: modifier,
-		Handler:  handler,
-	}
-	km.bindings = append(km.bindings, binding)
+	km.BindSequence([]KeyPress{{Key: key, Ch: ch, Modifier: modifier}}, "", handler)
 }
 
 func (km *KeyMap) BindKey(key termbox.Key, handler KeyHandler) {
@@ -45,29 +49,112 @@ func (km *KeyMap) BindCtrl(ch rune, handler KeyHandler) {
 	km.Bind(0, ch, termbox.ModAlt, handler)
 }
 
+// BindSequence binds a key sequence on behalf of owner. A later binding
+// of the same sequence takes precedence over an earlier one.
+func (km *KeyMap) BindSequence(sequence []KeyPress, owner string, handler KeyHandler) {
+	km.bindings = append(km.bindings, KeyBinding{
+		Sequence: sequence,
+		Handler:  handler,
+		Owner:    owner,
+	})
+}
+
+// BindString binds a key sequence written in Emacs notation, e.g. "C-x C-s".
+func (km *KeyMap) BindString(keys, owner string, handler KeyHandler) error {
+	sequence, err := ParseKeySequence(keys)
+	if err != nil {
+		return err
+	}
+	km.BindSequence(sequence, owner, handler)
+	return nil
+}
+
+// RemoveOwner deletes every binding created by owner.
+func (km *KeyMap) RemoveOwner(owner string) {
+	bindings := km.bindings[:0]
+	for _, b := range km.bindings {
+		if b.Owner != owner {
+			bindings = append(bindings, b)
+		}
+	}
+	km.bindings = bindings
+}
+
+// Bindings returns the bindings in the order they were made.
+func (km *KeyMap) Bindings() []KeyBinding {
+	return km.bindings
+}
+
+// Pending returns the prefix keys typed so far, e.g. "C-x", or "".
+func (km *KeyMap) Pending() string {
+	return FormatKeySequence(km.pending)
+}
+
+// Handle processes one key event. It returns true if the event was part
+// of a bound key sequence, including a prefix waiting for more keys.
+//
+// The newest binding the keys typed so far lead to decides: a newer
+// "C-a C-b" turns C-a into a prefix, while a newer "C-a" hides the
+// longer sequences bound before it.
 func (km *KeyMap) Handle(ev termbox.Event) bool {
-	for _, binding := range km.bindings {
-		if binding.matches(ev) {
+	km.pending = append(km.pending, pressFromEvent(ev))
+
+	for i := len(km.bindings) - 1; i >= 0; i-- {
+		binding := km.bindings[i]
+		if !sequenceHasPrefix(binding.Sequence, km.pending) {
+			continue
+		}
+		if len(binding.Sequence) == len(km.pending) {
+			km.pending = nil
 			binding.Handler()
-			return true
 		}
+		return true
 	}
-	return false
+
+	// An unbound key after a prefix is swallowed, like Emacs does.
+	consumed := len(km.pending) > 1
+	km.pending = nil
+	return consumed
 }
 
-func (b *KeyBinding) matches(ev termbox.Event) bool {
-	if b.Key != 0 && ev.Key != b.Key {
-		return false
+func pressFromEvent(ev termbox.Event) KeyPress {
+	press := KeyPress{Modifier: ev.Mod & termbox.ModAlt}
+	if ev.Ch != 0 {
+		press.Ch = ev.Ch
+	} else {
+		press.Key = ev.Key
 	}
-	if b.Ch != 0 && ev.Ch != b.Ch {
+	return press
+}
+
+func sequenceHasPrefix(sequence, prefix []KeyPress) bool {
+	if len(prefix) > len(sequence) {
 		return false
 	}
-	if b.Modifier != 0 && ev.Mod != b.Modifier {
-		return false
+	for i := range prefix {
+		if !sequence[i].matches(prefix[i]) {
+			return false
+		}
 	}
 	return true
 }
 
+func (p KeyPress) matches(other KeyPress) bool {
+	if p.Ch != 0 || other.Ch != 0 {
+		return p.Ch == other.Ch && p.Modifier == other.Modifier
+	}
+	return p.Key == other.Key && p.Modifier == other.Modifier
+}
+
 func CreateEmacsKeyMap() *KeyMap {
 	return NewKeyMap()
-}
\ No newline at end of file
+}
+
+// FormatKeySequence renders a key sequence in Emacs notation.
+func FormatKeySequence(sequence []KeyPress) string {
+	parts := make([]string, len(sequence))
+	for i, press := range sequence {
+		parts[i] = press.String()
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,122 @@
+package keybinding
+
+import (
+	"testing"
+
+	"github.com/nsf/termbox-go"
+)
+
+func TestParseKeySequence(t *testing.T) {
+	tests := []struct {
+		keys string
+		want []KeyPress
+	}{
+		{"C-x C-s", []KeyPress{{Key: termbox.KeyCtrlX}, {Key: termbox.KeyCtrlS}}},
+		{"M-g g", []KeyPress{{Ch: 'g', Modifier: termbox.ModAlt}, {Ch: 'g'}}},
+		{"C-c <f5>", []KeyPress{{Key: termbox.KeyCtrlC}, {Key: termbox.KeyF5}}},
+		{"C-SPC", []KeyPress{{Key: termbox.KeyCtrlSpace}}},
+	}
+	for _, tt := range tests {
+		got, err := ParseKeySequence(tt.keys)
+		if err != nil {
+			t.Errorf("ParseKeySequence(%q) failed: %v", tt.keys, err)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("ParseKeySequence(%q) = %v, want %v", tt.keys, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("ParseKeySequence(%q)[%d] = %+v, want %+v", tt.keys, i, got[i], tt.want[i])
+			}
+		}
+		if s := FormatKeySequence(got); s != tt.keys {
+			t.Errorf("FormatKeySequence(%q) = %q", tt.keys, s)
+		}
+	}
+
+	for _, keys := range []string{"", "C-", "C-RET", "foo"} {
+		if _, err := ParseKeySequence(keys); err == nil {
+			t.Errorf("ParseKeySequence(%q) succeeded, want error", keys)
+		}
+	}
+}
+
+func TestHandlePrefixSequence(t *testing.T) {
+	km := NewKeyMap()
+	saved := 0
+	if err := km.BindString("C-x C-s", "", func() { saved++ }); err != nil {
+		t.Fatal(err)
+	}
+
+	if !km.Handle(termbox.Event{Key: termbox.KeyCtrlX}) {
+		t.Fatal("prefix key was not consumed")
+	}
+	if km.Pending() != "C-x" {
+		t.Errorf("Pending() = %q, want C-x", km.Pending())
+	}
+	if !km.Handle(termbox.Event{Key: termbox.KeyCtrlS}) || saved != 1 {
+		t.Errorf("C-x C-s ran %d times, want 1", saved)
+	}
+	if km.Pending() != "" {
+		t.Errorf("Pending() = %q after complete sequence", km.Pending())
+	}
+
+	// An unbound key after a prefix is swallowed and resets the prefix.
+	km.Handle(termbox.Event{Key: termbox.KeyCtrlX})
+	if !km.Handle(termbox.Event{Ch: 'q'}) {
+		t.Error("unbound key after prefix was not consumed")
+	}
+	if km.Handle(termbox.Event{Ch: 'q'}) {
+		t.Error("plain unbound key was consumed")
+	}
+}
+
+func TestLaterBindingWinsAndRemoveOwner(t *testing.T) {
+	km := NewKeyMap()
+	got := ""
+	km.BindString("C-c C-f", "", func() { got = "core" })
+	km.BindString("C-c C-f", "go-mode", func() { got = "go-mode" })
+
+	km.Handle(termbox.Event{Key: termbox.KeyCtrlC})
+	km.Handle(termbox.Event{Key: termbox.KeyCtrlF})
+	if got != "go-mode" {
+		t.Errorf("handler = %q, want go-mode", got)
+	}
+
+	km.RemoveOwner("go-mode")
+	km.Handle(termbox.Event{Key: termbox.KeyCtrlC})
+	km.Handle(termbox.Event{Key: termbox.KeyCtrlF})
+	if got != "core" {
+		t.Errorf("handler after RemoveOwner = %q, want core", got)
+	}
+}
+
+func TestNewestBindingDecidesPrefix(t *testing.T) {
+	km := NewKeyMap()
+	got := ""
+	km.BindString("C-a", "", func() { got = "C-a" })
+	km.BindString("C-a C-b", "tree", func() { got = "C-a C-b" })
+
+	if !km.Handle(termbox.Event{Key: termbox.KeyCtrlA}) || got != "" {
+		t.Fatalf("C-a ran %q, want it to wait for the newer C-a C-b", got)
+	}
+	km.Handle(termbox.Event{Key: termbox.KeyCtrlB})
+	if got != "C-a C-b" {
+		t.Errorf("handler = %q, want C-a C-b", got)
+	}
+
+	km.RemoveOwner("tree")
+	km.Handle(termbox.Event{Key: termbox.KeyCtrlA})
+	if got != "C-a" {
+		t.Errorf("handler after RemoveOwner = %q, want C-a", got)
+	}
+
+	km.BindString("C-a C-b", "tree", func() { got = "C-a C-b" })
+	km.BindString("C-a", "", func() { got = "newest C-a" })
+	km.Handle(termbox.Event{Key: termbox.KeyCtrlA})
+	if got != "newest C-a" || km.Pending() != "" {
+		t.Errorf("handler = %q, pending %q, want the newest C-a", got, km.Pending())
+	}
+}
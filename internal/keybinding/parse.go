@@ -0,0 +1,134 @@
+package keybinding
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/nsf/termbox-go"
+)
+
+var namedKeys = map[string]termbox.Key{
+	"RET":      termbox.KeyEnter,
+	"TAB":      termbox.KeyTab,
+	"SPC":      termbox.KeySpace,
+	"ESC":      termbox.KeyEsc,
+	"DEL":      termbox.KeyBackspace2,
+	"<f1>":     termbox.KeyF1,
+	"<f2>":     termbox.KeyF2,
+	"<f3>":     termbox.KeyF3,
+	"<f4>":     termbox.KeyF4,
+	"<f5>":     termbox.KeyF5,
+	"<f6>":     termbox.KeyF6,
+	"<f7>":     termbox.KeyF7,
+	"<f8>":     termbox.KeyF8,
+	"<f9>":     termbox.KeyF9,
+	"<f10>":    termbox.KeyF10,
+	"<f11>":    termbox.KeyF11,
+	"<f12>":    termbox.KeyF12,
+	"<up>":     termbox.KeyArrowUp,
+	"<down>":   termbox.KeyArrowDown,
+	"<left>":   termbox.KeyArrowLeft,
+	"<right>":  termbox.KeyArrowRight,
+	"<home>":   termbox.KeyHome,
+	"<end>":    termbox.KeyEnd,
+	"<prior>":  termbox.KeyPgup,
+	"<next>":   termbox.KeyPgdn,
+	"<insert>": termbox.KeyInsert,
+	"<delete>": termbox.KeyDelete,
+}
+
+// ParseKeySequence parses a key sequence in Emacs notation such as
+// "C-x C-s", "M-g g", "C-c <f5>" or "C-SPC".
+func ParseKeySequence(keys string) ([]KeyPress, error) {
+	fields := strings.Fields(keys)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty key sequence")
+	}
+
+	sequence := make([]KeyPress, len(fields))
+	for i, field := range fields {
+		press, err := parseKeyPress(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key sequence %q: %v", keys, err)
+		}
+		sequence[i] = press
+	}
+	return sequence, nil
+}
+
+func parseKeyPress(field string) (KeyPress, error) {
+	var press KeyPress
+	ctrl := false
+	for {
+		switch {
+		case strings.HasPrefix(field, "C-") && len(field) > 2:
+			ctrl = true
+			field = field[2:]
+			continue
+		case strings.HasPrefix(field, "M-") && len(field) > 2:
+			press.Modifier = termbox.ModAlt
+			field = field[2:]
+			continue
+		}
+		break
+	}
+
+	if key, ok := namedKeys[field]; ok {
+		if ctrl {
+			if key != termbox.KeySpace {
+				return press, fmt.Errorf("C-%s is not supported", field)
+			}
+			key = termbox.KeyCtrlSpace
+		}
+		press.Key = key
+		return press, nil
+	}
+
+	ch, size := utf8.DecodeRuneInString(field)
+	if size != len(field) {
+		return press, fmt.Errorf("unknown key %q", field)
+	}
+	if !ctrl {
+		press.Ch = ch
+		return press, nil
+	}
+
+	switch {
+	case ch >= 'a' && ch <= 'z':
+		press.Key = termbox.KeyCtrlA + termbox.Key(ch-'a')
+	case ch == '@':
+		press.Key = termbox.KeyCtrlSpace
+	case ch == '/' || ch == '_':
+		press.Key = termbox.KeyCtrlUnderscore
+	case ch == ']':
+		press.Key = termbox.KeyCtrlRsqBracket
+	case ch == '\\':
+		press.Key = termbox.KeyCtrlBackslash
+	default:
+		return press, fmt.Errorf("C-%c is not supported", ch)
+	}
+	return press, nil
+}
+
+func (p KeyPress) String() string {
+	prefix := ""
+	if p.Modifier&termbox.ModAlt != 0 {
+		prefix = "M-"
+	}
+	if p.Ch != 0 {
+		return prefix + string(p.Ch)
+	}
+	for name, key := range namedKeys {
+		if key == p.Key {
+			return prefix + name
+		}
+	}
+	switch {
+	case p.Key == termbox.KeyCtrlSpace:
+		return prefix + "C-SPC"
+	case p.Key >= termbox.KeyCtrlA && p.Key <= termbox.KeyCtrlZ:
+		return prefix + "C-" + string(rune('a'+p.Key-termbox.KeyCtrlA))
+	}
+	return prefix + fmt.Sprintf("<key-%d>", p.Key)
+}
@@ -0,0 +1,51 @@
+// Package killring implements the Emacs kill ring shared by the buffers
+// and the minibuffer.
+package killring
+
+// DefaultSize is the number of kills remembered.
+const DefaultSize = 60
+
+type KillRing struct {
+	entries []string
+	maxSize int
+}
+
+func New(maxSize int) *KillRing {
+	if maxSize <= 0 {
+		maxSize = DefaultSize
+	}
+	return &KillRing{maxSize: maxSize}
+}
+
+// Push adds text as the most recent kill.
+func (k *KillRing) Push(text string) {
+	if text == "" {
+		return
+	}
+	k.entries = append([]string{text}, k.entries...)
+	if len(k.entries) > k.maxSize {
+		k.entries = k.entries[:k.maxSize]
+	}
+}
+
+// Append extends the most recent kill, so that consecutive kills are
+// yanked back as one piece. prepend is used for backward kills.
+func (k *KillRing) Append(text string, prepend bool) {
+	if len(k.entries) == 0 {
+		k.Push(text)
+		return
+	}
+	if prepend {
+		k.entries[0] = text + k.entries[0]
+	} else {
+		k.entries[0] += text
+	}
+}
+
+// Top returns the most recent kill, or "" if nothing has been killed.
+func (k *KillRing) Top() string {
+	if len(k.entries) == 0 {
+		return ""
+	}
+	return k.entries[0]
+}
@@ -0,0 +1,78 @@
+package minibuffer
+
+import (
+	"unicode"
+)
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// forwardWord returns the position after the end of the next word.
+func (mb *Minibuffer) forwardWord() int {
+	pos := mb.cursorPos
+	for pos < len(mb.input) && !isWordRune(mb.input[pos]) {
+		pos++
+	}
+	for pos < len(mb.input) && isWordRune(mb.input[pos]) {
+		pos++
+	}
+	return pos
+}
+
+// backwardWord returns the position of the start of the previous word.
+func (mb *Minibuffer) backwardWord() int {
+	pos := mb.cursorPos
+	for pos > 0 && !isWordRune(mb.input[pos-1]) {
+		pos--
+	}
+	for pos > 0 && isWordRune(mb.input[pos-1]) {
+		pos--
+	}
+	return pos
+}
+
+func (mb *Minibuffer) insertRunes(text []rune) {
+	input := make([]rune, 0, len(mb.input)+len(text))
+	input = append(input, mb.input[:mb.cursorPos]...)
+	input = append(input, text...)
+	input = append(input, mb.input[mb.cursorPos:]...)
+	mb.input = input
+	mb.cursorPos += len(text)
+}
+
+// deleteRange removes input[from:to] and returns the removed text.
+func (mb *Minibuffer) deleteRange(from, to int) string {
+	if from >= to {
+		return ""
+	}
+	removed := string(mb.input[from:to])
+	mb.input = append(mb.input[:from:from], mb.input[to:]...)
+	mb.cursorPos = from
+	return removed
+}
+
+// kill deletes input[from:to] and saves it in the kill ring. Consecutive
+// kills are merged into one kill ring entry.
+func (mb *Minibuffer) kill(from, to int) {
+	backward := from < mb.cursorPos
+	text := mb.deleteRange(from, to)
+	if text == "" {
+		return
+	}
+	if mb.killRing != nil {
+		if mb.lastWasKill {
+			mb.killRing.Append(text, backward)
+		} else {
+			mb.killRing.Push(text)
+		}
+	}
+	mb.thisIsKill = true
+}
+
+func (mb *Minibuffer) yank() {
+	if mb.killRing == nil {
+		return
+	}
+	mb.insertRunes([]rune(mb.killRing.Top()))
+}
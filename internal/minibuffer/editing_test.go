@@ -0,0 +1,84 @@
+package minibuffer
+
+import (
+	"testing"
+
+	"github.com/TakahashiShuuhei/edito/internal/killring"
+	"github.com/nsf/termbox-go"
+)
+
+func typeString(mb *Minibuffer, s string) {
+	for _, ch := range s {
+		mb.HandleKey(termbox.Event{Ch: ch})
+	}
+}
+
+func TestMultiByteInput(t *testing.T) {
+	mb := New()
+	mb.Activate(ModeInput, "> ", nil)
+	typeString(mb, "日本語")
+	mb.HandleKey(termbox.Event{Key: termbox.KeyArrowLeft})
+	mb.HandleKey(termbox.Event{Key: termbox.KeyBackspace2})
+
+	if got := mb.GetInput(); got != "日語" {
+		t.Errorf("input = %q, want %q", got, "日語")
+	}
+}
+
+func TestKillAndYank(t *testing.T) {
+	mb := New()
+	mb.SetKillRing(killring.New(10))
+	mb.Activate(ModeInput, "> ", nil)
+	typeString(mb, "find some file")
+
+	mb.HandleKey(termbox.Event{Key: termbox.KeyCtrlW})
+	mb.HandleKey(termbox.Event{Key: termbox.KeyCtrlW})
+	if got := mb.GetInput(); got != "find " {
+		t.Fatalf("after C-w C-w input = %q", got)
+	}
+
+	mb.HandleKey(termbox.Event{Key: termbox.KeyCtrlA})
+	mb.HandleKey(termbox.Event{Key: termbox.KeyCtrlY})
+	if got := mb.GetInput(); got != "some filefind " {
+		t.Errorf("consecutive kills should be yanked together, got %q", got)
+	}
+
+	mb.HandleKey(termbox.Event{Key: termbox.KeyCtrlA})
+	mb.HandleKey(termbox.Event{Mod: termbox.ModAlt, Ch: 'f'})
+	mb.HandleKey(termbox.Event{Key: termbox.KeyCtrlK})
+	if got := mb.GetInput(); got != "some" {
+		t.Errorf("after M-f C-k input = %q", got)
+	}
+}
+
+func TestCtrlGAborts(t *testing.T) {
+	called := false
+	mb := New()
+	mb.Activate(ModeInput, "> ", func(string) error {
+		called = true
+		return nil
+	})
+	typeString(mb, "abc")
+	mb.HandleKey(termbox.Event{Key: termbox.KeyCtrlG})
+
+	if mb.IsActive() || called {
+		t.Errorf("C-g should deactivate without calling the handler")
+	}
+}
+
+func TestHorizontalScroll(t *testing.T) {
+	mb := New()
+	mb.Activate(ModeInput, "> ", nil)
+	typeString(mb, "0123456789abcdefghij")
+
+	mb.scrollInput(10)
+	if mb.hscroll != 11 {
+		t.Errorf("hscroll = %d, want 11", mb.hscroll)
+	}
+
+	mb.HandleKey(termbox.Event{Key: termbox.KeyCtrlA})
+	mb.scrollInput(10)
+	if mb.hscroll != 0 {
+		t.Errorf("hscroll after C-a = %d, want 0", mb.hscroll)
+	}
+}
@@ -0,0 +1,119 @@
+package minibuffer
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// FileSource completes file system paths. The directory part of the input
+// selects the directory that is listed; the last path element is the query.
+type FileSource struct {
+	home    string
+	listDir string
+	entries []Completion
+}
+
+func NewFileSource() *FileSource {
+	home, _ := os.UserHomeDir()
+	return &FileSource{home: home}
+}
+
+func (fs *FileSource) Complete(input string) ([]Completion, string) {
+	input = ResolveFileInput(input)
+	dir, query := splitFileInput(input)
+
+	listDir := fs.Expand(dir)
+	if listDir == "" {
+		listDir = "."
+	}
+	if listDir != fs.listDir || fs.entries == nil {
+		fs.listDir = listDir
+		fs.entries = fs.list(listDir)
+	}
+
+	candidates := fs.entries
+	if !strings.HasPrefix(query, ".") {
+		candidates = make([]Completion, 0, len(fs.entries))
+		for _, c := range fs.entries {
+			if !strings.HasPrefix(c.Text, ".") {
+				candidates = append(candidates, c)
+			}
+		}
+	}
+
+	// Values are relative to the directory as the user typed it.
+	result := make([]Completion, len(candidates))
+	for i, c := range candidates {
+		c.Value = dir + c.Text
+		result[i] = c
+	}
+	return result, query
+}
+
+func (fs *FileSource) list(dir string) []Completion {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return []Completion{}
+	}
+
+	completions := make([]Completion, 0, len(entries))
+	for _, entry := range entries {
+		isDir := entry.IsDir()
+		if entry.Type()&os.ModeSymlink != 0 {
+			if stat, err := os.Stat(filepath.Join(dir, entry.Name())); err == nil {
+				isDir = stat.IsDir()
+			}
+		}
+		name := entry.Name()
+		if isDir {
+			name += "/"
+		}
+		completions = append(completions, Completion{Text: name, Continue: isDir})
+	}
+	sort.SliceStable(completions, func(i, j int) bool {
+		return completions[i].Text < completions[j].Text
+	})
+	return completions
+}
+
+// Expand replaces a leading "~" with the home directory.
+func (fs *FileSource) Expand(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		return fs.home + path[1:]
+	}
+	return path
+}
+
+// Abbreviate replaces the home directory prefix of path with "~".
+func (fs *FileSource) Abbreviate(path string) string {
+	if fs.home != "" && (path == fs.home || strings.HasPrefix(path, fs.home+"/")) {
+		return "~" + path[len(fs.home):]
+	}
+	return path
+}
+
+// ResolveFileInput applies the Emacs path reset rules: "//" starts over at
+// the root and "/~/" starts over at the home directory, so that a new path
+// can be typed after the default directory without deleting it first.
+func ResolveFileInput(input string) string {
+	if i := strings.LastIndex(input, "//"); i >= 0 {
+		input = input[i+1:]
+	}
+	if i := strings.LastIndex(input, "/~"); i >= 0 {
+		rest := input[i+1:]
+		if rest == "~" || strings.HasPrefix(rest, "~/") {
+			input = rest
+		}
+	}
+	return input
+}
+
+func splitFileInput(input string) (dir, base string) {
+	i := strings.LastIndex(input, "/")
+	if i < 0 {
+		return "", input
+	}
+	return input[:i+1], input[i+1:]
+}
@@ -0,0 +1,101 @@
+package minibuffer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nsf/termbox-go"
+)
+
+func TestResolveFileInput(t *testing.T) {
+	tests := map[string]string{
+		"/home/user/src/":      "/home/user/src/",
+		"/home/user/src//etc/": "/etc/",
+		"/home/user/src/~/x":   "~/x",
+		"~/a//b":               "/b",
+		"/tmp/a~b":             "/tmp/a~b",
+	}
+	for input, want := range tests {
+		if got := ResolveFileInput(input); got != want {
+			t.Errorf("ResolveFileInput(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestFileSourceListsDirectory(t *testing.T) {
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, "sub"), 0755)
+	os.WriteFile(filepath.Join(dir, "main.go"), nil, 0644)
+	os.WriteFile(filepath.Join(dir, ".hidden"), nil, 0644)
+
+	source := NewFileSource()
+	candidates, query := source.Complete(dir + "/ma")
+	if query != "ma" {
+		t.Errorf("query = %q, want %q", query, "ma")
+	}
+	if len(candidates) != 2 {
+		t.Fatalf("expected 2 visible candidates, got %v", candidates)
+	}
+
+	for _, c := range candidates {
+		switch c.Text {
+		case "sub/":
+			if !c.Continue || c.Value != dir+"/sub/" {
+				t.Errorf("unexpected directory candidate %+v", c)
+			}
+		case "main.go":
+			if c.Continue || c.Value != dir+"/main.go" {
+				t.Errorf("unexpected file candidate %+v", c)
+			}
+		default:
+			t.Errorf("unexpected candidate %q", c.Text)
+		}
+	}
+
+	if candidates, _ := source.Complete(dir + "/."); len(candidates) != 3 {
+		t.Errorf("expected dotfiles when query starts with '.', got %v", candidates)
+	}
+}
+
+func TestEnterKeepsANewFileName(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0644)
+	os.WriteFile(filepath.Join(dir, "newer.go"), nil, 0644)
+
+	find := func(keys ...termbox.Event) string {
+		var got string
+		mb := New()
+		mb.Activate(ModeInput, "Find file: ", func(input string) error {
+			got = input
+			return nil
+		})
+		mb.SetInput(dir + "/")
+		mb.SetSource(NewFileSource())
+		for _, ev := range keys {
+			mb.HandleKey(ev)
+		}
+		mb.HandleKey(termbox.Event{Key: termbox.KeyEnter})
+		return got
+	}
+	chars := func(s string) []termbox.Event {
+		var events []termbox.Event
+		for _, ch := range s {
+			events = append(events, termbox.Event{Ch: ch})
+		}
+		return events
+	}
+
+	if got := find(chars("nt")...); got != dir+"/nt" {
+		t.Errorf("new name matching notes.txt fuzzily submitted %q", got)
+	}
+	if got := find(chars("new")...); got != dir+"/new" {
+		t.Errorf("new name that starts newer.go submitted %q", got)
+	}
+	if got := find(); got != dir+"/" {
+		t.Errorf("Enter on the directory submitted %q", got)
+	}
+	if got := find(append(chars("nt"), termbox.Event{Key: termbox.KeyCtrlN}, termbox.Event{Key: termbox.KeyCtrlP})...); got != dir+"/notes.txt" {
+		t.Errorf("selected completion submitted as %q", got)
+	}
+}
@@ -0,0 +1,132 @@
+package minibuffer
+
+import (
+	"unicode"
+)
+
+// Scoring constants for FuzzyMatch, loosely modelled on fzf's algorithm:
+// every matched character scores, characters at word boundaries and runs
+// of consecutive characters score extra, and gaps between matches cost.
+const (
+	scoreMatch        = 16
+	scoreGapStart     = -3
+	scoreGapExtension = -1
+	bonusBoundary     = 8
+	bonusCamel        = 7
+	bonusConsecutive  = 4
+	bonusFirstChar    = 4
+)
+
+// FuzzyMatch reports whether every rune of pattern occurs in text in order
+// and, if so, returns a score (higher is better) and the rune indices of
+// text that were matched. Matching is case-insensitive unless pattern
+// contains an upper-case letter.
+func FuzzyMatch(pattern, text string) (int, []int, bool) {
+	p := []rune(pattern)
+	t := []rune(text)
+	if len(p) == 0 {
+		return 0, nil, true
+	}
+	if len(p) > len(t) {
+		return 0, nil, false
+	}
+
+	caseSensitive := false
+	for _, r := range p {
+		if unicode.IsUpper(r) {
+			caseSensitive = true
+			break
+		}
+	}
+	fold := func(r rune) rune {
+		if caseSensitive {
+			return r
+		}
+		return unicode.ToLower(r)
+	}
+
+	bonus := make([]int, len(t))
+	for j := range t {
+		bonus[j] = positionBonus(t, j)
+	}
+
+	// score[i][j] is the best score for matching p[:i+1] with p[i] at t[j];
+	// from[i][j] is the position of p[i-1] in that alignment.
+	const none = -1 << 30
+	score := make([][]int, len(p))
+	from := make([][]int, len(p))
+	for i := range p {
+		score[i] = make([]int, len(t))
+		from[i] = make([]int, len(t))
+		for j := range t {
+			score[i][j] = none
+			from[i][j] = -1
+			if fold(t[j]) != fold(p[i]) {
+				continue
+			}
+			base := scoreMatch + bonus[j]
+			if i == 0 {
+				score[i][j] = base
+				if j == 0 {
+					score[i][j] += bonusFirstChar
+				}
+				continue
+			}
+			for k := i - 1; k < j; k++ {
+				if score[i-1][k] == none {
+					continue
+				}
+				s := score[i-1][k] + base
+				if gap := j - k - 1; gap == 0 {
+					s += bonusConsecutive
+				} else {
+					s += scoreGapStart + scoreGapExtension*(gap-1)
+				}
+				if s > score[i][j] {
+					score[i][j] = s
+					from[i][j] = k
+				}
+			}
+		}
+	}
+
+	last := len(p) - 1
+	best, bestJ := none, -1
+	for j := range t {
+		if score[last][j] > best {
+			best, bestJ = score[last][j], j
+		}
+	}
+	if bestJ < 0 {
+		return 0, nil, false
+	}
+
+	positions := make([]int, len(p))
+	for i, j := last, bestJ; i >= 0; i-- {
+		positions[i] = j
+		j = from[i][j]
+	}
+	return best, positions, true
+}
+
+func positionBonus(t []rune, j int) int {
+	if j == 0 {
+		return bonusBoundary
+	}
+	prev, cur := t[j-1], t[j]
+	switch {
+	case isSeparator(prev) && !isSeparator(cur):
+		return bonusBoundary
+	case unicode.IsLower(prev) && unicode.IsUpper(cur):
+		return bonusCamel
+	}
+	return 0
+}
+
+func isSeparator(r rune) bool {
+	switch r {
+	case '-', '_', '/', '.', ' ', ':':
+		return true
+	}
+	return false
+}
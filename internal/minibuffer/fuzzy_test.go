@@ -0,0 +1,99 @@
+package minibuffer
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/nsf/termbox-go"
+)
+
+func TestFuzzyMatch(t *testing.T) {
+	tests := []struct {
+		pattern, text string
+		ok            bool
+		positions     []int
+	}{
+		{"", "anything", true, nil},
+		{"sb", "save-buffer", true, []int{0, 5}},
+		{"gl", "goto-line", true, []int{0, 5}},
+		{"GL", "goto-line", false, nil},
+		{"xyz", "save-buffer", false, nil},
+		{"buf", "kill-buffer", true, []int{5, 6, 7}},
+	}
+
+	for _, tt := range tests {
+		_, positions, ok := FuzzyMatch(tt.pattern, tt.text)
+		if ok != tt.ok {
+			t.Errorf("FuzzyMatch(%q, %q) ok = %v, want %v", tt.pattern, tt.text, ok, tt.ok)
+			continue
+		}
+		if ok && !reflect.DeepEqual(positions, tt.positions) {
+			t.Errorf("FuzzyMatch(%q, %q) positions = %v, want %v", tt.pattern, tt.text, positions, tt.positions)
+		}
+	}
+}
+
+func TestFuzzyMatchRanksBoundaryMatchesFirst(t *testing.T) {
+	boundary, _, _ := FuzzyMatch("sb", "switch-to-buffer")
+	inner, _, _ := FuzzyMatch("sb", "list-buffers")
+	if boundary <= inner {
+		t.Errorf("expected word-boundary match to score higher: %d <= %d", boundary, inner)
+	}
+}
+
+func TestFilterKeepsCandidatesAfterBackspace(t *testing.T) {
+	mb := New()
+	mb.Activate(ModeCommand, "M-x ", nil)
+	mb.SetCompletions([]Completion{
+		{Text: "save-buffer"},
+		{Text: "kill-buffer"},
+		{Text: "quit"},
+	})
+
+	mb.HandleKey(termbox.Event{Ch: 'q'})
+	if got := len(mb.Completions()); got != 1 {
+		t.Fatalf("expected 1 completion after typing, got %d", got)
+	}
+
+	mb.HandleKey(termbox.Event{Key: termbox.KeyBackspace})
+	if got := len(mb.Completions()); got != 3 {
+		t.Fatalf("expected all completions after backspace, got %d", got)
+	}
+}
+
+func TestSelectionScrollsPopup(t *testing.T) {
+	mb := New()
+	mb.Activate(ModeCommand, "M-x ", nil)
+	candidates := make([]Completion, 15)
+	for i := range candidates {
+		candidates[i] = Completion{Text: string(rune('a' + i))}
+	}
+	mb.SetCompletions(candidates)
+
+	for i := 0; i < 12; i++ {
+		mb.HandleKey(termbox.Event{Key: termbox.KeyArrowDown})
+	}
+	if mb.selectedComp != 12 {
+		t.Fatalf("expected selection 12, got %d", mb.selectedComp)
+	}
+	if mb.scrollOffset != 3 {
+		t.Errorf("expected scroll offset 3, got %d", mb.scrollOffset)
+	}
+}
+
+func TestRequireMatchTakesFuzzySelection(t *testing.T) {
+	var got string
+	mb := New()
+	mb.Activate(ModeCommand, "M-x ", func(input string) error {
+		got = input
+		return nil
+	})
+	mb.RequireMatch()
+	mb.SetCompletions([]Completion{{Text: "save-buffer"}, {Text: "quit"}})
+	mb.HandleKey(termbox.Event{Ch: 's'})
+	mb.HandleKey(termbox.Event{Ch: 'b'})
+	mb.HandleKey(termbox.Event{Key: termbox.KeyEnter})
+	if got != "save-buffer" {
+		t.Errorf("submitted %q, want save-buffer", got)
+	}
+}
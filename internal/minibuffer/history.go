@@ -0,0 +1,112 @@
+package minibuffer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// History categories. Each kind of prompt keeps its own input history.
+const (
+	HistoryCommand  = "command"
+	HistoryFile     = "file"
+	HistoryGotoLine = "goto-line"
+)
+
+// DefaultHistorySize is the number of entries kept per category.
+const DefaultHistorySize = 100
+
+// History stores minibuffer inputs per category, most recent first, and
+// persists them to a JSON file.
+type History struct {
+	path    string
+	maxSize int
+	entries map[string][]string
+}
+
+func NewHistory(path string, maxSize int) *History {
+	if maxSize <= 0 {
+		maxSize = DefaultHistorySize
+	}
+	return &History{
+		path:    path,
+		maxSize: maxSize,
+		entries: make(map[string][]string),
+	}
+}
+
+// Load reads the history file. A missing file is not an error.
+func (h *History) Load() error {
+	data, err := os.ReadFile(h.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read history: %v", err)
+	}
+
+	entries := make(map[string][]string)
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("failed to decode history: %v", err)
+	}
+	for category, list := range entries {
+		if len(list) > h.maxSize {
+			list = list[:h.maxSize]
+		}
+		entries[category] = list
+	}
+	h.entries = entries
+	return nil
+}
+
+func (h *History) Save() error {
+	if h.path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(h.path), 0755); err != nil {
+		return fmt.Errorf("failed to create history directory: %v", err)
+	}
+	data, err := json.MarshalIndent(h.entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode history: %v", err)
+	}
+	return os.WriteFile(h.path, data, 0644)
+}
+
+// Add records input as the most recent entry of category. An earlier
+// identical entry is removed so every input appears only once.
+func (h *History) Add(category, input string) {
+	if input == "" {
+		return
+	}
+	list := []string{input}
+	for _, entry := range h.entries[category] {
+		if entry != input {
+			list = append(list, entry)
+		}
+	}
+	if len(list) > h.maxSize {
+		list = list[:h.maxSize]
+	}
+	h.entries[category] = list
+}
+
+// SetMaxSize changes the number of entries kept per category, dropping
+// the oldest entries beyond it.
+func (h *History) SetMaxSize(maxSize int) {
+	if maxSize <= 0 {
+		maxSize = DefaultHistorySize
+	}
+	h.maxSize = maxSize
+	for category, list := range h.entries {
+		if len(list) > maxSize {
+			h.entries[category] = list[:maxSize]
+		}
+	}
+}
+
+// Entries returns the history of category, most recent first.
+func (h *History) Entries(category string) []string {
+	return h.entries[category]
+}
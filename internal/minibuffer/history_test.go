@@ -0,0 +1,71 @@
+package minibuffer
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/nsf/termbox-go"
+)
+
+func TestHistoryDeduplicatesAndLimits(t *testing.T) {
+	h := NewHistory("", 3)
+	for _, input := range []string{"a", "b", "a", "c", "d"} {
+		h.Add(HistoryCommand, input)
+	}
+
+	want := []string{"d", "c", "a"}
+	if got := h.Entries(HistoryCommand); !reflect.DeepEqual(got, want) {
+		t.Errorf("Entries() = %v, want %v", got, want)
+	}
+}
+
+func TestHistoryPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.json")
+	h := NewHistory(path, 10)
+	h.Add(HistoryFile, "/tmp/a.txt")
+	h.Add(HistoryGotoLine, "42")
+	if err := h.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	loaded := NewHistory(path, 10)
+	if err := loaded.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if got := loaded.Entries(HistoryGotoLine); !reflect.DeepEqual(got, []string{"42"}) {
+		t.Errorf("goto-line history = %v", got)
+	}
+}
+
+func TestHistoryNavigation(t *testing.T) {
+	h := NewHistory("", 10)
+	h.Add(HistoryCommand, "foo")
+	h.Add(HistoryCommand, "bar")
+	h.Add(HistoryCommand, "baz")
+
+	mb := New()
+	mb.SetHistory(h)
+	mb.Activate(ModeSearch, "Search: ", nil)
+	mb.UseHistory(HistoryCommand)
+
+	meta := func(ch rune) termbox.Event { return termbox.Event{Mod: termbox.ModAlt, Ch: ch} }
+
+	mb.HandleKey(meta('p'))
+	mb.HandleKey(meta('p'))
+	if mb.GetInput() != "bar" {
+		t.Errorf("after M-p M-p input = %q, want %q", mb.GetInput(), "bar")
+	}
+
+	mb.HandleKey(meta('n'))
+	mb.HandleKey(meta('n'))
+	if mb.GetInput() != "" {
+		t.Errorf("after returning from history input = %q, want empty", mb.GetInput())
+	}
+
+	mb.HandleKey(termbox.Event{Ch: 'o'})
+	mb.HandleKey(meta('r'))
+	if mb.GetInput() != "foo" {
+		t.Errorf("after M-r input = %q, want %q", mb.GetInput(), "foo")
+	}
+}
@@ -1,11 +1,18 @@
 package minibuffer
 
 import (
+	"sort"
+	"strconv"
 	"strings"
 	
+	"github.com/mattn/go-runewidth"
 	"github.com/nsf/termbox-go"
+	"github.com/TakahashiShuuhei/edito/internal/killring"
 )
 
+// maxVisibleCompletions is the height of the completion popup.
+const maxVisibleCompletions = 10
+
 type Mode int
 
 const (
@@ -18,43 +25,104 @@ const (
 type Completion struct {
 	Text        string
 	Description string
+	// Value is inserted when the completion is chosen; defaults to Text.
+	Value string
+	// Continue marks candidates that are a step towards the final input,
+	// such as directories. Choosing one keeps the prompt open.
+	Continue bool
+}
+
+func (c Completion) value() string {
+	if c.Value != "" {
+		return c.Value
+	}
+	return c.Text
+}
+
+// Match is a candidate that survived filtering, with the rune positions
+// of Text that matched the input.
+type Match struct {
+	Completion
+	Score     int
+	Positions []int
 }
 
 type Minibuffer struct {
 	mode         Mode
 	prompt       string
-	input        string
+	input        []rune
 	cursorPos    int
-	completions  []Completion
+	hscroll      int
+	source       CompletionSource
+	completions  []Match
 	selectedComp int
+	// moved is set once the user chooses a completion with C-n/C-p.
+	moved        bool
+	requireMatch bool
+	scrollOffset int
 	active       bool
 	handler      func(input string) error
+	history      *History
+	historyCat   string
+	historyPos   int
+	historyInput string
+	killRing     *killring.KillRing
+	lastWasKill  bool
+	thisIsKill   bool
 }
 
 func New() *Minibuffer {
 	return &Minibuffer{
 		mode:        ModeNormal,
-		completions: make([]Completion, 0),
+		completions: make([]Match, 0),
 	}
 }
 
 func (mb *Minibuffer) Activate(mode Mode, prompt string, handler func(string) error) {
 	mb.mode = mode
 	mb.prompt = prompt
-	mb.input = ""
+	mb.input = nil
 	mb.cursorPos = 0
-	mb.completions = make([]Completion, 0)
+	mb.hscroll = 0
+	mb.lastWasKill = false
+	mb.source = nil
+	mb.completions = make([]Match, 0)
 	mb.selectedComp = 0
+	mb.scrollOffset = 0
+	mb.moved = false
+	mb.requireMatch = false
 	mb.active = true
 	mb.handler = handler
+	mb.historyCat = ""
+	mb.historyPos = -1
 }
 
 func (mb *Minibuffer) Deactivate() {
 	mb.active = false
-	mb.input = ""
+	mb.input = nil
 	mb.cursorPos = 0
-	mb.completions = make([]Completion, 0)
+	mb.hscroll = 0
+	mb.source = nil
+	mb.completions = make([]Match, 0)
 	mb.selectedComp = 0
+	mb.scrollOffset = 0
+}
+
+// SetKillRing sets the kill ring used by C-k, C-w and C-y.
+func (mb *Minibuffer) SetKillRing(killRing *killring.KillRing) {
+	mb.killRing = killRing
+}
+
+// SetHistory sets the history store shared by all prompts.
+func (mb *Minibuffer) SetHistory(history *History) {
+	mb.history = history
+}
+
+// UseHistory selects the history category of the active prompt. Accepted
+// input is recorded there and M-p, M-n and M-r step through it.
+func (mb *Minibuffer) UseHistory(category string) {
+	mb.historyCat = category
+	mb.historyPos = -1
 }
 
 func (mb *Minibuffer) IsActive() bool {
@@ -62,12 +130,42 @@ func (mb *Minibuffer) IsActive() bool {
 }
 
 func (mb *Minibuffer) GetInput() string {
-	return mb.input
+	return string(mb.input)
 }
 
+// SetCompletions sets the full candidate set. It is kept unchanged and
+// re-filtered against the input after every edit.
 func (mb *Minibuffer) SetCompletions(completions []Completion) {
-	mb.completions = completions
-	mb.selectedComp = 0
+	mb.SetSource(staticSource(completions))
+}
+
+// RequireMatch makes the active prompt accept only its candidates, such
+// as command names: Enter takes the selected completion even when the
+// input matched it only fuzzily.
+func (mb *Minibuffer) RequireMatch() {
+	mb.requireMatch = true
+}
+
+// SetSource sets where candidates come from for the active prompt.
+func (mb *Minibuffer) SetSource(source CompletionSource) {
+	mb.source = source
+	mb.FilterCompletions(string(mb.input))
+}
+
+// SetInput replaces the input, e.g. to pre-fill a default value.
+func (mb *Minibuffer) SetInput(input string) {
+	mb.setInput(input)
+	mb.FilterCompletions(input)
+}
+
+func (mb *Minibuffer) setInput(input string) {
+	mb.input = []rune(input)
+	mb.cursorPos = len(mb.input)
+}
+
+// Completions returns the candidates matching the current input, best first.
+func (mb *Minibuffer) Completions() []Match {
+	return mb.completions
 }
 
 func (mb *Minibuffer) HandleKey(ev termbox.Event) bool {
@@ -75,67 +173,104 @@ func (mb *Minibuffer) HandleKey(ev termbox.Event) bool {
 		return false
 	}
 	
-	if len(mb.completions) > 0 {
-		mb.FilterCompletions(mb.input)
+	previousInput := string(mb.input)
+	mb.thisIsKill = false
+	defer func() {
+		mb.lastWasKill = mb.thisIsKill
+		if input := string(mb.input); mb.active && input != previousInput {
+			mb.FilterCompletions(input)
+		}
+	}()
+	
+	if ev.Mod&termbox.ModAlt != 0 {
+		return mb.handleMetaKey(ev)
 	}
 	
 	switch ev.Key {
-	case termbox.KeyEsc:
+	case termbox.KeyEsc, termbox.KeyCtrlG:
 		mb.Deactivate()
 		return true
 		
 	case termbox.KeyEnter:
-		if len(mb.completions) > 0 && mb.selectedComp < len(mb.completions) {
-			mb.input = mb.completions[mb.selectedComp].Text
-		}
-		if mb.handler != nil {
-			mb.handler(mb.input)
+		if selected, ok := mb.acceptedCompletion(); ok {
+			mb.setInput(selected.value())
+			if selected.Continue {
+				return true
+			}
 		}
-		mb.Deactivate()
+		mb.submit()
+		return true
+		
+	case termbox.KeyCtrlJ:
+		// Accept the input exactly as typed, ignoring completions.
+		mb.submit()
 		return true
 		
 	case termbox.KeyBackspace, termbox.KeyBackspace2:
 		if mb.cursorPos > 0 {
-			mb.input = mb.input[:mb.cursorPos-1] + mb.input[mb.cursorPos:]
-			mb.cursorPos--
+			mb.deleteRange(mb.cursorPos-1, mb.cursorPos)
+		}
+		return true
+		
+	case termbox.KeyCtrlD, termbox.KeyDelete:
+		if mb.cursorPos < len(mb.input) {
+			mb.deleteRange(mb.cursorPos, mb.cursorPos+1)
 		}
 		return true
 		
-	case termbox.KeyArrowLeft:
+	case termbox.KeyArrowLeft, termbox.KeyCtrlB:
 		if mb.cursorPos > 0 {
 			mb.cursorPos--
 		}
 		return true
 		
-	case termbox.KeyArrowRight:
+	case termbox.KeyArrowRight, termbox.KeyCtrlF:
 		if mb.cursorPos < len(mb.input) {
 			mb.cursorPos++
 		}
 		return true
 		
+	case termbox.KeyCtrlA, termbox.KeyHome:
+		mb.cursorPos = 0
+		return true
+		
+	case termbox.KeyCtrlE, termbox.KeyEnd:
+		mb.cursorPos = len(mb.input)
+		return true
+		
+	case termbox.KeyCtrlK:
+		mb.kill(mb.cursorPos, len(mb.input))
+		return true
+		
+	case termbox.KeyCtrlW:
+		mb.kill(mb.backwardWord(), mb.cursorPos)
+		return true
+		
+	case termbox.KeyCtrlY:
+		mb.yank()
+		return true
+		
 	case termbox.KeyArrowUp, termbox.KeyCtrlP:
-		if len(mb.completions) > 0 {
-			mb.selectedComp = (mb.selectedComp - 1 + len(mb.completions)) % len(mb.completions)
-		}
+		mb.moveSelection(-1)
 		return true
 		
 	case termbox.KeyArrowDown, termbox.KeyCtrlN:
-		if len(mb.completions) > 0 {
-			mb.selectedComp = (mb.selectedComp + 1) % len(mb.completions)
-		}
+		mb.moveSelection(1)
 		return true
 		
 	case termbox.KeyTab:
 		if len(mb.completions) > 0 {
-			mb.input = mb.completions[mb.selectedComp].Text
-			mb.cursorPos = len(mb.input)
+			mb.setInput(mb.completions[mb.selectedComp].value())
 		}
 		return true
 		
+	case termbox.KeySpace:
+		mb.insertRunes([]rune{' '})
+		return true
+		
 	default:
 		if ev.Ch != 0 {
-			mb.input = mb.input[:mb.cursorPos] + string(ev.Ch) + mb.input[mb.cursorPos:]
-			mb.cursorPos++
+			mb.insertRunes([]rune{ev.Ch})
 			return true
 		}
 	}
@@ -143,28 +278,193 @@ func (mb *Minibuffer) HandleKey(ev termbox.Event) bool {
 	return false
 }
 
+// acceptedCompletion returns the completion Enter takes instead of the
+// input as typed: the selected one if the user moved to it or the prompt
+// requires a match. A new file name that matches the start of an existing
+// one, or a directory, is thus submitted as typed.
+func (mb *Minibuffer) acceptedCompletion() (Completion, bool) {
+	if mb.selectedComp >= len(mb.completions) {
+		return Completion{}, false
+	}
+	selected := mb.completions[mb.selectedComp].Completion
+	if mb.moved || mb.requireMatch {
+		return selected, true
+	}
+	return Completion{}, false
+}
+
+func (mb *Minibuffer) submit() {
+	input, handler := string(mb.input), mb.handler
+	mb.recordHistory(input)
+	// Deactivate first so that the handler can open another prompt.
+	mb.Deactivate()
+	if handler != nil {
+		handler(input)
+	}
+}
+
+func (mb *Minibuffer) handleMetaKey(ev termbox.Event) bool {
+	switch ev.Ch {
+	case 'p':
+		mb.historyStep(1)
+	case 'n':
+		mb.historyStep(-1)
+	case 'r':
+		mb.historySearch()
+	case 'f':
+		mb.cursorPos = mb.forwardWord()
+	case 'b':
+		mb.cursorPos = mb.backwardWord()
+	case 'd':
+		mb.kill(mb.cursorPos, mb.forwardWord())
+	default:
+		if ev.Key == termbox.KeyBackspace || ev.Key == termbox.KeyBackspace2 {
+			mb.kill(mb.backwardWord(), mb.cursorPos)
+			return true
+		}
+		return false
+	}
+	return true
+}
+
+func (mb *Minibuffer) historyEntries() []string {
+	if mb.history == nil || mb.historyCat == "" {
+		return nil
+	}
+	return mb.history.Entries(mb.historyCat)
+}
+
+// historyStep moves delta entries back in history; -1 returns towards the
+// input that was being typed before history navigation started.
+func (mb *Minibuffer) historyStep(delta int) {
+	entries := mb.historyEntries()
+	pos := mb.historyPos + delta
+	if pos >= len(entries) || pos < -1 {
+		return
+	}
+	mb.showHistoryEntry(pos)
+}
+
+// historySearch moves to the next older entry containing the text that
+// was typed before history navigation started.
+func (mb *Minibuffer) historySearch() {
+	query := string(mb.input)
+	if mb.historyPos >= 0 {
+		query = mb.historyInput
+	}
+	entries := mb.historyEntries()
+	for pos := mb.historyPos + 1; pos < len(entries); pos++ {
+		if strings.Contains(entries[pos], query) {
+			mb.showHistoryEntry(pos)
+			return
+		}
+	}
+}
+
+func (mb *Minibuffer) showHistoryEntry(pos int) {
+	if mb.historyPos == -1 {
+		mb.historyInput = string(mb.input)
+	}
+	mb.historyPos = pos
+	if pos == -1 {
+		mb.setInput(mb.historyInput)
+	} else {
+		mb.setInput(mb.historyEntries()[pos])
+	}
+}
+
+func (mb *Minibuffer) recordHistory(input string) {
+	if mb.history == nil || mb.historyCat == "" {
+		return
+	}
+	mb.history.Add(mb.historyCat, input)
+	mb.history.Save()
+}
+
+func (mb *Minibuffer) moveSelection(delta int) {
+	if len(mb.completions) == 0 {
+		return
+	}
+	mb.selectedComp = (mb.selectedComp + delta + len(mb.completions)) % len(mb.completions)
+	mb.moved = true
+	mb.scrollToSelection()
+}
+
+// scrollToSelection keeps the selected completion inside the popup.
+func (mb *Minibuffer) scrollToSelection() {
+	if mb.selectedComp < mb.scrollOffset {
+		mb.scrollOffset = mb.selectedComp
+	}
+	if mb.selectedComp >= mb.scrollOffset+maxVisibleCompletions {
+		mb.scrollOffset = mb.selectedComp - maxVisibleCompletions + 1
+	}
+}
+
 func (mb *Minibuffer) Draw(width, y int) {
 	if !mb.active {
 		return
 	}
 	
-	promptText := mb.prompt + mb.input
+	prompt := []rune(mb.prompt)
+	promptWidth := runewidth.StringWidth(mb.prompt)
+	if promptWidth > width/2 {
+		// Keep at least half of the line for the input.
+		prompt = []rune(runewidth.Truncate(mb.prompt, width/2, "…"))
+		promptWidth = runewidth.StringWidth(string(prompt))
+	}
 	
 	for i := 0; i < width; i++ {
-		ch := ' '
-		if i < len(promptText) {
-			ch = rune(promptText[i])
+		termbox.SetCell(i, y, ' ', termbox.ColorWhite, termbox.ColorBlue)
+	}
+	
+	x := 0
+	for _, ch := range prompt {
+		termbox.SetCell(x, y, ch, termbox.ColorWhite, termbox.ColorBlue)
+		x += runewidth.RuneWidth(ch)
+	}
+	
+	mb.scrollInput(width - promptWidth)
+	cursorX := -1
+	for i := mb.hscroll; i <= len(mb.input); i++ {
+		if i == mb.cursorPos {
+			cursorX = x
 		}
-		termbox.SetCell(i, y, ch, termbox.ColorWhite, termbox.ColorBlue)
+		if i == len(mb.input) {
+			break
+		}
+		w := runewidth.RuneWidth(mb.input[i])
+		if x+w > width {
+			break
+		}
+		termbox.SetCell(x, y, mb.input[i], termbox.ColorWhite, termbox.ColorBlue)
+		x += w
 	}
 	
-	cursorX := len(mb.prompt) + mb.cursorPos
-	if cursorX < width {
+	if cursorX >= 0 && cursorX < width {
 		termbox.SetCursor(cursorX, y)
 	}
 	
 	if len(mb.completions) > 0 {
-		mb.drawCompletions(width, y-len(mb.completions)-1)
+		visible := len(mb.completions)
+		if visible > maxVisibleCompletions {
+			visible = maxVisibleCompletions
+		}
+		mb.drawCompletions(width, y-visible-1)
+	}
+}
+
+// scrollInput adjusts the horizontal scroll so that the cursor stays
+// within the available columns.
+func (mb *Minibuffer) scrollInput(available int) {
+	if available < 1 {
+		available = 1
+	}
+	if mb.cursorPos < mb.hscroll {
+		mb.hscroll = mb.cursorPos
+	}
+	// The cursor needs one column after the text before it.
+	for mb.hscroll < mb.cursorPos && runewidth.StringWidth(string(mb.input[mb.hscroll:mb.cursorPos]))+1 > available {
+		mb.hscroll++
 	}
 }
 
@@ -173,13 +473,13 @@ func (mb *Minibuffer) drawCompletions(width, startY int) {
 		return
 	}
 	
-	maxCompletions := 10
-	if len(mb.completions) < maxCompletions {
-		maxCompletions = len(mb.completions)
+	end := mb.scrollOffset + maxVisibleCompletions
+	if end > len(mb.completions) {
+		end = len(mb.completions)
 	}
 	
-	for i := 0; i < maxCompletions; i++ {
-		y := startY + i
+	for i := mb.scrollOffset; i < end; i++ {
+		y := startY + i - mb.scrollOffset
 		completion := mb.completions[i]
 		
 		bg := termbox.ColorDefault
@@ -190,42 +490,83 @@ func (mb *Minibuffer) drawCompletions(width, startY int) {
 			fg = termbox.ColorBlack
 		}
 		
-		text := completion.Text
+		matched := make(map[int]bool, len(completion.Positions))
+		for _, pos := range completion.Positions {
+			matched[pos] = true
+		}
+		
+		text := []rune(completion.Text)
+		textLen := len(text)
 		if completion.Description != "" {
-			text += " - " + completion.Description
+			text = append(text, []rune(" - "+completion.Description)...)
 		}
 		
-		if len(text) > width {
-			text = text[:width-3] + "..."
+		if len(text) > width && width > 3 {
+			text = append(text[:width-3], '.', '.', '.')
 		}
 		
-		for j := 0; j < width; j++ {
+		x := 0
+		for j := 0; x < width; j++ {
 			ch := ' '
+			cellFg := fg
 			if j < len(text) {
-				ch = rune(text[j])
+				ch = text[j]
+				if j < textLen && matched[j] {
+					cellFg = termbox.ColorYellow | termbox.AttrBold
+				}
+			}
+			termbox.SetCell(x, y, ch, cellFg, bg)
+			x += runewidth.RuneWidth(ch)
+		}
+	}
+	
+	if len(mb.completions) > maxVisibleCompletions {
+		indicator := []rune(" " + strconv.Itoa(mb.selectedComp+1) + "/" + strconv.Itoa(len(mb.completions)) + " ")
+		x := width - len(indicator)
+		for j, ch := range indicator {
+			if x+j >= 0 {
+				termbox.SetCell(x+j, startY, ch, termbox.ColorBlack, termbox.ColorCyan)
 			}
-			termbox.SetCell(j, y, ch, fg, bg)
 		}
 	}
 }
 
-func (mb *Minibuffer) FilterCompletions(query string) {
-	if query == "" {
+// FilterCompletions rebuilds the visible completions from the completion
+// source. Candidates are ranked by their fuzzy score against the
+// text; candidates that only match through their description come last.
+func (mb *Minibuffer) FilterCompletions(input string) {
+	mb.moved = false
+	if mb.source == nil {
+		mb.completions = mb.completions[:0]
+		mb.selectedComp = 0
+		mb.scrollOffset = 0
 		return
 	}
+	candidates, query := mb.source.Complete(input)
+	matches := make([]Match, 0, len(candidates))
+	descQuery := strings.ToLower(query)
 	
-	filtered := make([]Completion, 0)
-	query = strings.ToLower(query)
-	
-	for _, comp := range mb.completions {
-		if strings.Contains(strings.ToLower(comp.Text), query) ||
-		   strings.Contains(strings.ToLower(comp.Description), query) {
-			filtered = append(filtered, comp)
+	for i, comp := range candidates {
+		if score, positions, ok := FuzzyMatch(query, comp.Text); ok {
+			matches = append(matches, Match{Completion: comp, Score: score, Positions: positions})
+			continue
+		}
+		if query != "" && strings.Contains(strings.ToLower(comp.Description), descQuery) {
+			// Below any fuzzy match on the text, in candidate order.
+			matches = append(matches, Match{Completion: comp, Score: -1<<20 - i})
 		}
 	}
 	
-	mb.completions = filtered
-	if mb.selectedComp >= len(mb.completions) {
-		mb.selectedComp = 0
+	if query != "" {
+		sort.SliceStable(matches, func(i, j int) bool {
+			if matches[i].Score != matches[j].Score {
+				return matches[i].Score > matches[j].Score
+			}
+			return len(matches[i].Text) < len(matches[j].Text)
+		})
 	}
-}
\ No newline at end of file
+	
+	mb.completions = matches
+	mb.selectedComp = 0
+	mb.scrollOffset = 0
+}
@@ -0,0 +1,17 @@
+package minibuffer
+
+// CompletionSource produces completion candidates for the current input.
+// It is consulted after every edit, so candidates can be computed lazily,
+// for example by listing the directory the input currently points into.
+type CompletionSource interface {
+	// Complete returns the candidates for input together with the part
+	// of input they should be filtered against.
+	Complete(input string) (candidates []Completion, query string)
+}
+
+// staticSource offers a fixed candidate list filtered against the whole input.
+type staticSource []Completion
+
+func (s staticSource) Complete(input string) ([]Completion, string) {
+	return s, input
+}
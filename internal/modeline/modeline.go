@@ -0,0 +1,122 @@
+// Package modeline renders the status line shown below each buffer.
+//
+// A mode line is a list of named segments. The editor registers the
+// built-in segments and plugins may register more; the format decides
+// which segments are shown and in what order.
+package modeline
+
+import (
+	"strings"
+
+	"github.com/TakahashiShuuhei/edito/internal/buffer"
+)
+
+// Context is passed to every segment when the mode line is drawn.
+type Context struct {
+	Buffer *buffer.Buffer
+	Height int // number of text rows visible in the window
+}
+
+// RenderFunc produces the text of a segment. An empty string hides the segment.
+type RenderFunc func(ctx Context) string
+
+// DefaultFormat is the segment order used until the user configures one.
+var DefaultFormat = []string{
+	"flags",
+	"buffer-name",
+	"position",
+	"percent",
+	"modes",
+	"encoding",
+	"eol",
+	"vcs",
+}
+
+type segment struct {
+	name   string
+	render RenderFunc
+}
+
+type ModeLine struct {
+	segments     map[string]segment
+	format       []string
+	customFormat bool
+	vcs          *vcsCache
+}
+
+func New() *ModeLine {
+	m := &ModeLine{
+		segments: make(map[string]segment),
+		format:   append([]string(nil), DefaultFormat...),
+		vcs:      newVCSCache(),
+	}
+	m.registerBuiltins()
+	return m
+}
+
+// Register adds or replaces a segment. Segments that are not part of a
+// user-configured format are appended to the default one so that plugin
+// segments show up without extra configuration.
+func (m *ModeLine) Register(name string, render RenderFunc) {
+	_, exists := m.segments[name]
+	m.segments[name] = segment{name: name, render: render}
+	if !exists && !m.customFormat && !m.inFormat(name) {
+		m.format = append(m.format, name)
+	}
+}
+
+// Unregister removes a segment and drops it from the format.
+func (m *ModeLine) Unregister(name string) {
+	delete(m.segments, name)
+	if m.customFormat {
+		return
+	}
+	format := m.format[:0]
+	for _, n := range m.format {
+		if n != name {
+			format = append(format, n)
+		}
+	}
+	m.format = format
+}
+
+// SetFormat sets the segment order. Unknown names are kept so that a
+// segment registered later by a plugin still appears in its position.
+func (m *ModeLine) SetFormat(names []string) {
+	m.format = append([]string(nil), names...)
+	m.customFormat = true
+}
+
+// ParseFormat splits a format string such as "buffer-name flags position".
+func ParseFormat(format string) []string {
+	return strings.FieldsFunc(format, func(r rune) bool {
+		return r == ' ' || r == ','
+	})
+}
+
+func (m *ModeLine) Format() []string {
+	return append([]string(nil), m.format...)
+}
+
+func (m *ModeLine) Render(ctx Context) string {
+	parts := make([]string, 0, len(m.format))
+	for _, name := range m.format {
+		seg, ok := m.segments[name]
+		if !ok {
+			continue
+		}
+		if text := seg.render(ctx); text != "" {
+			parts = append(parts, text)
+		}
+	}
+	return strings.Join(parts, "  ")
+}
+
+func (m *ModeLine) inFormat(name string) bool {
+	for _, n := range m.format {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
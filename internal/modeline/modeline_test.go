@@ -0,0 +1,120 @@
+package modeline
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/TakahashiShuuhei/edito/internal/buffer"
+)
+
+func TestRenderFollowsFormat(t *testing.T) {
+	m := New()
+	buf := &buffer.Buffer{Name: "main.go", Lines: []string{""}, MajorMode: "go-mode", Encoding: "utf-8", EOL: "LF"}
+	ctx := Context{Buffer: buf, Height: 10}
+
+	if got, want := m.Render(ctx), "--  main.go  L1 C1  All  (go-mode)  utf-8  LF"; got != want {
+		t.Errorf("Render = %q, want %q", got, want)
+	}
+
+	// Segments registered by plugins are appended to the default format.
+	m.Register("clock", func(Context) string { return "12:00" })
+	m.Register("empty", func(Context) string { return "" })
+	if got, want := m.Render(ctx), "--  main.go  L1 C1  All  (go-mode)  utf-8  LF  12:00"; got != want {
+		t.Errorf("Render = %q, want %q", got, want)
+	}
+	m.Unregister("clock")
+	if got := m.Format(); slices.Contains(got, "clock") {
+		t.Errorf("Format = %v, want clock dropped", got)
+	}
+
+	// A configured format decides the order, keeps names that are not
+	// registered yet and does not grow when segments are registered.
+	m.SetFormat(ParseFormat("clock, buffer-name flags"))
+	if got, want := m.Render(ctx), "main.go  --"; got != want {
+		t.Errorf("Render = %q, want %q", got, want)
+	}
+	m.Register("clock", func(Context) string { return "12:00" })
+	m.Register("battery", func(Context) string { return "80%" })
+	if got, want := m.Render(ctx), "12:00  main.go  --"; got != want {
+		t.Errorf("Render = %q, want %q", got, want)
+	}
+}
+
+func TestFlags(t *testing.T) {
+	tests := []struct {
+		readOnly, modified bool
+		want               string
+	}{
+		{false, false, "--"},
+		{false, true, "**"},
+		{true, false, "%%"},
+		{true, true, "%*"},
+	}
+	for _, tt := range tests {
+		buf := &buffer.Buffer{ReadOnly: tt.readOnly, Modified: tt.modified}
+		if got := renderFlags(Context{Buffer: buf}); got != tt.want {
+			t.Errorf("read-only %v, modified %v: flags = %q, want %q", tt.readOnly, tt.modified, got, tt.want)
+		}
+	}
+	if got := renderFlags(Context{}); got != "" {
+		t.Errorf("flags without a buffer = %q, want none", got)
+	}
+}
+
+func TestPercent(t *testing.T) {
+	tests := []struct {
+		lines, offset, height int
+		want                  string
+	}{
+		{5, 0, 10, "All"},
+		{10, 0, 10, "All"},
+		{100, 0, 10, "Top"},
+		{100, 90, 10, "Bot"},
+		{100, 45, 10, "50%"},
+		{100, 9, 10, "10%"},
+	}
+	for _, tt := range tests {
+		buf := &buffer.Buffer{Lines: make([]string, tt.lines), OffsetY: tt.offset}
+		if got := renderPercent(Context{Buffer: buf, Height: tt.height}); got != tt.want {
+			t.Errorf("%d lines from %d in %d rows = %q, want %q", tt.lines, tt.offset, tt.height, got, tt.want)
+		}
+	}
+}
+
+func TestVCSCache(t *testing.T) {
+	repo := t.TempDir()
+	os.MkdirAll(filepath.Join(repo, ".git"), 0755)
+	head := filepath.Join(repo, ".git", "HEAD")
+	os.WriteFile(head, []byte("ref: refs/heads/main\n"), 0644)
+	os.MkdirAll(filepath.Join(repo, "sub"), 0755)
+
+	c := newVCSCache()
+	if got := c.gitBranch(filepath.Join(repo, "sub", "a.go")); got != "main" {
+		t.Errorf("branch = %q, want main", got)
+	}
+
+	// A checkout rewrites HEAD, which is noticed by its modification time.
+	os.WriteFile(head, []byte("0123456789abcdef\n"), 0644)
+	later := time.Now().Add(time.Second)
+	os.Chtimes(head, later, later)
+	if got := c.gitBranch(filepath.Join(repo, "a.go")); got != "0123456" {
+		t.Errorf("branch after checkout = %q, want 0123456", got)
+	}
+
+	outside := t.TempDir()
+	if got := c.gitBranch(filepath.Join(outside, "a.go")); got != "" {
+		t.Errorf("branch outside a repository = %q, want none", got)
+	}
+
+	for i := 0; i < maxVCSDirs*2; i++ {
+		dir := filepath.Join(repo, fmt.Sprint(i))
+		c.gitBranch(filepath.Join(dir, "a.go"))
+		if len(c.dirs) > maxVCSDirs {
+			t.Fatalf("cache holds %d directories, want at most %d", len(c.dirs), maxVCSDirs)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package modeline
+
+import (
+	"fmt"
+	"strings"
+)
+
+func (m *ModeLine) registerBuiltins() {
+	m.segments["buffer-name"] = segment{"buffer-name", renderBufferName}
+	m.segments["flags"] = segment{"flags", renderFlags}
+	m.segments["position"] = segment{"position", renderPosition}
+	m.segments["percent"] = segment{"percent", renderPercent}
+	m.segments["modes"] = segment{"modes", renderModes}
+	m.segments["encoding"] = segment{"encoding", renderEncoding}
+	m.segments["eol"] = segment{"eol", renderEOL}
+	m.segments["vcs"] = segment{"vcs", m.renderVCS}
+}
+
+func renderBufferName(ctx Context) string {
+	if ctx.Buffer == nil {
+		return "No buffer"
+	}
+	return ctx.Buffer.Name
+}
+
+// renderFlags follows the Emacs convention: "%%" read-only, "**" modified, "--" clean.
+func renderFlags(ctx Context) string {
+	if ctx.Buffer == nil {
+		return ""
+	}
+	switch {
+	case ctx.Buffer.ReadOnly && ctx.Buffer.Modified:
+		return "%*"
+	case ctx.Buffer.ReadOnly:
+		return "%%"
+	case ctx.Buffer.Modified:
+		return "**"
+	}
+	return "--"
+}
+
+func renderPosition(ctx Context) string {
+	if ctx.Buffer == nil {
+		return ""
+	}
+	return fmt.Sprintf("L%d C%d", ctx.Buffer.CursorY+1, ctx.Buffer.CursorX+1)
+}
+
+func renderPercent(ctx Context) string {
+	buf := ctx.Buffer
+	if buf == nil {
+		return ""
+	}
+	total := len(buf.Lines)
+	top := buf.OffsetY == 0
+	bottom := buf.OffsetY+ctx.Height >= total
+	switch {
+	case top && bottom:
+		return "All"
+	case top:
+		return "Top"
+	case bottom:
+		return "Bot"
+	}
+	return fmt.Sprintf("%d%%", buf.OffsetY*100/(total-ctx.Height))
+}
+
+func renderModes(ctx Context) string {
+	if ctx.Buffer == nil || ctx.Buffer.MajorMode == "" {
+		return ""
+	}
+	modes := append([]string{ctx.Buffer.MajorMode}, ctx.Buffer.MinorModes...)
+	return "(" + strings.Join(modes, " ") + ")"
+}
+
+func renderEncoding(ctx Context) string {
+	if ctx.Buffer == nil {
+		return ""
+	}
+	return ctx.Buffer.Encoding
+}
+
+func renderEOL(ctx Context) string {
+	if ctx.Buffer == nil {
+		return ""
+	}
+	return ctx.Buffer.EOL
+}
+
+func (m *ModeLine) renderVCS(ctx Context) string {
+	if ctx.Buffer == nil || ctx.Buffer.Filename == "" {
+		return ""
+	}
+	branch := m.vcs.gitBranch(ctx.Buffer.Filename)
+	if branch == "" {
+		return ""
+	}
+	return "Git:" + branch
+}
@@ -0,0 +1,99 @@
+package modeline
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// maxVCSDirs bounds the directories a vcsCache remembers.
+const maxVCSDirs = 64
+
+type vcsEntry struct {
+	head    string // path of the HEAD file, "" outside a repository
+	modTime time.Time
+	branch  string
+}
+
+// vcsCache remembers for each directory where its repository's HEAD is and
+// what it contained, so that a redraw only stats the HEAD file.
+type vcsCache struct {
+	dirs map[string]*vcsEntry
+}
+
+func newVCSCache() *vcsCache {
+	return &vcsCache{dirs: make(map[string]*vcsEntry)}
+}
+
+// gitBranch returns the branch checked out in the repository containing
+// filename, a short commit id for a detached HEAD, or "" outside a repository.
+func (c *vcsCache) gitBranch(filename string) string {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return ""
+	}
+	dir := filepath.Dir(abs)
+	entry, ok := c.dirs[dir]
+	if !ok {
+		if len(c.dirs) >= maxVCSDirs {
+			clear(c.dirs)
+		}
+		entry = &vcsEntry{head: findGitHead(dir)}
+		c.dirs[dir] = entry
+	}
+	if entry.head == "" {
+		return ""
+	}
+
+	stat, err := os.Stat(entry.head)
+	if err != nil {
+		return ""
+	}
+	if !entry.modTime.IsZero() && entry.modTime.Equal(stat.ModTime()) {
+		return entry.branch
+	}
+
+	data, err := os.ReadFile(entry.head)
+	if err != nil {
+		return ""
+	}
+	entry.modTime = stat.ModTime()
+	entry.branch = parseHead(strings.TrimSpace(string(data)))
+	return entry.branch
+}
+
+func findGitHead(dir string) string {
+	for {
+		gitPath := filepath.Join(dir, ".git")
+		if stat, err := os.Stat(gitPath); err == nil {
+			if stat.IsDir() {
+				return filepath.Join(gitPath, "HEAD")
+			}
+			// Worktrees and submodules use a "gitdir: <path>" file.
+			if data, err := os.ReadFile(gitPath); err == nil {
+				gitDir := strings.TrimSpace(strings.TrimPrefix(string(data), "gitdir:"))
+				if !filepath.IsAbs(gitDir) {
+					gitDir = filepath.Join(dir, gitDir)
+				}
+				return filepath.Join(gitDir, "HEAD")
+			}
+			return ""
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+func parseHead(head string) string {
+	if ref, ok := strings.CutPrefix(head, "ref: "); ok {
+		return strings.TrimPrefix(ref, "refs/heads/")
+	}
+	if len(head) > 7 {
+		return head[:7]
+	}
+	return head
+}
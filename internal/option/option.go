@@ -0,0 +1,369 @@
+// Package option keeps the editor's options: their declarations with a
+// type, default, documentation and validator, their global and
+// buffer-local values, and the functions watching them.
+package option
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Type is the type of an option's value.
+type Type string
+
+const (
+	Bool   Type = "bool"
+	Int    Type = "int"
+	Float  Type = "float"
+	String Type = "string"
+)
+
+// Option declares an option.
+type Option struct {
+	Name    string
+	Type    Type
+	Default any
+	Doc     string
+	// BufferLocal options may also be set for a single buffer, where the
+	// buffer's value overrides the global one.
+	BufferLocal bool
+	// Validate, if set, rejects values of the right type, such as a
+	// negative width.
+	Validate func(value any) error
+	// Owner is the plugin that declared the option, "" for the editor.
+	Owner string
+}
+
+// Change describes a new value of an option. Buffer is the buffer whose
+// local value changed, or "" for the global value.
+type Change struct {
+	Name   string
+	Old    any
+	New    any
+	Buffer string
+}
+
+// UnknownError is returned for an option nobody has declared.
+type UnknownError struct {
+	Name       string
+	Suggestion string
+}
+
+func (e *UnknownError) Error() string {
+	if e.Suggestion != "" {
+		return fmt.Sprintf("unknown option %q (did you mean %q?)", e.Name, e.Suggestion)
+	}
+	return fmt.Sprintf("unknown option %q", e.Name)
+}
+
+type watcher struct {
+	owner string
+	fn    func(Change)
+}
+
+// Registry holds the declared options and their values. It is used from
+// the editor goroutine only.
+type Registry struct {
+	options  map[string]*Option
+	values   map[string]any
+	pending  map[string]any
+	watchers map[string][]watcher
+}
+
+func New() *Registry {
+	return &Registry{
+		options:  make(map[string]*Option),
+		values:   make(map[string]any),
+		pending:  make(map[string]any),
+		watchers: make(map[string][]watcher),
+	}
+}
+
+// Define declares opt. A value set before the declaration, as config.go
+// does for options of plugins loaded later, is applied now; an invalid
+// one is discarded and reported in the returned error, and the option is
+// defined all the same.
+func (r *Registry) Define(opt Option) error {
+	if opt.Name == "" {
+		return fmt.Errorf("option name required")
+	}
+	if _, ok := r.options[opt.Name]; ok {
+		return fmt.Errorf("option %s is already defined", opt.Name)
+	}
+	def, err := r.check(&opt, opt.Default)
+	if err != nil {
+		return fmt.Errorf("default of option %s: %v", opt.Name, err)
+	}
+	opt.Default = def
+	r.options[opt.Name] = &opt
+
+	value, ok := r.pending[opt.Name]
+	if !ok {
+		return nil
+	}
+	delete(r.pending, opt.Name)
+	if value, err = r.check(&opt, value); err != nil {
+		return fmt.Errorf("option %s: %v", opt.Name, err)
+	}
+	r.values[opt.Name] = value
+	return nil
+}
+
+// Lookup returns the declaration of name.
+func (r *Registry) Lookup(name string) (Option, bool) {
+	opt, ok := r.options[name]
+	if !ok {
+		return Option{}, false
+	}
+	return *opt, true
+}
+
+// Options returns the declared options sorted by name.
+func (r *Registry) Options() []Option {
+	list := make([]Option, 0, len(r.options))
+	for _, opt := range r.options {
+		list = append(list, *opt)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Get returns the global value of name, its default if it was never set,
+// or nil if it is not declared.
+func (r *Registry) Get(name string) any {
+	if value, ok := r.values[name]; ok {
+		return value
+	}
+	if opt, ok := r.options[name]; ok {
+		return opt.Default
+	}
+	return nil
+}
+
+// Local returns the value of name in a buffer with the local values
+// locals.
+func (r *Registry) Local(name string, locals map[string]any) any {
+	if value, ok := locals[name]; ok {
+		return value
+	}
+	return r.Get(name)
+}
+
+// Set sets the global value of name. The value of an undeclared option is
+// kept until the option is declared, and an *UnknownError is returned.
+func (r *Registry) Set(name string, value any) error {
+	opt, ok := r.options[name]
+	if !ok {
+		r.pending[name] = value
+		return &UnknownError{Name: name, Suggestion: r.Suggest(name)}
+	}
+	value, err := r.check(opt, value)
+	if err != nil {
+		return fmt.Errorf("option %s: %v", name, err)
+	}
+	old := r.Get(name)
+	r.values[name] = value
+	r.notify(Change{Name: name, Old: old, New: value})
+	return nil
+}
+
+// SetLocal sets the value of name in buffer, whose local values are
+// locals.
+func (r *Registry) SetLocal(buffer string, locals map[string]any, name string, value any) error {
+	opt, ok := r.options[name]
+	if !ok {
+		return &UnknownError{Name: name, Suggestion: r.Suggest(name)}
+	}
+	if !opt.BufferLocal {
+		return fmt.Errorf("option %s cannot be set for a single buffer", name)
+	}
+	value, err := r.check(opt, value)
+	if err != nil {
+		return fmt.Errorf("option %s: %v", name, err)
+	}
+	old := r.Local(name, locals)
+	locals[name] = value
+	r.notify(Change{Name: name, Old: old, New: value, Buffer: buffer})
+	return nil
+}
+
+// IsSet reports whether the global value of name was set.
+func (r *Registry) IsSet(name string) bool {
+	_, ok := r.values[name]
+	return ok
+}
+
+// Pending returns the options that were set but never declared.
+func (r *Registry) Pending() []string {
+	names := make([]string, 0, len(r.pending))
+	for name := range r.pending {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Watch calls fn, on behalf of owner, whenever name changes globally or
+// in a buffer.
+func (r *Registry) Watch(owner, name string, fn func(Change)) {
+	r.watchers[name] = append(r.watchers[name], watcher{owner, fn})
+}
+
+// RemoveOwner removes the options declared by owner and the functions it
+// watches with. The values of its options are kept in case it is loaded
+// again.
+func (r *Registry) RemoveOwner(owner string) {
+	for name, opt := range r.options {
+		if opt.Owner != owner {
+			continue
+		}
+		if value, ok := r.values[name]; ok {
+			r.pending[name] = value
+			delete(r.values, name)
+		}
+		delete(r.options, name)
+	}
+	for name, list := range r.watchers {
+		kept := list[:0]
+		for _, w := range list {
+			if w.owner != owner {
+				kept = append(kept, w)
+			}
+		}
+		r.watchers[name] = kept
+	}
+}
+
+func (r *Registry) notify(c Change) {
+	for _, w := range r.watchers[c.Name] {
+		w.fn(c)
+	}
+}
+
+func (r *Registry) check(opt *Option, value any) (any, error) {
+	value, err := Convert(opt.Type, value)
+	if err != nil {
+		return nil, err
+	}
+	if opt.Validate != nil {
+		if err := opt.Validate(value); err != nil {
+			return nil, err
+		}
+	}
+	return value, nil
+}
+
+// Suggest returns the declared option closest to name, if any is a
+// likely typo of it.
+func (r *Registry) Suggest(name string) string {
+	best, bestDistance := "", 3
+	for candidate := range r.options {
+		if d := distance(name, candidate); d < bestDistance || (d == bestDistance && candidate < best) {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best
+}
+
+// distance is the edit distance between a and b, counting a swap of
+// adjacent characters as one edit.
+func distance(a, b string) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
+
+// Convert returns value as type t. Whole floats are accepted as ints and
+// ints as floats, since numbers from JSON and config.go arrive either way.
+func Convert(t Type, value any) (any, error) {
+	switch t {
+	case Bool:
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+	case Int:
+		switch v := value.(type) {
+		case int:
+			return v, nil
+		case int64:
+			return int(v), nil
+		case float64:
+			if v == math.Trunc(v) {
+				return int(v), nil
+			}
+		}
+	case Float:
+		switch v := value.(type) {
+		case float64:
+			return v, nil
+		case int:
+			return float64(v), nil
+		case int64:
+			return float64(v), nil
+		}
+	case String:
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+	default:
+		return nil, fmt.Errorf("unknown type %q", t)
+	}
+	return nil, fmt.Errorf("%s expected, got %s", t, Format(value))
+}
+
+// Parse reads a value of type t typed by the user.
+func Parse(t Type, s string) (any, error) {
+	s = strings.TrimSpace(s)
+	switch t {
+	case Bool:
+		switch s {
+		case "t", "on", "yes":
+			return true, nil
+		case "nil", "off", "no":
+			return false, nil
+		}
+		return strconv.ParseBool(s)
+	case Int:
+		return strconv.Atoi(s)
+	case Float:
+		return strconv.ParseFloat(s, 64)
+	case String:
+		if unquoted, err := strconv.Unquote(s); err == nil {
+			return unquoted, nil
+		}
+		return s, nil
+	}
+	return nil, fmt.Errorf("unknown type %q", t)
+}
+
+// Format shows value the way it would be written in config.go.
+func Format(value any) string {
+	if s, ok := value.(string); ok {
+		return strconv.Quote(s)
+	}
+	if value == nil {
+		return "nil"
+	}
+	return fmt.Sprint(value)
+}
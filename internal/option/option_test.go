@@ -0,0 +1,121 @@
+package option
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestSetChecksDeclarations(t *testing.T) {
+	r := New()
+	err := r.Define(Option{Name: "tab-width", Type: Int, Default: 4, BufferLocal: true, Validate: func(v any) error {
+		if v.(int) <= 0 {
+			return fmt.Errorf("must be positive")
+		}
+		return nil
+	}})
+	if err != nil {
+		t.Fatalf("Define failed: %v", err)
+	}
+
+	var changes []Change
+	r.Watch("", "tab-width", func(c Change) { changes = append(changes, c) })
+
+	if err := r.Set("tab-width", 8.0); err != nil {
+		t.Errorf("Set of a whole float failed: %v", err)
+	}
+	if err := r.Set("tab-width", "8"); err == nil {
+		t.Error("Set of a string into an int option succeeded")
+	}
+	if err := r.Set("tab-width", 0); err == nil {
+		t.Error("Set of a value the validator rejects succeeded")
+	}
+	if got := r.Get("tab-width"); got != 8 {
+		t.Errorf("Get = %v, want 8", got)
+	}
+
+	var unknown *UnknownError
+	if err := r.Set("tab-widht", 2); !errors.As(err, &unknown) || unknown.Suggestion != "tab-width" {
+		t.Errorf("Set of a typo = %v, want a suggestion of tab-width", err)
+	}
+	if pending := r.Pending(); !reflect.DeepEqual(pending, []string{"tab-widht"}) {
+		t.Errorf("Pending = %v", pending)
+	}
+
+	locals := make(map[string]any)
+	if err := r.SetLocal("main.go", locals, "tab-width", 2); err != nil {
+		t.Fatalf("SetLocal failed: %v", err)
+	}
+	if r.Local("tab-width", locals) != 2 || r.Get("tab-width") != 8 {
+		t.Errorf("local = %v, global = %v, want 2 and 8", r.Local("tab-width", locals), r.Get("tab-width"))
+	}
+
+	want := []Change{
+		{Name: "tab-width", Old: 4, New: 8},
+		{Name: "tab-width", Old: 8, New: 2, Buffer: "main.go"},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("changes = %+v, want %+v", changes, want)
+	}
+}
+
+func TestValuesSetBeforeDefinitionAreKept(t *testing.T) {
+	r := New()
+	r.Set("tree-width", 30)
+	if err := r.Define(Option{Name: "tree-width", Type: Int, Default: 20, Owner: "tree"}); err != nil {
+		t.Fatalf("Define failed: %v", err)
+	}
+	if got := r.Get("tree-width"); got != 30 {
+		t.Errorf("Get = %v, want the value set before Define", got)
+	}
+	if len(r.Pending()) != 0 {
+		t.Errorf("Pending = %v after Define", r.Pending())
+	}
+
+	called := false
+	r.Watch("tree", "tree-width", func(Change) { called = true })
+	r.RemoveOwner("tree")
+	if _, ok := r.Lookup("tree-width"); ok {
+		t.Error("option still defined after RemoveOwner")
+	}
+	r.Define(Option{Name: "tree-width", Type: Int, Default: 20, Owner: "tree"})
+	if got := r.Get("tree-width"); got != 30 {
+		t.Errorf("Get = %v after reloading, want 30", got)
+	}
+	r.Set("tree-width", 40)
+	if called {
+		t.Error("watcher of a removed owner was called")
+	}
+
+	r.Set("tree-style", 1)
+	if err := r.Define(Option{Name: "tree-style", Type: String, Default: "ascii"}); err == nil {
+		t.Error("Define accepted an invalid value set before it")
+	}
+	if got := r.Get("tree-style"); got != "ascii" {
+		t.Errorf("Get = %v, want the default", got)
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		t    Type
+		in   string
+		want any
+	}{
+		{Bool, "t", true},
+		{Bool, "false", false},
+		{Int, " 12 ", 12},
+		{Float, "0.5", 0.5},
+		{String, `"a b"`, "a b"},
+		{String, "plain", "plain"},
+	}
+	for _, test := range tests {
+		if got, err := Parse(test.t, test.in); err != nil || got != test.want {
+			t.Errorf("Parse(%s, %q) = %v, %v, want %v", test.t, test.in, got, err, test.want)
+		}
+	}
+	if _, err := Parse(Int, "four"); err == nil {
+		t.Error("Parse(int, \"four\") succeeded")
+	}
+}
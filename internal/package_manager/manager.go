@@ -1,12 +1,17 @@
 package package_manager
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/TakahashiShuuhei/edito/internal/buildstamp"
+	"github.com/TakahashiShuuhei/edito/internal/pkgstate"
+	"github.com/TakahashiShuuhei/edito/internal/semver"
 )
 
 type Package struct {
@@ -15,93 +20,305 @@ type Package struct {
 	Description string `json:"description"`
 	URL         string `json:"url"`
 	Author      string `json:"author"`
+	// SHA256 is the hex sha256 digest of the artifact at URL, and
+	// Signature a base64 ed25519 signature by a trusted key of
+	// SignedMessage(Name, Version, SHA256).
+	SHA256    string `json:"sha256"`
+	Signature string `json:"signature"`
+	// Manifest is the URL of the sidecar manifest of a .wasm package,
+	// digested and signed like the artifact.
+	Manifest          string `json:"manifest,omitempty"`
+	ManifestSHA256    string `json:"manifest_sha256,omitempty"`
+	ManifestSignature string `json:"manifest_signature,omitempty"`
+	// Registry is the registry the package was found in.
+	Registry string `json:"-"`
 }
 
-type Registry struct {
-	URL      string
-	packages map[string]Package
-}
+// DefaultRegistry is used when no registry is configured.
+const DefaultRegistry = "https://packages.edito.dev"
 
 type Manager struct {
-	registry     *Registry
+	registries   []*Registry
+	packages     map[string]Package
 	installedDir string
+	cacheDir     string
+	trustedKeys  []TrustedKey
+	installed    *pkgstate.DB
 }
 
-func NewManager(registryURL, installedDir string) *Manager {
+func NewManager(installedDir string) *Manager {
 	return &Manager{
-		registry: &Registry{
-			URL:      registryURL,
-			packages: make(map[string]Package),
-		},
+		packages:     make(map[string]Package),
 		installedDir: installedDir,
+		installed:    pkgstate.New(""),
 	}
 }
 
-func (m *Manager) UpdateRegistry() error {
-	resp, err := http.Get(m.registry.URL + "/packages.json")
-	if err != nil {
-		return fmt.Errorf("failed to fetch registry: %v", err)
+// AddRegistry adds a registry at location: an http(s) URL, a file:// URL
+// or a directory. When several registries list a package, the one with
+// the highest priority wins, and among equal priorities the one added
+// first.
+func (m *Manager) AddRegistry(location string, priority int) {
+	r := &Registry{URL: location, Priority: priority, packages: make(map[string]Package)}
+	i := len(m.registries)
+	for i > 0 && m.registries[i-1].Priority < priority {
+		i--
 	}
-	defer resp.Body.Close()
+	m.registries = append(m.registries[:i], append([]*Registry{r}, m.registries[i:]...)...)
+}
+
+// Registries returns the registries in priority order.
+func (m *Manager) Registries() []*Registry {
+	return append([]*Registry(nil), m.registries...)
+}
+
+// IsRegistry reports whether location is one of the registries.
+func (m *Manager) IsRegistry(location string) bool {
+	for _, r := range m.registries {
+		if r.URL == location {
+			return true
+		}
+	}
+	return false
+}
+
+// SetCacheDir sets the directory in which registry indexes are cached, so
+// that searching works offline.
+func (m *Manager) SetCacheDir(dir string) {
+	m.cacheDir = dir
+}
+
+// SetInstalled sets the installed-state database in which installed
+// packages are recorded with their version and registry.
+func (m *Manager) SetInstalled(db *pkgstate.DB) {
+	m.installed = db
+}
+
+// SetTrustedKeys sets the keys whose signatures InstallPackage accepts.
+func (m *Manager) SetTrustedKeys(keys []TrustedKey) {
+	m.trustedKeys = keys
+}
 
-	var packages []Package
-	if err := json.NewDecoder(resp.Body).Decode(&packages); err != nil {
-		return fmt.Errorf("failed to decode registry: %v", err)
+// UpdateRegistry reads the index of every registry. Registries that
+// cannot be reached are read from the cache. The packages of the
+// registries that could be read are available even when an error is
+// returned for the others.
+func (m *Manager) UpdateRegistry() error {
+	var errs []error
+	for _, r := range m.registries {
+		if err := r.load(m.cacheDir); err != nil {
+			errs = append(errs, err)
+		}
 	}
 
-	for _, pkg := range packages {
-		m.registry.packages[pkg.Name] = pkg
+	m.packages = make(map[string]Package)
+	for i := len(m.registries) - 1; i >= 0; i-- {
+		for name, pkg := range m.registries[i].packages {
+			m.packages[name] = pkg
+		}
 	}
+	return errors.Join(errs...)
+}
 
-	return nil
+// Package returns the package called name from the highest priority
+// registry that lists it.
+func (m *Manager) Package(name string) (Package, bool) {
+	pkg, ok := m.packages[name]
+	return pkg, ok
 }
 
 func (m *Manager) SearchPackage(query string) []Package {
 	var results []Package
-	for _, pkg := range m.registry.packages {
+	for _, pkg := range m.packages {
 		if containsIgnoreCase(pkg.Name, query) || containsIgnoreCase(pkg.Description, query) {
 			results = append(results, pkg)
 		}
 	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Name < results[j].Name })
 	return results
 }
 
 func (m *Manager) InstallPackage(name string) error {
-	pkg, exists := m.registry.packages[name]
+	pkg, exists := m.packages[name]
 	if !exists {
-		return fmt.Errorf("package %s not found in registry", name)
+		return fmt.Errorf("package %s not found in any registry", name)
 	}
 
 	if err := os.MkdirAll(m.installedDir, 0755); err != nil {
 		return fmt.Errorf("failed to create install directory: %v", err)
 	}
 
-	resp, err := http.Get(pkg.URL)
+	// Everything is downloaded and verified before anything is written,
+	// so a failed verification leaves the install directory untouched.
+	data, err := m.fetchVerified(name, pkg.URL, pkg.SHA256, pkg.Signature,
+		SignedMessage(pkg.Name, pkg.Version, strings.ToLower(pkg.SHA256)))
 	if err != nil {
-		return fmt.Errorf("failed to download package: %v", err)
+		return err
+	}
+
+	// WebAssembly plugins are installed as name.wasm with their manifest
+	// next to them as name.json.
+	if strings.HasSuffix(pkg.URL, ".wasm") {
+		if pkg.Manifest == "" {
+			return fmt.Errorf("package %s has no manifest", name)
+		}
+		manifest, err := m.fetchVerified(name, pkg.Manifest, pkg.ManifestSHA256, pkg.ManifestSignature,
+			SignedMessage("manifest", pkg.Name, pkg.Version, strings.ToLower(pkg.ManifestSHA256)))
+		if err != nil {
+			return err
+		}
+		if err := writeFile(filepath.Join(m.installedDir, name+".json"), manifest); err != nil {
+			return err
+		}
+		if err := writeFile(filepath.Join(m.installedDir, name+".wasm"), data); err != nil {
+			return err
+		}
+		return m.recordInstalled(pkg)
 	}
-	defer resp.Body.Close()
 
 	filename := filepath.Join(m.installedDir, name+".so")
-	file, err := os.Create(filename)
+	if err := writeFile(filename, data); err != nil {
+		return err
+	}
+	// A stamp of an earlier build no longer applies.
+	buildstamp.Remove(filename)
+	return m.recordInstalled(pkg)
+}
+
+func (m *Manager) recordInstalled(pkg Package) error {
+	m.installed.Set(pkgstate.Plugin{
+		Name:        pkg.Name,
+		Version:     pkg.Version,
+		Source:      pkg.Registry,
+		SHA256:      strings.ToLower(pkg.SHA256),
+		InstalledAt: time.Now().UTC().Format(time.RFC3339),
+	})
+	return m.installed.Save()
+}
+
+// Outdated returns the installed registry packages whose registry
+// version is newer than the installed one, as name to registry version.
+func (m *Manager) Outdated() map[string]string {
+	outdated := make(map[string]string)
+	for _, p := range m.installed.List() {
+		pkg, ok := m.packages[p.Name]
+		if !ok || !m.IsRegistry(p.Source) {
+			continue
+		}
+		installed, err := semver.Parse(p.Version)
+		if err != nil {
+			continue
+		}
+		if latest, err := semver.Parse(pkg.Version); err == nil && latest.Compare(installed) > 0 {
+			outdated[p.Name] = pkg.Version
+		}
+	}
+	return outdated
+}
+
+func (m *Manager) fetchVerified(name, url, digest, signature string, message []byte) ([]byte, error) {
+	data, err := fetch(url)
 	if err != nil {
-		return fmt.Errorf("failed to create package file: %v", err)
+		return nil, fmt.Errorf("failed to download package %s: %v", name, err)
+	}
+	if err := verify(name, url, data, digest, signature, message, m.trustedKeys); err != nil {
+		return nil, err
 	}
-	defer file.Close()
+	return data, nil
+}
+
+// tempPattern names the temporary files of installs in progress.
+const tempPattern = ".install-*"
 
-	_, err = io.Copy(file, resp.Body)
+// CleanInstallDir removes temporary files left behind by interrupted
+// installs and returns their paths.
+func (m *Manager) CleanInstallDir() ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(m.installedDir, tempPattern))
 	if err != nil {
-		return fmt.Errorf("failed to save package: %v", err)
+		return nil, err
+	}
+	var removed []string
+	for _, path := range matches {
+		if err := os.Remove(path); err != nil {
+			return removed, fmt.Errorf("failed to remove %s: %v", path, err)
+		}
+		removed = append(removed, path)
 	}
+	return removed, nil
+}
+
+// writeFile writes data to filename through a temporary file, so that a
+// partly written plugin is never left behind.
+func writeFile(filename string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(filename), tempPattern)
+	if err != nil {
+		return fmt.Errorf("failed to create package file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
 
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save package: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save package: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), filename); err != nil {
+		return fmt.Errorf("failed to save package: %v", err)
+	}
 	return nil
 }
 
+// InstallDir returns the directory packages are installed in.
+func (m *Manager) InstallDir() string {
+	return m.installedDir
+}
+
+// ArtifactPath returns the installed .so or .wasm file of name.
+func (m *Manager) ArtifactPath(name string) (string, bool) {
+	for _, ext := range []string{".so", ".wasm"} {
+		path := filepath.Join(m.installedDir, name+ext)
+		if _, err := os.Stat(path); err == nil {
+			return path, true
+		}
+	}
+	return "", false
+}
+
 func (m *Manager) UninstallPackage(name string) error {
+	if err := m.uninstall(name); err != nil {
+		return err
+	}
+	if _, ok := m.installed.Get(name); ok {
+		m.installed.Remove(name)
+		return m.installed.Save()
+	}
+	return nil
+}
+
+func (m *Manager) uninstall(name string) error {
+	dir := filepath.Join(m.installedDir, name)
+	if _, err := os.Stat(filepath.Join(dir, "plugin.json")); err == nil {
+		if err := os.RemoveAll(dir); err != nil {
+			return fmt.Errorf("failed to remove package: %v", err)
+		}
+		return nil
+	}
+	
+	wasm := filepath.Join(m.installedDir, name+".wasm")
+	if _, err := os.Stat(wasm); err == nil {
+		os.Remove(filepath.Join(m.installedDir, name+".json"))
+		if err := os.Remove(wasm); err != nil {
+			return fmt.Errorf("failed to remove package: %v", err)
+		}
+		return nil
+	}
+
 	filename := filepath.Join(m.installedDir, name+".so")
 	if err := os.Remove(filename); err != nil {
 		return fmt.Errorf("failed to remove package: %v", err)
 	}
+	buildstamp.Remove(filename)
 	return nil
 }
 
@@ -116,9 +333,13 @@ func (m *Manager) ListInstalled() ([]string, error) {
 
 	var packages []string
 	for _, file := range files {
-		if filepath.Ext(file.Name()) == ".so" {
-			name := file.Name()[:len(file.Name())-3]
-			packages = append(packages, name)
+		if ext := filepath.Ext(file.Name()); ext == ".so" || ext == ".wasm" {
+			packages = append(packages, strings.TrimSuffix(file.Name(), ext))
+		} else if file.IsDir() {
+			// Process plugins live in a directory with a plugin.json
+			if _, err := os.Stat(filepath.Join(m.installedDir, file.Name(), "plugin.json")); err == nil {
+				packages = append(packages, file.Name())
+			}
 		}
 	}
 
@@ -0,0 +1,209 @@
+package package_manager
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestInstallPackageVerifiesArtifacts(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherKey, _ := ed25519.GenerateKey(nil)
+
+	artifact := []byte("plugin binary")
+	sum := sha256.Sum256(artifact)
+	digest := hex.EncodeToString(sum[:])
+	sign := func(key ed25519.PrivateKey, name, version string) string {
+		return base64.StdEncoding.EncodeToString(ed25519.Sign(key, SignedMessage(name, version, digest)))
+	}
+	signature := sign(private, "good", "1.0.0")
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/packages.json":
+			json.NewEncoder(w).Encode([]Package{
+				{Name: "good", Version: "1.0.0", URL: server.URL + "/good.so", SHA256: digest, Signature: signature},
+				{Name: "tampered", Version: "1.0.0", URL: server.URL + "/tampered.so", SHA256: digest, Signature: sign(private, "tampered", "1.0.0")},
+				{Name: "forged", Version: "1.0.0", URL: server.URL + "/good.so", SHA256: digest, Signature: sign(otherKey, "forged", "1.0.0")},
+				{Name: "unsigned", Version: "1.0.0", URL: server.URL + "/good.so", SHA256: digest},
+				// An artifact signed for good, served under another
+				// name or as another version.
+				{Name: "renamed", Version: "1.0.0", URL: server.URL + "/good.so", SHA256: digest, Signature: signature},
+				{Name: "relabeled", Version: "2.0.0", URL: server.URL + "/good.so", SHA256: digest, Signature: sign(private, "relabeled", "1.0.0")},
+				{Name: "missing", Version: "1.0.0", URL: server.URL + "/missing.so", SHA256: digest, Signature: sign(private, "missing", "1.0.0")},
+			})
+		case "/good.so":
+			w.Write(artifact)
+		case "/tampered.so":
+			w.Write([]byte("evil binary"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	keysFile := filepath.Join(dir, "trusted-keys")
+	line := "# registry key\n" + base64.StdEncoding.EncodeToString(public) + " packages.edito.dev\n"
+	if err := os.WriteFile(keysFile, []byte(line), 0644); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := LoadTrustedKeys(keysFile)
+	if err != nil || len(keys) != 1 || keys[0].Comment != "packages.edito.dev" {
+		t.Fatalf("LoadTrustedKeys = %v, %v", keys, err)
+	}
+
+	installDir := filepath.Join(dir, "plugins")
+	m := NewManager(installDir)
+	m.AddRegistry(server.URL, 0)
+	m.SetTrustedKeys(keys)
+	if err := m.UpdateRegistry(); err != nil {
+		t.Fatalf("UpdateRegistry failed: %v", err)
+	}
+
+	if err := m.InstallPackage("good"); err != nil {
+		t.Fatalf("InstallPackage(good) failed: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(installDir, "good.so")); string(data) != string(artifact) {
+		t.Errorf("good.so = %q", data)
+	}
+
+	for _, name := range []string{"tampered", "forged", "unsigned", "renamed", "relabeled"} {
+		var verr *VerificationError
+		if err := m.InstallPackage(name); !errors.As(err, &verr) {
+			t.Errorf("InstallPackage(%s) = %v, want a VerificationError", name, err)
+		}
+		if _, err := os.Stat(filepath.Join(installDir, name+".so")); !os.IsNotExist(err) {
+			t.Errorf("%s.so was installed despite failing verification", name)
+		}
+	}
+	if err := m.InstallPackage("missing"); err == nil {
+		t.Error("InstallPackage saved a 404 response")
+	}
+	if _, err := os.Stat(filepath.Join(installDir, "missing.so")); !os.IsNotExist(err) {
+		t.Error("missing.so was created from a 404 response")
+	}
+}
+
+func TestRegistriesByPriorityWithOfflineCache(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func(name, version string, data []byte) (string, string) {
+		sum := sha256.Sum256(data)
+		digest := hex.EncodeToString(sum[:])
+		return digest, base64.StdEncoding.EncodeToString(ed25519.Sign(private, SignedMessage(name, version, digest)))
+	}
+
+	// A mirror on disk with relative artifact paths.
+	mirror := t.TempDir()
+	local := []byte("mirrored tree")
+	digest, signature := sign("tree", "1.1.0", local)
+	os.WriteFile(filepath.Join(mirror, "tree.so"), local, 0644)
+	index, _ := json.Marshal([]Package{{Name: "tree", Version: "1.1.0", URL: "tree.so", SHA256: digest, Signature: signature}})
+	os.WriteFile(filepath.Join(mirror, "packages.json"), index, 0644)
+
+	remote := []byte("remote tree")
+	remoteDigest, remoteSignature := sign("tree", "1.2.0", remote)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/packages.json":
+			json.NewEncoder(w).Encode([]Package{
+				{Name: "tree", Version: "1.2.0", URL: "tree.so", SHA256: remoteDigest, Signature: remoteSignature},
+				{Name: "lsp", Version: "0.1.0", Description: "Language server client", URL: "lsp.so"},
+			})
+		case "/tree.so":
+			w.Write(remote)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	dir := t.TempDir()
+	cacheDir := filepath.Join(dir, "cache")
+	newManager := func() *Manager {
+		m := NewManager(filepath.Join(dir, "plugins"))
+		m.SetTrustedKeys([]TrustedKey{{Key: public}})
+		m.SetCacheDir(cacheDir)
+		m.AddRegistry(server.URL, 0)
+		m.AddRegistry(mirror, 10)
+		return m
+	}
+
+	m := newManager()
+	if registries := m.Registries(); registries[0].Priority != 10 {
+		t.Errorf("registries are not in priority order: %v", registries)
+	}
+	if err := m.UpdateRegistry(); err != nil {
+		t.Fatalf("UpdateRegistry failed: %v", err)
+	}
+	if pkg, _ := m.Package("tree"); pkg.Version != "1.1.0" || pkg.URL != filepath.Join(mirror, "tree.so") {
+		t.Errorf("tree = %+v, want the mirror's 1.1.0", pkg)
+	}
+	if err := m.InstallPackage("tree"); err != nil {
+		t.Fatalf("InstallPackage failed: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "plugins", "tree.so")); string(data) != string(local) {
+		t.Errorf("tree.so = %q, want the mirrored artifact", data)
+	}
+
+	// Offline, the remote index comes from the cache.
+	server.Close()
+	m = newManager()
+	if err := m.UpdateRegistry(); err != nil {
+		t.Fatalf("UpdateRegistry offline failed: %v", err)
+	}
+	if results := m.SearchPackage("Language"); len(results) != 1 || results[0].Name != "lsp" {
+		t.Errorf("SearchPackage offline = %+v, want lsp from the cached index", results)
+	}
+	if !m.Registries()[1].Cached {
+		t.Error("remote registry was not marked as cached")
+	}
+
+	m = NewManager(filepath.Join(dir, "plugins"))
+	m.AddRegistry(server.URL, 0)
+	if err := m.UpdateRegistry(); err == nil {
+		t.Error("UpdateRegistry succeeded for an unreachable registry without a cache")
+	}
+
+	m = NewManager(filepath.Join(dir, "plugins"))
+	m.SetTrustedKeys([]TrustedKey{{Key: public}})
+	m.AddRegistry("file://"+filepath.ToSlash(mirror), 0)
+	if err := m.UpdateRegistry(); err != nil {
+		t.Fatalf("UpdateRegistry of a file:// registry failed: %v", err)
+	}
+	if err := m.InstallPackage("tree"); err != nil {
+		t.Errorf("InstallPackage from a file:// registry failed: %v", err)
+	}
+}
+
+func TestFetchGivesUpOnAHangingServer(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	timeout := httpClient.Timeout
+	httpClient.Timeout = 50 * time.Millisecond
+	defer func() { httpClient.Timeout = timeout }()
+
+	if _, err := fetch(server.URL + "/" + indexFile); err == nil {
+		t.Error("fetch from a server that never answers succeeded")
+	}
+}
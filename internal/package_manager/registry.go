@@ -0,0 +1,172 @@
+package package_manager
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// indexFile is the name of a registry's index, relative to its location.
+const indexFile = "packages.json"
+
+// fetchTimeout bounds a download, so that a registry or mirror that stops
+// answering fails the install instead of blocking it.
+const fetchTimeout = 2 * time.Minute
+
+var httpClient = &http.Client{Timeout: fetchTimeout}
+
+// Registry is a package index. Its location is an http(s) URL, a file://
+// URL or a plain directory holding packages.json. Package URLs in the
+// index may be relative to that location, so that a directory of
+// artifacts can be copied to an offline machine as it is.
+type Registry struct {
+	URL string
+	// Priority decides which registry wins when several list the same
+	// package; higher wins.
+	Priority int
+	// Cached is set when the index was read from the on-disk cache
+	// because the registry could not be reached.
+	Cached   bool
+	packages map[string]Package
+}
+
+func (r *Registry) String() string {
+	return r.URL
+}
+
+// location returns ref resolved against the registry: relative paths are
+// taken relative to the directory or URL of the index.
+func (r *Registry) location(ref string) string {
+	if ref == "" || isURL(ref) || filepath.IsAbs(ref) {
+		return ref
+	}
+	if isURL(r.URL) {
+		base, err := url.Parse(strings.TrimSuffix(r.URL, "/") + "/")
+		if err != nil {
+			return ref
+		}
+		rel, err := url.Parse(ref)
+		if err != nil {
+			return ref
+		}
+		return base.ResolveReference(rel).String()
+	}
+	return filepath.Join(r.URL, filepath.FromSlash(ref))
+}
+
+// load reads the index of the registry, falling back to the copy in
+// cacheDir when the registry cannot be read, and refreshing that copy
+// when it can.
+func (r *Registry) load(cacheDir string) error {
+	data, err := fetch(r.location(indexFile))
+	r.Cached = false
+	if err != nil {
+		cached, cacheErr := os.ReadFile(r.cacheFile(cacheDir))
+		if cacheDir == "" || cacheErr != nil {
+			return fmt.Errorf("failed to fetch registry %s: %v", r.URL, err)
+		}
+		data = cached
+		r.Cached = true
+	}
+
+	var packages []Package
+	if err := json.Unmarshal(data, &packages); err != nil {
+		return fmt.Errorf("failed to decode registry %s: %v", r.URL, err)
+	}
+
+	r.packages = make(map[string]Package)
+	for _, pkg := range packages {
+		pkg.Registry = r.URL
+		pkg.URL = r.location(pkg.URL)
+		pkg.Manifest = r.location(pkg.Manifest)
+		r.packages[pkg.Name] = pkg
+	}
+
+	if !r.Cached && cacheDir != "" {
+		if err := os.MkdirAll(cacheDir, 0755); err == nil {
+			writeFile(r.cacheFile(cacheDir), data)
+		}
+	}
+	return nil
+}
+
+// cacheFile names the cached index after a digest of the registry URL.
+func (r *Registry) cacheFile(cacheDir string) string {
+	sum := sha256.Sum256([]byte(r.URL))
+	return filepath.Join(cacheDir, hex.EncodeToString(sum[:8])+".json")
+}
+
+func isURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && len(u.Scheme) > 1 && u.Host+u.Path != ""
+}
+
+// fetch reads location, which is an http(s) URL, a file:// URL or a
+// path. Any HTTP status but 200 is an error, so that an error page is
+// never mistaken for a package.
+func fetch(location string) ([]byte, error) {
+	u, err := url.Parse(location)
+	if err != nil || len(u.Scheme) <= 1 {
+		// Plain paths, including Windows drive letters.
+		return os.ReadFile(location)
+	}
+
+	switch u.Scheme {
+	case "file":
+		return os.ReadFile(filepath.FromSlash(u.Path))
+	case "http", "https":
+	default:
+		return nil, fmt.Errorf("unsupported registry scheme %q", u.Scheme)
+	}
+
+	resp, err := httpClient.Get(location)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", location, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// CleanCache removes cached indexes of registries that are no longer
+// configured and returns their paths.
+func (m *Manager) CleanCache() ([]string, error) {
+	if m.cacheDir == "" {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(m.cacheDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read registry cache: %v", err)
+	}
+
+	keep := make(map[string]bool)
+	for _, r := range m.registries {
+		keep[r.cacheFile(m.cacheDir)] = true
+	}
+	var removed []string
+	for _, entry := range entries {
+		path := filepath.Join(m.cacheDir, entry.Name())
+		if keep[path] || entry.IsDir() {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			return removed, fmt.Errorf("failed to remove %s: %v", path, err)
+		}
+		removed = append(removed, path)
+	}
+	return removed, nil
+}
@@ -0,0 +1,107 @@
+package package_manager
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// TrustedKey is an ed25519 public key that may sign packages.
+type TrustedKey struct {
+	Key     ed25519.PublicKey
+	Comment string
+}
+
+// LoadTrustedKeys reads a trusted-keys file. Each line holds a base64
+// ed25519 public key optionally followed by a comment; blank lines and
+// lines starting with # are ignored. A missing file yields no keys.
+func LoadTrustedKeys(path string) ([]TrustedKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read trusted keys: %v", err)
+	}
+
+	var keys []TrustedKey
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, " ", 2)
+		key, err := base64.StdEncoding.DecodeString(fields[0])
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("%s:%d: not a base64 ed25519 public key", path, n)
+		}
+		trusted := TrustedKey{Key: ed25519.PublicKey(key)}
+		if len(fields) > 1 {
+			trusted.Comment = strings.TrimSpace(fields[1])
+		}
+		keys = append(keys, trusted)
+	}
+	return keys, nil
+}
+
+// VerificationError reports a downloaded artifact that did not match the
+// registry. Nothing is installed when it is returned.
+type VerificationError struct {
+	Package string
+	URL     string
+	Reason  string
+}
+
+func (e *VerificationError) Error() string {
+	return fmt.Sprintf("package %s failed verification: %s (%s); nothing was installed", e.Package, e.Reason, e.URL)
+}
+
+// SignedMessage returns what a registry signs for a package: its name,
+// version and digest separated by NUL bytes. Signing them together keeps
+// a mirror from serving a signed artifact under another name or version.
+// The manifest of a .wasm package is signed as "manifest" followed by the
+// same fields with the manifest's digest.
+func SignedMessage(fields ...string) []byte {
+	return []byte(strings.Join(fields, "\x00"))
+}
+
+// verify checks data against the sha256 digest published in the registry
+// and message, which embeds that digest, against the detached base64
+// ed25519 signature.
+func verify(name, url string, data []byte, digest, signature string, message []byte, keys []TrustedKey) error {
+	fail := func(format string, args ...any) error {
+		return &VerificationError{Package: name, URL: url, Reason: fmt.Sprintf(format, args...)}
+	}
+
+	if digest == "" {
+		return fail("the registry has no sha256 digest for it")
+	}
+	sum := sha256.Sum256(data)
+	if got := hex.EncodeToString(sum[:]); !strings.EqualFold(got, digest) {
+		return fail("sha256 mismatch: registry has %s, download has %s", digest, got)
+	}
+
+	if signature == "" {
+		return fail("the registry has no signature for it")
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return fail("the signature is not a base64 ed25519 signature")
+	}
+	if len(keys) == 0 {
+		return fail("no trusted keys are configured")
+	}
+	for _, key := range keys {
+		if ed25519.Verify(key.Key, message, sig) {
+			return nil
+		}
+	}
+	return fail("the signature does not match any trusted key")
+}
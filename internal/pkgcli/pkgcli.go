@@ -0,0 +1,536 @@
+// Package pkgcli implements `edito pkg`, which manages plugins from the
+// command line so that machines can be provisioned by scripts.
+package pkgcli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/TakahashiShuuhei/edito/internal/api"
+	"github.com/TakahashiShuuhei/edito/internal/config"
+	"github.com/TakahashiShuuhei/edito/internal/package_manager"
+	"github.com/TakahashiShuuhei/edito/internal/pkgstate"
+	"github.com/TakahashiShuuhei/edito/internal/plugin"
+)
+
+// Exit codes of edito pkg.
+const (
+	ExitOK = iota
+	// ExitError is returned for failures not covered below, such as
+	// network or build errors.
+	ExitError
+	ExitUsage
+	ExitNotFound
+	// ExitVerifyFailed is returned when a download or an installed
+	// plugin does not match its digest or signature.
+	ExitVerifyFailed
+)
+
+const usage = `Usage: edito pkg [--json] <command> [arguments]
+
+Commands:
+  search [query]       search the registries
+  info <name>          show a package and its installed version
+  install <name>...    install packages or plugins listed in config.go
+  uninstall <name>...  remove installed plugins
+  list                 list installed plugins
+  upgrade [name...]    upgrade plugins, all of them by default
+  verify [name...]     check installed plugins against their recorded digests
+  gc                   remove leftover downloads, stale records and caches
+
+Exit codes: 0 success, 1 error, 2 usage, 3 not found, 4 verification failed.
+`
+
+// env holds what the commands work on.
+type env struct {
+	cfg       *config.Config
+	manager   *package_manager.Manager
+	installer *plugin.AutoInstaller
+	installed *pkgstate.DB
+	specs     []plugin.PluginSpec
+	stdout    io.Writer
+	stderr    io.Writer
+	json      bool
+}
+
+// result is the outcome for one plugin of a command that changes or
+// checks several.
+type result struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+	code    int
+}
+
+// Run runs edito pkg with args, the arguments after "pkg", and returns
+// the exit code.
+func Run(args []string, stdout, stderr io.Writer) int {
+	e := &env{stdout: stdout, stderr: stderr}
+
+	var rest []string
+	for _, arg := range args {
+		switch arg {
+		case "--json", "-json":
+			e.json = true
+		case "-h", "--help", "help":
+			fmt.Fprint(stdout, usage)
+			return ExitOK
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	if len(rest) == 0 {
+		fmt.Fprint(stderr, usage)
+		return ExitUsage
+	}
+
+	cfg, err := config.New()
+	if err != nil {
+		fmt.Fprintf(stderr, "edito pkg: %v\n", err)
+		return ExitError
+	}
+	e.setup(cfg)
+
+	command, args := rest[0], rest[1:]
+	switch command {
+	case "search":
+		return e.search(strings.Join(args, " "))
+	case "info":
+		if len(args) != 1 {
+			return e.usageError("info takes one package name")
+		}
+		return e.info(args[0])
+	case "install":
+		if len(args) == 0 {
+			return e.usageError("install needs at least one package name")
+		}
+		return e.install(args)
+	case "uninstall":
+		if len(args) == 0 {
+			return e.usageError("uninstall needs at least one package name")
+		}
+		return e.uninstall(args)
+	case "list":
+		return e.list()
+	case "upgrade":
+		return e.upgrade(args)
+	case "verify":
+		return e.verify(args)
+	case "gc":
+		return e.gc()
+	}
+	return e.usageError(fmt.Sprintf("unknown command %q", command))
+}
+
+func (e *env) usageError(message string) int {
+	fmt.Fprintf(e.stderr, "edito pkg: %s\n\n%s", message, usage)
+	return ExitUsage
+}
+
+// setup reads the registries and plugin specs from config.go the way the
+// editor does. The rest of the configuration runs against an editor that
+// ignores it.
+func (e *env) setup(cfg *config.Config) {
+	e.cfg = cfg
+	e.manager = package_manager.NewManager(cfg.PluginDir())
+	e.manager.SetCacheDir(cfg.RegistryCacheDir())
+
+	registries := 0
+	err := config.LoadGoConfig(cfg.GoConfigFile(), api.New(api.Backend{
+		InstallPlugin: func(name, repository, version string) {
+			spec := plugin.PluginSpec{Name: name, Repository: repository, Version: version}
+			e.specs = append(e.specs, spec.WithBaseDir(cfg.ConfigDir))
+		},
+		AddRegistry: func(location string, priority int) {
+			e.manager.AddRegistry(location, priority)
+			registries++
+		},
+	}))
+	if err != nil {
+		e.warn(err)
+	}
+	if registries == 0 {
+		e.manager.AddRegistry(package_manager.DefaultRegistry, 0)
+	}
+
+	if e.installed, err = pkgstate.Open(cfg.InstalledFile()); err != nil {
+		e.warn(err)
+	}
+	e.manager.SetInstalled(e.installed)
+	if keys, err := package_manager.LoadTrustedKeys(cfg.TrustedKeysFile()); err != nil {
+		e.warn(err)
+	} else {
+		e.manager.SetTrustedKeys(keys)
+	}
+
+	lock, err := pkgstate.Open(cfg.LockFile())
+	if err != nil {
+		e.warn(err)
+	}
+	e.installer = plugin.NewAutoInstaller(cfg.PluginDir(), cfg.CacheDir)
+	e.installer.SetState(e.installed, lock)
+	// Progress goes to stderr so that --json output stays parseable.
+	e.installer.SetOutput(e.stderr)
+}
+
+func (e *env) warn(err error) {
+	fmt.Fprintf(e.stderr, "warning: %v\n", err)
+}
+
+// update reads the registry indexes. Registries that cannot be read are
+// reported, and the others are still used.
+func (e *env) update() {
+	if err := e.manager.UpdateRegistry(); err != nil {
+		e.warn(err)
+	}
+}
+
+func (e *env) spec(name string) (plugin.PluginSpec, bool) {
+	for _, spec := range e.specs {
+		if spec.Name == name {
+			return spec, true
+		}
+	}
+	return plugin.PluginSpec{}, false
+}
+
+func (e *env) isInstalled(name string) bool {
+	names, _ := e.manager.ListInstalled()
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// output prints value as JSON with --json, and calls human otherwise.
+func (e *env) output(value any, human func()) {
+	if !e.json {
+		human()
+		return
+	}
+	enc := json.NewEncoder(e.stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(value)
+}
+
+// finish prints results and returns the most specific failing exit code.
+func (e *env) finish(results []result) int {
+	e.output(results, func() {
+		for _, r := range results {
+			line := fmt.Sprintf("%-24s %-10s %s", r.Name, r.Status, r.Version)
+			if r.Error != "" {
+				line = fmt.Sprintf("%-24s %-10s %s", r.Name, r.Status, r.Error)
+			}
+			fmt.Fprintln(e.stdout, strings.TrimRight(line, " "))
+		}
+	})
+
+	code := ExitOK
+	for _, r := range results {
+		if r.code > code {
+			code = r.code
+		}
+	}
+	return code
+}
+
+func failed(name string, err error) result {
+	r := result{Name: name, Status: "failed", Error: err.Error(), code: ExitError}
+	var verr *package_manager.VerificationError
+	if errors.As(err, &verr) {
+		r.code = ExitVerifyFailed
+	}
+	return r
+}
+
+func notFound(name, where string) result {
+	return result{Name: name, Status: "not-found", Error: fmt.Sprintf("%s not found %s", name, where), code: ExitNotFound}
+}
+
+// packageInfo is the JSON form of a registry package.
+type packageInfo struct {
+	Name        string `json:"name"`
+	Version     string `json:"version,omitempty"`
+	Description string `json:"description,omitempty"`
+	Author      string `json:"author,omitempty"`
+	Registry    string `json:"registry,omitempty"`
+	Installed   string `json:"installed,omitempty"`
+	Source      string `json:"source,omitempty"`
+}
+
+func (e *env) describe(pkg package_manager.Package) packageInfo {
+	info := packageInfo{Name: pkg.Name, Version: pkg.Version, Description: pkg.Description, Author: pkg.Author, Registry: pkg.Registry}
+	if p, ok := e.installed.Get(pkg.Name); ok {
+		info.Installed = p.Version
+	}
+	return info
+}
+
+func (e *env) search(query string) int {
+	e.update()
+	var infos []packageInfo
+	for _, pkg := range e.manager.SearchPackage(query) {
+		infos = append(infos, e.describe(pkg))
+	}
+	e.output(infos, func() {
+		for _, info := range infos {
+			installed := ""
+			if info.Installed != "" {
+				installed = " [installed " + info.Installed + "]"
+			}
+			fmt.Fprintf(e.stdout, "%-24s %-10s %s%s\n", info.Name, info.Version, info.Description, installed)
+		}
+	})
+	if len(infos) == 0 {
+		return ExitNotFound
+	}
+	return ExitOK
+}
+
+func (e *env) info(name string) int {
+	e.update()
+	pkg, inRegistry := e.manager.Package(name)
+	info := e.describe(pkg)
+	info.Name = name
+	p, installed := e.installed.Get(name)
+	if installed {
+		info.Installed = p.Version
+		info.Source = p.Source
+	}
+	if spec, ok := e.spec(name); ok && info.Source == "" {
+		info.Source = spec.Repository
+	}
+	if !inRegistry && !installed && !e.isInstalled(name) {
+		if _, ok := e.spec(name); !ok {
+			fmt.Fprintf(e.stderr, "edito pkg: %s not found in any registry or config.go\n", name)
+			return ExitNotFound
+		}
+	}
+
+	e.output(info, func() {
+		for _, field := range [][2]string{
+			{"Name", info.Name},
+			{"Version", info.Version},
+			{"Description", info.Description},
+			{"Author", info.Author},
+			{"Registry", info.Registry},
+			{"Installed", info.Installed},
+			{"Source", info.Source},
+		} {
+			if field[1] != "" {
+				fmt.Fprintf(e.stdout, "%-12s %s\n", field[0]+":", field[1])
+			}
+		}
+	})
+	return ExitOK
+}
+
+func (e *env) install(names []string) int {
+	e.update()
+	var results []result
+	for _, name := range names {
+		results = append(results, e.installOne(name))
+	}
+	return e.finish(results)
+}
+
+// installOne installs name from config.go's InstallPlugin spec if it has
+// one, and from the registries otherwise.
+func (e *env) installOne(name string) result {
+	if spec, ok := e.spec(name); ok {
+		if err := e.installer.InstallPlugin(spec); err != nil {
+			return failed(name, err)
+		}
+	} else {
+		if _, ok := e.manager.Package(name); !ok {
+			return notFound(name, "in any registry or config.go")
+		}
+		if err := e.manager.InstallPackage(name); err != nil {
+			return failed(name, err)
+		}
+	}
+	p, _ := e.installed.Get(name)
+	return result{Name: name, Version: p.Version, Status: "installed"}
+}
+
+func (e *env) uninstall(names []string) int {
+	var results []result
+	for _, name := range names {
+		if !e.isInstalled(name) {
+			results = append(results, notFound(name, "among installed plugins"))
+			continue
+		}
+		if err := e.manager.UninstallPackage(name); err != nil {
+			results = append(results, failed(name, err))
+			continue
+		}
+		results = append(results, result{Name: name, Status: "removed"})
+	}
+	return e.finish(results)
+}
+
+func (e *env) list() int {
+	names, err := e.manager.ListInstalled()
+	if err != nil {
+		fmt.Fprintf(e.stderr, "edito pkg: %v\n", err)
+		return ExitError
+	}
+
+	var infos []packageInfo
+	for _, name := range names {
+		info := packageInfo{Name: name}
+		if p, ok := e.installed.Get(name); ok {
+			info.Installed = p.Version
+			info.Source = p.Source
+		}
+		infos = append(infos, info)
+	}
+	e.output(infos, func() {
+		for _, info := range infos {
+			version := info.Installed
+			if version == "" {
+				version = "-"
+			}
+			fmt.Fprintln(e.stdout, strings.TrimRight(fmt.Sprintf("%-24s %-10s %s", info.Name, version, info.Source), " "))
+		}
+	})
+	return ExitOK
+}
+
+func (e *env) upgrade(names []string) int {
+	e.update()
+	if len(names) == 0 {
+		for _, p := range e.installed.List() {
+			names = append(names, p.Name)
+		}
+	}
+
+	var results []result
+	for _, name := range names {
+		results = append(results, e.upgradeOne(name))
+	}
+	return e.finish(results)
+}
+
+func (e *env) upgradeOne(name string) result {
+	current, installed := e.installed.Get(name)
+	if spec, ok := e.spec(name); ok {
+		version, err := e.installer.Upgrade(spec)
+		if err != nil {
+			return failed(name, err)
+		}
+		if installed && current.Version == version {
+			return result{Name: name, Version: version, Status: "current"}
+		}
+		return result{Name: name, Version: version, Status: "upgraded"}
+	}
+
+	if !installed || !e.manager.IsRegistry(current.Source) {
+		if e.isInstalled(name) {
+			return result{Name: name, Version: current.Version, Status: "skipped", Error: "not installed from a registry or config.go"}
+		}
+		return notFound(name, "among installed plugins")
+	}
+	if _, outdated := e.manager.Outdated()[name]; !outdated {
+		return result{Name: name, Version: current.Version, Status: "current"}
+	}
+	if err := e.manager.InstallPackage(name); err != nil {
+		return failed(name, err)
+	}
+	p, _ := e.installed.Get(name)
+	return result{Name: name, Version: p.Version, Status: "upgraded"}
+}
+
+func (e *env) verify(names []string) int {
+	if len(names) == 0 {
+		for _, p := range e.installed.List() {
+			names = append(names, p.Name)
+		}
+	}
+
+	var results []result
+	for _, name := range names {
+		results = append(results, e.verifyOne(name))
+	}
+	return e.finish(results)
+}
+
+func (e *env) verifyOne(name string) result {
+	p, ok := e.installed.Get(name)
+	if !ok {
+		return notFound(name, "among recorded installs")
+	}
+	path, ok := e.manager.ArtifactPath(name)
+	if !ok {
+		return result{Name: name, Version: p.Version, Status: "missing", Error: "the plugin file is missing; reinstall it", code: ExitVerifyFailed}
+	}
+	if p.SHA256 == "" {
+		return result{Name: name, Version: p.Version, Status: "unknown", Error: "no digest was recorded; reinstall it", code: ExitVerifyFailed}
+	}
+	digest, err := pkgstate.FileDigest(path)
+	if err != nil {
+		return failed(name, err)
+	}
+	if digest != p.SHA256 {
+		return result{Name: name, Version: p.Version, Status: "modified", Error: fmt.Sprintf("%s has sha256 %s, installed as %s", path, digest, p.SHA256), code: ExitVerifyFailed}
+	}
+	return result{Name: name, Version: p.Version, Status: "ok"}
+}
+
+// gc removes temporary files of interrupted installs, records of plugins
+// whose files are gone, and cached indexes of registries no longer
+// configured.
+func (e *env) gc() int {
+	var removed []string
+	code := ExitOK
+	collect := func(paths []string, err error) {
+		removed = append(removed, paths...)
+		if err != nil {
+			e.warn(err)
+			code = ExitError
+		}
+	}
+
+	collect(e.manager.CleanInstallDir())
+	collect(e.manager.CleanCache())
+
+	pruned := false
+	for _, p := range e.installed.List() {
+		if !e.isInstalled(p.Name) {
+			e.installed.Remove(p.Name)
+			removed = append(removed, "record of "+p.Name)
+			pruned = true
+		}
+	}
+	if pruned {
+		if err := e.installed.Save(); err != nil {
+			e.warn(err)
+			code = ExitError
+		}
+	}
+
+	if removed == nil {
+		removed = []string{}
+	}
+	e.output(map[string][]string{"removed": removed}, func() {
+		for _, item := range removed {
+			fmt.Fprintf(e.stdout, "removed %s\n", item)
+		}
+		if len(removed) == 0 {
+			fmt.Fprintln(e.stdout, "nothing to remove")
+		}
+	})
+	return code
+}
+
+// Main is the entry point used by the edito binary.
+func Main(args []string) {
+	os.Exit(Run(args, os.Stdout, os.Stderr))
+}
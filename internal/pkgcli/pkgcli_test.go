@@ -0,0 +1,117 @@
+package pkgcli
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/TakahashiShuuhei/edito/internal/package_manager"
+)
+
+// setupHome points the XDG directories at a temporary home with a
+// config.go that uses a directory registry holding one signed package.
+func setupHome(t *testing.T) (registry string) {
+	home := t.TempDir()
+	for _, v := range []string{"XDG_CONFIG_HOME", "XDG_DATA_HOME", "XDG_CACHE_HOME"} {
+		t.Setenv(v, filepath.Join(home, v))
+	}
+	configDir := filepath.Join(home, "XDG_CONFIG_HOME", "edito")
+	registry = filepath.Join(home, "registry")
+	os.MkdirAll(configDir, 0755)
+	os.MkdirAll(registry, 0755)
+
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(configDir, "trusted-keys"), []byte(base64.StdEncoding.EncodeToString(public)+"\n"), 0644)
+	config := "package config\n\nimport \"github.com/TakahashiShuuhei/edito/pkg/edito\"\n\nfunc init() {\n\tedito.AddRegistry(\"" + filepath.ToSlash(registry) + "\", 0)\n}\n"
+	os.WriteFile(filepath.Join(configDir, "config.go"), []byte(config), 0644)
+
+	artifact := []byte("tree plugin")
+	sum := sha256.Sum256(artifact)
+	os.WriteFile(filepath.Join(registry, "tree.so"), artifact, 0644)
+	index, _ := json.Marshal([]package_manager.Package{{
+		Name:        "tree",
+		Version:     "1.0.0",
+		Description: "File tree",
+		URL:         "tree.so",
+		SHA256:      hex.EncodeToString(sum[:]),
+		Signature:   base64.StdEncoding.EncodeToString(ed25519.Sign(private, package_manager.SignedMessage("tree", "1.0.0", hex.EncodeToString(sum[:])))),
+	}})
+	os.WriteFile(filepath.Join(registry, "packages.json"), index, 0644)
+	return registry
+}
+
+func run(t *testing.T, args ...string) (string, int) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := Run(args, &stdout, &stderr)
+	return stdout.String(), code
+}
+
+func TestPkgCommands(t *testing.T) {
+	setupHome(t)
+
+	if _, code := run(t); code != ExitUsage {
+		t.Errorf("no command: exit %d, want %d", code, ExitUsage)
+	}
+	if _, code := run(t, "frobnicate"); code != ExitUsage {
+		t.Errorf("unknown command: exit %d, want %d", code, ExitUsage)
+	}
+
+	out, code := run(t, "--json", "search", "tree")
+	var found []packageInfo
+	if code != ExitOK || json.Unmarshal([]byte(out), &found) != nil || len(found) != 1 || found[0].Version != "1.0.0" {
+		t.Fatalf("search: exit %d, output %s", code, out)
+	}
+	if _, code := run(t, "info", "nothing"); code != ExitNotFound {
+		t.Errorf("info of an unknown package: exit %d, want %d", code, ExitNotFound)
+	}
+
+	if out, code := run(t, "install", "tree"); code != ExitOK || !strings.Contains(out, "installed") {
+		t.Fatalf("install: exit %d, output %s", code, out)
+	}
+	if _, code := run(t, "install", "nothing"); code != ExitNotFound {
+		t.Errorf("install of an unknown package: exit %d, want %d", code, ExitNotFound)
+	}
+
+	out, _ = run(t, "--json", "list")
+	var listed []packageInfo
+	if json.Unmarshal([]byte(out), &listed) != nil || len(listed) != 1 || listed[0].Installed != "1.0.0" {
+		t.Errorf("list = %s, want tree 1.0.0", out)
+	}
+
+	if _, code := run(t, "verify"); code != ExitOK {
+		t.Errorf("verify of an intact install: exit %d", code)
+	}
+	pluginDir := filepath.Join(os.Getenv("XDG_DATA_HOME"), "edito", "plugins")
+	os.WriteFile(filepath.Join(pluginDir, "tree.so"), []byte("tampered"), 0644)
+	if out, code := run(t, "verify", "tree"); code != ExitVerifyFailed || !strings.Contains(out, "modified") {
+		t.Errorf("verify of a modified plugin: exit %d, output %s", code, out)
+	}
+
+	if out, code := run(t, "upgrade"); code != ExitOK || !strings.Contains(out, "current") {
+		t.Errorf("upgrade: exit %d, output %s", code, out)
+	}
+
+	os.WriteFile(filepath.Join(pluginDir, ".install-123"), nil, 0644)
+	if _, code := run(t, "uninstall", "tree"); code != ExitOK {
+		t.Errorf("uninstall: exit %d", code)
+	}
+	if _, code := run(t, "uninstall", "tree"); code != ExitNotFound {
+		t.Errorf("second uninstall: exit %d, want %d", code, ExitNotFound)
+	}
+	out, code = run(t, "--json", "gc")
+	var gc map[string][]string
+	if code != ExitOK || json.Unmarshal([]byte(out), &gc) != nil || len(gc["removed"]) != 1 {
+		t.Errorf("gc: exit %d, output %s", code, out)
+	}
+}
@@ -0,0 +1,152 @@
+// Package pkgstate records which plugin versions are installed and which
+// versions a setup is locked to.
+package pkgstate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Plugin describes one installed or locked plugin.
+type Plugin struct {
+	Name string `json:"-"`
+	// Version is the resolved version, e.g. "v0.2.3", or a branch or
+	// commit for plugins that are not versioned.
+	Version string `json:"version"`
+	// Source is the Go module path for plugins built from source, or the
+	// registry URL for downloaded packages.
+	Source string `json:"source"`
+	// Constraint is the version the configuration asked for, e.g. "^0.2.0".
+	Constraint string `json:"constraint,omitempty"`
+	// SHA256 is the hex digest of the installed artifact, checked by
+	// edito pkg verify.
+	SHA256 string `json:"sha256,omitempty"`
+	// InstalledAt is an RFC 3339 time. The lockfile leaves it empty so
+	// that it only changes when versions do.
+	InstalledAt string `json:"installed_at,omitempty"`
+}
+
+// DB is a JSON file mapping plugin names to Plugin records. It backs both
+// the installed-state database in DataDir and the lockfile next to
+// config.go. It is safe for concurrent use, since plugins are installed
+// in the background while the editor reads it.
+type DB struct {
+	path    string
+	mutex   sync.Mutex
+	plugins map[string]Plugin
+}
+
+type dbFile struct {
+	Plugins map[string]Plugin `json:"plugins"`
+}
+
+func New(path string) *DB {
+	return &DB{
+		path:    path,
+		plugins: make(map[string]Plugin),
+	}
+}
+
+// Open returns the DB at path, loaded.
+func Open(path string) (*DB, error) {
+	db := New(path)
+	return db, db.Load()
+}
+
+func (db *DB) Path() string {
+	return db.path
+}
+
+// Load reads the file. A missing file is not an error.
+func (db *DB) Load() error {
+	data, err := os.ReadFile(db.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read %s: %v", db.path, err)
+	}
+
+	var file dbFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to decode %s: %v", db.path, err)
+	}
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	db.plugins = make(map[string]Plugin)
+	for name, p := range file.Plugins {
+		p.Name = name
+		db.plugins[name] = p
+	}
+	return nil
+}
+
+func (db *DB) Save() error {
+	if db.path == "" {
+		return nil
+	}
+	// Held while writing so that concurrent saves land in order.
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	if err := os.MkdirAll(filepath.Dir(db.path), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %v", filepath.Dir(db.path), err)
+	}
+	data, err := json.MarshalIndent(dbFile{Plugins: db.plugins}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %v", db.path, err)
+	}
+	return os.WriteFile(db.path, append(data, '\n'), 0644)
+}
+
+func (db *DB) Get(name string) (Plugin, bool) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	p, ok := db.plugins[name]
+	return p, ok
+}
+
+func (db *DB) Set(p Plugin) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	db.plugins[p.Name] = p
+}
+
+func (db *DB) Remove(name string) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	delete(db.plugins, name)
+}
+
+// List returns the records sorted by name.
+func (db *DB) List() []Plugin {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	plugins := make([]Plugin, 0, len(db.plugins))
+	for _, p := range db.plugins {
+		plugins = append(plugins, p)
+	}
+	sort.Slice(plugins, func(i, j int) bool { return plugins[i].Name < plugins[j].Name })
+	return plugins
+}
+
+// FileDigest returns the hex sha256 digest of the file at path.
+func FileDigest(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
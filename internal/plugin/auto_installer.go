@@ -1,88 +1,555 @@
 package plugin
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/TakahashiShuuhei/edito/internal/buildstamp"
+	"github.com/TakahashiShuuhei/edito/internal/pkgstate"
+	"github.com/TakahashiShuuhei/edito/internal/semver"
 )
 
 // PluginSpec defines a plugin to be automatically installed
 type PluginSpec struct {
 	Name       string // プラグイン名 (例: "file-tree")
-	Repository string // GitリポジトリURL (例: "github.com/TakahashiShuuhei/edito-file-tree")
-	Version    string // バージョンタグ (例: "v0.1.0", "latest", "main")
+	Repository string // モジュールパス (例: "github.com/TakahashiShuuhei/edito-file-tree") またはローカルのディレクトリ (例: "~/src/edito-file-tree")
+	Version    string // バージョン制約 (例: "v0.1.0", "^0.2.0", "~0.2.1", ">=0.1.0 <0.3.0", "latest")、ブランチ名 (例: "main")、コミット、またはローカルの場合 "develop"
 }
 
 // AutoInstaller handles automatic plugin installation
 type AutoInstaller struct {
-	pluginDir string
-	cacheDir  string
+	pluginDir   string
+	cacheDir    string
+	installed   *pkgstate.DB
+	lock        *pkgstate.DB
+	out         io.Writer
+	parallelism int
+	building    map[string]bool
+	// mutex guards the state above. Builds run without it, so that
+	// several plugins can be built at once.
+	mutex sync.Mutex
+
+	// listVersions, query and build are replaced in tests.
+	listVersions func(ctx context.Context, module string) ([]string, error)
+	query        func(ctx context.Context, module, ref string) (string, error)
+	build        func(ctx context.Context, spec PluginSpec) error
+}
+
+// Update describes a plugin with a newer version available.
+type Update struct {
+	Name      string
+	Installed string
+	// Wanted is the newest version the configured constraint allows, and
+	// Latest the newest version published.
+	Wanted string
+	Latest string
+}
+
+// States reported by InstallAll.
+const (
+	InstallBuilding  = "building"
+	InstallInstalled = "installed"
+	InstallCurrent   = "current"
+	InstallFailed    = "failed"
+	InstallCancelled = "cancelled"
+)
+
+// Progress reports a change in the state of one plugin during InstallAll.
+type Progress struct {
+	Name  string
+	State string
+	Err   error
+	// Done counts the plugins finished so far, out of Total.
+	Done  int
+	Total int
 }
 
+// DefaultParallelism bounds the number of plugins built at once.
+var DefaultParallelism = min(4, runtime.NumCPU())
+
 // NewAutoInstaller creates a new auto installer
 func NewAutoInstaller(pluginDir, cacheDir string) *AutoInstaller {
-	return &AutoInstaller{
-		pluginDir: pluginDir,
-		cacheDir:  cacheDir,
+	ai := &AutoInstaller{
+		pluginDir:    pluginDir,
+		cacheDir:     cacheDir,
+		installed:    pkgstate.New(""),
+		lock:         pkgstate.New(""),
+		out:          os.Stdout,
+		parallelism:  DefaultParallelism,
+		building:     make(map[string]bool),
+		listVersions: goListVersions,
+		query:        goQuery,
+	}
+	ai.build = ai.buildAndInstall
+	return ai
+}
+
+// SetState sets the installed-state database and the lockfile. Installed
+// versions and sources are recorded in installed, and the resolved
+// versions in lock, which InstallPlugin then prefers.
+func (ai *AutoInstaller) SetState(installed, lock *pkgstate.DB) {
+	ai.mutex.Lock()
+	defer ai.mutex.Unlock()
+	ai.installed = installed
+	ai.lock = lock
+}
+
+// SetOutput sets where progress messages are written.
+func (ai *AutoInstaller) SetOutput(w io.Writer) {
+	ai.mutex.Lock()
+	defer ai.mutex.Unlock()
+	ai.out = w
+}
+
+// SetParallelism sets how many plugins InstallAll builds at once.
+func (ai *AutoInstaller) SetParallelism(n int) {
+	ai.mutex.Lock()
+	defer ai.mutex.Unlock()
+	ai.parallelism = max(n, 1)
+}
+
+func (ai *AutoInstaller) printf(format string, args ...any) {
+	ai.mutex.Lock()
+	defer ai.mutex.Unlock()
+	fmt.Fprintf(ai.out, format, args...)
+}
+
+// Installed returns the installed-state record of name.
+func (ai *AutoInstaller) Installed(name string) (pkgstate.Plugin, bool) {
+	ai.mutex.Lock()
+	defer ai.mutex.Unlock()
+	return ai.installed.Get(name)
+}
+
+// Resolve returns the version of spec to install: the locked version if
+// it still satisfies spec.Version, otherwise the newest version that does.
+// A branch or commit resolves to the pseudo-version of its commit, locked
+// like a version, and a local directory to a digest of its source.
+func (ai *AutoInstaller) Resolve(spec PluginSpec) (string, error) {
+	return ai.resolve(context.Background(), spec)
+}
+
+func (ai *AutoInstaller) resolve(ctx context.Context, spec PluginSpec) (string, error) {
+	if spec.IsLocal() {
+		return localVersion(spec.Repository)
+	}
+	ai.mutex.Lock()
+	locked, ok := ai.lock.Get(spec.Name)
+	ai.mutex.Unlock()
+	ok = ok && locked.Source == spec.Repository
+
+	if isRef(spec.Version) {
+		if ok && locked.Constraint == spec.Version {
+			return locked.Version, nil
+		}
+		return ai.resolveRef(ctx, spec)
+	}
+	if ok {
+		c, _ := semver.ParseConstraint(spec.Version)
+		if v, err := semver.Parse(locked.Version); err == nil && c.Allows(v) {
+			return locked.Version, nil
+		}
+	}
+	return ai.newest(ctx, spec, spec.Version)
+}
+
+// resolveRef returns the version of the commit a branch or commit of spec
+// names.
+func (ai *AutoInstaller) resolveRef(ctx context.Context, spec PluginSpec) (string, error) {
+	version, err := ai.query(ctx, spec.Repository, spec.Version)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s@%s: %v", spec.Repository, spec.Version, err)
+	}
+	return version, nil
+}
+
+// newest returns the newest published version of spec allowed by
+// constraint.
+func (ai *AutoInstaller) newest(ctx context.Context, spec PluginSpec, constraint string) (string, error) {
+	c, err := semver.ParseConstraint(constraint)
+	if err != nil {
+		return "", err
+	}
+	versions, err := ai.listVersions(ctx, spec.Repository)
+	if err != nil {
+		return "", fmt.Errorf("failed to list versions of %s: %v", spec.Repository, err)
 	}
+	if best, ok := c.Best(versions); ok {
+		return best, nil
+	}
+	if len(versions) == 0 && (constraint == "" || constraint == "latest") {
+		// Modules without tags are installed at their latest commit.
+		return "latest", nil
+	}
+	return "", fmt.Errorf("no version of %s matches %q", spec.Repository, constraint)
 }
 
-// InstallPlugin automatically downloads, builds, and installs a plugin
+// InstallPlugin installs the version of spec chosen by Resolve, unless it
+// is already installed.
 func (ai *AutoInstaller) InstallPlugin(spec PluginSpec) error {
+	_, err := ai.installPlugin(context.Background(), spec, func() {})
+	return err
+}
+
+// installPlugin calls building before it starts a build, and reports
+// whether it built the plugin.
+func (ai *AutoInstaller) installPlugin(ctx context.Context, spec PluginSpec, building func()) (bool, error) {
+	version, err := ai.resolve(ctx, spec)
+	if err != nil {
+		return false, err
+	}
+
+	ai.mutex.Lock()
 	soPath := filepath.Join(ai.pluginDir, spec.Name+".so")
-	
-	// すでに.soファイルが存在する場合はスキップ
-	if _, err := os.Stat(soPath); err == nil {
-		fmt.Printf("Plugin %s already installed, skipping\n", spec.Name)
-		return nil
-	}
-	
-	fmt.Printf("Installing plugin %s from %s@%s\n", spec.Name, spec.Repository, spec.Version)
-	
-	// 一時ディレクトリでプラグインをビルド
-	tempDir, err := ai.createTempBuildDir(spec)
+	if current, ok := ai.installed.Get(spec.Name); ok && current.Version == version && current.Source == spec.Repository {
+		// A plugin built for another Go or edito version is rebuilt.
+		if _, err := os.Stat(soPath); err == nil && buildstamp.Check(soPath) == nil {
+			defer ai.mutex.Unlock()
+			// Already installed; make sure the lockfile records it.
+			if locked, _ := ai.lock.Get(spec.Name); locked.Version != version || locked.Source != spec.Repository || locked.Constraint != spec.Version {
+				ai.record(spec, version, current.InstalledAt)
+				return false, ai.saveState()
+			}
+			return false, nil
+		}
+	} else if !ok && spec.Version == version {
+		// Plugins installed before versions were recorded are kept
+		// when they ask for a fixed version.
+		if _, err := os.Stat(soPath); err == nil && buildstamp.Check(soPath) == nil {
+			fmt.Fprintf(ai.out, "Plugin %s already installed, skipping\n", spec.Name)
+			ai.mutex.Unlock()
+			return false, nil
+		}
+	}
+	ai.mutex.Unlock()
+
+	building()
+	return true, ai.install(ctx, spec, version)
+}
+
+// Upgrade installs the newest version of spec that spec.Version allows,
+// or the current commit of its branch, ignoring the lockfile, and returns
+// it. A local plugin is rebuilt if its source changed.
+func (ai *AutoInstaller) Upgrade(spec PluginSpec) (string, error) {
+	ctx := context.Background()
+	var version string
+	var err error
+	switch {
+	case spec.IsLocal():
+		version, err = localVersion(spec.Repository)
+	case isRef(spec.Version):
+		version, err = ai.resolveRef(ctx, spec)
+	default:
+		version, err = ai.newest(ctx, spec, spec.Version)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to create temp dir: %v", err)
+		return "", err
+	}
+	if current, ok := ai.Installed(spec.Name); ok && current.Version == version && current.Source == spec.Repository {
+		return version, nil
+	}
+	return version, ai.install(ctx, spec, version)
+}
+
+// Outdated returns the plugins in specs with a newer version than the
+// installed one.
+func (ai *AutoInstaller) Outdated(specs []PluginSpec) ([]Update, error) {
+	ctx := context.Background()
+	var updates []Update
+	for _, spec := range specs {
+		if spec.IsLocal() || isRef(spec.Version) {
+			continue
+		}
+		current, ok := ai.Installed(spec.Name)
+		if !ok {
+			continue
+		}
+		installed, err := semver.Parse(current.Version)
+		if err != nil {
+			continue
+		}
+		latest, err := ai.newest(ctx, spec, "latest")
+		if err != nil {
+			return updates, err
+		}
+		wanted, err := ai.newest(ctx, spec, spec.Version)
+		if err != nil {
+			wanted = current.Version
+		}
+		if newer(latest, installed) || newer(wanted, installed) {
+			updates = append(updates, Update{Name: spec.Name, Installed: current.Version, Wanted: wanted, Latest: latest})
+		}
+	}
+	return updates, nil
+}
+
+func newer(version string, than semver.Version) bool {
+	v, err := semver.Parse(version)
+	return err == nil && v.Compare(than) > 0
+}
+
+// InstallAll installs specs like InstallPlugin, building up to the
+// configured number of plugins at once. Cancelling ctx stops the builds
+// in progress and skips the rest. progress, which may be nil, is called
+// from the install goroutines when a build starts and when each plugin is
+// done. The returned error joins the failures.
+func (ai *AutoInstaller) InstallAll(ctx context.Context, specs []PluginSpec, progress func(Progress)) error {
+	if progress == nil {
+		progress = func(Progress) {}
+	}
+	ai.mutex.Lock()
+	slots := make(chan struct{}, ai.parallelism)
+	ai.mutex.Unlock()
+
+	var (
+		wg    sync.WaitGroup
+		mutex sync.Mutex
+		done  int
+		errs  []error
+	)
+	finish := func(spec PluginSpec, state string, err error) {
+		mutex.Lock()
+		done++
+		p := Progress{Name: spec.Name, State: state, Err: err, Done: done, Total: len(specs)}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("plugin %s: %w", spec.Name, err))
+		}
+		mutex.Unlock()
+		progress(p)
 	}
-	defer os.RemoveAll(tempDir)
-	
-	// プラグインをダウンロード
-	if err := ai.downloadPlugin(tempDir, spec); err != nil {
+
+	for _, spec := range specs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			case <-ctx.Done():
+				finish(spec, InstallCancelled, ctx.Err())
+				return
+			}
+			if ctx.Err() != nil {
+				finish(spec, InstallCancelled, ctx.Err())
+				return
+			}
+
+			built, err := ai.installPlugin(ctx, spec, func() {
+				progress(Progress{Name: spec.Name, State: InstallBuilding, Total: len(specs)})
+			})
+			switch {
+			case ctx.Err() != nil:
+				finish(spec, InstallCancelled, ctx.Err())
+			case err != nil:
+				finish(spec, InstallFailed, err)
+			case built:
+				finish(spec, InstallInstalled, nil)
+			default:
+				finish(spec, InstallCurrent, nil)
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+func (ai *AutoInstaller) install(ctx context.Context, spec PluginSpec, version string) error {
+	ai.mutex.Lock()
+	if ai.building[spec.Name] {
+		ai.mutex.Unlock()
+		return fmt.Errorf("plugin %s is already being built", spec.Name)
+	}
+	ai.building[spec.Name] = true
+	ai.mutex.Unlock()
+	defer func() {
+		ai.mutex.Lock()
+		delete(ai.building, spec.Name)
+		ai.mutex.Unlock()
+	}()
+
+	constraint := spec.Version
+	spec.Version = version
+	ai.printf("Installing plugin %s from %s@%s\n", spec.Name, spec.Repository, spec.Version)
+	if err := ai.build(ctx, spec); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	spec.Version = constraint
+
+	ai.mutex.Lock()
+	ai.record(spec, version, time.Now().UTC().Format(time.RFC3339))
+	err := ai.saveState()
+	ai.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	ai.printf("Plugin %s installed successfully\n", spec.Name)
+	return nil
+}
+
+// record must be called with the mutex held.
+func (ai *AutoInstaller) record(spec PluginSpec, version, installedAt string) {
+	digest, _ := pkgstate.FileDigest(filepath.Join(ai.pluginDir, spec.Name+".so"))
+	ai.installed.Set(pkgstate.Plugin{Name: spec.Name, Version: version, Source: spec.Repository, Constraint: spec.Version, SHA256: digest, InstalledAt: installedAt})
+	ai.lock.Set(pkgstate.Plugin{Name: spec.Name, Version: version, Source: spec.Repository, Constraint: spec.Version})
+}
+
+// saveState must be called with the mutex held.
+func (ai *AutoInstaller) saveState() error {
+	if err := ai.installed.Save(); err != nil {
+		return err
+	}
+	return ai.lock.Save()
+}
+
+// workspace is the persistent build directory of a plugin. Keeping its
+// go.mod and go.sum between builds, together with the GOCACHE under
+// cacheDir, makes rebuilding a plugin mostly incremental. Local plugins
+// get their own, so that the replace directive never leaks into builds
+// of the published module.
+func (ai *AutoInstaller) workspace(spec PluginSpec) string {
+	if spec.IsLocal() {
+		return filepath.Join(ai.cacheDir, "build", spec.Name+"@local")
+	}
+	return filepath.Join(ai.cacheDir, "build", spec.Name)
+}
+
+// goCommand runs the go tool in dir with the installer's build cache and
+// the Go version of the running edito, and returns its combined output.
+func (ai *AutoInstaller) goCommand(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "go", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), buildstamp.BuildEnv()...)
+	if ai.cacheDir != "" {
+		cmd.Env = append(cmd.Env, "GOCACHE="+filepath.Join(ai.cacheDir, "go-build"))
+	}
+	return cmd.CombinedOutput()
+}
+
+// buildAndInstall downloads, builds and installs spec.Version of a plugin.
+func (ai *AutoInstaller) buildAndInstall(ctx context.Context, spec PluginSpec) error {
+	dir := ai.workspace(spec)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create build dir: %v", err)
+	}
+
+	// プラグインをダウンロード（ローカルの場合は replace で参照）
+	module, err := ai.downloadPlugin(ctx, dir, spec)
+	if err != nil {
+		// 壊れた作業ディレクトリは次回のために作り直す
+		os.RemoveAll(dir)
 		return fmt.Errorf("failed to download plugin: %v", err)
 	}
-	
+	spec.Repository = module
+
 	// プラグインをビルド
-	if err := ai.buildPlugin(tempDir, spec); err != nil {
+	if err := ai.buildPlugin(ctx, dir, spec); err != nil {
+		os.RemoveAll(dir)
 		return fmt.Errorf("failed to build plugin: %v", err)
 	}
-	
+
+	// 実行中の edito で読み込めるか確認
+	if err := buildstamp.Check(filepath.Join(dir, spec.Name+".so")); err != nil {
+		return fmt.Errorf("built plugin cannot be loaded: %v; the plugin needs a release compatible with this edito", err)
+	}
+
 	// プラグインを配置
-	if err := ai.installBuiltPlugin(tempDir, spec); err != nil {
+	if err := ai.installBuiltPlugin(dir, spec); err != nil {
 		return fmt.Errorf("failed to install plugin: %v", err)
 	}
-	
-	fmt.Printf("Plugin %s installed successfully\n", spec.Name)
-	return nil
+	return buildstamp.Write(filepath.Join(ai.pluginDir, spec.Name+".so"))
+}
+
+// goListVersions returns the tagged versions of a module.
+func goListVersions(ctx context.Context, module string) ([]string, error) {
+	output, err := goListModule(ctx, "-versions", module)
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(string(output))
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	return fields[1:], nil
 }
 
-func (ai *AutoInstaller) createTempBuildDir(spec PluginSpec) (string, error) {
-	tempDir, err := os.MkdirTemp("", "edito-plugin-"+spec.Name+"-*")
+// goQuery returns the version, or pseudo-version, of the commit that ref
+// names in module.
+func goQuery(ctx context.Context, module, ref string) (string, error) {
+	output, err := goListModule(ctx, "-f", "{{.Version}}", module+"@"+ref)
 	if err != nil {
 		return "", err
 	}
-	return tempDir, nil
+	return strings.TrimSpace(string(output)), nil
 }
 
-func (ai *AutoInstaller) downloadPlugin(tempDir string, spec PluginSpec) error {
-	// go mod init
-	cmd := exec.Command("go", "mod", "init", "temp-plugin-build")
-	cmd.Dir = tempDir
+// goListModule runs go list -m with args outside any module.
+func goListModule(ctx context.Context, args ...string) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "edito-versions-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	cmd := exec.CommandContext(ctx, "go", "mod", "init", "temp-version-list")
+	cmd.Dir = dir
 	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("go mod init failed: %v", err)
+		return nil, fmt.Errorf("go mod init failed: %v", err)
 	}
-	
+	cmd = exec.CommandContext(ctx, "go", append([]string{"list", "-m"}, args...)...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("go list failed: %v\nOutput: %s", err, strings.TrimSpace(string(output)))
+	}
+	return output, nil
+}
+
+// downloadPlugin prepares the workspace to build spec and returns the
+// module path to import.
+func (ai *AutoInstaller) downloadPlugin(ctx context.Context, dir string, spec PluginSpec) (string, error) {
+	// go mod init（作業ディレクトリを再利用する場合は不要）
+	// プラグインごとにモジュール名を変え、読み込み時にプラグインのパスが衝突しないようにする
+	if _, err := os.Stat(filepath.Join(dir, "go.mod")); os.IsNotExist(err) {
+		if output, err := ai.goCommand(ctx, dir, "mod", "init", "edito-plugin-build/"+spec.Name); err != nil {
+			return "", fmt.Errorf("go mod init failed: %v\nOutput: %s", err, output)
+		}
+	}
+
+	// edito と共有するモジュールは実行中の edito と同じバージョンに揃える
+	var pins []string
+	if running, ok := buildstamp.Running(); ok {
+		pins = running.Requirements()
+	}
+
+	// ローカルのディレクトリは replace で参照する
+	if spec.IsLocal() {
+		module, err := modulePath(spec.Repository)
+		if err != nil {
+			return "", err
+		}
+		if output, err := ai.goCommand(ctx, dir, "mod", "edit", "-replace="+module+"="+spec.Repository); err != nil {
+			return "", fmt.Errorf("go mod edit failed: %v\nOutput: %s", err, output)
+		}
+		if len(pins) > 0 {
+			if output, err := ai.goCommand(ctx, dir, append([]string{"get"}, pins...)...); err != nil {
+				return "", fmt.Errorf("go get failed: %v\nOutput: %s", err, output)
+			}
+		}
+		return module, nil
+	}
+
 	// go get でプラグインをダウンロード
 	version := spec.Version
 	if version == "latest" {
@@ -90,18 +557,16 @@ func (ai *AutoInstaller) downloadPlugin(tempDir string, spec PluginSpec) error {
 	} else if version != "" && !strings.HasPrefix(version, "@") {
 		version = "@" + version
 	}
-	
+
 	repoURL := spec.Repository + version
-	cmd = exec.Command("go", "get", repoURL)
-	cmd.Dir = tempDir
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("go get %s failed: %v", repoURL, err)
+	if output, err := ai.goCommand(ctx, dir, append([]string{"get", repoURL}, pins...)...); err != nil {
+		return "", fmt.Errorf("go get %s failed: %v\nOutput: %s", repoURL, err, output)
 	}
-	
-	return nil
+
+	return spec.Repository, nil
 }
 
-func (ai *AutoInstaller) buildPlugin(tempDir string, spec PluginSpec) error {
+func (ai *AutoInstaller) buildPlugin(ctx context.Context, dir string, spec PluginSpec) error {
 	// main.goファイルを作成（プラグインをimportしてre-export）
 	mainGoContent := fmt.Sprintf(`package main
 
@@ -112,74 +577,71 @@ import (
 // プラグインのre-export
 // この方法でプラグインパッケージをロード可能にする
 `, spec.Repository)
-	
-	mainGoPath := filepath.Join(tempDir, "main.go")
+
+	mainGoPath := filepath.Join(dir, "main.go")
 	if err := os.WriteFile(mainGoPath, []byte(mainGoContent), 0644); err != nil {
 		return fmt.Errorf("failed to write main.go: %v", err)
 	}
-	
+
 	// go mod tidy
-	cmd := exec.Command("go", "mod", "tidy")
-	cmd.Dir = tempDir
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("go mod tidy failed: %v", err)
+	if output, err := ai.goCommand(ctx, dir, "mod", "tidy"); err != nil {
+		return fmt.Errorf("go mod tidy failed: %v\nOutput: %s", err, output)
 	}
-	
+
 	// プラグインとしてビルド
-	outputPath := filepath.Join(tempDir, spec.Name+".so")
-	cmd = exec.Command("go", "build", "-buildmode=plugin", "-o", outputPath, ".")
-	cmd.Dir = tempDir
-	cmd.Env = append(os.Environ(), "CGO_ENABLED=1")
-	
-	output, err := cmd.CombinedOutput()
+	outputPath := filepath.Join(dir, spec.Name+".so")
+	output, err := ai.goCommand(ctx, dir, "build", "-buildmode=plugin", "-o", outputPath, ".")
 	if err != nil {
 		return fmt.Errorf("go build failed: %v\nOutput: %s", err, string(output))
 	}
-	
+
 	return nil
 }
 
-func (ai *AutoInstaller) installBuiltPlugin(tempDir string, spec PluginSpec) error {
-	sourcePath := filepath.Join(tempDir, spec.Name+".so")
+func (ai *AutoInstaller) installBuiltPlugin(dir string, spec PluginSpec) error {
+	sourcePath := filepath.Join(dir, spec.Name+".so")
 	targetPath := filepath.Join(ai.pluginDir, spec.Name+".so")
-	
+
 	// プラグインディレクトリを作成
 	if err := os.MkdirAll(ai.pluginDir, 0755); err != nil {
 		return fmt.Errorf("failed to create plugin dir: %v", err)
 	}
-	
+
 	// .soファイルをコピー
 	sourceFile, err := os.Open(sourcePath)
 	if err != nil {
 		return fmt.Errorf("failed to open source file: %v", err)
 	}
 	defer sourceFile.Close()
-	
-	targetFile, err := os.Create(targetPath)
+
+	// 読み込み中のエディタが壊れたファイルを見ないよう、一時ファイルに書いてから置き換える
+	targetFile, err := os.CreateTemp(ai.pluginDir, ".install-*")
 	if err != nil {
 		return fmt.Errorf("failed to create target file: %v", err)
 	}
-	defer targetFile.Close()
-	
-	if _, err := sourceFile.Seek(0, 0); err != nil {
-		return fmt.Errorf("failed to seek source file: %v", err)
-	}
-	
+	defer os.Remove(targetFile.Name())
+
 	if _, err := targetFile.ReadFrom(sourceFile); err != nil {
+		targetFile.Close()
 		return fmt.Errorf("failed to copy file: %v", err)
 	}
-	
+	if err := targetFile.Close(); err != nil {
+		return fmt.Errorf("failed to copy file: %v", err)
+	}
+	if err := os.Rename(targetFile.Name(), targetPath); err != nil {
+		return fmt.Errorf("failed to copy file: %v", err)
+	}
+
 	return nil
 }
 
 // CheckAndInstallPlugins checks config and installs missing plugins
 func (ai *AutoInstaller) CheckAndInstallPlugins(specs []PluginSpec) error {
-	for _, spec := range specs {
-		if err := ai.InstallPlugin(spec); err != nil {
-			fmt.Printf("Warning: failed to install plugin %s: %v\n", spec.Name, err)
-			// 一つのプラグインが失敗しても他を続ける
-			continue
+	// 一つのプラグインが失敗しても他を続ける
+	ai.InstallAll(context.Background(), specs, func(p Progress) {
+		if p.State == InstallFailed {
+			ai.printf("Warning: failed to install plugin %s: %v\n", p.Name, p.Err)
 		}
-	}
+	})
 	return nil
-}
\ No newline at end of file
+}
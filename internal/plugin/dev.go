@@ -0,0 +1,51 @@
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/TakahashiShuuhei/edito/internal/buildstamp"
+)
+
+// BuildDev builds the plugin package in sourceDir for reload-plugin.
+//
+// A Go plugin cannot be unloaded, and the runtime refuses to open a second
+// plugin with the same plugin path. Each build therefore compiles the
+// main package under a fresh versioned path (-p and -pluginpath must
+// agree) into a new file, so that the new code is loaded next to the old
+// one. The old code stays in memory until edito exits.
+func BuildDev(sourceDir, outDir, name string) (string, error) {
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create dev plugin dir: %v", err)
+	}
+
+	// Builds of earlier reloads are no longer needed on disk; a loaded
+	// plugin stays mapped after its file is removed.
+	if old, err := filepath.Glob(filepath.Join(outDir, name+"-*.so")); err == nil {
+		for _, path := range old {
+			os.Remove(path)
+		}
+	}
+
+	version := time.Now().UnixNano()
+	outputPath := filepath.Join(outDir, fmt.Sprintf("%s-%d.so", name, version))
+	pluginPath := fmt.Sprintf("edito-dev-%s-%d", name, version)
+
+	cmd := exec.Command("go", "build", "-buildmode=plugin",
+		"-gcflags=-p="+pluginPath, "-ldflags=-pluginpath="+pluginPath,
+		"-o", outputPath, ".")
+	cmd.Dir = sourceDir
+	cmd.Env = append(os.Environ(), buildstamp.BuildEnv()...)
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("go build failed: %v\nOutput: %s", err, string(output))
+	}
+	if err := buildstamp.Write(outputPath); err != nil {
+		return "", err
+	}
+	return outputPath, nil
+}
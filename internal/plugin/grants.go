@@ -0,0 +1,117 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/TakahashiShuuhei/edito/internal/capability"
+)
+
+// Grants records the user's answer to each plugin's capability request,
+// so that the user is asked only once per plugin. A plugin that later
+// asks for more capabilities is asked about again.
+type Grants struct {
+	path    string
+	plugins map[string]grant
+}
+
+type grant struct {
+	Capabilities []string `json:"capabilities"`
+	Allowed      bool     `json:"allowed"`
+}
+
+func NewGrants(path string) *Grants {
+	return &Grants{
+		path:    path,
+		plugins: make(map[string]grant),
+	}
+}
+
+// Load reads the grants file. A missing file is not an error.
+func (g *Grants) Load() error {
+	data, err := os.ReadFile(g.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read plugin grants: %v", err)
+	}
+
+	plugins := make(map[string]grant)
+	if err := json.Unmarshal(data, &plugins); err != nil {
+		return fmt.Errorf("failed to decode plugin grants: %v", err)
+	}
+	g.plugins = plugins
+	return nil
+}
+
+func (g *Grants) Save() error {
+	if g.path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(g.path), 0755); err != nil {
+		return fmt.Errorf("failed to create plugin grants directory: %v", err)
+	}
+	data, err := json.MarshalIndent(g.plugins, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode plugin grants: %v", err)
+	}
+	return os.WriteFile(g.path, data, 0600)
+}
+
+// Decided reports whether the user has answered for every capability in
+// requested.
+func (g *Grants) Decided(name string, requested []capability.Capability) bool {
+	recorded, ok := g.plugins[name]
+	if !ok {
+		return false
+	}
+	for _, c := range requested {
+		if !contains(recorded.Capabilities, c.String()) {
+			return false
+		}
+	}
+	return true
+}
+
+// Set records the user's answer for requested.
+func (g *Grants) Set(name string, requested []capability.Capability, allowed bool) {
+	caps := make([]string, len(requested))
+	for i, c := range requested {
+		caps[i] = c.String()
+	}
+	sort.Strings(caps)
+	g.plugins[name] = grant{Capabilities: caps, Allowed: allowed}
+}
+
+// Forget drops the answer for name, so that the user is asked again.
+func (g *Grants) Forget(name string) {
+	delete(g.plugins, name)
+}
+
+// Granted returns the capabilities in requested that the user allowed.
+func (g *Grants) Granted(name string, requested []capability.Capability) []capability.Capability {
+	recorded, ok := g.plugins[name]
+	if !ok || !recorded.Allowed {
+		return nil
+	}
+	var granted []capability.Capability
+	for _, c := range requested {
+		if contains(recorded.Capabilities, c.String()) {
+			granted = append(granted, c)
+		}
+	}
+	return granted
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/TakahashiShuuhei/edito/internal/api"
+)
+
+// DefaultCallTimeout is how long a call into plugin code may run before
+// it counts as a failure. Calls run on the editor goroutine and are
+// always waited for: Go cannot stop them, and left running they would
+// change editor state concurrently. A plugin that never returns
+// therefore still hangs the editor.
+const DefaultCallTimeout = 5 * time.Second
+
+// MaxFailures is the number of panics and slow calls after which a
+// plugin should be disabled.
+const MaxFailures = 3
+
+// Failure describes a call into plugin code that panicked or ran longer
+// than the call timeout.
+type Failure struct {
+	Plugin    string
+	Operation string
+	Err       error
+	Stack     string
+	Time      time.Time
+	// Count is how many times the plugin has failed since it was loaded.
+	Count int
+	// Disable is set once the plugin has failed MaxFailures times, or
+	// when it reported api.ErrPluginStopped.
+	Disable bool
+	// Slow is set when all of its failures were slow or stopped calls
+	// rather than panics.
+	Slow bool
+}
+
+// SetFailureHandler sets the function that is told about every failure.
+// It runs on the goroutine that called into the plugin.
+func (m *Manager) SetFailureHandler(handler func(f Failure)) {
+	m.onFailure = handler
+}
+
+// SetCallTimeout changes how long a call may take before it counts as a
+// failure.
+func (m *Manager) SetCallTimeout(timeout time.Duration) {
+	m.timeout = timeout
+}
+
+// Failures returns how many times the plugin called name has failed since
+// it was loaded.
+func (m *Manager) Failures(name string) int {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return m.failures[name]
+}
+
+// Call runs fn, which calls into the plugin called name, so that a panic
+// in the plugin cannot take the editor down. Panics, calls longer than
+// the call timeout and plugins that stopped are reported to the failure
+// handler. A panic is returned as an error; otherwise the error returned
+// by fn is passed through, since a slow call still finished its work.
+func (m *Manager) Call(name, operation string, fn func() error) error {
+	stack, elapsed, err := m.run(fn)
+	panicked := stack != ""
+	stopped := errors.Is(err, api.ErrPluginStopped)
+	if !panicked && !stopped && elapsed <= m.timeout {
+		return err
+	}
+
+	m.mutex.Lock()
+	m.failures[name]++
+	if panicked {
+		m.panics[name]++
+	}
+	count, panics := m.failures[name], m.panics[name]
+	m.mutex.Unlock()
+
+	failure := err
+	if !panicked && !stopped {
+		failure = fmt.Errorf("took %v, longer than %v", elapsed.Round(time.Millisecond), m.timeout)
+	}
+	failure = fmt.Errorf("plugin %s failed in %s: %v", name, operation, failure)
+	if m.onFailure != nil {
+		m.onFailure(Failure{
+			Plugin:    name,
+			Operation: operation,
+			Err:       failure,
+			Stack:     stack,
+			Time:      time.Now(),
+			Count:     count,
+			Disable:   count >= MaxFailures || stopped,
+			Slow:      panics == 0,
+		})
+	}
+	if panicked {
+		return failure
+	}
+	return err
+}
+
+// run calls fn and returns how long it took. A panic is returned as an
+// error together with its stack trace, except a panic with
+// api.ErrPluginStopped, which is returned as is.
+func (m *Manager) run(fn func() error) (stack string, elapsed time.Duration, err error) {
+	start := time.Now()
+	defer func() {
+		elapsed = time.Since(start)
+		if r := recover(); r != nil {
+			if e, ok := r.(error); ok && errors.Is(e, api.ErrPluginStopped) {
+				err = e
+				return
+			}
+			stack = string(debug.Stack())
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return "", 0, fn()
+}
@@ -0,0 +1,119 @@
+package plugin
+
+import (
+	"github.com/TakahashiShuuhei/edito/internal/api"
+)
+
+// LegacyPlugin is the original in-process plugin contract. Plugins written
+// against it are wrapped so that they load through the api.Plugin interface.
+type LegacyPlugin interface {
+	Name() string
+	Version() string
+	Init(api *API) error
+	Execute(command string, args []string) error
+}
+
+// API is the function table handed to LegacyPlugin.Init.
+type API struct {
+	RegisterCommand    func(name string, handler func(args []string) error)
+	RegisterKeyBinding func(key string, handler func())
+	GetCurrentLine     func() string
+	SetCurrentLine     func(line string)
+	GetCursorPosition  func() (int, int)
+	SetCursorPosition  func(x, y int)
+	InsertText         func(text string)
+	DeleteText         func(start, end int)
+	ShowMessage        func(message string)
+	AddModeLineSegment func(name string, render func() string)
+}
+
+type legacyAdapter struct {
+	legacy LegacyPlugin
+}
+
+func (a *legacyAdapter) Name() string {
+	return a.legacy.Name()
+}
+
+func (a *legacyAdapter) Version() string {
+	return a.legacy.Version()
+}
+
+func (a *legacyAdapter) Init(editorAPI *api.EditorAPI) error {
+	return a.legacy.Init(newLegacyAPI(editorAPI))
+}
+
+func (a *legacyAdapter) Cleanup() error {
+	return nil
+}
+
+// newLegacyAPI implements the legacy function table on top of EditorAPI.
+// Line operations act on the current line of the current buffer.
+func newLegacyAPI(e *api.EditorAPI) *API {
+	currentLine := func(buf api.Buffer) (int, []string, bool) {
+		if buf == nil {
+			return 0, nil, false
+		}
+		_, y := buf.GetCursorPosition()
+		lines := buf.GetLines()
+		return y, lines, y >= 0 && y < len(lines)
+	}
+
+	return &API{
+		RegisterCommand: func(name string, handler func(args []string) error) {
+			e.RegisterCommand(name, "", handler)
+		},
+		RegisterKeyBinding: e.BindKeyFunc,
+		GetCurrentLine: func() string {
+			y, lines, ok := currentLine(e.GetCurrentBuffer())
+			if !ok {
+				return ""
+			}
+			return lines[y]
+		},
+		SetCurrentLine: func(line string) {
+			buf := e.GetCurrentBuffer()
+			if y, lines, ok := currentLine(buf); ok {
+				lines[y] = line
+				buf.SetLines(lines)
+			}
+		},
+		GetCursorPosition: func() (int, int) {
+			if buf := e.GetCurrentBuffer(); buf != nil {
+				return buf.GetCursorPosition()
+			}
+			return 0, 0
+		},
+		SetCursorPosition: func(x, y int) {
+			if buf := e.GetCurrentBuffer(); buf != nil {
+				buf.SetCursorPosition(x, y)
+			}
+		},
+		InsertText: func(text string) {
+			if buf := e.GetCurrentBuffer(); buf != nil {
+				buf.InsertText(text)
+			}
+		},
+		DeleteText: func(start, end int) {
+			buf := e.GetCurrentBuffer()
+			y, lines, ok := currentLine(buf)
+			if !ok {
+				return
+			}
+			line := lines[y]
+			if start < 0 {
+				start = 0
+			}
+			if end > len(line) {
+				end = len(line)
+			}
+			if start >= end {
+				return
+			}
+			lines[y] = line[:start] + line[end:]
+			buf.SetLines(lines)
+		},
+		ShowMessage:        e.ShowMessage,
+		AddModeLineSegment: e.AddModeLineSegment,
+	}
+}
@@ -0,0 +1,156 @@
+package plugin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/TakahashiShuuhei/edito/internal/api"
+)
+
+// Candidate is a plugin that has been opened but not initialized yet.
+type Candidate struct {
+	Plugin api.Plugin
+	Path   string
+}
+
+// ReadManifest reads a plugin manifest from a JSON file.
+func ReadManifest(path string) (*api.Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var m api.Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid manifest %s: %v", path, err)
+	}
+	if m.Name == "" {
+		return nil, fmt.Errorf("invalid manifest %s: name is required", path)
+	}
+	return &m, nil
+}
+
+// ManifestOf returns the manifest of p. Plugins without one get a manifest
+// built from Name, Version and APIVersion.
+func ManifestOf(p api.Plugin) api.Manifest {
+	if d, ok := p.(api.Described); ok {
+		return d.Manifest()
+	}
+	m := api.Manifest{Name: p.Name(), Version: p.Version()}
+	if v, ok := p.(api.Versioned); ok {
+		m.APIVersion = v.APIVersion()
+	}
+	return m
+}
+
+// described attaches a manifest to a plugin that does not carry one.
+type described struct {
+	api.Plugin
+	manifest api.Manifest
+}
+
+func (d *described) Manifest() api.Manifest {
+	return d.manifest
+}
+
+// Manifest returns the manifest of the plugin called name, which is
+// loaded or being initialized.
+func (m *Manager) Manifest(name string) (api.Manifest, bool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	manifest, ok := m.manifests[name]
+	return manifest, ok
+}
+
+// checkDependencies reports the first dependency of manifest that is not
+// loaded.
+func (m *Manager) checkDependencies(manifest api.Manifest) error {
+	for _, dep := range manifest.Dependencies {
+		if !m.IsLoaded(dep) {
+			return fmt.Errorf("requires plugin %s, which is not loaded", dep)
+		}
+	}
+	return nil
+}
+
+type cycleError struct {
+	path []string
+}
+
+func (e *cycleError) Error() string {
+	return "dependency cycle: " + strings.Join(e.path, " -> ")
+}
+
+// LoadAll initializes candidates so that every plugin comes after the
+// plugins it depends on. A plugin is skipped, with an error, if a
+// dependency is neither loaded nor among the candidates, if a dependency
+// could not be loaded, if it is part of a dependency cycle, or if it needs
+// a newer plugin API. The others are loaded regardless.
+func (m *Manager) LoadAll(candidates []Candidate) []error {
+	byName := make(map[string]Candidate)
+	var names []string
+	var errs []error
+	for _, c := range candidates {
+		name := c.Plugin.Name()
+		if _, dup := byName[name]; dup {
+			errs = append(errs, fmt.Errorf("plugin %s: found twice, ignoring %s", name, c.Path))
+			continue
+		}
+		byName[name] = c
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	results := make(map[string]error)
+	visiting := make(map[string]bool)
+
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		if err, done := results[name]; done {
+			return err
+		}
+		if m.IsLoaded(name) {
+			return nil
+		}
+		if visiting[name] {
+			return &cycleError{path: append(append([]string(nil), path...), name)}
+		}
+		visiting[name] = true
+		defer delete(visiting, name)
+
+		c := byName[name]
+		var err error
+		for _, dep := range ManifestOf(c.Plugin).Dependencies {
+			if _, ok := byName[dep]; !ok && !m.IsLoaded(dep) {
+				err = fmt.Errorf("plugin %s requires plugin %s, which is not installed or is disabled", name, dep)
+				break
+			}
+			if depErr := visit(dep, append(path, name)); depErr != nil {
+				var cycle *cycleError
+				if errors.As(depErr, &cycle) {
+					err = fmt.Errorf("plugin %s: %w", name, cycle)
+				} else {
+					err = fmt.Errorf("plugin %s requires plugin %s, which failed to load", name, dep)
+				}
+				break
+			}
+		}
+		if err == nil {
+			err = m.Add(c.Plugin, c.Path)
+		}
+		results[name] = err
+		return err
+	}
+
+	for _, name := range names {
+		if err := visit(name, nil); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
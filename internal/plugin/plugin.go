@@ -3,97 +3,238 @@ package plugin
 import (
 	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 	"plugin"
+	"sort"
+	"strings"
 	"sync"
-)
+	"time"
 
-type Plugin interface {
-	Name() string
-	Version() string
-	Init(api *API) error
-	Execute(command string, args []string) error
-}
+	"github.com/TakahashiShuuhei/edito/internal/api"
+	"github.com/TakahashiShuuhei/edito/internal/buildstamp"
+)
 
-type API struct {
-	RegisterCommand func(name string, handler func(args []string) error)
-	RegisterKeyBinding func(key string, handler func())
-	GetCurrentLine func() string
-	SetCurrentLine func(line string)
-	GetCursorPosition func() (int, int)
-	SetCursorPosition func(x, y int)
-	InsertText func(text string)
-	DeleteText func(start, end int)
-	ShowMessage func(message string)
-}
+// APIFactory creates the API handed to the plugin called owner. Every
+// plugin gets its own instance so that its registrations can be tracked.
+type APIFactory func(owner string) *api.EditorAPI
 
 type Manager struct {
-	plugins map[string]Plugin
-	loaded  map[string]*plugin.Plugin
-	api     *API
-	mutex   sync.RWMutex
+	plugins    map[string]api.Plugin
+	paths      map[string]string
+	manifests  map[string]api.Manifest
+	apiFactory APIFactory
+	onUnload   func(name string)
+	onFailure  func(f Failure)
+	failures   map[string]int
+	panics     map[string]int
+	timeout    time.Duration
+	mutex      sync.RWMutex
 }
 
 func NewManager() *Manager {
 	return &Manager{
-		plugins: make(map[string]Plugin),
-		loaded:  make(map[string]*plugin.Plugin),
-		api:     &API{},
+		plugins:   make(map[string]api.Plugin),
+		paths:     make(map[string]string),
+		manifests: make(map[string]api.Manifest),
+		failures:  make(map[string]int),
+		panics:    make(map[string]int),
+		timeout:   DefaultCallTimeout,
+		apiFactory: func(owner string) *api.EditorAPI {
+			return api.New(api.Backend{})
+		},
 	}
 }
 
-func (m *Manager) SetAPI(api *API) {
-	m.api = api
+func (m *Manager) SetAPIFactory(factory APIFactory) {
+	m.apiFactory = factory
+}
+
+// SetUnloadHook sets a function that is called with the plugin name after
+// a plugin is unloaded, to remove what it registered.
+func (m *Manager) SetUnloadHook(hook func(name string)) {
+	m.onUnload = hook
 }
 
 func (m *Manager) LoadPlugin(path string) error {
-	m.mutex.Lock()
-	defer m.mutex.Unlock()
+	c, err := m.Open(path)
+	if err != nil {
+		return err
+	}
+	return m.Add(c.Plugin, c.Path)
+}
+
+// Open opens the .so file at path without initializing the plugin. Its
+// manifest is the exported Manifest variable or name.json next to the
+// file; without either it is built from the plugin itself.
+func (m *Manager) Open(path string) (Candidate, error) {
+	// plugin.Open of a mismatched build fails with an obscure error, so
+	// the build is checked first.
+	if err := buildstamp.Check(path); err != nil {
+		return Candidate{}, fmt.Errorf("plugin %s: %w", path, err)
+	}
 
 	p, err := plugin.Open(path)
 	if err != nil {
-		return fmt.Errorf("failed to open plugin %s: %v", path, err)
+		return Candidate{}, fmt.Errorf("failed to open plugin %s: %v", path, err)
 	}
 
 	symPlugin, err := p.Lookup("Plugin")
 	if err != nil {
-		return fmt.Errorf("plugin %s does not export 'Plugin' symbol: %v", path, err)
+		return Candidate{}, fmt.Errorf("plugin %s does not export 'Plugin' symbol: %v", path, err)
 	}
 
-	pluginInstance, ok := symPlugin.(Plugin)
-	if !ok {
-		return fmt.Errorf("plugin %s does not implement Plugin interface", path)
+	pluginInstance, err := asPlugin(symPlugin)
+	if err != nil {
+		return Candidate{}, fmt.Errorf("plugin %s: %v", path, err)
 	}
 
-	name := pluginInstance.Name()
-	if _, exists := m.plugins[name]; exists {
+	var manifest *api.Manifest
+	if sym, err := p.Lookup("Manifest"); err == nil {
+		if mf, ok := sym.(*api.Manifest); ok {
+			manifest = mf
+		}
+	}
+	if manifest == nil {
+		if mf, err := ReadManifest(strings.TrimSuffix(path, filepath.Ext(path)) + ".json"); err == nil {
+			manifest = mf
+		} else if !os.IsNotExist(err) {
+			return Candidate{}, err
+		}
+	}
+	if manifest != nil {
+		mf := *manifest
+		if mf.APIVersion == 0 {
+			mf.APIVersion = ManifestOf(pluginInstance).APIVersion
+		}
+		pluginInstance = &described{Plugin: pluginInstance, manifest: mf}
+	}
+
+	return Candidate{Plugin: pluginInstance, Path: path}, nil
+}
+
+// Add initializes an opened plugin, or one that does not come from a .so
+// file such as a process plugin, and manages it. path is where it came
+// from. The plugin's dependencies must already be loaded.
+//
+// The lock is not held while Init runs, so that the plugin may use the
+// editor, including commands that list plugins, during initialization.
+func (m *Manager) Add(p api.Plugin, path string) error {
+	name := p.Name()
+	if m.IsLoaded(name) {
 		return fmt.Errorf("plugin %s is already loaded", name)
 	}
 
-	if err := pluginInstance.Init(m.api); err != nil {
+	if err := checkAPIVersion(p); err != nil {
+		return fmt.Errorf("plugin %s: %v", name, err)
+	}
+	if err := m.checkDependencies(ManifestOf(p)); err != nil {
+		return fmt.Errorf("plugin %s: %v", name, err)
+	}
+
+	// The manifest is known during Init, so that the editor can check
+	// the plugin's capabilities while it initializes.
+	m.mutex.Lock()
+	delete(m.failures, name)
+	delete(m.panics, name)
+	m.manifests[name] = ManifestOf(p)
+	m.mutex.Unlock()
+
+	editor := m.apiFactory(name)
+	if err := m.Call(name, "Init", func() error { return p.Init(editor) }); err != nil {
+		m.mutex.Lock()
+		delete(m.manifests, name)
+		m.mutex.Unlock()
+		if m.onUnload != nil {
+			m.onUnload(name)
+		}
 		return fmt.Errorf("failed to initialize plugin %s: %v", name, err)
 	}
 
-	m.plugins[name] = pluginInstance
-	m.loaded[name] = p
+	m.mutex.Lock()
+	m.plugins[name] = p
+	m.paths[name] = path
+	m.mutex.Unlock()
 
 	return nil
 }
 
+// asPlugin accepts the exported Plugin symbol in any of the supported
+// shapes and returns it as an api.Plugin.
+func asPlugin(sym any) (api.Plugin, error) {
+	switch p := sym.(type) {
+	case api.Plugin:
+		return p, nil
+	case LegacyPlugin:
+		return &legacyAdapter{legacy: p}, nil
+	}
+	return nil, fmt.Errorf("exported Plugin does not implement the plugin interface")
+}
+
+func checkAPIVersion(p api.Plugin) error {
+	version := ManifestOf(p).RequiredAPIVersion()
+	if version > api.APIVersion {
+		return fmt.Errorf("requires plugin API version %d, but this edito provides version %d; upgrade edito", version, api.APIVersion)
+	}
+	return nil
+}
+
+// UnloadPlugin calls the plugin's Cleanup and removes everything it
+// registered. The plugin code itself stays in memory, because Go plugins
+// cannot be unloaded; it is simply no longer reachable.
 func (m *Manager) UnloadPlugin(name string) error {
 	m.mutex.Lock()
-	defer m.mutex.Unlock()
-
-	if _, exists := m.plugins[name]; !exists {
+	p, exists := m.plugins[name]
+	if !exists {
+		m.mutex.Unlock()
 		return fmt.Errorf("plugin %s is not loaded", name)
 	}
 
 	delete(m.plugins, name)
-	delete(m.loaded, name)
+	delete(m.paths, name)
+	delete(m.manifests, name)
+	m.mutex.Unlock()
+
+	_, _, err := m.run(p.Cleanup)
+
+	if m.onUnload != nil {
+		m.onUnload(name)
+	}
 
+	if err != nil {
+		return fmt.Errorf("plugin %s cleanup failed: %v", name, err)
+	}
 	return nil
 }
 
-func (m *Manager) GetPlugin(name string) (Plugin, error) {
+// ReloadPlugin unloads the plugin called name, if it is loaded, and loads
+// the plugin at path in its place.
+func (m *Manager) ReloadPlugin(name, path string) error {
+	if m.IsLoaded(name) {
+		if err := m.UnloadPlugin(name); err != nil {
+			return err
+		}
+	}
+	return m.LoadPlugin(path)
+}
+
+func (m *Manager) IsLoaded(name string) bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	_, exists := m.plugins[name]
+	return exists
+}
+
+// PluginPath returns the file the plugin called name was loaded from.
+func (m *Manager) PluginPath(name string) string {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return m.paths[name]
+}
+
+func (m *Manager) GetPlugin(name string) (api.Plugin, error) {
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
 
@@ -112,15 +253,7 @@ func (m *Manager) ListPlugins() []string {
 	for name := range m.plugins {
 		names = append(names, name)
 	}
+	sort.Strings(names)
 
 	return names
 }
-
-func (m *Manager) ExecuteCommand(name string, command string, args []string) error {
-	plugin, err := m.GetPlugin(name)
-	if err != nil {
-		return err
-	}
-
-	return plugin.Execute(command, args)
-}
\ No newline at end of file
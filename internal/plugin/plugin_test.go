@@ -0,0 +1,521 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/TakahashiShuuhei/edito/internal/api"
+	"github.com/TakahashiShuuhei/edito/internal/pkgstate"
+)
+
+type fakePlugin struct {
+	cleaned bool
+	panics  bool
+}
+
+func (p *fakePlugin) Name() string              { return "fake" }
+func (p *fakePlugin) Version() string           { return "1.0.0" }
+func (p *fakePlugin) Init(*api.EditorAPI) error { return nil }
+func (p *fakePlugin) Cleanup() error {
+	if p.panics {
+		panic("boom")
+	}
+	p.cleaned = true
+	return nil
+}
+
+func TestUnloadPluginRunsCleanup(t *testing.T) {
+	m := NewManager()
+	removed := ""
+	m.SetUnloadHook(func(name string) { removed = name })
+
+	p := &fakePlugin{}
+	m.plugins["fake"] = p
+	if err := m.UnloadPlugin("fake"); err != nil {
+		t.Fatalf("UnloadPlugin failed: %v", err)
+	}
+	if !p.cleaned {
+		t.Error("Cleanup was not called")
+	}
+	if removed != "fake" {
+		t.Errorf("unload hook got %q, want fake", removed)
+	}
+	if m.IsLoaded("fake") {
+		t.Error("plugin still loaded")
+	}
+	if err := m.UnloadPlugin("fake"); err == nil {
+		t.Error("unloading twice succeeded")
+	}
+}
+
+func TestUnloadPluginRecoversCleanupPanic(t *testing.T) {
+	m := NewManager()
+	removed := false
+	m.SetUnloadHook(func(name string) { removed = true })
+
+	m.plugins["fake"] = &fakePlugin{panics: true}
+	if err := m.UnloadPlugin("fake"); err == nil {
+		t.Error("panicking Cleanup was not reported")
+	}
+	if !removed || m.IsLoaded("fake") {
+		t.Error("plugin was not removed after a failed Cleanup")
+	}
+}
+
+func TestStatePersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plugin-state.json")
+	s := NewState(path)
+	s.SetDisabled("b", true)
+	s.SetDisabled("a", true)
+	s.SetDisabled("b", false)
+	if err := s.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	loaded := NewState(path)
+	if err := loaded.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if got := loaded.Disabled(); !reflect.DeepEqual(got, []string{"a"}) {
+		t.Errorf("Disabled() = %v, want [a]", got)
+	}
+}
+
+func TestCallRecoversPanics(t *testing.T) {
+	m := NewManager()
+	var failures []Failure
+	m.SetFailureHandler(func(f Failure) { failures = append(failures, f) })
+
+	if err := m.Call("fake", "command", func() error { return errors.New("plain") }); err == nil || err.Error() != "plain" {
+		t.Errorf("returned error = %v, want plain", err)
+	}
+	if len(failures) != 0 {
+		t.Errorf("returned error was reported as a failure: %v", failures)
+	}
+
+	for i := 0; i < MaxFailures; i++ {
+		err := m.Call("fake", "command", func() error {
+			var p *fakePlugin
+			return p.Cleanup()
+		})
+		if err == nil {
+			t.Fatal("panic was not returned as an error")
+		}
+	}
+	if len(failures) != MaxFailures {
+		t.Fatalf("got %d failures, want %d", len(failures), MaxFailures)
+	}
+	if failures[0].Stack == "" || failures[0].Disable {
+		t.Errorf("first failure = %+v, want a stack and no Disable", failures[0])
+	}
+	if !failures[MaxFailures-1].Disable {
+		t.Error("plugin was not disabled after MaxFailures panics")
+	}
+}
+
+func TestSlowCallIsCountedAsAFailure(t *testing.T) {
+	m := NewManager()
+	m.SetCallTimeout(10 * time.Millisecond)
+	var failures []Failure
+	m.SetFailureHandler(func(f Failure) { failures = append(failures, f) })
+
+	// The call is waited for, so that it cannot change editor state
+	// after Call returns, and what it returned is kept.
+	finished := false
+	err := m.Call("fake", "command", func() error {
+		time.Sleep(20 * time.Millisecond)
+		finished = true
+		return nil
+	})
+	if err != nil || !finished {
+		t.Fatalf("Call = %v, finished = %v, want nil after the call finished", err, finished)
+	}
+	if len(failures) != 1 || failures[0].Disable {
+		t.Fatalf("failures = %+v, want one that does not disable the plugin", failures)
+	}
+
+	for i := 1; i < MaxFailures; i++ {
+		m.Call("fake", "command", func() error {
+			time.Sleep(20 * time.Millisecond)
+			return nil
+		})
+	}
+	if last := failures[len(failures)-1]; !last.Disable || !last.Slow || last.Count != MaxFailures {
+		t.Errorf("last failure = %+v, want Disable and Slow after %d slow calls", last, MaxFailures)
+	}
+
+	m.Call("other", "command", func() error {
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	})
+	m.Call("other", "command", func() error { panic("boom") })
+	m.Call("other", "command", func() error {
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	})
+	if last := failures[len(failures)-1]; !last.Disable || last.Slow {
+		t.Errorf("last failure = %+v, want Disable without Slow once a call panicked", last)
+	}
+}
+
+func TestStoppedPluginIsUnloaded(t *testing.T) {
+	m := NewManager()
+	var failures []Failure
+	m.SetFailureHandler(func(f Failure) { failures = append(failures, f) })
+
+	stopped := fmt.Errorf("spin exceeded the CPU time limit: %w", api.ErrPluginStopped)
+	if err := m.Call("wasm", "command spin", func() error { return stopped }); !errors.Is(err, api.ErrPluginStopped) {
+		t.Errorf("returned error = %v, want the stop", err)
+	}
+	// Hooks cannot return errors, so they panic with the stop.
+	if err := m.Call("wasm", "hook", func() error { panic(stopped) }); !errors.Is(err, api.ErrPluginStopped) {
+		t.Errorf("returned error = %v, want the stop", err)
+	}
+	for _, f := range failures {
+		if !f.Disable || !f.Slow || f.Stack != "" {
+			t.Errorf("failure = %+v, want Disable and Slow without a stack", f)
+		}
+	}
+	if len(failures) != 2 {
+		t.Errorf("got %d failures, want 2", len(failures))
+	}
+}
+
+type manifestPlugin struct {
+	manifest api.Manifest
+	inited   *[]string
+}
+
+func (p *manifestPlugin) Name() string           { return p.manifest.Name }
+func (p *manifestPlugin) Version() string        { return p.manifest.Version }
+func (p *manifestPlugin) Cleanup() error         { return nil }
+func (p *manifestPlugin) Manifest() api.Manifest { return p.manifest }
+func (p *manifestPlugin) Init(*api.EditorAPI) error {
+	*p.inited = append(*p.inited, p.manifest.Name)
+	return nil
+}
+
+func TestLoadAllResolvesDependencies(t *testing.T) {
+	var inited []string
+	candidate := func(name string, apiVersion int, deps ...string) Candidate {
+		return Candidate{Plugin: &manifestPlugin{
+			manifest: api.Manifest{Name: name, APIVersion: apiVersion, Dependencies: deps},
+			inited:   &inited,
+		}}
+	}
+
+	m := NewManager()
+	errs := m.LoadAll([]Candidate{
+		candidate("c", 0, "b"),
+		candidate("b", 0, "a"),
+		candidate("a", 0),
+		candidate("orphan", 0, "missing"),
+		candidate("needs-orphan", 0, "orphan"),
+		candidate("p", 0, "q"),
+		candidate("q", 0, "p"),
+		candidate("future", api.APIVersion+1),
+	})
+
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(inited, want) {
+		t.Errorf("init order = %v, want %v", inited, want)
+	}
+
+	var messages []string
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	all := strings.Join(messages, "\n")
+	for _, want := range []string{
+		"plugin orphan requires plugin missing, which is not installed",
+		"plugin needs-orphan requires plugin orphan, which failed to load",
+		"plugin p: dependency cycle: p -> q -> p",
+		"plugin q: dependency cycle: p -> q -> p",
+		"upgrade edito",
+	} {
+		if !strings.Contains(all, want) {
+			t.Errorf("errors do not mention %q:\n%s", want, all)
+		}
+	}
+	if len(errs) != 5 {
+		t.Errorf("got %d errors, want 5:\n%s", len(errs), all)
+	}
+}
+
+func TestAutoInstallerFollowsConstraintsAndLockfile(t *testing.T) {
+	dir := t.TempDir()
+	published := []string{"v0.1.0", "v0.2.0", "v0.2.1"}
+	var built []string
+
+	newInstaller := func() *AutoInstaller {
+		ai := NewAutoInstaller(dir, t.TempDir())
+		ai.SetOutput(io.Discard)
+		ai.listVersions = func(context.Context, string) ([]string, error) { return published, nil }
+		ai.build = func(ctx context.Context, spec PluginSpec) error {
+			built = append(built, spec.Version)
+			return os.WriteFile(filepath.Join(dir, spec.Name+".so"), []byte(spec.Version), 0644)
+		}
+		installed, _ := pkgstate.Open(filepath.Join(dir, "installed.json"))
+		lock, _ := pkgstate.Open(filepath.Join(dir, "plugins.lock"))
+		ai.SetState(installed, lock)
+		return ai
+	}
+
+	spec := PluginSpec{Name: "tree", Repository: "example.com/tree", Version: "v0.1.0"}
+	ai := newInstaller()
+	if err := ai.InstallPlugin(spec); err != nil {
+		t.Fatalf("InstallPlugin failed: %v", err)
+	}
+	// Changing the requested version upgrades the installed plugin.
+	spec.Version = "^0.2.0"
+	if err := ai.InstallPlugin(spec); err != nil {
+		t.Fatalf("InstallPlugin failed: %v", err)
+	}
+	if err := ai.InstallPlugin(spec); err != nil {
+		t.Fatalf("InstallPlugin failed: %v", err)
+	}
+	if !reflect.DeepEqual(built, []string{"v0.1.0", "v0.2.1"}) {
+		t.Fatalf("built %v, want v0.1.0 then v0.2.1 once", built)
+	}
+
+	// Another machine with the lockfile gets the locked version even
+	// though a newer one is published.
+	published = append(published, "v0.2.2", "v0.3.0")
+	os.Remove(filepath.Join(dir, "installed.json"))
+	os.Remove(filepath.Join(dir, "tree.so"))
+	ai = newInstaller()
+	if version, err := ai.Resolve(spec); err != nil || version != "v0.2.1" {
+		t.Errorf("Resolve = %q, %v, want the locked v0.2.1", version, err)
+	}
+
+	if err := ai.InstallPlugin(spec); err != nil {
+		t.Fatalf("InstallPlugin failed: %v", err)
+	}
+	updates, err := ai.Outdated([]PluginSpec{spec})
+	if err != nil {
+		t.Fatalf("Outdated failed: %v", err)
+	}
+	want := []Update{{Name: "tree", Installed: "v0.2.1", Wanted: "v0.2.2", Latest: "v0.3.0"}}
+	if !reflect.DeepEqual(updates, want) {
+		t.Errorf("Outdated = %+v, want %+v", updates, want)
+	}
+
+	if version, err := ai.Upgrade(spec); err != nil || version != "v0.2.2" {
+		t.Errorf("Upgrade = %q, %v, want v0.2.2", version, err)
+	}
+	lock, _ := pkgstate.Open(filepath.Join(dir, "plugins.lock"))
+	if locked, _ := lock.Get("tree"); locked.Version != "v0.2.2" || locked.Constraint != "^0.2.0" || locked.InstalledAt != "" {
+		t.Errorf("lockfile entry = %+v, want v0.2.2 for ^0.2.0", locked)
+	}
+}
+
+func TestInstallAllBuildsInParallelAndCancels(t *testing.T) {
+	dir := t.TempDir()
+	ai := NewAutoInstaller(dir, t.TempDir())
+	ai.SetOutput(io.Discard)
+	ai.SetParallelism(2)
+	ai.listVersions = func(context.Context, string) ([]string, error) { return []string{"v1.0.0"}, nil }
+
+	var (
+		mutex            sync.Mutex
+		running, maxSeen int
+	)
+	release := make(chan struct{})
+	ai.build = func(ctx context.Context, spec PluginSpec) error {
+		mutex.Lock()
+		running++
+		maxSeen = max(maxSeen, running)
+		mutex.Unlock()
+		defer func() {
+			mutex.Lock()
+			running--
+			mutex.Unlock()
+		}()
+		select {
+		case <-release:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		return os.WriteFile(filepath.Join(dir, spec.Name+".so"), nil, 0644)
+	}
+
+	var specs []PluginSpec
+	for _, name := range []string{"a", "b", "c", "d"} {
+		specs = append(specs, PluginSpec{Name: name, Repository: "example.com/" + name, Version: "v1.0.0"})
+	}
+	states := make(map[string]string)
+	record := func(p Progress) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if p.State != InstallBuilding {
+			states[p.Name] = p.State
+		}
+	}
+
+	close(release)
+	if err := ai.InstallAll(context.Background(), specs, record); err != nil {
+		t.Fatalf("InstallAll failed: %v", err)
+	}
+	if maxSeen > 2 {
+		t.Errorf("%d builds ran at once, want at most 2", maxSeen)
+	}
+	for _, spec := range specs {
+		if states[spec.Name] != InstallInstalled {
+			t.Errorf("%s ended %q, want installed", spec.Name, states[spec.Name])
+		}
+	}
+
+	// Builds in progress stop when the context is cancelled, and the
+	// plugins waiting for a slot are skipped.
+	release = make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	for i := range specs {
+		specs[i].Name += "2"
+	}
+	done := make(chan error)
+	go func() { done <- ai.InstallAll(ctx, specs, record) }()
+	for {
+		mutex.Lock()
+		n := running
+		mutex.Unlock()
+		if n == 2 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("InstallAll = %v, want context.Canceled", err)
+	}
+	for _, spec := range specs {
+		if states[spec.Name] != InstallCancelled {
+			t.Errorf("%s ended %q, want cancelled", spec.Name, states[spec.Name])
+		}
+		if _, ok := ai.Installed(spec.Name); ok {
+			t.Errorf("cancelled %s was recorded as installed", spec.Name)
+		}
+	}
+}
+
+// TestInstallAllSharesInstalledState marks and installs a package in the
+// installed DB, as list-packages does on the editor goroutine, while
+// InstallAll records the plugins it builds in the same DB. Run with -race.
+func TestInstallAllSharesInstalledState(t *testing.T) {
+	dir := t.TempDir()
+	installed := pkgstate.New(filepath.Join(dir, "installed.json"))
+	ai := NewAutoInstaller(dir, t.TempDir())
+	ai.SetOutput(io.Discard)
+	ai.SetState(installed, pkgstate.New(filepath.Join(dir, "plugins.lock")))
+	ai.listVersions = func(context.Context, string) ([]string, error) { return []string{"v1.0.0"}, nil }
+	ai.build = func(ctx context.Context, spec PluginSpec) error {
+		time.Sleep(time.Millisecond)
+		return os.WriteFile(filepath.Join(dir, spec.Name+".so"), nil, 0644)
+	}
+
+	var specs []PluginSpec
+	for i := range 8 {
+		name := string(rune('a' + i))
+		specs = append(specs, PluginSpec{Name: name, Repository: "example.com/" + name, Version: "v1.0.0"})
+	}
+	done := make(chan error)
+	go func() { done <- ai.InstallAll(context.Background(), specs, nil) }()
+
+	for i := 0; ; i++ {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("InstallAll failed: %v", err)
+			}
+			if _, ok := installed.Get("tree"); !ok {
+				t.Error("the package installed meanwhile was lost")
+			}
+			if got := len(installed.List()); got != len(specs)+1 {
+				t.Errorf("%d plugins recorded, want %d", got, len(specs)+1)
+			}
+			return
+		default:
+		}
+		installed.Get("tree")
+		installed.Set(pkgstate.Plugin{Name: "tree", Version: fmt.Sprintf("1.0.%d", i), Source: "https://packages.edito.dev"})
+		if err := installed.Save(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestAutoInstallerLocalDirectoriesAndRefs(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "src", "tree")
+	os.MkdirAll(source, 0755)
+	os.WriteFile(filepath.Join(source, "go.mod"), []byte("module example.com/tree\n"), 0644)
+	os.WriteFile(filepath.Join(source, "tree.go"), []byte("package tree\n"), 0644)
+
+	commit := "v0.0.0-20240101000000-aaaaaaaaaaaa"
+	var queries, built []string
+	newInstaller := func() *AutoInstaller {
+		ai := NewAutoInstaller(dir, t.TempDir())
+		ai.SetOutput(io.Discard)
+		ai.query = func(ctx context.Context, module, ref string) (string, error) {
+			queries = append(queries, module+"@"+ref)
+			return commit, nil
+		}
+		ai.build = func(ctx context.Context, spec PluginSpec) error {
+			built = append(built, spec.Version)
+			return os.WriteFile(filepath.Join(dir, spec.Name+".so"), nil, 0644)
+		}
+		installed, _ := pkgstate.Open(filepath.Join(dir, "installed.json"))
+		lock, _ := pkgstate.Open(filepath.Join(dir, "plugins.lock"))
+		ai.SetState(installed, lock)
+		return ai
+	}
+
+	spec := PluginSpec{Name: "tree", Repository: "./src/tree"}.WithBaseDir(dir)
+	if !spec.IsLocal() || spec.Repository != source {
+		t.Fatalf("WithBaseDir = %+v, want the local directory %s", spec, source)
+	}
+	ai := newInstaller()
+	if err := ai.InstallPlugin(spec); err != nil {
+		t.Fatalf("InstallPlugin failed: %v", err)
+	}
+	if err := ai.InstallPlugin(spec); err != nil {
+		t.Fatalf("InstallPlugin failed: %v", err)
+	}
+	// Changing the source rebuilds the plugin.
+	os.WriteFile(filepath.Join(source, "tree.go"), []byte("package tree\n\nvar X = 1\n"), 0644)
+	if err := ai.InstallPlugin(spec); err != nil {
+		t.Fatalf("InstallPlugin failed: %v", err)
+	}
+	if len(built) != 2 || !strings.HasPrefix(built[0], "local-") || built[0] == built[1] {
+		t.Errorf("built %v, want two different local versions", built)
+	}
+
+	// A branch resolves to the pseudo-version of its commit, which is
+	// locked until the plugin is upgraded.
+	built = nil
+	branch := PluginSpec{Name: "tree", Repository: "example.com/tree", Version: "main"}
+	if err := ai.InstallPlugin(branch); err != nil {
+		t.Fatalf("InstallPlugin failed: %v", err)
+	}
+	if err := newInstaller().InstallPlugin(branch); err != nil {
+		t.Fatalf("InstallPlugin failed: %v", err)
+	}
+	if !reflect.DeepEqual(built, []string{commit}) || len(queries) != 1 {
+		t.Errorf("built %v after queries %v, want %s built once", built, queries, commit)
+	}
+	commit = "v0.0.0-20240201000000-bbbbbbbbbbbb"
+	if version, err := newInstaller().Upgrade(branch); err != nil || version != commit {
+		t.Errorf("Upgrade = %q, %v, want %s", version, err, commit)
+	}
+
+	if !isRef("0123abc") || !isRef("main") || isRef("^1.2.0") || isRef("latest") {
+		t.Error("isRef does not tell commits and branches from constraints")
+	}
+}
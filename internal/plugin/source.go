@@ -0,0 +1,115 @@
+package plugin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/TakahashiShuuhei/edito/internal/semver"
+)
+
+// DevelopVersion is the version of a local plugin that is built from its
+// directory like reload-plugin and rebuilt whenever its source changes.
+const DevelopVersion = "develop"
+
+// commitPattern matches an abbreviated or full git commit hash.
+var commitPattern = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
+
+// IsLocal reports whether the plugin is built from a directory on this
+// machine instead of being downloaded.
+func (s PluginSpec) IsLocal() bool {
+	r := s.Repository
+	return filepath.IsAbs(r) || r == "." || r == "~" ||
+		strings.HasPrefix(r, "./") || strings.HasPrefix(r, "../") || strings.HasPrefix(r, "~/")
+}
+
+// Develop reports whether the plugin is developed in its local directory.
+func (s PluginSpec) Develop() bool {
+	return s.IsLocal() && s.Version == DevelopVersion
+}
+
+// WithBaseDir returns s with its local directory made absolute: ~ is the
+// home directory, and relative paths are relative to dir.
+func (s PluginSpec) WithBaseDir(dir string) PluginSpec {
+	if !s.IsLocal() {
+		return s
+	}
+	path := s.Repository
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, path[1:])
+		}
+	} else if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	s.Repository = filepath.Clean(path)
+	return s
+}
+
+// isRef reports whether version names a git branch or commit rather than
+// a version constraint.
+func isRef(version string) bool {
+	return commitPattern.MatchString(version) || !semver.IsConstraint(version)
+}
+
+// SourceDigest returns a digest of the Go files, go.mod and go.sum under
+// dir, which changes whenever the plugin's source does. Hidden
+// directories and testdata are skipped.
+func SourceDigest(dir string) (string, error) {
+	h := sha256.New()
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := d.Name()
+		if d.IsDir() {
+			if path != dir && (strings.HasPrefix(name, ".") || name == "testdata") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(name) != ".go" && name != "go.mod" && name != "go.sum" {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		fmt.Fprintf(h, "%s\x00%d\x00", filepath.ToSlash(rel), len(data))
+		h.Write(data)
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to read plugin source: %v", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// localVersion is the recorded version of a local plugin.
+func localVersion(dir string) (string, error) {
+	digest, err := SourceDigest(dir)
+	if err != nil {
+		return "", err
+	}
+	return "local-" + digest[:12], nil
+}
+
+// modulePath returns the module path declared in dir/go.mod.
+func modulePath(dir string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		return "", fmt.Errorf("plugin directory %s has no go.mod: %v", dir, err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if rest, ok := strings.CutPrefix(strings.TrimSpace(line), "module"); ok && rest != "" && (rest[0] == ' ' || rest[0] == '\t') {
+			return strings.Trim(strings.TrimSpace(rest), `"`), nil
+		}
+	}
+	return "", fmt.Errorf("%s/go.mod declares no module", dir)
+}
@@ -0,0 +1,84 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// State records which plugins the user has disabled. It is persisted as
+// JSON so that a disabled plugin stays disabled across restarts.
+type State struct {
+	path     string
+	disabled map[string]bool
+}
+
+type stateFile struct {
+	Disabled []string `json:"disabled"`
+}
+
+func NewState(path string) *State {
+	return &State{
+		path:     path,
+		disabled: make(map[string]bool),
+	}
+}
+
+// Load reads the state file. A missing file is not an error.
+func (s *State) Load() error {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read plugin state: %v", err)
+	}
+
+	var file stateFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to decode plugin state: %v", err)
+	}
+	s.disabled = make(map[string]bool)
+	for _, name := range file.Disabled {
+		s.disabled[name] = true
+	}
+	return nil
+}
+
+func (s *State) Save() error {
+	if s.path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create plugin state directory: %v", err)
+	}
+	data, err := json.MarshalIndent(stateFile{Disabled: s.Disabled()}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode plugin state: %v", err)
+	}
+	return os.WriteFile(s.path, data, 0644)
+}
+
+func (s *State) IsDisabled(name string) bool {
+	return s.disabled[name]
+}
+
+func (s *State) SetDisabled(name string, disabled bool) {
+	if disabled {
+		s.disabled[name] = true
+	} else {
+		delete(s.disabled, name)
+	}
+}
+
+// Disabled returns the disabled plugin names in sorted order.
+func (s *State) Disabled() []string {
+	names := make([]string, 0, len(s.disabled))
+	for name := range s.disabled {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
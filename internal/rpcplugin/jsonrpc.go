@@ -0,0 +1,265 @@
+// Package rpcplugin runs plugins as child processes that talk to the
+// editor with JSON-RPC 2.0 over stdin and stdout, one message per line.
+package rpcplugin
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout is how long a call waits for the plugin to answer.
+const DefaultTimeout = 5 * time.Second
+
+// ErrClosed is returned by calls on a connection whose peer has gone away.
+var ErrClosed = errors.New("connection closed")
+
+type message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      *int64          `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// Error is a JSON-RPC error object.
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// JSON-RPC error codes used by the editor.
+const (
+	CodeMethodNotFound = -32601
+	CodeInternalError  = -32603
+)
+
+// Handler answers a request or notification sent by the peer.
+type Handler func(method string, params json.RawMessage) (any, error)
+
+// Conn is one end of a JSON-RPC connection.
+//
+// Requests from the peer are never handled on the reader goroutine. They
+// are queued and handled by whoever calls Serve, or by a goroutine blocked
+// in Call, so that all handlers run on the editor goroutine. notify is
+// called from the reader goroutine whenever a request has been queued.
+type Conn struct {
+	w       io.Writer
+	handler Handler
+	notify  func()
+	Timeout time.Duration
+
+	writeMu  sync.Mutex
+	mu       sync.Mutex
+	nextID   int64
+	pending  map[int64]chan *message
+	incoming chan *message
+	done     chan struct{}
+	err      error
+}
+
+func NewConn(r io.Reader, w io.Writer, handler Handler, notify func()) *Conn {
+	c := &Conn{
+		w:        w,
+		handler:  handler,
+		notify:   notify,
+		Timeout:  DefaultTimeout,
+		pending:  make(map[int64]chan *message),
+		incoming: make(chan *message, 64),
+		done:     make(chan struct{}),
+	}
+	go c.read(r)
+	return c
+}
+
+func (c *Conn) read(r io.Reader) {
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			c.dispatch(line)
+		}
+		if err != nil {
+			c.close(err)
+			return
+		}
+	}
+}
+
+func (c *Conn) dispatch(line []byte) {
+	var msg message
+	if err := json.Unmarshal(line, &msg); err != nil {
+		// Not a message; plugins sometimes print stray output.
+		return
+	}
+
+	if msg.Method == "" {
+		if msg.ID == nil {
+			return
+		}
+		c.mu.Lock()
+		ch := c.pending[*msg.ID]
+		delete(c.pending, *msg.ID)
+		c.mu.Unlock()
+		if ch != nil {
+			ch <- &msg
+		}
+		return
+	}
+
+	select {
+	case c.incoming <- &msg:
+	case <-c.done:
+		return
+	}
+	if c.notify != nil {
+		c.notify()
+	}
+}
+
+func (c *Conn) close(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	select {
+	case <-c.done:
+		return
+	default:
+	}
+	if err == io.EOF {
+		err = ErrClosed
+	}
+	c.err = err
+	close(c.done)
+}
+
+// Done is closed when the peer closes the connection.
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns why the connection was closed.
+func (c *Conn) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Call sends a request and waits for its result, handling the peer's own
+// requests while it waits.
+func (c *Conn) Call(method string, params, result any) error {
+	c.mu.Lock()
+	c.nextID++
+	id := c.nextID
+	ch := make(chan *message, 1)
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	if err := c.send(&message{ID: &id, Method: method}, params); err != nil {
+		return err
+	}
+
+	timeout := time.NewTimer(c.Timeout)
+	defer timeout.Stop()
+	for {
+		select {
+		case resp := <-ch:
+			if resp.Error != nil {
+				return resp.Error
+			}
+			if result != nil && len(resp.Result) > 0 {
+				if err := json.Unmarshal(resp.Result, result); err != nil {
+					return fmt.Errorf("invalid result for %s: %v", method, err)
+				}
+			}
+			return nil
+		case req := <-c.incoming:
+			c.serve(req)
+		case <-timeout.C:
+			return fmt.Errorf("%s timed out after %v", method, c.Timeout)
+		case <-c.done:
+			return c.Err()
+		}
+	}
+}
+
+// Notify sends a notification, which has no response.
+func (c *Conn) Notify(method string, params any) error {
+	return c.send(&message{Method: method}, params)
+}
+
+// Serve handles the queued requests of the peer without blocking.
+func (c *Conn) Serve() {
+	for {
+		select {
+		case req := <-c.incoming:
+			c.serve(req)
+		default:
+			return
+		}
+	}
+}
+
+func (c *Conn) serve(req *message) {
+	result, err := c.handler(req.Method, req.Params)
+	if req.ID == nil {
+		return
+	}
+
+	resp := &message{ID: req.ID}
+	if err != nil {
+		resp.Error = toError(err)
+	} else {
+		data, marshalErr := json.Marshal(result)
+		if marshalErr != nil {
+			resp.Error = &Error{Code: CodeInternalError, Message: marshalErr.Error()}
+		} else {
+			resp.Result = data
+		}
+	}
+	c.send(resp, nil)
+}
+
+func toError(err error) *Error {
+	var rpcErr *Error
+	if errors.As(err, &rpcErr) {
+		return rpcErr
+	}
+	return &Error{Code: CodeInternalError, Message: err.Error()}
+}
+
+func (c *Conn) send(msg *message, params any) error {
+	msg.JSONRPC = "2.0"
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return fmt.Errorf("invalid params for %s: %v", msg.Method, err)
+		}
+		msg.Params = data
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if _, err := c.w.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write to plugin: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,385 @@
+package rpcplugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/TakahashiShuuhei/edito/internal/api"
+)
+
+// ManifestFile is the file that marks a directory as a process plugin.
+const ManifestFile = "plugin.json"
+
+// Supervisor limits: a plugin that crashes more than maxRestarts times
+// within restartWindow is not restarted again.
+const (
+	maxRestarts   = 5
+	restartWindow = time.Minute
+	shutdownGrace = 2 * time.Second
+)
+
+// Manifest describes a process plugin: the common plugin manifest plus
+// the command that starts it.
+type Manifest struct {
+	api.Manifest
+	Command []string `json:"command"`
+}
+
+// LoadManifest reads plugin.json from dir.
+func LoadManifest(dir string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		return nil, err
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", ManifestFile, err)
+	}
+	if m.Name == "" {
+		return nil, fmt.Errorf("invalid %s: name is required", ManifestFile)
+	}
+	if len(m.Command) == 0 {
+		return nil, fmt.Errorf("invalid %s: command is required", ManifestFile)
+	}
+	return &m, nil
+}
+
+// IsPluginDir reports whether dir contains a process plugin.
+func IsPluginDir(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, ManifestFile))
+	return err == nil
+}
+
+// Options connect a process plugin to the editor.
+type Options struct {
+	// Post runs fn on the editor goroutine. It is called from other
+	// goroutines when the plugin sends a request on its own or exits.
+	Post func(fn func())
+	// Reset removes everything the plugin registered before it is
+	// restarted after a crash.
+	Reset func(name string)
+	// LogFile receives the plugin's stderr. Empty discards it.
+	LogFile string
+}
+
+// Plugin runs a plugin as a supervised child process. It implements
+// api.Plugin, so the plugin manager treats it like an in-process plugin.
+type Plugin struct {
+	dir      string
+	manifest *Manifest
+	options  Options
+	api      *api.EditorAPI
+
+	cmd      *exec.Cmd
+	stdin    io.WriteCloser
+	conn     *Conn
+	stopping bool
+	restarts []time.Time
+}
+
+// New prepares the plugin in dir. The process is started by Init.
+func New(dir string, options Options) (*Plugin, error) {
+	manifest, err := LoadManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &Plugin{dir: dir, manifest: manifest, options: options}, nil
+}
+
+func (p *Plugin) Name() string {
+	return p.manifest.Name
+}
+
+func (p *Plugin) Version() string {
+	return p.manifest.Version
+}
+
+func (p *Plugin) APIVersion() int {
+	return p.manifest.RequiredAPIVersion()
+}
+
+func (p *Plugin) Manifest() api.Manifest {
+	return p.manifest.Manifest
+}
+
+func (p *Plugin) Init(editor *api.EditorAPI) error {
+	p.api = editor
+	p.stopping = false
+	return p.start()
+}
+
+func (p *Plugin) Cleanup() error {
+	p.stopping = true
+	if p.conn == nil {
+		return nil
+	}
+
+	p.conn.Timeout = shutdownGrace
+	p.conn.Call(MethodShutdown, nil, nil)
+	// Closing stdin tells the plugin to exit.
+	p.stdin.Close()
+
+	select {
+	case <-p.conn.Done():
+	case <-time.After(shutdownGrace):
+		p.cmd.Process.Kill()
+	}
+	return nil
+}
+
+func (p *Plugin) start() error {
+	command := p.manifest.Command
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Dir = p.dir
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if p.options.LogFile != "" {
+		if err := os.MkdirAll(filepath.Dir(p.options.LogFile), 0755); err == nil {
+			if log, err := os.OpenFile(p.options.LogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644); err == nil {
+				cmd.Stderr = log
+			}
+		}
+	}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start %s: %v", command[0], err)
+	}
+
+	var conn *Conn
+	conn = NewConn(stdout, stdin, p.handle, func() {
+		p.post(func() { conn.Serve() })
+	})
+	p.cmd = cmd
+	p.stdin = stdin
+	p.conn = conn
+	go p.wait(cmd, conn)
+
+	params := InitializeParams{Name: p.manifest.Name, APIVersion: api.APIVersion}
+	if err := conn.Call(MethodInitialize, params, nil); err != nil {
+		p.conn = nil
+		cmd.Process.Kill()
+		return fmt.Errorf("initialize failed: %v", err)
+	}
+	return nil
+}
+
+// wait reaps the process and asks the editor goroutine to restart it if
+// it exited unexpectedly.
+func (p *Plugin) wait(cmd *exec.Cmd, conn *Conn) {
+	err := cmd.Wait()
+	if f, ok := cmd.Stderr.(*os.File); ok {
+		f.Close()
+	}
+	<-conn.Done()
+	p.post(func() {
+		if p.stopping || p.conn != conn {
+			return
+		}
+		p.restart(err)
+	})
+}
+
+func (p *Plugin) restart(exitErr error) {
+	now := time.Now()
+	recent := p.restarts[:0]
+	for _, t := range p.restarts {
+		if now.Sub(t) < restartWindow {
+			recent = append(recent, t)
+		}
+	}
+	p.restarts = append(recent, now)
+
+	if p.options.Reset != nil {
+		p.options.Reset(p.manifest.Name)
+	}
+	if len(p.restarts) > maxRestarts {
+		p.conn = nil
+		p.api.ShowMessage(fmt.Sprintf("Plugin %s keeps crashing (%v); not restarting", p.manifest.Name, exitErr))
+		return
+	}
+	if err := p.start(); err != nil {
+		p.api.ShowMessage(fmt.Sprintf("Plugin %s could not be restarted: %v", p.manifest.Name, err))
+		return
+	}
+	p.api.ShowMessage(fmt.Sprintf("Plugin %s crashed and was restarted", p.manifest.Name))
+}
+
+func (p *Plugin) post(fn func()) {
+	if p.options.Post != nil {
+		p.options.Post(fn)
+	}
+}
+
+// call sends a request to the running process.
+func (p *Plugin) call(method string, params, result any) error {
+	if p.conn == nil {
+		return fmt.Errorf("plugin %s is not running", p.manifest.Name)
+	}
+	return p.conn.Call(method, params, result)
+}
+
+// handle answers the requests the plugin sends to the editor.
+func (p *Plugin) handle(method string, raw json.RawMessage) (any, error) {
+	switch method {
+	case MethodRegisterCommand:
+		var params CommandParams
+		if err := decode(raw, &params); err != nil {
+			return nil, err
+		}
+		name := params.Name
+		p.api.RegisterCommand(name, params.Description, func(args []string) error {
+			return p.call(MethodExecute, CommandParams{Name: name, Args: args}, nil)
+		})
+		return nil, nil
+
+	case MethodBindKey:
+		var params KeyParams
+		if err := decode(raw, &params); err != nil {
+			return nil, err
+		}
+		p.api.BindKey(params.Key, params.Command)
+		return nil, nil
+
+	case MethodAddHook:
+		var params HookParams
+		if err := decode(raw, &params); err != nil {
+			return nil, err
+		}
+		p.api.AddHook(params.Event, p.runHook)
+		return nil, nil
+
+	case MethodExecuteCommand:
+		var params CommandParams
+		if err := decode(raw, &params); err != nil {
+			return nil, err
+		}
+		return nil, p.api.ExecuteCommand(params.Name, params.Args)
+
+	case MethodShowMessage:
+		var params MessageParams
+		if err := decode(raw, &params); err != nil {
+			return nil, err
+		}
+		p.api.ShowMessage(params.Message)
+		return nil, nil
+
+	case MethodSetOption:
+		var params OptionParams
+		if err := decode(raw, &params); err != nil {
+			return nil, err
+		}
+		p.api.SetOption(params.Key, params.Value)
+		return nil, nil
+
+	case MethodFindFile:
+		var params FileParams
+		if err := decode(raw, &params); err != nil {
+			return nil, err
+		}
+		buf, err := p.api.FindFile(params.Filename)
+		if err != nil {
+			return nil, err
+		}
+		return bufferInfo(buf), nil
+
+	case MethodListBuffers:
+		buffers := p.api.ListBuffers()
+		infos := make([]*BufferInfo, len(buffers))
+		for i, buf := range buffers {
+			infos[i] = bufferInfo(buf)
+		}
+		return infos, nil
+	}
+
+	return p.handleBuffer(method, raw)
+}
+
+func (p *Plugin) handleBuffer(method string, raw json.RawMessage) (any, error) {
+	var params BufferParams
+	if err := decode(raw, &params); err != nil {
+		return nil, err
+	}
+	buf := p.findBuffer(params.Buffer)
+
+	switch method {
+	case MethodCurrentBuffer:
+		return bufferInfo(buf), nil
+	}
+
+	if buf == nil {
+		if params.Buffer == "" {
+			return nil, fmt.Errorf("no current buffer")
+		}
+		return nil, fmt.Errorf("no buffer named %s", params.Buffer)
+	}
+
+	switch method {
+	case MethodGetLines:
+		return buf.GetLines(), nil
+	case MethodSetLines:
+		buf.SetLines(params.Lines)
+		return nil, nil
+	case MethodInsertText:
+		buf.InsertText(params.Text)
+		return nil, nil
+	case MethodSetCursor:
+		buf.SetCursorPosition(params.X, params.Y)
+		return nil, nil
+	case MethodSave:
+		return nil, buf.Save()
+	}
+	return nil, &Error{Code: CodeMethodNotFound, Message: "method not found: " + method}
+}
+
+func (p *Plugin) findBuffer(name string) api.Buffer {
+	if name == "" {
+		return p.api.GetCurrentBuffer()
+	}
+	for _, buf := range p.api.ListBuffers() {
+		if buf.GetName() == name {
+			return buf
+		}
+	}
+	return nil
+}
+
+func (p *Plugin) runHook(ctx *api.HookContext) {
+	params := HookParams{
+		Event:   ctx.Event,
+		Buffer:  bufferInfo(ctx.Buffer),
+		Command: ctx.Command,
+		Args:    ctx.Args,
+		Mode:    ctx.Mode,
+	}
+	var result HookResult
+	if err := p.call(MethodRunHook, params, &result); err != nil {
+		p.api.ShowMessage(fmt.Sprintf("Plugin %s %s hook failed: %v", p.manifest.Name, ctx.Event, err))
+		return
+	}
+	if result.Cancel {
+		ctx.Cancel(result.Reason)
+	}
+}
+
+func decode(raw json.RawMessage, v any) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return fmt.Errorf("invalid params: %v", err)
+	}
+	return nil
+}
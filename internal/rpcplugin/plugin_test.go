@@ -0,0 +1,180 @@
+package rpcplugin
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TakahashiShuuhei/edito/internal/api"
+)
+
+// TestHelperPlugin is not a real test. It is the plugin process started by
+// the other tests, talking to them over stdio.
+func TestHelperPlugin(t *testing.T) {
+	if os.Getenv("EDITO_HELPER_PLUGIN") != "1" {
+		return
+	}
+
+	wake := make(chan struct{}, 1)
+	var conn *Conn
+	conn = NewConn(os.Stdin, os.Stdout, func(method string, raw json.RawMessage) (any, error) {
+		switch method {
+		case MethodInitialize:
+			conn.Call(MethodRegisterCommand, CommandParams{Name: "hello", Description: "Say hello"}, nil)
+			conn.Call(MethodRegisterCommand, CommandParams{Name: "crash"}, nil)
+			conn.Call(MethodAddHook, HookParams{Event: "before-save"}, nil)
+		case MethodExecute:
+			var params CommandParams
+			json.Unmarshal(raw, &params)
+			if params.Name == "crash" {
+				os.Exit(3)
+			}
+			return nil, conn.Call(MethodInsertText, BufferParams{Text: "hello " + strings.Join(params.Args, " ")}, nil)
+		case MethodRunHook:
+			return HookResult{Cancel: true, Reason: "not yet"}, nil
+		}
+		return nil, nil
+	}, func() {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	})
+
+	for {
+		select {
+		case <-wake:
+			conn.Serve()
+		case <-conn.Done():
+			os.Exit(0)
+		}
+	}
+}
+
+type fakeBuffer struct {
+	api.Buffer
+	text string
+}
+
+func (b *fakeBuffer) InsertText(text string) { b.text += text }
+
+type fakeEditor struct {
+	commands map[string]func(args []string) error
+	hooks    map[string]func(ctx *api.HookContext)
+	buffer   *fakeBuffer
+	messages []string
+	resets   int
+	posted   chan func()
+}
+
+func newFakeEditor() *fakeEditor {
+	return &fakeEditor{
+		commands: make(map[string]func(args []string) error),
+		hooks:    make(map[string]func(ctx *api.HookContext)),
+		buffer:   &fakeBuffer{},
+		posted:   make(chan func(), 16),
+	}
+}
+
+func (f *fakeEditor) api() *api.EditorAPI {
+	return api.New(api.Backend{
+		RegisterCommand: func(name, description string, handler func(args []string) error) {
+			f.commands[name] = handler
+		},
+		AddHook: func(event string, handler func(ctx *api.HookContext)) {
+			f.hooks[event] = handler
+		},
+		GetCurrentBuffer: func() api.Buffer { return f.buffer },
+		ShowMessage:      func(message string) { f.messages = append(f.messages, message) },
+	})
+}
+
+// runPosted runs posted functions until done reports true.
+func (f *fakeEditor) runPosted(t *testing.T, done func() bool) {
+	deadline := time.After(5 * time.Second)
+	for !done() {
+		select {
+		case fn := <-f.posted:
+			fn()
+		case <-deadline:
+			t.Fatal("timed out waiting for the plugin")
+		}
+	}
+}
+
+func startHelper(t *testing.T, f *fakeEditor) *Plugin {
+	dir := t.TempDir()
+	manifest := Manifest{
+		Manifest: api.Manifest{Name: "helper", Version: "1.0.0"},
+		Command:  []string{os.Args[0], "-test.run=^TestHelperPlugin$"},
+	}
+	data, _ := json.Marshal(manifest)
+	if err := os.WriteFile(filepath.Join(dir, ManifestFile), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("EDITO_HELPER_PLUGIN", "1")
+
+	p, err := New(dir, Options{
+		Post:  func(fn func()) { f.posted <- fn },
+		Reset: func(name string) { f.resets++ },
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if err := p.Init(f.api()); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	t.Cleanup(func() { p.Cleanup() })
+	return p
+}
+
+func TestProcessPluginCommandsAndHooks(t *testing.T) {
+	f := newFakeEditor()
+	startHelper(t, f)
+
+	hello := f.commands["hello"]
+	if hello == nil {
+		t.Fatal("hello command was not registered")
+	}
+	if err := hello([]string{"world"}); err != nil {
+		t.Fatalf("hello failed: %v", err)
+	}
+	if f.buffer.text != "hello world" {
+		t.Errorf("buffer text = %q, want %q", f.buffer.text, "hello world")
+	}
+
+	ctx := &api.HookContext{Event: "before-save"}
+	f.hooks["before-save"](ctx)
+	if cancelled, reason := ctx.Cancelled(); !cancelled || reason != "not yet" {
+		t.Errorf("Cancelled() = %v, %q", cancelled, reason)
+	}
+}
+
+func TestProcessPluginRestartsAfterCrash(t *testing.T) {
+	f := newFakeEditor()
+	startHelper(t, f)
+
+	if err := f.commands["crash"](nil); err == nil {
+		t.Error("crashing command reported success")
+	}
+	f.commands = make(map[string]func(args []string) error)
+
+	f.runPosted(t, func() bool { return f.commands["hello"] != nil })
+	if f.resets != 1 {
+		t.Errorf("Reset called %d times, want 1", f.resets)
+	}
+	if err := f.commands["hello"](nil); err != nil {
+		t.Errorf("hello after restart failed: %v", err)
+	}
+}
+
+func TestLoadManifestRequiresCommand(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, ManifestFile), []byte(`{"name": "x"}`), 0644)
+	if _, err := LoadManifest(dir); err == nil {
+		t.Error("manifest without command was accepted")
+	}
+}
@@ -0,0 +1,107 @@
+package rpcplugin
+
+import "github.com/TakahashiShuuhei/edito/internal/api"
+
+// Methods the editor calls on the plugin.
+const (
+	MethodInitialize = "initialize"
+	MethodShutdown   = "shutdown"
+	MethodExecute    = "command/execute"
+	MethodRunHook    = "hook/run"
+)
+
+// Methods the plugin calls on the editor.
+const (
+	MethodRegisterCommand = "editor/registerCommand"
+	MethodBindKey         = "editor/bindKey"
+	MethodAddHook         = "editor/addHook"
+	MethodExecuteCommand  = "editor/executeCommand"
+	MethodShowMessage     = "editor/showMessage"
+	MethodSetOption       = "editor/setOption"
+	MethodFindFile        = "editor/findFile"
+	MethodListBuffers     = "editor/listBuffers"
+	MethodCurrentBuffer   = "buffer/current"
+	MethodGetLines        = "buffer/getLines"
+	MethodSetLines        = "buffer/setLines"
+	MethodInsertText      = "buffer/insertText"
+	MethodSetCursor       = "buffer/setCursor"
+	MethodSave            = "buffer/save"
+)
+
+type InitializeParams struct {
+	Name       string `json:"name"`
+	APIVersion int    `json:"apiVersion"`
+}
+
+type CommandParams struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Args        []string `json:"args,omitempty"`
+}
+
+type KeyParams struct {
+	Key     string `json:"key"`
+	Command string `json:"command"`
+}
+
+type HookParams struct {
+	Event   string      `json:"event"`
+	Buffer  *BufferInfo `json:"buffer,omitempty"`
+	Command string      `json:"command,omitempty"`
+	Args    []string    `json:"args,omitempty"`
+	Mode    string      `json:"mode,omitempty"`
+}
+
+// HookResult is returned by hook/run. Setting Cancel on a before-* event
+// cancels the operation.
+type HookResult struct {
+	Cancel bool   `json:"cancel,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+type MessageParams struct {
+	Message string `json:"message"`
+}
+
+type OptionParams struct {
+	Key   string `json:"key"`
+	Value any    `json:"value"`
+}
+
+type FileParams struct {
+	Filename string `json:"filename"`
+}
+
+// BufferParams selects a buffer by name. An empty name means the current
+// buffer.
+type BufferParams struct {
+	Buffer string   `json:"buffer,omitempty"`
+	Lines  []string `json:"lines,omitempty"`
+	Text   string   `json:"text,omitempty"`
+	X      int      `json:"x,omitempty"`
+	Y      int      `json:"y,omitempty"`
+}
+
+type BufferInfo struct {
+	Name     string `json:"name"`
+	Filename string `json:"filename"`
+	Modified bool   `json:"modified"`
+	CursorX  int    `json:"cursorX"`
+	CursorY  int    `json:"cursorY"`
+	Lines    int    `json:"lines"`
+}
+
+func bufferInfo(buf api.Buffer) *BufferInfo {
+	if buf == nil {
+		return nil
+	}
+	x, y := buf.GetCursorPosition()
+	return &BufferInfo{
+		Name:     buf.GetName(),
+		Filename: buf.GetFilename(),
+		Modified: buf.IsModified(),
+		CursorX:  x,
+		CursorY:  y,
+		Lines:    len(buf.GetLines()),
+	}
+}
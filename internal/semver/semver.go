@@ -0,0 +1,280 @@
+// Package semver parses semantic versions and the version constraints
+// used to request plugins: exact versions, ^ and ~ ranges, comparison
+// ranges such as ">=1.2.0 <2.0.0", and alternatives joined with ||.
+package semver
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// maxNumberLength is the most digits a major, minor or patch number may
+// have. git abbreviates commits to at least 7 characters, so an all-digit
+// commit id is not mistaken for a version.
+const maxNumberLength = 6
+
+// Version is a semantic version. Build metadata is ignored.
+type Version struct {
+	Major, Minor, Patch int
+	Pre                 string
+}
+
+// Parse parses a version such as "v1.2.3" or "1.2.3-rc.1". The leading v
+// is optional and missing minor or patch numbers are taken as 0.
+func Parse(s string) (Version, error) {
+	v, _, err := parse(s)
+	return v, err
+}
+
+// parse also reports how many of major, minor and patch were given, which
+// ~ and ^ use to decide what may change.
+func parse(s string) (Version, int, error) {
+	orig := s
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if i := strings.IndexByte(s, '+'); i >= 0 {
+		s = s[:i]
+	}
+
+	var v Version
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		v.Pre = s[i+1:]
+		s = s[:i]
+		if v.Pre == "" {
+			return Version{}, 0, fmt.Errorf("invalid version %q", orig)
+		}
+	}
+
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 || s == "" {
+		return Version{}, 0, fmt.Errorf("invalid version %q", orig)
+	}
+	nums := []*int{&v.Major, &v.Minor, &v.Patch}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 || len(part) > maxNumberLength || len(part) > 1 && part[0] == '0' {
+			return Version{}, 0, fmt.Errorf("invalid version %q", orig)
+		}
+		*nums[i] = n
+	}
+	return v, len(parts), nil
+}
+
+func (v Version) String() string {
+	s := fmt.Sprintf("v%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Pre != "" {
+		s += "-" + v.Pre
+	}
+	return s
+}
+
+// Compare returns -1, 0 or 1 as v is lower than, equal to or higher than w.
+// A pre-release is lower than the release it precedes.
+func (v Version) Compare(w Version) int {
+	for _, d := range []int{v.Major - w.Major, v.Minor - w.Minor, v.Patch - w.Patch} {
+		if d != 0 {
+			return sign(d)
+		}
+	}
+	switch {
+	case v.Pre == w.Pre:
+		return 0
+	case v.Pre == "":
+		return 1
+	case w.Pre == "":
+		return -1
+	}
+	return comparePre(v.Pre, w.Pre)
+}
+
+func comparePre(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aErr := strconv.Atoi(as[i])
+		bn, bErr := strconv.Atoi(bs[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			if an != bn {
+				return sign(an - bn)
+			}
+		case aErr == nil:
+			return -1
+		case bErr == nil:
+			return 1
+		case as[i] != bs[i]:
+			return strings.Compare(as[i], bs[i])
+		}
+	}
+	return sign(len(as) - len(bs))
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
+
+// Constraint is a set of acceptable versions.
+type Constraint struct {
+	text string
+	any  [][]comparison // alternatives of conjunctions
+}
+
+type comparison struct {
+	op      string
+	version Version
+}
+
+// ParseConstraint parses a constraint. "", "*" and "latest" accept any
+// release. A bare version accepts only that version.
+func ParseConstraint(s string) (Constraint, error) {
+	c := Constraint{text: strings.TrimSpace(s)}
+	if c.text == "" || c.text == "*" || c.text == "latest" {
+		c.any = [][]comparison{{}}
+		return c, nil
+	}
+
+	for _, alt := range strings.Split(c.text, "||") {
+		var all []comparison
+		fields := strings.Fields(alt)
+		for i := 0; i < len(fields); i++ {
+			// An operator may be separated from its version: ">= 1.2.0".
+			field := fields[i]
+			if slices.Contains(operators, field) && i+1 < len(fields) {
+				i++
+				field += fields[i]
+			}
+			cmps, err := parseComparison(field)
+			if err != nil {
+				return Constraint{}, fmt.Errorf("invalid constraint %q: %v", s, err)
+			}
+			all = append(all, cmps...)
+		}
+		if len(all) == 0 {
+			return Constraint{}, fmt.Errorf("invalid constraint %q", s)
+		}
+		c.any = append(c.any, all)
+	}
+	return c, nil
+}
+
+// operators are the prefixes of a comparison, longest first.
+var operators = []string{">=", "<=", ">", "<", "=", "^", "~"}
+
+func parseComparison(s string) ([]comparison, error) {
+	for _, op := range operators {
+		if !strings.HasPrefix(s, op) {
+			continue
+		}
+		v, n, err := parse(s[len(op):])
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case "^":
+			return []comparison{{">=", v}, {"<", caretLimit(v, n)}}, nil
+		case "~":
+			return []comparison{{">=", v}, {"<", tildeLimit(v, n)}}, nil
+		}
+		return []comparison{{op, v}}, nil
+	}
+	v, _, err := parse(s)
+	if err != nil {
+		return nil, err
+	}
+	return []comparison{{"=", v}}, nil
+}
+
+// caretLimit is the first version ^v excludes: the next version that
+// changes the leftmost non-zero number.
+func caretLimit(v Version, given int) Version {
+	switch {
+	case v.Major > 0 || given == 1:
+		return Version{Major: v.Major + 1, Pre: "0"}
+	case v.Minor > 0 || given == 2:
+		return Version{Minor: v.Minor + 1, Pre: "0"}
+	}
+	return Version{Patch: v.Patch + 1, Pre: "0"}
+}
+
+// tildeLimit is the first version ~v excludes: ~1.2.3 allows patch
+// updates and ~1 minor ones.
+func tildeLimit(v Version, given int) Version {
+	if given == 1 {
+		return Version{Major: v.Major + 1, Pre: "0"}
+	}
+	return Version{Major: v.Major, Minor: v.Minor + 1, Pre: "0"}
+}
+
+// Allows reports whether v satisfies the constraint. Pre-releases are
+// only accepted by comparisons that name a pre-release of the same
+// major.minor.patch.
+func (c Constraint) Allows(v Version) bool {
+	for _, all := range c.any {
+		if allowsAll(all, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func allowsAll(all []comparison, v Version) bool {
+	preAllowed := v.Pre == ""
+	for _, cmp := range all {
+		d := v.Compare(cmp.version)
+		ok := false
+		switch cmp.op {
+		case "=":
+			ok = d == 0
+		case ">":
+			ok = d > 0
+		case ">=":
+			ok = d >= 0
+		case "<":
+			ok = d < 0
+		case "<=":
+			ok = d <= 0
+		}
+		if !ok {
+			return false
+		}
+		w := cmp.version
+		if w.Pre != "" && w.Pre != "0" && w.Major == v.Major && w.Minor == v.Minor && w.Patch == v.Patch {
+			preAllowed = true
+		}
+	}
+	return preAllowed
+}
+
+// Best returns the highest of versions that the constraint allows.
+// Entries that are not versions are skipped.
+func (c Constraint) Best(versions []string) (string, bool) {
+	var best string
+	var bestVersion Version
+	for _, s := range versions {
+		v, err := Parse(s)
+		if err != nil || !c.Allows(v) {
+			continue
+		}
+		if best == "" || v.Compare(bestVersion) > 0 {
+			best, bestVersion = s, v
+		}
+	}
+	return best, best != ""
+}
+
+func (c Constraint) String() string {
+	return c.text
+}
+
+// IsConstraint reports whether s is a version or a constraint, as opposed
+// to a branch name or commit that is passed to the go tool as is.
+func IsConstraint(s string) bool {
+	_, err := ParseConstraint(s)
+	return err == nil
+}
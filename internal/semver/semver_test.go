@@ -0,0 +1,86 @@
+package semver
+
+import "testing"
+
+func TestCompare(t *testing.T) {
+	ordered := []string{"v0.9.0", "1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-beta", "1.0.0-beta.2", "1.0.0-beta.11", "1.0.0-rc.1", "1.0.0", "v1.0.1", "1.2", "1.10.0", "2"}
+	for i := 1; i < len(ordered); i++ {
+		a, err := Parse(ordered[i-1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := Parse(ordered[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a.Compare(b) != -1 || b.Compare(a) != 1 {
+			t.Errorf("%s should be lower than %s", ordered[i-1], ordered[i])
+		}
+	}
+	for _, bad := range []string{"", "v", "1.x", "1.2.3.4", "1.0.0-", "01.2.3", "1.02", "1234567", "v1.0.1234567"} {
+		if _, err := Parse(bad); err == nil {
+			t.Errorf("Parse(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestConstraints(t *testing.T) {
+	tests := []struct {
+		constraint string
+		allowed    []string
+		rejected   []string
+	}{
+		{"^1.2.3", []string{"1.2.3", "1.9.0"}, []string{"1.2.2", "2.0.0", "2.0.0-rc.1", "1.3.0-beta"}},
+		{"^0.2.3", []string{"0.2.3", "0.2.9"}, []string{"0.3.0", "0.2.2"}},
+		{"^0.0.3", []string{"0.0.3"}, []string{"0.0.4"}},
+		{"^0", []string{"0.0.1", "0.9.0"}, []string{"1.0.0"}},
+		{"~1.2.3", []string{"1.2.3", "1.2.9"}, []string{"1.3.0"}},
+		{"~1.2", []string{"1.2.0", "1.2.9"}, []string{"1.3.0"}},
+		{"~1", []string{"1.0.0", "1.9.0"}, []string{"2.0.0"}},
+		{">=1.2.0 <2.0.0", []string{"1.2.0", "1.99.0"}, []string{"1.1.9", "2.0.0"}},
+		{">= 1.2.0 < 2.0.0", []string{"1.2.0", "1.99.0"}, []string{"1.1.9", "2.0.0"}},
+		{"^ 1.2", []string{"1.2.0", "1.9.0"}, []string{"2.0.0"}},
+		{"^1.0.0 || ^3.0.0", []string{"1.1.0", "3.2.0"}, []string{"2.0.0"}},
+		{"v0.2.0", []string{"0.2.0"}, []string{"0.2.1"}},
+		{">=1.0.0-rc.1", []string{"1.0.0-rc.2", "1.0.0", "1.1.0"}, []string{"1.1.0-beta"}},
+		{"latest", []string{"0.0.1", "5.0.0"}, []string{"5.0.0-beta"}},
+	}
+	for _, tt := range tests {
+		c, err := ParseConstraint(tt.constraint)
+		if err != nil {
+			t.Fatalf("ParseConstraint(%q): %v", tt.constraint, err)
+		}
+		for _, s := range tt.allowed {
+			if v, _ := Parse(s); !c.Allows(v) {
+				t.Errorf("%q should allow %s", tt.constraint, s)
+			}
+		}
+		for _, s := range tt.rejected {
+			if v, _ := Parse(s); c.Allows(v) {
+				t.Errorf("%q should reject %s", tt.constraint, s)
+			}
+		}
+	}
+
+	c, _ := ParseConstraint("^0.2.0")
+	if best, ok := c.Best([]string{"v0.1.0", "v0.2.0", "v0.2.4", "v0.3.0", "v0.2.5-rc.1", "main"}); !ok || best != "v0.2.4" {
+		t.Errorf("Best = %q, %v, want v0.2.4", best, ok)
+	}
+	for s, want := range map[string]bool{
+		"main":       false,
+		">=1.0.0 <2": true,
+		">= 1.0.0":   true,
+		"1.2.3":      true,
+		"1234567":    false,
+		"0123456":    false,
+		"01":         false,
+		">=":         false,
+		"20240101":   false,
+		"v2":         true,
+		"a1b2c3d":    false,
+	} {
+		if got := IsConstraint(s); got != want {
+			t.Errorf("IsConstraint(%q) = %v, want %v", s, got, want)
+		}
+	}
+}
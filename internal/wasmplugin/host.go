@@ -0,0 +1,148 @@
+package wasmplugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	wapi "github.com/tetratelabs/wazero/api"
+
+	"github.com/TakahashiShuuhei/edito/internal/api"
+)
+
+// HostModule is the import module name of the editor functions.
+const HostModule = "edito"
+
+// instantiateHost defines the "edito" host module. Strings are passed as
+// (pointer, length) pairs in guest memory. Strings returned to the guest
+// are copied into memory from edito_alloc and packed into an i64 as
+// pointer<<32 | length.
+func (p *Plugin) instantiateHost(ctx context.Context) error {
+	b := p.runtime.NewHostModuleBuilder(HostModule)
+
+	b.NewFunctionBuilder().WithFunc(func(ctx context.Context, m wapi.Module, namePtr, nameLen, descPtr, descLen uint32) {
+		p.require(CapCommands)
+		name := p.readString(m, namePtr, nameLen)
+		p.api.RegisterCommand(name, p.readString(m, descPtr, descLen), func(args []string) error {
+			return p.runCommand(name, args)
+		})
+	}).Export("register_command")
+
+	b.NewFunctionBuilder().WithFunc(func(ctx context.Context, m wapi.Module, keyPtr, keyLen, cmdPtr, cmdLen uint32) {
+		p.require(CapKeys)
+		p.api.BindKey(p.readString(m, keyPtr, keyLen), p.readString(m, cmdPtr, cmdLen))
+	}).Export("bind_key")
+
+	b.NewFunctionBuilder().WithFunc(func(ctx context.Context, m wapi.Module, eventPtr, eventLen uint32) {
+		p.require(CapHooks)
+		p.api.AddHook(p.readString(m, eventPtr, eventLen), p.runHook)
+	}).Export("add_hook")
+
+	b.NewFunctionBuilder().WithFunc(func(ctx context.Context, m wapi.Module, namePtr, nameLen, argsPtr, argsLen uint32) int32 {
+		p.require(CapCommands)
+		var args []string
+		if argsLen > 0 {
+			if err := json.Unmarshal([]byte(p.readString(m, argsPtr, argsLen)), &args); err != nil {
+				panic(fmt.Errorf("execute_command: invalid args: %v", err))
+			}
+		}
+		if err := p.api.ExecuteCommand(p.readString(m, namePtr, nameLen), args); err != nil {
+			p.api.ShowMessage(err.Error())
+			return -1
+		}
+		return 0
+	}).Export("execute_command")
+
+	b.NewFunctionBuilder().WithFunc(func(ctx context.Context, m wapi.Module, ptr, size uint32) {
+		p.require(CapMessages)
+		p.api.ShowMessage(p.readString(m, ptr, size))
+	}).Export("show_message")
+
+	b.NewFunctionBuilder().WithFunc(func(ctx context.Context, m wapi.Module, ptr, size uint32) {
+		p.api.ShowMessage(fmt.Sprintf("[%s] %s", p.manifest.Name, p.readString(m, ptr, size)))
+	}).Export("log")
+
+	b.NewFunctionBuilder().WithFunc(func(ctx context.Context, m wapi.Module) uint64 {
+		p.require(CapBufferRead)
+		return p.returnString(ctx, m, strings.Join(p.buffer().GetLines(), "\n"))
+	}).Export("buffer_get_text")
+
+	b.NewFunctionBuilder().WithFunc(func(ctx context.Context, m wapi.Module) uint64 {
+		p.require(CapBufferRead)
+		return p.returnString(ctx, m, p.buffer().GetFilename())
+	}).Export("buffer_get_filename")
+
+	b.NewFunctionBuilder().WithFunc(func(ctx context.Context, m wapi.Module) uint64 {
+		p.require(CapBufferRead)
+		x, y := p.buffer().GetCursorPosition()
+		return uint64(uint32(y))<<32 | uint64(uint32(x))
+	}).Export("buffer_get_cursor")
+
+	b.NewFunctionBuilder().WithFunc(func(ctx context.Context, m wapi.Module, ptr, size uint32) {
+		p.require(CapBufferWrite)
+		p.buffer().SetLines(strings.Split(p.readString(m, ptr, size), "\n"))
+	}).Export("buffer_set_text")
+
+	b.NewFunctionBuilder().WithFunc(func(ctx context.Context, m wapi.Module, ptr, size uint32) {
+		p.require(CapBufferWrite)
+		p.buffer().InsertText(p.readString(m, ptr, size))
+	}).Export("buffer_insert_text")
+
+	b.NewFunctionBuilder().WithFunc(func(ctx context.Context, m wapi.Module, x, y uint32) {
+		p.require(CapBufferWrite)
+		p.buffer().SetCursorPosition(int(x), int(y))
+	}).Export("buffer_set_cursor")
+
+	if _, err := b.Instantiate(ctx); err != nil {
+		return fmt.Errorf("failed to define host module: %v", err)
+	}
+	return nil
+}
+
+// require traps the guest call if the manifest does not grant capability.
+func (p *Plugin) require(capability string) {
+	if !p.manifest.allows(capability) {
+		panic(fmt.Errorf("plugin %s lacks the %q capability", p.manifest.Name, capability))
+	}
+}
+
+func (p *Plugin) buffer() api.Buffer {
+	buf := p.api.GetCurrentBuffer()
+	if buf == nil {
+		panic(fmt.Errorf("no current buffer"))
+	}
+	return buf
+}
+
+func (p *Plugin) readString(m wapi.Module, ptr, size uint32) string {
+	if size == 0 {
+		return ""
+	}
+	data, ok := m.Memory().Read(ptr, size)
+	if !ok {
+		panic(fmt.Errorf("string at %d+%d is out of range", ptr, size))
+	}
+	return string(data)
+}
+
+func (p *Plugin) returnString(ctx context.Context, m wapi.Module, s string) uint64 {
+	ptr, size := p.writeString(ctx, m, s)
+	return uint64(ptr)<<32 | uint64(size)
+}
+
+// writeString copies s into guest memory allocated with edito_alloc.
+func (p *Plugin) writeString(ctx context.Context, m wapi.Module, s string) (uint32, uint32) {
+	if s == "" {
+		return 0, 0
+	}
+	results, err := m.ExportedFunction("edito_alloc").Call(ctx, uint64(len(s)))
+	if err != nil {
+		panic(fmt.Errorf("edito_alloc failed: %v", err))
+	}
+	ptr := uint32(results[0])
+	if !m.Memory().Write(ptr, []byte(s)) {
+		panic(fmt.Errorf("edito_alloc returned an out of range pointer"))
+	}
+	return ptr, uint32(len(s))
+}
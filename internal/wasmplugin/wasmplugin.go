@@ -0,0 +1,282 @@
+// Package wasmplugin runs plugins compiled to WebAssembly with wazero, a
+// pure-Go runtime. Unlike .so plugins they need neither CGO nor a
+// toolchain that matches the editor's.
+package wasmplugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	wapi "github.com/tetratelabs/wazero/api"
+
+	"github.com/TakahashiShuuhei/edito/internal/api"
+)
+
+// Capabilities a manifest can grant. A host function that needs a
+// capability the plugin was not granted traps.
+const (
+	CapCommands    = "commands"
+	CapKeys        = "keys"
+	CapHooks       = "hooks"
+	CapMessages    = "messages"
+	CapBufferRead  = "buffer-read"
+	CapBufferWrite = "buffer-write"
+)
+
+// Defaults for limits the manifest leaves unset.
+const (
+	DefaultMemoryLimitMB = 64
+	DefaultTimeout       = time.Second
+)
+
+const pageSize = 64 * 1024
+
+// Manifest is the sidecar file name.json next to name.wasm: the common
+// plugin manifest plus the limits of the sandbox.
+type Manifest struct {
+	api.Manifest
+	MemoryLimitMB int `json:"memoryLimitMB,omitempty"`
+	TimeoutMs     int `json:"timeoutMs,omitempty"`
+}
+
+// ManifestPath returns the sidecar manifest of the module at wasmPath.
+func ManifestPath(wasmPath string) string {
+	return strings.TrimSuffix(wasmPath, filepath.Ext(wasmPath)) + ".json"
+}
+
+// LoadManifest reads the sidecar manifest of the module at wasmPath.
+func LoadManifest(wasmPath string) (*Manifest, error) {
+	data, err := os.ReadFile(ManifestPath(wasmPath))
+	if err != nil {
+		return nil, fmt.Errorf("missing manifest: %v", err)
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %v", err)
+	}
+	if m.Name == "" {
+		return nil, fmt.Errorf("invalid manifest: name is required")
+	}
+	return &m, nil
+}
+
+func (m *Manifest) memoryLimitPages() uint32 {
+	mb := m.MemoryLimitMB
+	if mb <= 0 {
+		mb = DefaultMemoryLimitMB
+	}
+	return uint32(mb * 1024 * 1024 / pageSize)
+}
+
+func (m *Manifest) timeout() time.Duration {
+	if m.TimeoutMs <= 0 {
+		return DefaultTimeout
+	}
+	return time.Duration(m.TimeoutMs) * time.Millisecond
+}
+
+func (m *Manifest) allows(capability string) bool {
+	for _, c := range m.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// Plugin is a WebAssembly module loaded as an edito plugin. It implements
+// api.Plugin.
+type Plugin struct {
+	wasm     []byte
+	manifest *Manifest
+	api      *api.EditorAPI
+
+	runtime wazero.Runtime
+	module  wapi.Module
+	// stopped is set once a call exceeded the CPU time limit, which
+	// closes the runtime; every later call returns it.
+	stopped error
+}
+
+// Load reads the module at path and its manifest. The module is compiled
+// and started by Init.
+func Load(path string) (*Plugin, error) {
+	manifest, err := LoadManifest(path)
+	if err != nil {
+		return nil, err
+	}
+	wasm, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return New(wasm, manifest), nil
+}
+
+// New creates a plugin from module bytes and a manifest.
+func New(wasm []byte, manifest *Manifest) *Plugin {
+	return &Plugin{wasm: wasm, manifest: manifest}
+}
+
+func (p *Plugin) Name() string {
+	return p.manifest.Name
+}
+
+func (p *Plugin) Version() string {
+	return p.manifest.Version
+}
+
+func (p *Plugin) APIVersion() int {
+	return p.manifest.RequiredAPIVersion()
+}
+
+func (p *Plugin) Manifest() api.Manifest {
+	return p.manifest.Manifest
+}
+
+func (p *Plugin) Init(editor *api.EditorAPI) error {
+	p.api = editor
+	ctx := context.Background()
+
+	config := wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(p.manifest.memoryLimitPages()).
+		WithCloseOnContextDone(true)
+	p.runtime = wazero.NewRuntimeWithConfig(ctx, config)
+
+	if err := p.instantiateHost(ctx); err != nil {
+		p.runtime.Close(ctx)
+		return err
+	}
+
+	module, err := p.runtime.InstantiateWithConfig(ctx, p.wasm,
+		wazero.NewModuleConfig().WithName(p.manifest.Name).WithStartFunctions())
+	if err != nil {
+		p.runtime.Close(ctx)
+		return fmt.Errorf("failed to instantiate module: %v", err)
+	}
+	p.module = module
+
+	for _, name := range []string{"memory", "edito_alloc", "edito_init"} {
+		if module.ExportedMemory(name) == nil && module.ExportedFunction(name) == nil {
+			p.runtime.Close(ctx)
+			return fmt.Errorf("module does not export %s", name)
+		}
+	}
+
+	if _, err := p.call("edito_init"); err != nil {
+		p.runtime.Close(ctx)
+		return err
+	}
+	return nil
+}
+
+func (p *Plugin) Cleanup() error {
+	if p.runtime == nil {
+		return nil
+	}
+	var err error
+	if p.stopped == nil && p.module.ExportedFunction("edito_cleanup") != nil {
+		_, err = p.call("edito_cleanup")
+	}
+	p.runtime.Close(context.Background())
+	p.runtime = nil
+	return err
+}
+
+// call runs an exported function under the CPU time limit. A negative
+// i32 result is reported as an error.
+func (p *Plugin) call(name string, params ...uint64) (uint64, error) {
+	if p.stopped != nil {
+		return 0, p.stopped
+	}
+	fn := p.module.ExportedFunction(name)
+	if fn == nil {
+		return 0, fmt.Errorf("module does not export %s", name)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.manifest.timeout())
+	defer cancel()
+
+	results, err := fn.Call(ctx, params...)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			p.stopped = fmt.Errorf("%s exceeded the CPU time limit of %v: %w", name, p.manifest.timeout(), api.ErrPluginStopped)
+			return 0, p.stopped
+		}
+		return 0, fmt.Errorf("%s failed: %v", name, err)
+	}
+	if len(results) == 0 {
+		return 0, nil
+	}
+	if int32(results[0]) < 0 {
+		return results[0], fmt.Errorf("%s returned error code %d", name, int32(results[0]))
+	}
+	return results[0], nil
+}
+
+// stringArgs copies values into guest memory as (pointer, length) pairs
+// for an exported function.
+func (p *Plugin) stringArgs(values ...string) ([]uint64, error) {
+	params := make([]uint64, 0, len(values)*2)
+	for _, s := range values {
+		var ptr, size uint32
+		if s != "" {
+			results, err := p.call("edito_alloc", uint64(len(s)))
+			if err != nil {
+				return nil, err
+			}
+			ptr, size = uint32(results), uint32(len(s))
+			if !p.module.Memory().Write(ptr, []byte(s)) {
+				return nil, fmt.Errorf("edito_alloc returned an out of range pointer")
+			}
+		}
+		params = append(params, uint64(ptr), uint64(size))
+	}
+	return params, nil
+}
+
+func (p *Plugin) runCommand(name string, args []string) error {
+	argsJSON, _ := json.Marshal(args)
+	params, err := p.stringArgs(name, string(argsJSON))
+	if err != nil {
+		return err
+	}
+	_, err = p.call("edito_command", params...)
+	return err
+}
+
+func (p *Plugin) runHook(ctx *api.HookContext) {
+	info := map[string]any{
+		"event":   ctx.Event,
+		"command": ctx.Command,
+		"args":    ctx.Args,
+		"mode":    ctx.Mode,
+	}
+	if ctx.Buffer != nil {
+		info["buffer"] = ctx.Buffer.GetName()
+		info["filename"] = ctx.Buffer.GetFilename()
+	}
+	data, _ := json.Marshal(info)
+
+	params, err := p.stringArgs(ctx.Event, string(data))
+	if err == nil {
+		var result uint64
+		result, err = p.call("edito_hook", params...)
+		if err == nil && result == 1 {
+			ctx.Cancel(fmt.Sprintf("cancelled by %s", p.manifest.Name))
+		}
+	}
+	if errors.Is(err, api.ErrPluginStopped) {
+		panic(err)
+	}
+	if err != nil {
+		p.api.ShowMessage(fmt.Sprintf("Plugin %s %s hook failed: %v", p.manifest.Name, ctx.Event, err))
+	}
+}
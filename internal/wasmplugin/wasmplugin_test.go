@@ -0,0 +1,278 @@
+package wasmplugin
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/TakahashiShuuhei/edito/internal/api"
+)
+
+// The test module is assembled by hand so that the tests need no wasm
+// toolchain. It imports register_command, buffer_insert_text, show_message
+// and buffer_get_text, and registers five commands that it tells apart by
+// the length of their name:
+//
+//	hello        inserts "hello from wasm"
+//	spin         loops forever
+//	grow-memory  grows memory by 100 pages and returns the result
+//	msg          calls show_message
+//	duplicate    inserts the buffer text again
+const testData = "hello" + "spin" + "grow-memory" + "msg" + "duplicate" + "hello from wasm"
+
+func leb(v uint32) []byte {
+	var out []byte
+	for {
+		b := byte(v & 0x7f)
+		v >>= 7
+		if v != 0 {
+			out = append(out, b|0x80)
+			continue
+		}
+		return append(out, b)
+	}
+}
+
+func sleb(v int32) []byte {
+	var out []byte
+	for {
+		b := byte(v & 0x7f)
+		v >>= 7
+		if (v == 0 && b&0x40 == 0) || (v == -1 && b&0x40 != 0) {
+			return append(out, b)
+		}
+		out = append(out, b|0x80)
+	}
+}
+
+func vec(items ...[]byte) []byte {
+	out := leb(uint32(len(items)))
+	for _, item := range items {
+		out = append(out, item...)
+	}
+	return out
+}
+
+func str(s string) []byte {
+	return append(leb(uint32(len(s))), s...)
+}
+
+func section(id byte, content []byte) []byte {
+	return append(append([]byte{id}, leb(uint32(len(content)))...), content...)
+}
+
+func cat(parts ...[]byte) []byte {
+	var out []byte
+	for _, p := range parts {
+		out = append(out, p...)
+	}
+	return out
+}
+
+func i32Const(v int32) []byte {
+	return append([]byte{0x41}, sleb(v)...)
+}
+
+func funcType(params, results []byte) []byte {
+	return cat([]byte{0x60}, leb(uint32(len(params))), params, leb(uint32(len(results))), results)
+}
+
+func body(locals []byte, code ...[]byte) []byte {
+	b := cat(locals, cat(code...), []byte{0x0b})
+	return append(leb(uint32(len(b))), b...)
+}
+
+// ifLen runs code when the command name has length n.
+func ifLen(n int32, code ...[]byte) []byte {
+	return cat([]byte{0x20, 0x01}, i32Const(n), []byte{0x46, 0x04, 0x40}, cat(code...), []byte{0x0b})
+}
+
+func testModule() []byte {
+	const (
+		i32 = 0x7f
+		i64 = 0x7e
+	)
+	types := vec(
+		funcType([]byte{i32, i32, i32, i32}, nil),         // 0 register_command
+		funcType([]byte{i32, i32}, nil),                   // 1 insert_text, show_message
+		funcType(nil, []byte{i64}),                        // 2 get_text
+		funcType([]byte{i32}, []byte{i32}),                // 3 alloc
+		funcType(nil, []byte{i32}),                        // 4 init
+		funcType([]byte{i32, i32, i32, i32}, []byte{i32}), // 5 command
+	)
+	imports := vec(
+		cat(str(HostModule), str("register_command"), []byte{0x00, 0x00}),
+		cat(str(HostModule), str("buffer_insert_text"), []byte{0x00, 0x01}),
+		cat(str(HostModule), str("show_message"), []byte{0x00, 0x01}),
+		cat(str(HostModule), str("buffer_get_text"), []byte{0x00, 0x02}),
+	)
+	funcs := vec([]byte{0x03}, []byte{0x04}, []byte{0x05})
+	memory := vec([]byte{0x00, 0x01})
+	globals := vec(cat([]byte{i32, 0x01}, i32Const(1024), []byte{0x0b}))
+	exports := vec(
+		cat(str("memory"), []byte{0x02, 0x00}),
+		cat(str("edito_alloc"), []byte{0x00, 0x04}),
+		cat(str("edito_init"), []byte{0x00, 0x05}),
+		cat(str("edito_command"), []byte{0x00, 0x06}),
+	)
+
+	register := func(offset, length int32) []byte {
+		return cat(i32Const(offset), i32Const(length), i32Const(0), i32Const(0), []byte{0x10, 0x00})
+	}
+	ret0 := cat(i32Const(0), []byte{0x0f})
+
+	alloc := body(vec(),
+		[]byte{0x23, 0x00, 0x23, 0x00, 0x20, 0x00, 0x6a, 0x24, 0x00},
+	)
+	init := body(vec(),
+		register(0, 5), register(5, 4), register(9, 11), register(20, 3), register(23, 9),
+		i32Const(0),
+	)
+	command := body(vec(cat(leb(1), []byte{i64})),
+		ifLen(5, i32Const(32), i32Const(15), []byte{0x10, 0x01}, ret0),
+		ifLen(4, []byte{0x03, 0x40, 0x0c, 0x00, 0x0b}),
+		ifLen(11, i32Const(100), []byte{0x40, 0x00, 0x0f}),
+		ifLen(3, i32Const(20), i32Const(3), []byte{0x10, 0x02}, ret0),
+		ifLen(9,
+			[]byte{0x10, 0x03, 0x21, 0x04},
+			[]byte{0x20, 0x04, 0x42, 0x20, 0x88, 0xa7},
+			[]byte{0x20, 0x04, 0xa7},
+			[]byte{0x10, 0x01}, ret0),
+		i32Const(-2),
+	)
+	data := vec(cat([]byte{0x00}, i32Const(0), []byte{0x0b}, str(testData)))
+
+	return cat(
+		[]byte{0x00, 'a', 's', 'm', 0x01, 0x00, 0x00, 0x00},
+		section(1, types),
+		section(2, imports),
+		section(3, funcs),
+		section(5, memory),
+		section(6, globals),
+		section(7, exports),
+		section(10, vec(alloc, init, command)),
+		section(11, data),
+	)
+}
+
+type fakeBuffer struct {
+	api.Buffer
+	text string
+}
+
+func (b *fakeBuffer) GetLines() []string      { return strings.Split(b.text, "\n") }
+func (b *fakeBuffer) InsertText(text string)  { b.text += text }
+func (b *fakeBuffer) SetLines(lines []string) { b.text = strings.Join(lines, "\n") }
+
+type fakeEditor struct {
+	commands map[string]func(args []string) error
+	buffer   *fakeBuffer
+	messages []string
+}
+
+func startPlugin(t *testing.T, manifest *Manifest) *fakeEditor {
+	f := &fakeEditor{
+		commands: make(map[string]func(args []string) error),
+		buffer:   &fakeBuffer{},
+	}
+	editor := api.New(api.Backend{
+		RegisterCommand: func(name, description string, handler func(args []string) error) {
+			f.commands[name] = handler
+		},
+		GetCurrentBuffer: func() api.Buffer { return f.buffer },
+		ShowMessage:      func(message string) { f.messages = append(f.messages, message) },
+	})
+
+	p := New(testModule(), manifest)
+	if err := p.Init(editor); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	t.Cleanup(func() { p.Cleanup() })
+	return f
+}
+
+func testManifest() *Manifest {
+	return &Manifest{
+		Manifest: api.Manifest{
+			Name:         "wasm-test",
+			Version:      "1.0.0",
+			Capabilities: []string{CapCommands, CapBufferRead, CapBufferWrite},
+		},
+		MemoryLimitMB: 1,
+		TimeoutMs:     100,
+	}
+}
+
+func TestWasmPluginCommands(t *testing.T) {
+	f := startPlugin(t, testManifest())
+
+	if err := f.commands["hello"](nil); err != nil {
+		t.Fatalf("hello failed: %v", err)
+	}
+	if err := f.commands["duplicate"](nil); err != nil {
+		t.Fatalf("duplicate failed: %v", err)
+	}
+	want := "hello from wasmhello from wasm"
+	if f.buffer.text != want {
+		t.Errorf("buffer text = %q, want %q", f.buffer.text, want)
+	}
+}
+
+func TestWasmPluginCapabilities(t *testing.T) {
+	f := startPlugin(t, testManifest())
+
+	err := f.commands["msg"](nil)
+	if err == nil || !strings.Contains(err.Error(), CapMessages) {
+		t.Errorf("show_message without capability: err = %v", err)
+	}
+	if len(f.messages) != 0 {
+		t.Errorf("message shown without capability: %v", f.messages)
+	}
+
+	manifest := testManifest()
+	manifest.Capabilities = nil
+	p := New(testModule(), manifest)
+	if err := p.Init(api.New(api.Backend{})); err == nil {
+		p.Cleanup()
+		t.Error("plugin without the commands capability registered commands")
+	}
+}
+
+func TestWasmPluginLimits(t *testing.T) {
+	f := startPlugin(t, testManifest())
+
+	if err := f.commands["grow-memory"](nil); err == nil {
+		t.Error("memory grew beyond the limit")
+	}
+
+	err := f.commands["spin"](nil)
+	if err == nil || !strings.Contains(err.Error(), "CPU time limit") || !errors.Is(err, api.ErrPluginStopped) {
+		t.Errorf("spin: err = %v", err)
+	}
+
+	// The runtime is closed, so later calls report the stop as well.
+	if err := f.commands["hello"](nil); !errors.Is(err, api.ErrPluginStopped) {
+		t.Errorf("hello after the plugin stopped: err = %v", err)
+	}
+}
+
+func TestLoadRequiresManifest(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "x.wasm")
+	os.WriteFile(path, testModule(), 0644)
+
+	if _, err := Load(path); err == nil {
+		t.Error("module without manifest was loaded")
+	}
+
+	os.WriteFile(ManifestPath(path), []byte(`{"name": "x", "capabilities": ["commands"]}`), 0644)
+	p, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if p.Name() != "x" {
+		t.Errorf("Name() = %q", p.Name())
+	}
+}
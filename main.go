@@ -5,15 +5,22 @@ import (
 	"os"
 
 	"github.com/TakahashiShuuhei/edito/internal/editor"
+	"github.com/TakahashiShuuhei/edito/internal/pkgcli"
 )
 
 func main() {
 	if len(os.Args) < 2 {
 		fmt.Println("Usage: edito <filename>")
+		fmt.Println("       edito pkg <command>  (see edito pkg --help)")
 		fmt.Printf("Version: %s\n", GetVersion())
 		os.Exit(1)
 	}
 	
+	// Package management: edito pkg <command>
+	if os.Args[1] == "pkg" {
+		pkgcli.Main(os.Args[2:])
+	}
+	
 	// Handle version flag
 	if len(os.Args) == 2 && (os.Args[1] == "--version" || os.Args[1] == "-v") {
 		fmt.Printf("edito version %s\n", GetVersion())
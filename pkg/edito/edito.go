@@ -3,62 +3,157 @@
 package edito
 
 // Re-export the API for user convenience
-import "github.com/TakahashiShuuhei/edito/internal/api"
+import (
+	"time"
 
-// Global editor instance - this will be set by the main edito binary
-var editor = api.Editor
+	"github.com/TakahashiShuuhei/edito/internal/api"
+)
+
+// APIVersion is the plugin contract version implemented by this edito build
+const APIVersion = api.APIVersion
+
+// Plugin is the interface every plugin implements. A plugin package is
+// built with -buildmode=plugin and exports it as a variable:
+//
+//	var Plugin MyPlugin
+type Plugin = api.Plugin
+
+// API is handed to Plugin.Init and gives access to the editor
+type API = api.EditorAPI
+
+// Buffer represents a text buffer
+type Buffer = api.Buffer
+
+// HookContext is passed to handlers registered with AddHook
+type HookContext = api.HookContext
+
+// Versioned may be implemented by a plugin to declare the APIVersion it was built against
+type Versioned = api.Versioned
+
+// ExecOptions configures a program run with API.Exec
+type ExecOptions = api.ExecOptions
+
+// Option declares an option with API.DefineOption
+type Option = api.Option
+
+// OptionType is the type of an option's value
+type OptionType = api.OptionType
+
+// OptionChange is passed to functions registered with OnOptionChange
+type OptionChange = api.OptionChange
+
+// Option types
+const (
+	OptionBool   = api.OptionBool
+	OptionInt    = api.OptionInt
+	OptionFloat  = api.OptionFloat
+	OptionString = api.OptionString
+)
+
+// Manifest declares a plugin's name, version, required API version and
+// dependencies. A plugin package may export it next to Plugin:
+//
+//	var Manifest = edito.Manifest{Name: "go-mode", Version: "1.0.0", Dependencies: []string{"lsp"}}
+type Manifest = api.Manifest
+
+// editor returns the global editor instance set by the main edito binary
+func editor() *api.EditorAPI {
+	return api.Editor
+}
 
 // BindKey binds a key combination to a command
 // Usage: edito.BindKey("C-x C-s", "save-buffer")
 func BindKey(key, command string) {
-	if editor != nil {
-		editor.BindKey(key, command)
+	if e := editor(); e != nil {
+		e.BindKey(key, command)
 	}
 }
 
 // LoadPlugin loads a plugin by name
 // Usage: edito.LoadPlugin("syntax-highlighting")
 func LoadPlugin(name string) {
-	if editor != nil {
-		editor.LoadPlugin(name)
+	if e := editor(); e != nil {
+		e.LoadPlugin(name)
 	}
 }
 
 // SetOption sets an editor option
 // Usage: edito.SetOption("tab-width", 4)
 func SetOption(key string, value any) {
-	if editor != nil {
-		editor.SetOption(key, value)
+	if e := editor(); e != nil {
+		e.SetOption(key, value)
+	}
+}
+
+// SetLocalOption sets an option for the current buffer only
+// Usage: edito.SetLocalOption("indent-tabs-mode", true)
+func SetLocalOption(name string, value any) error {
+	if e := editor(); e != nil {
+		return e.SetLocalOption(name, value)
+	}
+	return nil
+}
+
+// GetOption returns the value of an option in the current buffer
+// Usage: width, _ := edito.GetOption("tab-width").(int)
+func GetOption(name string) any {
+	if e := editor(); e != nil {
+		return e.GetOption(name)
+	}
+	return nil
+}
+
+// OnOptionChange calls fn whenever the option changes
+// Usage: edito.OnOptionChange("tab-width", func(c edito.OptionChange) { ... })
+func OnOptionChange(name string, fn func(change OptionChange)) {
+	if e := editor(); e != nil {
+		e.OnOptionChange(name, fn)
 	}
 }
 
 // RegisterHook registers an event hook
 // Usage: edito.RegisterHook("file-opened", func() { ... })
 func RegisterHook(event string, handler func()) {
-	if editor != nil {
-		editor.RegisterHook(event, handler)
+	if e := editor(); e != nil {
+		e.RegisterHook(event, handler)
+	}
+}
+
+// AddHook registers an event hook that receives the event context
+// Usage: edito.AddHook("before-save", func(ctx *edito.HookContext) { ctx.Cancel("read only") })
+func AddHook(event string, handler func(ctx *HookContext)) {
+	if e := editor(); e != nil {
+		e.AddHook(event, handler)
+	}
+}
+
+// RegisterCommand adds a command that can be run with M-x
+// Usage: edito.RegisterCommand("hello", "Say hello", func(args []string) error { ... })
+func RegisterCommand(name, description string, handler func(args []string) error) {
+	if e := editor(); e != nil {
+		e.RegisterCommand(name, description, handler)
 	}
 }
 
 // GetCurrentBuffer returns the current active buffer
-func GetCurrentBuffer() api.Buffer {
-	if editor != nil {
-		return editor.GetCurrentBuffer()
+func GetCurrentBuffer() Buffer {
+	if e := editor(); e != nil {
+		return e.GetCurrentBuffer()
 	}
 	return nil
 }
 
 // ShowMessage displays a message to the user
 func ShowMessage(message string) {
-	if editor != nil {
-		editor.ShowMessage(message)
+	if e := editor(); e != nil {
+		e.ShowMessage(message)
 	}
 }
 
 // ExecuteCommand executes an editor command
 func ExecuteCommand(command string, args []string) error {
-	if editor != nil {
-		return editor.ExecuteCommand(command, args)
+	if e := editor(); e != nil {
+		return e.ExecuteCommand(command, args)
 	}
 	return nil
 }
@@ -66,7 +161,48 @@ func ExecuteCommand(command string, args []string) error {
 // InstallPlugin installs a plugin from a git repository
 // Usage: edito.InstallPlugin("file-tree", "github.com/TakahashiShuuhei/edito-file-tree", "v0.1.0")
 func InstallPlugin(name, repository, version string) {
-	if editor != nil {
-		editor.InstallPlugin(name, repository, version)
+	if e := editor(); e != nil {
+		e.InstallPlugin(name, repository, version)
+	}
+}
+
+// AddRegistry adds a package registry; higher priorities win
+// Usage: edito.AddRegistry("file:///srv/edito-mirror", 10)
+func AddRegistry(location string, priority int) {
+	if e := editor(); e != nil {
+		e.AddRegistry(location, priority)
 	}
-}
\ No newline at end of file
+}
+
+// RunAfter calls fn once after delay; the returned function cancels it
+// Usage: edito.RunAfter(2*time.Second, func() { edito.ShowMessage("done") })
+func RunAfter(delay time.Duration, fn func()) (cancel func()) {
+	if e := editor(); e != nil {
+		return e.RunAfter(delay, fn)
+	}
+	return func() {}
+}
+
+// RunEvery calls fn every interval until the returned function is called
+func RunEvery(interval time.Duration, fn func()) (cancel func()) {
+	if e := editor(); e != nil {
+		return e.RunEvery(interval, fn)
+	}
+	return func() {}
+}
+
+// RunWhenIdle calls fn each time the editor has been idle for delay
+func RunWhenIdle(delay time.Duration, fn func()) (cancel func()) {
+	if e := editor(); e != nil {
+		return e.RunWhenIdle(delay, fn)
+	}
+	return func() {}
+}
+
+// Post runs fn on the editor goroutine; safe to call from any goroutine
+// Usage: go func() { out := work(); edito.Post(func() { edito.ShowMessage(out) }) }()
+func Post(fn func()) {
+	if e := editor(); e != nil {
+		e.Post(fn)
+	}
+}